@@ -0,0 +1,111 @@
+// Command sample-plugin is an out-of-process collector plugin that reports
+// synthetic deployments, as a template for real ones and for trying the
+// plugin protocol locally:
+//
+//	go build -o bin/sample-plugin ./cmd/sample-plugin
+//	go run ./cmd/plugin-harness -config '{"service": "api"}' bin/sample-plugin
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/external"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+const schema = `{
+  "type": "object",
+  "required": ["service"],
+  "additionalProperties": false,
+  "properties": {
+    "service": {"type": "string", "description": "Service the deployments belong to"},
+    "environment": {"type": "string", "default": "production"},
+    "per_cycle": {"type": "integer", "minimum": 1, "maximum": 100, "default": 1, "description": "Deployments reported per cycle"},
+    "delay_ms": {"type": "integer", "minimum": 0, "description": "Simulated upstream latency per cycle"}
+  }
+}`
+
+type config struct {
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+	PerCycle    int    `json:"per_cycle"`
+	DelayMs     int    `json:"delay_ms"`
+}
+
+// epoch is the start time of the first synthetic deployment; each cursor
+// step is one hour later, so repeated cycles report the same records.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type sample struct {
+	cfg config
+}
+
+func (s *sample) Name() string                  { return "sample" }
+func (s *sample) Description() string           { return "Synthetic deployments for trying out plugins" }
+func (s *sample) Version() string               { return "1.0.0" }
+func (s *sample) ConfigSchema() json.RawMessage { return json.RawMessage(schema) }
+
+func (s *sample) Validate(raw json.RawMessage) error {
+	cfg := config{PerCycle: 1}
+	if err := plugins.DecodeConfig(raw, &cfg); err != nil {
+		return err
+	}
+	switch {
+	case cfg.Service == "":
+		return fmt.Errorf("%w: service is required", plugins.ErrInvalidConfig)
+	case cfg.PerCycle < 1 || cfg.PerCycle > 100:
+		return fmt.Errorf("%w: per_cycle must be between 1 and 100", plugins.ErrInvalidConfig)
+	case cfg.DelayMs < 0:
+		return fmt.Errorf("%w: delay_ms must not be negative", plugins.ErrInvalidConfig)
+	}
+	return nil
+}
+
+func (s *sample) Initialize(_ context.Context, raw json.RawMessage) error {
+	if err := s.Validate(raw); err != nil {
+		return err
+	}
+	s.cfg = config{Environment: "production", PerCycle: 1}
+	if err := plugins.DecodeConfig(raw, &s.cfg); err != nil {
+		return err
+	}
+	// Diagnostics go to stderr, which the server logs
+	fmt.Fprintf(os.Stderr, "sample: collecting %d deployment(s) per cycle for %s\n", s.cfg.PerCycle, s.cfg.Service)
+	return nil
+}
+
+func (s *sample) HealthCheck(context.Context) error { return nil }
+
+func (s *sample) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	select {
+	case <-time.After(time.Duration(s.cfg.DelayMs) * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	n, _ := strconv.Atoi(string(since))
+	batch := &plugins.Batch{Cursor: plugins.Cursor(strconv.Itoa(n + s.cfg.PerCycle))}
+	for i := n; i < n+s.cfg.PerCycle; i++ {
+		start := epoch.Add(time.Duration(i) * time.Hour)
+		end := start.Add(5 * time.Minute)
+		batch.Deployments = append(batch.Deployments, metrics.Deployment{
+			ID: fmt.Sprintf("sample-%s-%d", s.cfg.Service, i), Service: s.cfg.Service, Environment: s.cfg.Environment,
+			Status: metrics.DeploymentStatusSuccess, StartTime: start, EndTime: &end,
+		})
+	}
+	return batch, nil
+}
+
+func (s *sample) Shutdown(context.Context) error { return nil }
+
+func main() {
+	if err := external.Serve(&sample{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -6,13 +6,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirhCC/MetricHub/internal/api"
+	"github.com/sirhCC/MetricHub/internal/collector"
 	"github.com/sirhCC/MetricHub/internal/config"
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/external"
+	ghcollector "github.com/sirhCC/MetricHub/internal/plugins/github"
+	"github.com/sirhCC/MetricHub/internal/plugins/gitrepo"
+	"github.com/sirhCC/MetricHub/internal/plugins/jira"
+	"github.com/sirhCC/MetricHub/internal/plugins/kube"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
 	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -56,7 +66,7 @@ func main() {
 			// Run migrations if enabled
 			if cfg.AutoMigrate {
 				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				if err := storage.ApplyMigrations(ctx, db.GetDB(), "./migrations", func(msg string, kv ...interface{}) { logger.Info(msg, kvToZap(kv...)...) }); err != nil {
+				if err := storage.ApplyMigrations(ctx, db.GetDB(), cfg.MigrationsDir, func(msg string, kv ...interface{}) { logger.Info(msg, kvToZap(kv...)...) }); err != nil {
 					logger.Error("migration failed", zap.Error(err))
 				} else {
 					logger.Info("database migrations applied")
@@ -86,9 +96,125 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Initialize API router with configured request timeout
-	requestTimeout := time.Duration(cfg.RequestTimeoutSeconds) * time.Second
-	router := api.NewRouter(logger, db, redis, requestTimeout)
+	// Webhook adapters. Without a secret an adapter accepts unverified
+	// deliveries, which is only allowed outside production.
+	github, err := webhooks.NewGitHub(webhooks.GitHubConfig{
+		Secret:              cfg.GitHubWebhookSecret,
+		DeployWorkflows:     cfg.GitHubDeployWorkflows,
+		WorkflowEnvironment: cfg.GitHubWorkflowEnvironment,
+	})
+	if err != nil {
+		logger.Fatal("Invalid GitHub webhook configuration", zap.Error(err))
+	}
+	jenkins, err := webhooks.NewJenkins(webhooks.JenkinsConfig{
+		Token:              cfg.JenkinsWebhookToken,
+		DeployJobs:         cfg.JenkinsDeployJobs,
+		DefaultEnvironment: cfg.JenkinsEnvironment,
+	})
+	if err != nil {
+		logger.Fatal("Invalid Jenkins webhook configuration", zap.Error(err))
+	}
+	pagerduty, err := webhooks.NewPagerDuty(webhooks.PagerDutyConfig{
+		Secret:             cfg.PagerDutyWebhookSecret,
+		Services:           cfg.PagerDutyServiceMap,
+		Priorities:         cfg.PagerDutyPriorityMap,
+		DefaultEnvironment: cfg.PagerDutyEnvironment,
+	})
+	if err != nil {
+		logger.Fatal("Invalid PagerDuty webhook configuration", zap.Error(err))
+	}
+	adapters := []webhooks.Adapter{
+		github,
+		webhooks.NewGitLab(webhooks.GitLabConfig{Token: cfg.GitLabWebhookToken}),
+		jenkins,
+		pagerduty,
+		webhooks.NewAlertmanager(webhooks.AlertmanagerConfig{
+			Token:              cfg.AlertmanagerWebhookToken,
+			Rule:               webhooks.IncidentRule{Severities: cfg.AlertmanagerIncidentSeverities, Names: cfg.AlertmanagerIncidentAlerts},
+			SeverityLabel:      cfg.AlertmanagerSeverityLabel,
+			DefaultEnvironment: cfg.AlertmanagerEnvironment,
+		}),
+		webhooks.NewOpsgenie(webhooks.OpsgenieConfig{
+			Token:              cfg.OpsgenieWebhookToken,
+			Rule:               webhooks.IncidentRule{Severities: cfg.OpsgenieIncidentPriorities, Names: cfg.OpsgenieIncidentAlerts},
+			DefaultEnvironment: cfg.OpsgenieEnvironment,
+		}),
+		webhooks.NewArgoCD(webhooks.ArgoCDConfig{Token: cfg.ArgoCDWebhookToken}),
+		webhooks.NewFlux(webhooks.FluxConfig{Secret: cfg.FluxWebhookSecret, Cluster: cfg.FluxCluster}),
+		webhooks.NewCDEvents(webhooks.CDEventsConfig{Token: cfg.CDEventsWebhookToken, DefaultEnvironment: cfg.CDEventsEnvironment}),
+	}
+	// Adapters without a configured secret can still get one through the
+	// admin API; until then production refuses their deliveries.
+	for _, a := range adapters {
+		switch {
+		case a.Verifies():
+		case cfg.IsProduction():
+			logger.Warn("Webhook adapter refuses deliveries until a secret is managed through the admin API", zap.String("adapter", a.Name()))
+		default:
+			logger.Warn("Webhook adapter accepts unverified deliveries: no secret configured", zap.String("adapter", a.Name()))
+		}
+	}
+
+	// The admin API (generic webhook mappings) needs ADMIN_TOKEN; without it
+	// it is open in development and closed elsewhere.
+	insecureAdmin := cfg.AdminToken == "" && cfg.IsDevelopment()
+	if insecureAdmin {
+		logger.Warn("Admin API is open without authentication: ADMIN_TOKEN is not set")
+	}
+
+	// Built-in plugin types, then plugin binaries, which may replace them;
+	// instances are created through the admin API. Collection calls are
+	// bounded by the collector timeout.
+	pluginTypes := map[string]plugins.Factory{
+		"github":     ghcollector.Factory(resilience.Config{}, logger),
+		"git":        gitrepo.Factory(logger),
+		"kubernetes": kube.Factory(logger),
+		"jira":       jira.Factory(resilience.Config{}, logger),
+	}
+	for typ, path := range cfg.PluginBinaries {
+		pluginTypes[typ] = external.Factory(external.Config{
+			Path:           path,
+			CallTimeout:    time.Duration(cfg.PluginCallTimeoutSeconds) * time.Second,
+			CollectTimeout: time.Duration(cfg.CollectorTimeoutSeconds) * time.Second,
+		}, logger)
+		logger.Info("Plugin type registered", zap.String("type", typ), zap.String("path", path))
+	}
+
+	// Webhook inbox workers and collector plugins run until shutdown
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var stopped sync.WaitGroup
+
+	// Initialize API router with configured request timeout and readiness requirements
+	router := api.NewRouter(logger, db, redis, api.Options{
+		RequestTimeout:    time.Duration(cfg.RequestTimeoutSeconds) * time.Second,
+		BatchTimeout:      time.Duration(cfg.BatchTimeoutSeconds) * time.Second,
+		MigrationsDir:     cfg.MigrationsDir,
+		RequireDatabase:   cfg.RequireDatabase,
+		RequireRedis:      cfg.RequireRedis,
+		Webhooks:          adapters,
+		AdminToken:        cfg.AdminToken,
+		InsecureAdmin:     insecureAdmin,
+		RequireSignatures: cfg.IsProduction(),
+		Inbox: webhooks.InboxConfig{
+			Workers:     cfg.WebhookWorkers,
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			RetryBase:   time.Duration(cfg.WebhookRetryBaseSeconds) * time.Second,
+			Retention:   time.Duration(cfg.WebhookRetentionHours) * time.Hour,
+		},
+		Collector: collector.Config{
+			Concurrency: cfg.CollectorConcurrency,
+			Interval:    time.Duration(cfg.CollectorIntervalSeconds) * time.Second,
+			Timeout:     time.Duration(cfg.CollectorTimeoutSeconds) * time.Second,
+		},
+		PluginTypes: pluginTypes,
+		WASM: webhooks.WASMLimits{
+			MemoryBytes: int64(cfg.WASMMemoryLimitMB) << 20,
+			Timeout:     time.Duration(cfg.WASMTimeoutMillis) * time.Millisecond,
+		},
+		Background: background,
+		Stopped:    &stopped,
+	})
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -125,6 +251,20 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
+	// Deliveries interrupted mid-processing are retried once their lease expires
+	stopBackground()
+	// Wait for collector plugins to shut down, so external plugin processes
+	// are stopped rather than left running
+	done := make(chan struct{})
+	go func() {
+		stopped.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("Collector plugins did not shut down in time")
+	}
 
 	logger.Info("Server exited")
 }
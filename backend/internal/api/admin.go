@@ -0,0 +1,376 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// maxMappingBytes bounds mapping documents and dry-run requests.
+const maxMappingBytes = 1 << 20
+
+// redacted replaces secrets in admin responses.
+const redacted = "********"
+
+// adminAuth guards /api/v1/admin with the ADMIN_TOKEN bearer token. Without
+// a token the admin API is closed unless InsecureAdmin is set (development).
+func (r *Router) adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r.opts.AdminToken == "" {
+			if r.opts.InsecureAdmin {
+				c.Next()
+				return
+			}
+			respondError(c, ErrForbidden, "admin API is disabled: ADMIN_TOKEN is not configured", nil)
+			c.Abort()
+			return
+		}
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(r.opts.AdminToken)) != 1 {
+			respondError(c, ErrUnauthorized, "admin bearer token required", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminMethods are the custom methods served under /api/v1/admin.
+func adminMethods(r *Router) map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"webhook-mappings:dry-run": r.dryRunWebhookMapping,
+		"wasm-transforms:dry-run":  r.dryRunWASMTransform,
+	}
+}
+
+// webhookMappingView is a stored mapping as returned by the admin API, with
+// its token redacted.
+type webhookMappingView struct {
+	Source    string                 `json:"source"`
+	Endpoint  string                 `json:"endpoint"`
+	Config    webhooks.MappingConfig `json:"config"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+func mappingView(m storage.WebhookMapping, g *webhooks.Generic) webhookMappingView {
+	cfg := g.Config()
+	if cfg.Token != "" {
+		cfg.Token = redacted
+	}
+	return webhookMappingView{
+		Source:    m.Source,
+		Endpoint:  "/api/v1/webhook/generic/" + m.Source,
+		Config:    cfg,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+func (r *Router) listWebhookMappings(c *gin.Context) {
+	stored, err := r.mappingRepo.List(c.Request.Context())
+	if err != nil {
+		r.logger.Error("list webhook mappings failed", zap.Error(err))
+		respondError(c, ErrInternal, "failed to list webhook mappings", nil)
+		return
+	}
+	views := make([]webhookMappingView, 0, len(stored))
+	for _, m := range stored {
+		g, err := webhooks.CompileMapping(m.Source, m.Config)
+		if err != nil {
+			r.logger.Warn("stored webhook mapping no longer compiles", zap.String("source", m.Source), zap.Error(err))
+			continue
+		}
+		views = append(views, mappingView(m, g))
+	}
+	respondOK(c, views)
+}
+
+func (r *Router) getWebhookMapping(c *gin.Context) {
+	source := c.Param("source")
+	m, err := r.mappingRepo.Get(c.Request.Context(), source)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "webhook mapping not found", gin.H{"source": source})
+		return
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to load webhook mapping", nil)
+		return
+	}
+	g, err := webhooks.CompileMapping(m.Source, m.Config)
+	if err != nil {
+		respondError(c, ErrInternal, "stored webhook mapping is invalid", gin.H{"reason": err.Error()})
+		return
+	}
+	respondOK(c, mappingView(*m, g))
+}
+
+// putWebhookMapping creates or replaces the mapping for :source after
+// compiling it, so only valid mappings are ever stored. A redacted token is
+// kept from the stored mapping, letting admins round-trip GET responses.
+func (r *Router) putWebhookMapping(c *gin.Context) {
+	source := c.Param("source")
+	raw, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMappingBytes))
+	if err != nil {
+		respondError(c, ErrValidation, "mapping too large or unreadable", gin.H{"max_bytes": maxMappingBytes})
+		return
+	}
+	g, err := webhooks.CompileMapping(source, raw)
+	if err != nil {
+		respondError(c, ErrValidation, "invalid webhook mapping", gin.H{"reason": err.Error()})
+		return
+	}
+	if cfg := g.Config(); cfg.Token == redacted {
+		prev, err := r.mappingRepo.Get(c.Request.Context(), source)
+		if err != nil {
+			respondError(c, ErrValidation, "token is redacted but no stored mapping holds it", nil)
+			return
+		}
+		var old webhooks.MappingConfig
+		_ = json.Unmarshal(prev.Config, &old)
+		cfg.Token = old.Token
+		if raw, err = json.Marshal(cfg); err != nil {
+			respondError(c, ErrInternal, "failed to encode webhook mapping", nil)
+			return
+		}
+		if g, err = webhooks.CompileMapping(source, raw); err != nil {
+			respondError(c, ErrValidation, "invalid webhook mapping", gin.H{"reason": err.Error()})
+			return
+		}
+	}
+	m := &storage.WebhookMapping{Source: source, Config: raw}
+	created, err := r.mappingRepo.Put(c.Request.Context(), m)
+	if err != nil {
+		r.logger.Error("store webhook mapping failed", zap.String("source", source), zap.Error(err))
+		respondError(c, ErrInternal, "failed to store webhook mapping", nil)
+		return
+	}
+	r.logger.Info("webhook mapping stored", zap.String("source", source), zap.Bool("created", created))
+	if created {
+		respondCreated(c, mappingView(*m, g))
+		return
+	}
+	respondOK(c, mappingView(*m, g))
+}
+
+func (r *Router) deleteWebhookMapping(c *gin.Context) {
+	source := c.Param("source")
+	err := r.mappingRepo.Delete(c.Request.Context(), source)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "webhook mapping not found", gin.H{"source": source})
+		return
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to delete webhook mapping", nil)
+		return
+	}
+	r.logger.Info("webhook mapping deleted", zap.String("source", source))
+	c.Status(http.StatusNoContent)
+}
+
+// dryRunRequest evaluates Payload against Config, or against the stored
+// mapping of Source when Config is omitted.
+type dryRunRequest struct {
+	Source  string          `json:"source"`
+	Config  json.RawMessage `json:"config"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// dryRunWebhookMapping shows what a payload would become without storing it.
+func (r *Router) dryRunWebhookMapping(c *gin.Context) {
+	var req dryRunRequest
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxMappingBytes))
+	if err := dec.Decode(&req); err != nil || len(req.Payload) == 0 {
+		respondError(c, ErrValidation, "body must be {source, config?, payload}", nil)
+		return
+	}
+	if req.Source == "" {
+		req.Source = "dry-run"
+	}
+	var g *webhooks.Generic
+	var err error
+	if len(req.Config) > 0 {
+		if g, err = webhooks.CompileMapping(req.Source, req.Config); err != nil {
+			respondError(c, ErrValidation, "invalid webhook mapping", gin.H{"reason": err.Error()})
+			return
+		}
+	} else if g, err = r.genericAdapter(c, req.Source); err != nil {
+		return
+	}
+
+	ev, matched, err := g.Evaluate(req.Payload)
+	switch {
+	case errors.Is(err, webhooks.ErrUnsupportedEvent):
+		respondOK(c, gin.H{"source": g.Name(), "ignored": true, "reason": err.Error(), "matched_rules": []string{}})
+		return
+	case err != nil:
+		respondError(c, ErrValidation, "payload does not map", gin.H{"reason": err.Error(), "matched_rules": matched})
+		return
+	}
+	respondOK(c, gin.H{
+		"source":        g.Name(),
+		"event":         ev.Type,
+		"delivery_id":   ev.DeliveryID,
+		"ignored":       false,
+		"matched_rules": matched,
+		"deployments":   ev.Deployments,
+		"incidents":     ev.Incidents,
+	})
+}
+
+// genericAdapter loads and compiles the stored mapping for source, writing
+// the error response itself when that fails.
+func (r *Router) genericAdapter(c *gin.Context, source string) (*webhooks.Generic, error) {
+	m, err := r.mappingRepo.Get(c.Request.Context(), source)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "webhook mapping not found", gin.H{"source": source})
+		return nil, err
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to load webhook mapping", nil)
+		return nil, err
+	}
+	g, err := webhooks.CompileMapping(m.Source, m.Config)
+	if err != nil {
+		r.logger.Error("stored webhook mapping no longer compiles", zap.String("source", source), zap.Error(err))
+		respondError(c, ErrInternal, "stored webhook mapping is invalid", nil)
+		return nil, err
+	}
+	return g, nil
+}
+
+// webhookInboxView is a stored delivery as returned by the admin API. Body
+// is only included when a single delivery is fetched.
+type webhookInboxView struct {
+	ID            int64               `json:"id"`
+	Source        string              `json:"source"`
+	DeliveryKey   string              `json:"delivery_key"`
+	Status        storage.InboxStatus `json:"status"`
+	Attempts      int                 `json:"attempts"`
+	NextAttemptAt time.Time           `json:"next_attempt_at"`
+	LastError     string              `json:"last_error,omitempty"`
+	Result        json.RawMessage     `json:"result,omitempty"`
+	ReceivedAt    time.Time           `json:"received_at"`
+	ProcessedAt   *time.Time          `json:"processed_at,omitempty"`
+	Headers       http.Header         `json:"headers,omitempty"`
+	Body          string              `json:"body,omitempty"`
+}
+
+func inboxView(it storage.InboxItem, full bool) webhookInboxView {
+	v := webhookInboxView{
+		ID:            it.ID,
+		Source:        it.Source,
+		DeliveryKey:   it.DeliveryKey,
+		Status:        it.Status,
+		Attempts:      it.Attempts,
+		NextAttemptAt: it.NextAttemptAt,
+		LastError:     it.LastError,
+		Result:        it.Result,
+		ReceivedAt:    it.ReceivedAt,
+		ProcessedAt:   it.ProcessedAt,
+	}
+	if full {
+		v.Headers = it.Headers
+		v.Body = string(it.Body)
+	}
+	return v
+}
+
+// listWebhookInbox lists the newest deliveries, optionally filtered by
+// ?status= (dead lists the dead-letter queue).
+func (r *Router) listWebhookInbox(c *gin.Context) {
+	status := storage.InboxStatus(c.Query("status"))
+	switch status {
+	case "", storage.InboxPending, storage.InboxProcessing, storage.InboxDone, storage.InboxIgnored, storage.InboxDead:
+	default:
+		respondError(c, ErrValidation, "unknown status", gin.H{"status": status, "allowed": []storage.InboxStatus{storage.InboxPending, storage.InboxProcessing, storage.InboxDone, storage.InboxIgnored, storage.InboxDead}})
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			respondError(c, ErrValidation, "limit must be between 1 and 500", nil)
+			return
+		}
+		limit = n
+	}
+	items, err := r.inbox.List(c.Request.Context(), status, limit)
+	if err != nil {
+		r.logger.Error("list webhook inbox failed", zap.Error(err))
+		respondError(c, ErrInternal, "failed to list webhook inbox", nil)
+		return
+	}
+	views := make([]webhookInboxView, 0, len(items))
+	for _, it := range items {
+		views = append(views, inboxView(it, false))
+	}
+	respondOK(c, views)
+}
+
+// inboxID parses :id, writing the error response itself when invalid.
+func inboxID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		respondError(c, ErrValidation, "id must be a positive integer", gin.H{"id": c.Param("id")})
+		return 0, false
+	}
+	return id, true
+}
+
+func (r *Router) getWebhookInboxItem(c *gin.Context) {
+	id, ok := inboxID(c)
+	if !ok {
+		return
+	}
+	it, err := r.inbox.Get(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "webhook delivery not found", gin.H{"id": id})
+		return
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to load webhook delivery", nil)
+		return
+	}
+	respondOK(c, inboxView(*it, true))
+}
+
+// replayWebhookInboxItem requeues a dead-lettered delivery with a fresh
+// attempt budget, typically after fixing its mapping or the bug it hit.
+func (r *Router) replayWebhookInboxItem(c *gin.Context) {
+	id, ok := inboxID(c)
+	if !ok {
+		return
+	}
+	err := r.inbox.Replay(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		respondError(c, ErrNotFound, "webhook delivery not found", gin.H{"id": id})
+		return
+	case errors.Is(err, storage.ErrConflict):
+		respondError(c, ErrConflict, "only dead deliveries can be replayed", gin.H{"id": id})
+		return
+	case err != nil:
+		respondError(c, ErrInternal, "failed to replay webhook delivery", nil)
+		return
+	}
+	r.logger.Info("webhook delivery replayed", zap.Int64("inbox_id", id))
+	r.startInboxWorker()
+	r.inboxWorker.Notify()
+	it, err := r.inbox.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, ErrInternal, "failed to load webhook delivery", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": inboxView(*it, false), "trace_id": requestIDFromContext(c)})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name   string
+		opts   Options
+		bearer string
+		code   int
+	}{
+		{"closed without token", Options{}, "", http.StatusForbidden},
+		{"open in development", Options{InsecureAdmin: true}, "", http.StatusOK},
+		{"wrong token", Options{AdminToken: "adm1n"}, "nope", http.StatusUnauthorized},
+		{"right token", Options{AdminToken: "adm1n"}, "adm1n", http.StatusOK},
+	}
+	for _, tc := range cases {
+		engine := NewRouter(zap.NewNop(), nil, nil, tc.opts)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/webhook-mappings", nil)
+		if tc.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.bearer)
+		}
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s: status %d want %d body=%s", tc.name, rec.Code, tc.code, rec.Body.String())
+		}
+	}
+}
+
+func TestGenericWebhookMappingLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{AdminToken: "adm1n"})
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec
+	}
+	admin := map[string]string{"Authorization": "Bearer adm1n"}
+	mapping := `{"token": "t0ken", "event_type": "$.kind", "rules": [{"name": "deploys", "kind": "deployment",
+		"when": [{"path": "$.kind", "equals": "deploy"}],
+		"fields": {"id": "$.id", "service": "$.app", "start_time": "$.at"},
+		"status": [{"value": "failed", "when": [{"path": "$.ok", "equals": false}]}]}]}`
+	payload := `{"kind": "deploy", "id": "42", "app": "billing", "ok": true, "at": "` + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + `"}`
+
+	type step struct {
+		name, method, path, body string
+		header                   map[string]string
+		code                     int
+		contains                 string
+	}
+	steps := []step{
+		{"invalid mapping", http.MethodPut, "/api/v1/admin/webhook-mappings/acme", `{"rules": [{"kind": "deployment", "fields": {"id": "$.id"}}]}`, admin, http.StatusBadRequest, "field \\\"service\\\" is required"},
+		{"create", http.MethodPut, "/api/v1/admin/webhook-mappings/acme", mapping, admin, http.StatusCreated, `"endpoint":"/api/v1/webhook/generic/acme"`},
+		{"token redacted", http.MethodGet, "/api/v1/admin/webhook-mappings/acme", "", admin, http.StatusOK, `"token":"********"`},
+		{"replace keeps token", http.MethodPut, "/api/v1/admin/webhook-mappings/acme", strings.Replace(mapping, "t0ken", "********", 1), admin, http.StatusOK, `"source":"acme"`},
+		{"dry run", http.MethodPost, "/api/v1/admin/webhook-mappings:dry-run", `{"source": "acme", "payload": ` + payload + `}`, admin, http.StatusOK, `"matched_rules":["deploys"]`},
+		{"dry run inline", http.MethodPost, "/api/v1/admin/webhook-mappings:dry-run", `{"config": ` + mapping + `, "payload": {"kind": "build"}}`, admin, http.StatusOK, `"ignored":true`},
+		{"delivery without token", http.MethodPost, "/api/v1/webhook/generic/acme", payload, nil, http.StatusUnauthorized, "unauthorized"},
+		{"delivery", http.MethodPost, "/api/v1/webhook/generic/acme", payload, map[string]string{"X-Webhook-Token": "t0ken"}, http.StatusAccepted, `"source":"generic/acme"`},
+	}
+	run := func(steps []step) {
+		for _, st := range steps {
+			rec := do(st.method, st.path, st.body, st.header)
+			if rec.Code != st.code || !strings.Contains(rec.Body.String(), st.contains) {
+				t.Errorf("%s: status %d body=%s", st.name, rec.Code, rec.Body.String())
+			}
+		}
+	}
+	run(steps)
+
+	// Deliveries are processed asynchronously with the mapping they were
+	// accepted under
+	awaitResponse(t, engine, "/api/v1/deployments", `"id":"acme-42"`)
+
+	run([]step{
+		{"inbox done", http.MethodGet, "/api/v1/admin/webhook-inbox?status=done", "", admin, http.StatusOK, `"source":"generic/acme"`},
+		{"listed as plugin", http.MethodGet, "/api/v1/plugins", "", nil, http.StatusOK, `"id":"generic/acme"`},
+		{"not generic", http.MethodPost, "/api/v1/webhook/github/acme", payload, nil, http.StatusNotFound, "not_found"},
+		{"delete", http.MethodDelete, "/api/v1/admin/webhook-mappings/acme", "", admin, http.StatusNoContent, ""},
+		{"gone", http.MethodPost, "/api/v1/webhook/generic/acme", payload, map[string]string{"X-Webhook-Token": "t0ken"}, http.StatusNotFound, "not_found"},
+	})
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+const (
+	// maxBatchItems caps a single batch request; larger backfills should be split.
+	maxBatchItems = 10000
+	// maxBatchBytes caps the request body of a batch request.
+	maxBatchBytes = 64 << 20
+	// maxNDJSONLine caps a single NDJSON record.
+	maxNDJSONLine = 1 << 20
+	// batchFlushItems is how many NDJSON items are stored at a time.
+	batchFlushItems = 500
+)
+
+// Per-item batch outcomes.
+const (
+	batchCreated  = "created"
+	batchInvalid  = "invalid"
+	batchConflict = "conflict"
+	batchFailed   = "failed"
+)
+
+// batchResult reports the outcome of one item, in request order.
+type batchResult struct {
+	Index  int           `json:"index"`
+	ID     string        `json:"id,omitempty"`
+	Status string        `json:"status"`
+	Error  *errorPayload `json:"error,omitempty"`
+}
+
+// customMethods maps Google-style custom method paths (collection:verb) under
+// /api/v1 to handlers. Gin cannot register a literal ':' inside a segment, so
+// they are served from a single /:method route and dispatched here.
+func customMethods(r *Router) map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"deployments:batch": r.batchDeployments,
+		"incidents:batch":   r.batchIncidents,
+	}
+}
+
+func (r *Router) dispatchCustomMethod(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := methods[c.Param("method")]
+		if !ok {
+			respondError(c, ErrNotFound, "endpoint not found", nil)
+			return
+		}
+		h(c)
+	}
+}
+
+// ndjsonTypes are the content types of NDJSON batches.
+var ndjsonTypes = map[string]bool{"application/x-ndjson": true, "application/ndjson": true, "application/jsonl": true, "application/x-jsonlines": true}
+
+func isNDJSON(c *gin.Context) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	return ndjsonTypes[mediaType]
+}
+
+// decodeBatch reads a JSON array or NDJSON stream (by Content-Type) and calls
+// add for every record. Malformed NDJSON lines are reported per item; a
+// malformed JSON array aborts the whole request.
+func decodeBatch(c *gin.Context, add func(raw json.RawMessage, decodeErr error)) error {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBytes)
+	count := 0
+	next := func() error {
+		if count++; count > maxBatchItems {
+			return errors.New("batch exceeds maximum item count")
+		}
+		return nil
+	}
+	if isNDJSON(c) {
+		sc := bufio.NewScanner(body)
+		sc.Buffer(make([]byte, 0, 64<<10), maxNDJSONLine)
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if err := next(); err != nil {
+				return err
+			}
+			if !json.Valid(line) {
+				add(nil, errors.New("malformed json record"))
+				continue
+			}
+			add(append(json.RawMessage(nil), line...), nil)
+		}
+		return sc.Err()
+	}
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return errors.New("expected a JSON array or an NDJSON stream")
+	}
+	for dec.More() {
+		if err := next(); err != nil {
+			return err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		add(raw, nil)
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// ingestBatch decodes a batch, validates every item with parse and stores the
+// valid ones with store, responding with the per-item results. NDJSON items
+// are stored every batchFlushItems as the stream is read, so a large backfill
+// is never held in memory whole; a JSON array is stored once it has been
+// read, so a malformed array stores nothing.
+func ingestBatch[T any](c *gin.Context, parse func(raw json.RawMessage, decodeErr error) (T, string, *errorPayload), store func(context.Context, []T) []error) {
+	flushAt := maxBatchItems
+	if isNDJSON(c) {
+		flushAt = batchFlushItems
+	}
+	var results []batchResult
+	var pending []T
+	var slots []int // index into results for each entry in pending
+	stored := 0     // results before this index are final
+	flush := func() {
+		if len(pending) == 0 {
+			stored = len(results)
+			return
+		}
+		errs := store(c.Request.Context(), pending)
+		for i, err := range errs {
+			storeResult(&results[slots[i]], err)
+		}
+		pending, slots, stored = pending[:0], slots[:0], len(results)
+	}
+	err := decodeBatch(c, func(raw json.RawMessage, decodeErr error) {
+		res := batchResult{Index: len(results)}
+		item, id, perr := parse(raw, decodeErr)
+		if perr != nil {
+			res.Status, res.Error = batchInvalid, perr
+		} else {
+			res.ID = id
+			pending = append(pending, item)
+			slots = append(slots, res.Index)
+		}
+		results = append(results, res)
+		if len(pending) == flushAt {
+			flush()
+		}
+	})
+	if err != nil {
+		batchDecodeError(c, err, results[:stored])
+		return
+	}
+	flush()
+	respondBatch(c, results)
+}
+
+// validateItem decodes one record into dst and applies the binding rules.
+func validateItem(raw json.RawMessage, decodeErr error, dst interface{}) *errorPayload {
+	if decodeErr == nil {
+		decodeErr = json.Unmarshal(raw, dst)
+	}
+	if decodeErr != nil {
+		return &errorPayload{Code: "validation_error", Message: "invalid json"}
+	}
+	if err := binding.Validator.ValidateStruct(dst); err != nil {
+		var verrs validator.ValidationErrors
+		if errors.As(err, &verrs) {
+			return &errorPayload{Code: "validation_error", Message: "request validation failed", Details: fieldErrors(verrs)}
+		}
+		return &errorPayload{Code: "validation_error", Message: err.Error()}
+	}
+	return nil
+}
+
+// storeResult maps a storage outcome onto a batch result.
+func storeResult(res *batchResult, err error) {
+	switch {
+	case err == nil:
+		res.Status = batchCreated
+	case errors.Is(err, storage.ErrConflict):
+		res.Status = batchConflict
+		res.Error = &errorPayload{Code: "conflict", Message: "already exists"}
+	default:
+		res.Status = batchFailed
+		res.Error = &errorPayload{Code: "internal_error", Message: "failed to persist"}
+	}
+}
+
+func respondBatch(c *gin.Context, results []batchResult) {
+	summary := map[string]int{"total": len(results), batchCreated: 0, batchInvalid: 0, batchConflict: 0, batchFailed: 0}
+	for _, res := range results {
+		summary[res.Status]++
+	}
+	respondOK(c, gin.H{"results": results, "summary": summary})
+}
+
+// batchDecodeError rejects a batch that could not be read. Items of an NDJSON
+// stream stored before the error are listed, so the client can resume after
+// them.
+func batchDecodeError(c *gin.Context, err error, stored []batchResult) {
+	details, message := gin.H{"max_items": maxBatchItems}, "invalid batch: "+strings.TrimPrefix(err.Error(), "json: ")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		details, message = gin.H{"max_bytes": maxBatchBytes}, "batch body too large"
+	}
+	if len(stored) > 0 {
+		details["results"] = stored
+	}
+	respondError(c, ErrValidation, message, details)
+}
+
+// batchDeployments ingests many deployments in one request, reporting results
+// per item so a bad record does not reject the batch.
+func (r *Router) batchDeployments(c *gin.Context) {
+	ingestBatch(c, func(raw json.RawMessage, decodeErr error) (metrics.Deployment, string, *errorPayload) {
+		var req deploymentRequest
+		if perr := validateItem(raw, decodeErr, &req); perr != nil {
+			return metrics.Deployment{}, "", perr
+		}
+		dep := req.toDeployment()
+		return dep, dep.ID, nil
+	}, r.deploymentRepo.CreateBatch)
+}
+
+// batchIncidents ingests many incidents in one request; see batchDeployments.
+func (r *Router) batchIncidents(c *gin.Context) {
+	ingestBatch(c, func(raw json.RawMessage, decodeErr error) (metrics.Incident, string, *errorPayload) {
+		var req incidentRequest
+		if perr := validateItem(raw, decodeErr, &req); perr != nil {
+			return metrics.Incident{}, "", perr
+		}
+		inc := req.toIncident()
+		return inc, inc.ID, nil
+	}, r.incidentRepo.CreateBatch)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func postBatch(engine *gin.Engine, path, contentType, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func batchStatuses(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d body=%s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Data struct {
+			Results []batchResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	statuses := make([]string, len(out.Data.Results))
+	for i, res := range out.Data.Results {
+		if res.Index != i {
+			t.Errorf("result %d has index %d", i, res.Index)
+		}
+		statuses[i] = res.Status
+	}
+	return statuses
+}
+
+func TestBatchDeploymentsJSONArray(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	body := `[
+		{"id":"d1","service":"api","environment":"prod","status":"success"},
+		{"id":"d2","service":"api","environment":"prod","status":"bogus"},
+		{"id":"d1","service":"api","environment":"prod","status":"failed"},
+		{"service":"web","environment":"prod","status":"failed"}
+	]`
+	got := batchStatuses(t, postBatch(engine, "/api/v1/deployments:batch", "application/json", body))
+	want := []string{batchCreated, batchInvalid, batchConflict, batchCreated}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("statuses got=%v want=%v", got, want)
+	}
+}
+
+func TestBatchIncidentsNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	body := `{"id":"i1","title":"a","service":"api","environment":"prod","severity":"low"}
+{"id":"i2","title":
+{"id":"i3","title":"c","service":"api","environment":"prod","severity":"critical"}
+`
+	got := batchStatuses(t, postBatch(engine, "/api/v1/incidents:batch", "application/x-ndjson", body))
+	want := []string{batchCreated, batchInvalid, batchCreated}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("statuses got=%v want=%v", got, want)
+	}
+}
+
+func TestBatchRejectsMalformedArrayAndUnknownMethod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	if rec := postBatch(engine, "/api/v1/deployments:batch", "application/json", `{"id":"x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("non-array body: status %d want 400", rec.Code)
+	}
+	if rec := postBatch(engine, "/api/v1/deployments:purge", "application/json", `[]`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown custom method: status %d want 404", rec.Code)
+	}
+}
+
+func ndjsonDeployments(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `{"id":"d%d","service":"api","environment":"prod","status":"success"}`+"\n", i)
+	}
+	return b.String()
+}
+
+func TestIngestBatchStoresNDJSONInChunks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var chunks []int
+	engine := gin.New()
+	engine.POST("/batch", func(c *gin.Context) {
+		ingestBatch(c, func(raw json.RawMessage, decodeErr error) (string, string, *errorPayload) {
+			return string(raw), "", nil
+		}, func(_ context.Context, items []string) []error {
+			chunks = append(chunks, len(items))
+			return make([]error, len(items))
+		})
+	})
+	body := ndjsonDeployments(2*batchFlushItems + 1)
+	if got := batchStatuses(t, postBatch(engine, "/batch", "application/x-ndjson", body)); len(got) != 2*batchFlushItems+1 {
+		t.Fatalf("ndjson: %d results", len(got))
+	}
+	if want := []int{batchFlushItems, batchFlushItems, 1}; fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Errorf("ndjson chunks got=%v want=%v", chunks, want)
+	}
+
+	chunks = nil
+	body = "[" + strings.ReplaceAll(strings.TrimSuffix(body, "\n"), "\n", ",") + "]"
+	batchStatuses(t, postBatch(engine, "/batch", "application/json", body))
+	if want := []int{2*batchFlushItems + 1}; fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Errorf("json array chunks got=%v want=%v", chunks, want)
+	}
+}
+
+func TestBatchNDJSONErrorListsStoredItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	rec := postBatch(engine, "/api/v1/deployments:batch", "application/x-ndjson", ndjsonDeployments(maxBatchItems+1))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d want 400", rec.Code)
+	}
+	var out struct {
+		Error struct {
+			Details struct {
+				Results []batchResult `json:"results"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if n := len(out.Error.Details.Results); n != maxBatchItems {
+		t.Errorf("stored results got=%d want=%d", n, maxBatchItems)
+	}
+	// The stored items are kept, so resuming reports them as conflicts.
+	got := batchStatuses(t, postBatch(engine, "/api/v1/deployments:batch", "application/x-ndjson", ndjsonDeployments(1)))
+	if len(got) != 1 || got[0] != batchConflict {
+		t.Errorf("resumed statuses got=%v", got)
+	}
+}
+
+func TestBatchUsesBatchTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{RequestTimeout: time.Nanosecond})
+	got := batchStatuses(t, postBatch(engine, "/api/v1/deployments:batch", "application/x-ndjson", ndjsonDeployments(3)))
+	if len(got) != 3 {
+		t.Errorf("statuses got=%v", got)
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/collector"
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+// collectorHealthView is a collector plugin's health for /plugins/:name/health.
+type collectorHealthView struct {
+	Plugin  string `json:"plugin"`
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+	collector.Health
+	// Breaker is set for plugins calling their upstream through a
+	// resilience.Client.
+	Breaker *resilience.State `json:"breaker,omitempty"`
+}
+
+// syncRecorder also records each cycle's outcome on the plugin instance, so
+// its sync status and health counters follow the scheduler. Plugins given
+// in Options.Collectors have no instance.
+type syncRecorder struct {
+	storage.PluginStateRepository
+	instances storage.PluginInstanceRepository
+}
+
+func (s syncRecorder) RecordRun(ctx context.Context, run storage.PluginRun) error {
+	if err := s.PluginStateRepository.RecordRun(ctx, run); err != nil {
+		return err
+	}
+	err := s.instances.RecordSync(ctx, run.Plugin, run.StartedAt.Add(run.Duration), run.Error)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// startCollectors runs the scheduler once, until Background is cancelled,
+// then shuts the plugins down, marking Stopped done. Without collector
+// plugins it starts when the first instance is, so routers without any run
+// no background goroutines.
+func (r *Router) startCollectors() {
+	r.collectorsOnce.Do(func() {
+		ctx := r.opts.Background
+		r.logger.Info("collector scheduler started", zap.Strings("plugins", r.scheduler.Scheduled()))
+		if r.opts.Stopped != nil {
+			r.opts.Stopped.Add(1)
+		}
+		go func() {
+			if r.opts.Stopped != nil {
+				defer r.opts.Stopped.Done()
+			}
+			// A plugin that fails to initialize stays scheduled: each cycle
+			// retries initializing it, and its health reports the error
+			if err := r.plugins.InitializeAll(ctx); err != nil {
+				r.logger.Error("collector plugin initialization failed", zap.Error(err))
+			}
+			r.scheduler.Run(ctx)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := r.plugins.ShutdownAll(shutdownCtx); err != nil {
+				r.logger.Warn("collector plugin shutdown failed", zap.Error(err))
+			}
+		}()
+	})
+}
+
+// loadPluginInstances starts the enabled stored instances.
+func (r *Router) loadPluginInstances(ctx context.Context) {
+	instances, err := r.instanceRepo.List(ctx)
+	if err != nil {
+		r.logger.Error("loading plugin instances failed", zap.Error(err))
+		return
+	}
+	for _, inst := range instances {
+		if inst.Enabled {
+			r.startInstance(ctx, inst)
+		}
+	}
+}
+
+// startInstance builds the instance's plugin from its type, initializes it
+// and schedules it. A failure is recorded as the instance's last error and
+// reported false. A plugin that fails to initialize, such as one whose
+// upstream is not reachable yet, is scheduled all the same: each cycle
+// retries initializing it.
+func (r *Router) startInstance(ctx context.Context, inst storage.PluginInstance) bool {
+	err := func() error {
+		factory, ok := r.opts.PluginTypes[inst.Type]
+		if !ok {
+			return fmt.Errorf("unknown plugin type %q", inst.Type)
+		}
+		config, err := plugins.WithSecret(inst.Config, inst.SecretRef)
+		if err != nil {
+			return err
+		}
+		return r.plugins.Start(ctx, factory(inst.Name), config)
+	}()
+	if err != nil {
+		r.logger.Error("plugin instance failed to start", zap.String("plugin", inst.Name), zap.String("type", inst.Type), zap.Error(err))
+		if rerr := r.instanceRepo.RecordSync(ctx, inst.Name, time.Now().UTC(), "start: "+err.Error()); rerr != nil {
+			r.logger.Warn("recording plugin start failure failed", zap.String("plugin", inst.Name), zap.Error(rerr))
+		}
+	}
+	if _, registered := r.plugins.Get(inst.Name); !registered {
+		return false
+	}
+	r.scheduler.Schedule(inst.Name, time.Duration(inst.IntervalSeconds)*time.Second)
+	r.startCollectors()
+	if err == nil {
+		r.logger.Info("plugin instance started", zap.String("plugin", inst.Name), zap.String("type", inst.Type))
+	}
+	return err == nil
+}
+
+// stopInstance unschedules the plugin and shuts it down after its running
+// cycle, if any, has recorded its outcome.
+func (r *Router) stopInstance(ctx context.Context, name string) {
+	if err := r.scheduler.Unschedule(ctx, name); err != nil {
+		r.logger.Warn("waiting for plugin cycle failed", zap.String("plugin", name), zap.Error(err))
+	}
+	err := r.plugins.Stop(ctx, name)
+	switch {
+	case errors.Is(err, plugins.ErrUnknownPlugin):
+	case err != nil:
+		r.logger.Warn("plugin instance shutdown failed", zap.String("plugin", name), zap.Error(err))
+	default:
+		r.logger.Info("plugin instance stopped", zap.String("plugin", name))
+	}
+}
+
+// collectorPlugins lists collector plugins with their health status for
+// /plugins: stored instances (disabled ones included) and plugins given in
+// Options.Collectors.
+func (r *Router) collectorPlugins(c *gin.Context) []gin.H {
+	ctx := c.Request.Context()
+	out := []gin.H{}
+	listed := map[string]bool{}
+	instances, err := r.instanceRepo.List(ctx)
+	if err != nil {
+		r.logger.Warn("listing plugin instances failed", zap.Error(err))
+	}
+	for _, inst := range instances {
+		listed[inst.Name] = true
+		entry := gin.H{"id": inst.Name, "name": inst.Name, "description": inst.Type + " collector", "type": "collector", "status": "disabled"}
+		if p, ok := r.plugins.Get(inst.Name); ok {
+			entry["description"], entry["version"] = p.Description(), p.Version()
+		}
+		if inst.Enabled {
+			entry["status"] = r.collectorStatus(ctx, inst.Name)
+		}
+		out = append(out, entry)
+	}
+	for _, name := range r.scheduler.Scheduled() {
+		p, ok := r.plugins.Get(name)
+		if !ok || listed[name] {
+			continue
+		}
+		out = append(out, gin.H{"id": name, "name": name, "description": p.Description(), "type": "collector", "version": p.Version(), "status": r.collectorStatus(ctx, name)})
+	}
+	return out
+}
+
+func (r *Router) collectorStatus(ctx context.Context, name string) string {
+	h, err := r.scheduler.Health(ctx, name)
+	if err != nil {
+		r.logger.Warn("collector health lookup failed", zap.String("plugin", name), zap.Error(err))
+		return "unknown"
+	}
+	if !r.plugins.Initialized(name) {
+		// Enabled but not started, or not initialized yet: its last error
+		// says why
+		return collector.StatusFailing
+	}
+	return h.Status
+}
+
+// collectorHealth writes the health of a collector plugin, reporting false
+// when name is not one.
+func (r *Router) collectorHealth(c *gin.Context, name string) bool {
+	ctx := c.Request.Context()
+	view := collectorHealthView{Plugin: name, Type: "collector"}
+	p, running := r.plugins.Get(name)
+	inst, err := r.instanceRepo.Get(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		r.logger.Error("plugin instance lookup failed", zap.String("plugin", name), zap.Error(err))
+		respondError(c, ErrInternal, "failed to read plugin health", nil)
+		return true
+	}
+	if !running && inst == nil {
+		return false
+	}
+	h, err := r.scheduler.Health(ctx, name)
+	if err != nil {
+		r.logger.Error("collector health lookup failed", zap.String("plugin", name), zap.Error(err))
+		respondError(c, ErrInternal, "failed to read plugin health", nil)
+		return true
+	}
+	view.Health = h
+	switch {
+	case running:
+		view.Version = p.Version()
+		if br, ok := p.(plugins.BreakerReporter); ok {
+			state := br.Breaker()
+			view.Breaker = &state
+		}
+		if !r.plugins.Initialized(name) && h.Runs == 0 && inst != nil {
+			// Initialization failed and no cycle has retried it yet
+			view.Status, view.LastError = collector.StatusFailing, inst.LastError
+		}
+	case !inst.Enabled:
+		view.Status = "disabled"
+	default:
+		view.Status, view.LastError = collector.StatusFailing, inst.LastError
+	}
+	c.JSON(http.StatusOK, view)
+	return true
+}
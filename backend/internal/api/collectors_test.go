@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/collector"
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// releases reports one deployment per cycle.
+type releases struct{}
+
+func (releases) Name() string                                      { return "releases" }
+func (releases) Description() string                               { return "Test releases" }
+func (releases) Version() string                                   { return "1.2.0" }
+func (releases) ConfigSchema() json.RawMessage                     { return nil }
+func (releases) Validate(json.RawMessage) error                    { return nil }
+func (releases) Initialize(context.Context, json.RawMessage) error { return nil }
+func (releases) HealthCheck(context.Context) error                 { return nil }
+func (releases) Shutdown(context.Context) error                    { return nil }
+
+func (releases) Collect(_ context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	start := time.Now().UTC()
+	return &plugins.Batch{
+		Deployments: []metrics.Deployment{{ID: "rel-" + string(since), Service: "api", Environment: "production", Status: metrics.DeploymentStatusSuccess, StartTime: start, EndTime: &start}},
+		Cursor:      since + "x",
+	}, nil
+}
+
+func TestCollectorPlugins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{
+		Collectors: []collector.Job{{Plugin: releases{}, Interval: 10 * time.Millisecond}},
+		Collector:  collector.Config{PollInterval: time.Millisecond},
+		Background: ctx,
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	var health collectorHealthView
+	deadline := time.Now().Add(2 * time.Second)
+	for health.Runs < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("collector did not run: %+v", health)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rec := get("/api/v1/plugins/releases/health")
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &health) != nil {
+			t.Fatalf("health: status %d body=%s", rec.Code, rec.Body.String())
+		}
+	}
+	if health.Status != collector.StatusHealthy || health.Version != "1.2.0" || health.LastRunAt == nil || health.ItemsIngested < 2 {
+		t.Errorf("health = %+v", health)
+	}
+	if body := get("/api/v1/plugins").Body.String(); !strings.Contains(body, `"type":"collector"`) || !strings.Contains(body, `"status":"healthy"`) {
+		t.Errorf("plugins = %s", body)
+	}
+	// Collected deployments are stored like ingested ones
+	if body := get("/api/v1/deployments").Body.String(); !strings.Contains(body, `"id":"rel-x"`) {
+		t.Errorf("deployments = %s", body)
+	}
+}
+
+// upstream collects from an HTTP upstream through a resilience client.
+type upstream struct {
+	releases
+	url    string
+	client *resilience.Client
+}
+
+func (upstream) Name() string                { return "upstream" }
+func (u upstream) Breaker() resilience.State { return u.client.Breaker() }
+
+func (u upstream) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream: %s", resp.Status)
+	}
+	return u.releases.Collect(ctx, since)
+}
+
+func TestCollectorBreakerHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := upstream{url: srv.URL, client: resilience.New("upstream", resilience.Config{MaxRetries: -1, FailureThreshold: 2, OpenTimeout: time.Hour}, zap.NewNop())}
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{
+		Collectors: []collector.Job{{Plugin: p, Interval: 10 * time.Millisecond}},
+		Collector:  collector.Config{PollInterval: time.Millisecond},
+		Background: ctx,
+	})
+
+	var health collectorHealthView
+	deadline := time.Now().Add(2 * time.Second)
+	for health.Breaker == nil || health.Breaker.State != resilience.StateOpen {
+		if time.Now().After(deadline) {
+			t.Fatalf("breaker did not open: %+v", health)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/plugins/upstream/health", nil))
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &health) != nil {
+			t.Fatalf("health: status %d body=%s", rec.Code, rec.Body.String())
+		}
+	}
+	if health.Breaker.ConsecutiveFailures != 2 || health.Breaker.RetryAt == nil || !strings.Contains(health.Breaker.LastError, "503") {
+		t.Errorf("breaker = %+v", health.Breaker)
+	}
+}
+
+// stoppable records its shutdown.
+type stoppable struct {
+	releases
+	shutdown chan struct{}
+}
+
+func (s stoppable) Shutdown(context.Context) error { close(s.shutdown); return nil }
+
+func TestCollectorsStoppedAfterBackground(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	var stopped sync.WaitGroup
+	p := stoppable{shutdown: make(chan struct{})}
+	NewRouter(zap.NewNop(), nil, nil, Options{
+		Collectors: []collector.Job{{Plugin: p, Interval: 10 * time.Millisecond}},
+		Collector:  collector.Config{PollInterval: time.Millisecond},
+		Background: ctx,
+		Stopped:    &stopped,
+	})
+	cancel()
+	stopped.Wait()
+	select {
+	case <-p.shutdown:
+	default:
+		t.Error("Stopped was done before the plugin shut down")
+	}
+}
@@ -4,6 +4,7 @@ import (
     "context"
     "errors"
     "net/http"
+    "strings"
     "time"
     "github.com/gin-gonic/gin"
 )
@@ -17,6 +18,7 @@ var (
     ErrUnauthorized = errors.New("unauthorized")
     ErrForbidden    = errors.New("forbidden")
     ErrTimeout      = errors.New("timeout")
+    ErrUnavailable  = errors.New("unavailable")
 )
 
 type errorPayload struct {
@@ -43,6 +45,8 @@ func respondError(c *gin.Context, err error, message string, details interface{}
         code = http.StatusForbidden; errCode = "forbidden"
     case errors.Is(err, ErrTimeout):
         code = http.StatusGatewayTimeout; errCode = "timeout"
+    case errors.Is(err, ErrUnavailable):
+        code = http.StatusServiceUnavailable; errCode = "unavailable"
     }
     rid := requestIDFromContext(c)
     c.JSON(code, gin.H{"error": errorPayload{Code: errCode, Message: message, Details: details, TraceID: rid}})
@@ -65,9 +69,13 @@ func requestIDFromContext(c *gin.Context) string {
 }
 
 // timeoutMiddleware enforces per-request timeouts; cancels context passed to handlers.
-func (r *Router) timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+// Batch ingestion (POST .../<collection>:batch) gets batchTimeout, since a backfill
+// of thousands of items takes longer than an ordinary request.
+func (r *Router) timeoutMiddleware(timeout, batchTimeout time.Duration) gin.HandlerFunc {
     return func(c *gin.Context) {
-        ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+        limit := timeout
+        if c.Request.Method == http.MethodPost && strings.HasSuffix(c.Request.URL.Path, ":batch") { limit = batchTimeout }
+        ctx, cancel := context.WithTimeout(c.Request.Context(), limit)
         defer cancel()
         c.Request = c.Request.WithContext(ctx)
         done := make(chan struct{})
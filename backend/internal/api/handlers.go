@@ -1,72 +1,26 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
 	"github.com/sirhCC/MetricHub/pkg/metrics"
 	"go.uber.org/zap"
 )
 
-// Health check handlers
-func (r *Router) healthCheck(c *gin.Context) {
-	response := gin.H{
-		"status":    "healthy",
-		"timestamp": time.Now().UTC(),
-		"version":   "0.1.0",
-		"checks": gin.H{
-			"database": "healthy",
-			"redis":    "healthy",
-		},
-	}
-
-	r.logger.Info("Health check requested", zap.String("status", "healthy"))
-	c.JSON(http.StatusOK, response)
-}
-
-func (r *Router) databaseHealth(c *gin.Context) {
-	// TODO: Implement actual database health check
-	response := gin.H{
-		"status":      "connected",
-		"latency":     "12ms",
-		"connections": 5,
-		"timestamp":   time.Now().UTC(),
-	}
-
-	c.JSON(http.StatusOK, response)
-}
-
-func (r *Router) redisHealth(c *gin.Context) {
-	// TODO: Implement actual Redis health check
-	response := gin.H{
-		"status":       "connected",
-		"memory_usage": "45MB",
-		"hit_rate":     "94.2%",
-		"timestamp":    time.Now().UTC(),
-	}
-
-	c.JSON(http.StatusOK, response)
-}
-
 // DORA Metrics handlers
 func (r *Router) getDoraMetrics(c *gin.Context) {
 	tr := r.parseTimeRange(c)
-	var deps []metrics.Deployment
-	var incs []metrics.Incident
-	if r.deploymentRepo != nil && r.incidentRepo != nil { // database path
-		var err error
-		deps, err = r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { respondError(c, ErrInternal, "failed to load deployments", nil); return }
-		incs, err = r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { respondError(c, ErrInternal, "failed to load incidents", nil); return }
-	} else { // in-memory fallback
-		r.mu.RLock()
-		deps = append([]metrics.Deployment(nil), r.deployments...)
-		incs = append([]metrics.Incident(nil), r.incidents...)
-		r.mu.RUnlock()
-	}
+	deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { respondError(c, ErrInternal, "failed to load deployments", nil); return }
+	incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { respondError(c, ErrInternal, "failed to load incidents", nil); return }
 	result, err := r.calculator.CalculateAll(deps, incs, tr)
 	if err != nil { respondError(c, ErrInternal, "calculation failed", nil); return }
 	classification := r.calculator.ClassifyPerformance(result)
@@ -88,130 +42,99 @@ func (r *Router) getDoraMetrics(c *gin.Context) {
 
 func (r *Router) getDeploymentFrequency(c *gin.Context) {
 	tr := r.parseTimeRange(c)
-	var deps []metrics.Deployment
-	if r.deploymentRepo != nil {
-		var err error
-		deps, err = r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployments"}); return }
-	} else {
-		r.mu.RLock(); deps = append([]metrics.Deployment(nil), r.deployments...); r.mu.RUnlock()
-	}
+	deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployments"}); return }
 	freq := r.calculator.CalculateDeploymentFrequency(deps, tr)
 	c.JSON(http.StatusOK, gin.H{"value": freq, "unit": "per_day", "time_range": tr})
 }
 
 func (r *Router) getLeadTime(c *gin.Context) {
-	var deps []metrics.Deployment
-	if r.deploymentRepo != nil {
-		tr := r.parseTimeRange(c)
-		var err error
-		deps, err = r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployments"}); return }
-	} else { r.mu.RLock(); deps = append([]metrics.Deployment(nil), r.deployments...); r.mu.RUnlock() }
+	tr := r.parseTimeRange(c)
+	deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployments"}); return }
 	lt := r.calculator.CalculateLeadTime(deps)
 	c.JSON(http.StatusOK, gin.H{"value": lt.String(), "unit": "duration"})
 }
 
 func (r *Router) getMTTR(c *gin.Context) {
-	var incs []metrics.Incident
-	if r.incidentRepo != nil {
-		tr := r.parseTimeRange(c)
-		var err error
-		incs, err = r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load incidents"}); return }
-	} else { r.mu.RLock(); incs = append([]metrics.Incident(nil), r.incidents...); r.mu.RUnlock() }
+	tr := r.parseTimeRange(c)
+	incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load incidents"}); return }
 	mttr := r.calculator.CalculateMTTR(incs)
 	c.JSON(http.StatusOK, gin.H{"value": mttr.String(), "unit": "duration"})
 }
 
 func (r *Router) getChangeFailureRate(c *gin.Context) {
 	tr := r.parseTimeRange(c)
-	var deps []metrics.Deployment
-	var incs []metrics.Incident
-	if r.deploymentRepo != nil && r.incidentRepo != nil {
-		var err error
-		deps, err = r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployments"}); return }
-		incs, err = r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
-		if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load incidents"}); return }
-	} else { r.mu.RLock(); deps = append([]metrics.Deployment(nil), r.deployments...); incs = append([]metrics.Incident(nil), r.incidents...); r.mu.RUnlock() }
+	deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployments"}); return }
+	incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End)
+	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load incidents"}); return }
 	cfr := r.calculator.CalculateChangeFailureRate(deps, incs)
 	c.JSON(http.StatusOK, gin.H{"value": cfr, "unit": "ratio"})
 }
 
 // Plugin handlers
 func (r *Router) listPlugins(c *gin.Context) {
-	// TODO: Get actual plugin list from database
-	response := gin.H{
-		"plugins": []gin.H{
-			{
-				"id":        "github",
-				"name":      "GitHub Integration",
-				"version":   "1.2.0",
-				"status":    "active",
-				"last_sync": time.Now().Add(-2 * time.Minute).UTC(),
-			},
-			{
-				"id":        "jenkins",
-				"name":      "Jenkins CI/CD",
-				"version":   "1.1.5",
-				"status":    "inactive",
-				"last_sync": time.Now().Add(-1 * time.Hour).UTC(),
-			},
-			{
-				"id":        "datadog",
-				"name":      "Datadog Monitoring",
-				"version":   "1.0.3",
-				"status":    "error",
-				"last_sync": time.Now().Add(-5 * time.Hour).UTC(),
-			},
-		},
+	// Webhook adapters without a configured or managed secret are unverified,
+	// or disabled when signatures are required; collectors report their health.
+	plugins := []gin.H{}
+	for _, name := range r.webhooks.Names() {
+		a, _ := r.webhooks.Get(name)
+		plugins = append(plugins, gin.H{"id": name, "name": name, "description": a.Description(), "type": "webhook", "status": r.webhookStatus(c, a)})
+	}
+	// Generic sources registered through the admin API
+	if mappings, err := r.mappingRepo.List(c.Request.Context()); err != nil {
+		r.logger.Warn("Listing webhook mappings failed", zap.Error(err))
+	} else {
+		for _, m := range mappings {
+			g, err := webhooks.CompileMapping(m.Source, m.Config)
+			if err != nil { continue }
+			plugins = append(plugins, gin.H{"id": g.Name(), "name": g.Name(), "description": g.Description(), "type": "webhook", "status": r.webhookStatus(c, g)})
+		}
+	}
+	// WebAssembly transforms uploaded through the admin API
+	if transforms, err := r.wasmRepo.List(c.Request.Context()); err != nil {
+		r.logger.Warn("Listing wasm transforms failed", zap.Error(err))
+	} else {
+		for _, t := range transforms {
+			v := transformView(t)
+			description := v.Config.Description
+			if description == "" { description = "WebAssembly transform " + t.Name }
+			plugins = append(plugins, gin.H{"id": "wasm/" + t.Name, "name": "wasm/" + t.Name, "description": description, "type": "webhook", "status": r.verificationStatus(c, "wasm/"+t.Name, v.Config.Token != "")})
+		}
 	}
+	plugins = append(plugins, r.collectorPlugins(c)...)
 
 	r.logger.Info("Plugin list requested")
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{"plugins": plugins})
 }
 
-func (r *Router) pluginHealth(c *gin.Context) {
-	pluginName := c.Param("name")
-
-	// TODO: Get actual plugin health from database
-	response := gin.H{
-		"plugin":     pluginName,
-		"status":     "healthy",
-		"last_check": time.Now().UTC(),
-		"metrics": gin.H{
-			"requests_per_minute": 25,
-			"error_rate":          0.02,
-			"response_time":       120,
-		},
-	}
+// webhookStatus reports whether deliveries to a webhook plugin are verified.
+func (r *Router) webhookStatus(c *gin.Context, a webhooks.Adapter) string {
+	return r.verificationStatus(c, a.Name(), a.Verifies())
+}
 
-	r.logger.Info("Plugin health requested", zap.String("plugin", pluginName))
-	c.JSON(http.StatusOK, response)
+// verificationStatus is webhookStatus for a plugin name and whether it has a
+// configured secret.
+func (r *Router) verificationStatus(c *gin.Context, name string, verifies bool) string {
+	if verifies { return "active" }
+	if managed, err := r.secretRepo.Active(c.Request.Context(), name); err == nil && len(managed) > 0 { return "active" }
+	if r.opts.RequireSignatures { return "disabled" }
+	return "unverified"
 }
 
-// Webhook handler
-func (r *Router) handleWebhook(c *gin.Context) {
-	pluginName := c.Param("plugin")
+func (r *Router) pluginHealth(c *gin.Context) {
+	pluginName := c.Param("name")
+	if r.collectorHealth(c, pluginName) { return }
 
-	var payload map[string]interface{}
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		r.logger.Error("Failed to parse webhook payload", zap.String("plugin", pluginName), zap.Error(err))
-		respondError(c, ErrValidation, "invalid json payload", nil)
+	// Webhook plugins are passive: their health is whether deliveries verify
+	a, ok := r.webhooks.Get(pluginName)
+	if !ok {
+		respondError(c, ErrNotFound, "plugin not found", gin.H{"name": pluginName})
 		return
 	}
-
-	// TODO: Process webhook payload and store data in database
-	response := gin.H{
-		"message":      "Webhook received",
-		"plugin":       pluginName,
-		"processed_at": time.Now().UTC(),
-		"processed":    true,
-	}
-
-	r.logger.Info("Webhook processed", zap.String("plugin", pluginName), zap.Any("payload", payload))
-	respondOK(c, response)
+	c.JSON(http.StatusOK, gin.H{"plugin": pluginName, "type": "webhook", "status": r.webhookStatus(c, a)})
 }
 
 // Helper function to generate mock historical data
@@ -246,54 +169,97 @@ func generateMockHistoricalData(metricType string) []gin.H {
 }
 
 // Ingestion endpoints (development in-memory only)
+
+// deploymentRequest is validated declaratively via binding tags (see validation.go).
 type deploymentRequest struct {
-	ID          string     `json:"id"`
+	ID          string     `json:"id" binding:"max=128"`
 	StartedAt   *time.Time `json:"started_at"`
-	EndedAt     *time.Time `json:"ended_at"`
-	Status      string     `json:"status"`
-	CommitSHA   string     `json:"commit_sha"`
-	Service     string     `json:"service"`
-	Environment string     `json:"environment"`
+	EndedAt     *time.Time `json:"ended_at" binding:"omitempty,not_before=StartedAt"`
+	Status      string     `json:"status" binding:"required,deployment_status"`
+	CommitSHA   string     `json:"commit_sha" binding:"max=64"`
+	Service     string     `json:"service" binding:"required,max=128"`
+	Environment string     `json:"environment" binding:"required,max=64"`
+	Version     string     `json:"version" binding:"max=128"`
+	Repository  string     `json:"repository" binding:"max=256"`
+	Branch      string     `json:"branch" binding:"max=256"`
+	Author      string     `json:"author" binding:"max=256"`
+	BuildURL    string     `json:"build_url" binding:"omitempty,max=2048,url"`
 }
 
-func (r *Router) createDeployment(c *gin.Context) {
-	var req deploymentRequest
-	if err := c.ShouldBindJSON(&req); err != nil { respondError(c, ErrValidation, "invalid json", nil); return }
-	start := time.Now(); if req.StartedAt != nil { start = *req.StartedAt }
-	dep := metrics.Deployment{
+// toDeployment maps a validated request onto the domain model.
+func (req deploymentRequest) toDeployment() metrics.Deployment {
+	if req.ID == "" { req.ID = uuid.NewString() }
+	// A deployment reported only by its completion time started no later than that
+	start := time.Now(); if req.StartedAt != nil { start = *req.StartedAt } else if req.EndedAt != nil && req.EndedAt.Before(start) { start = *req.EndedAt }
+	return metrics.Deployment{
 		ID:          req.ID,
 		Service:     req.Service,
 		Environment: req.Environment,
+		Version:     req.Version,
 		StartTime:   start,
 		EndTime:     req.EndedAt,
 		Status:      metrics.DeploymentStatus(req.Status),
 		CommitSHA:   req.CommitSHA,
 		CommitTime:  start,
+		Author:      req.Author,
+		Repository:  req.Repository,
+		Branch:      req.Branch,
+		BuildURL:    req.BuildURL,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
-	if r.deploymentRepo != nil {
-		if err := r.deploymentRepo.Create(c.Request.Context(), &dep); err != nil { respondError(c, ErrInternal, "failed to persist deployment", nil); return }
-	} else { r.mu.Lock(); r.deployments = append(r.deployments, dep); r.mu.Unlock() }
+}
+
+func (r *Router) createDeployment(c *gin.Context) {
+	var req deploymentRequest
+	if !bindJSON(c, &req) { return }
+	dep := req.toDeployment()
+	if err := r.deploymentRepo.Create(c.Request.Context(), &dep); err != nil {
+		if errors.Is(err, storage.ErrConflict) { respondError(c, ErrConflict, "deployment already exists", gin.H{"id": dep.ID}); return }
+		respondError(c, ErrInternal, "failed to persist deployment", nil); return
+	}
 	c.JSON(http.StatusCreated, gin.H{"data": gin.H{"deployment": dep}, "trace_id": requestIDFromContext(c)})
 }
 
+// upsertDeployment creates or updates a deployment by its natural key
+// (repository, commit_sha, environment), so CI retries converge on one row.
+func (r *Router) upsertDeployment(c *gin.Context) {
+	var req deploymentRequest
+	if !bindJSON(c, &req) { return }
+	var missing []fieldError
+	if req.Repository == "" { missing = append(missing, fieldError{Field: "repository", Rule: "required", Message: "is required"}) }
+	if req.CommitSHA == "" { missing = append(missing, fieldError{Field: "commit_sha", Rule: "required", Message: "is required"}) }
+	if len(missing) > 0 { respondError(c, ErrValidation, "request validation failed", missing); return }
+	dep := req.toDeployment()
+	// Without started_at the times are unknown, so an update keeps the stored ones
+	if req.StartedAt == nil { dep.StartTime, dep.CommitTime = time.Time{}, time.Time{} }
+	created, err := r.deploymentRepo.Upsert(c.Request.Context(), &dep)
+	if err != nil {
+		if errors.Is(err, storage.ErrConflict) { respondError(c, ErrConflict, "deployment id already used by another deployment", gin.H{"id": dep.ID}); return }
+		respondError(c, ErrInternal, "failed to persist deployment", nil); return
+	}
+	status := http.StatusOK
+	if created { status = http.StatusCreated }
+	c.JSON(status, gin.H{"data": gin.H{"deployment": dep, "created": created}, "trace_id": requestIDFromContext(c)})
+}
+
+// incidentRequest is validated declaratively via binding tags (see validation.go).
 type incidentRequest struct {
-	ID          string     `json:"id"`
+	ID          string     `json:"id" binding:"max=128"`
 	StartedAt   *time.Time `json:"started_at"`
-	ResolvedAt  *time.Time `json:"resolved_at"`
-	Severity    string     `json:"severity"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Service     string     `json:"service"`
-	Environment string     `json:"environment"`
+	ResolvedAt  *time.Time `json:"resolved_at" binding:"omitempty,not_before=StartedAt"`
+	Severity    string     `json:"severity" binding:"required,incident_severity"`
+	Title       string     `json:"title" binding:"required,max=256"`
+	Description string     `json:"description" binding:"max=4096"`
+	Service     string     `json:"service" binding:"required,max=128"`
+	Environment string     `json:"environment" binding:"required,max=64"`
 }
 
-func (r *Router) createIncident(c *gin.Context) {
-	var req incidentRequest
-	if err := c.ShouldBindJSON(&req); err != nil { respondError(c, ErrValidation, "invalid json", nil); return }
-	start := time.Now(); if req.StartedAt != nil { start = *req.StartedAt }
-	inc := metrics.Incident{
+// toIncident maps a validated request onto the domain model.
+func (req incidentRequest) toIncident() metrics.Incident {
+	if req.ID == "" { req.ID = uuid.NewString() }
+	start := time.Now(); if req.StartedAt != nil { start = *req.StartedAt } else if req.ResolvedAt != nil && req.ResolvedAt.Before(start) { start = *req.ResolvedAt }
+	return metrics.Incident{
 		ID:           req.ID,
 		Title:        req.Title,
 		Description:  req.Description,
@@ -305,40 +271,44 @@ func (r *Router) createIncident(c *gin.Context) {
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
-	if r.incidentRepo != nil {
-		if err := r.incidentRepo.Create(c.Request.Context(), &inc); err != nil { respondError(c, ErrInternal, "failed to persist incident", nil); return }
-	} else { r.mu.Lock(); r.incidents = append(r.incidents, inc); r.mu.Unlock() }
+}
+
+func (r *Router) createIncident(c *gin.Context) {
+	var req incidentRequest
+	if !bindJSON(c, &req) { return }
+	inc := req.toIncident()
+	if err := r.incidentRepo.Create(c.Request.Context(), &inc); err != nil {
+		if errors.Is(err, storage.ErrConflict) { respondError(c, ErrConflict, "incident already exists", gin.H{"id": inc.ID}); return }
+		respondError(c, ErrInternal, "failed to persist incident", nil); return
+	}
 	c.JSON(http.StatusCreated, gin.H{"data": gin.H{"incident": inc}, "trace_id": requestIDFromContext(c)})
 }
 
 func (r *Router) resolveIncident(c *gin.Context) {
 	id := c.Param("id")
 	now := time.Now()
-	if r.incidentRepo != nil {
-		if err := r.incidentRepo.Resolve(c.Request.Context(), id, now); err != nil { respondError(c, ErrNotFound, "incident not found", nil); return }
-		respondOK(c, gin.H{"resolved_at": now})
-		return
-	}
-	for i := range r.incidents {
-		if r.incidents[i].ID == id {
-			if r.incidents[i].ResolvedTime != nil { respondError(c, ErrConflict, "incident already resolved", nil); return }
-			r.mu.Lock(); r.incidents[i].ResolvedTime = &now; r.incidents[i].UpdatedAt = time.Now(); r.mu.Unlock()
-			respondOK(c, gin.H{"resolved_at": now}); return
+	if err := r.incidentRepo.Resolve(c.Request.Context(), id, now); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrConflict): respondError(c, ErrConflict, "incident already resolved", nil)
+		case errors.Is(err, storage.ErrNotFound): respondError(c, ErrNotFound, "incident not found", nil)
+		default: respondError(c, ErrInternal, "failed to resolve incident", nil)
 		}
+		return
 	}
-	respondError(c, ErrNotFound, "incident not found", nil)
+	respondOK(c, gin.H{"resolved_at": now})
+}
+
+// incidentDeployments lists the deployments that share an issue tracker
+// ticket with the incident, such as the change a Jira incident links to.
+func (r *Router) incidentDeployments(c *gin.Context) {
+	links, err := r.ticketRepo.IncidentDeployments(c.Request.Context(), c.Param("id")); if err != nil { respondError(c, ErrInternal, "failed to load linked deployments", nil); return }
+	respondOK(c, gin.H{"links": links, "count": len(links)})
 }
 
 func (r *Router) listState(c *gin.Context) {
 	tr := r.parseTimeRange(c)
-	if r.deploymentRepo != nil && r.incidentRepo != nil {
-		deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load deployments", nil); return }
-		incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load incidents", nil); return }
-		sort.Slice(deps, func(i, j int) bool { return deps[i].StartTime.Before(deps[j].StartTime) })
-		sort.Slice(incs, func(i, j int) bool { return incs[i].StartTime.Before(incs[j].StartTime) })
-		respondOK(c, gin.H{"deployments": deps, "incidents": incs}); return
-	}
-	r.mu.RLock(); deps := append([]metrics.Deployment(nil), r.deployments...); incs := append([]metrics.Incident(nil), r.incidents...); r.mu.RUnlock()
+	deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load deployments", nil); return }
+	incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load incidents", nil); return }
 	sort.Slice(deps, func(i, j int) bool { return deps[i].StartTime.Before(deps[j].StartTime) })
 	sort.Slice(incs, func(i, j int) bool { return incs[i].StartTime.Before(incs[j].StartTime) })
 	respondOK(c, gin.H{"deployments": deps, "incidents": incs})
@@ -347,13 +317,15 @@ func (r *Router) listState(c *gin.Context) {
 // listDeployments returns deployments only
 func (r *Router) listDeployments(c *gin.Context) {
 	tr := r.parseTimeRange(c)
-	if r.deploymentRepo != nil { deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load deployments", nil); return }; sort.Slice(deps, func(i, j int) bool { return deps[i].StartTime.Before(deps[j].StartTime) }); respondOK(c, gin.H{"deployments": deps, "count": len(deps)}); return }
-	r.mu.RLock(); deps := append([]metrics.Deployment(nil), r.deployments...); r.mu.RUnlock(); sort.Slice(deps, func(i, j int) bool { return deps[i].StartTime.Before(deps[j].StartTime) }); respondOK(c, gin.H{"deployments": deps, "count": len(deps)})
+	deps, err := r.deploymentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load deployments", nil); return }
+	sort.Slice(deps, func(i, j int) bool { return deps[i].StartTime.Before(deps[j].StartTime) })
+	respondOK(c, gin.H{"deployments": deps, "count": len(deps)})
 }
 
 // listIncidents returns incidents only
 func (r *Router) listIncidents(c *gin.Context) {
 	tr := r.parseTimeRange(c)
-	if r.incidentRepo != nil { incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load incidents", nil); return }; sort.Slice(incs, func(i, j int) bool { return incs[i].StartTime.Before(incs[j].StartTime) }); respondOK(c, gin.H{"incidents": incs, "count": len(incs)}); return }
-	r.mu.RLock(); incs := append([]metrics.Incident(nil), r.incidents...); r.mu.RUnlock(); sort.Slice(incs, func(i, j int) bool { return incs[i].StartTime.Before(incs[j].StartTime) }); respondOK(c, gin.H{"incidents": incs, "count": len(incs)})
+	incs, err := r.incidentRepo.ListRange(c.Request.Context(), tr.Start, tr.End); if err != nil { respondError(c, ErrInternal, "failed to load incidents", nil); return }
+	sort.Slice(incs, func(i, j int) bool { return incs[i].StartTime.Before(incs[j].StartTime) })
+	respondOK(c, gin.H{"incidents": incs, "count": len(incs)})
 }
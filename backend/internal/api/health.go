@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// dependencyCheckTimeout bounds each individual dependency probe.
+const dependencyCheckTimeout = 2 * time.Second
+
+// Dependency check states reported by the health endpoints.
+const (
+	checkHealthy       = "healthy"
+	checkUnhealthy     = "unhealthy"
+	checkNotConfigured = "not_configured"
+)
+
+// dependencyCheck is the outcome of probing a single dependency.
+type dependencyCheck struct {
+	Status    string  `json:"status"`
+	Required  bool    `json:"required"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// failing reports whether the check should fail readiness.
+func (d dependencyCheck) failing() bool {
+	return d.Required && d.Status != checkHealthy
+}
+
+func (r *Router) checkDatabase(ctx context.Context) dependencyCheck {
+	if r.db == nil {
+		return dependencyCheck{Status: checkNotConfigured, Required: r.opts.RequireDatabase}
+	}
+	return probe(ctx, r.opts.RequireDatabase, r.db.Health)
+}
+
+func (r *Router) checkRedis(ctx context.Context) dependencyCheck {
+	if r.redis == nil {
+		return dependencyCheck{Status: checkNotConfigured, Required: r.opts.RequireRedis}
+	}
+	return probe(ctx, r.opts.RequireRedis, r.redis.Health)
+}
+
+// probe runs fn under dependencyCheckTimeout and records its latency.
+func probe(ctx context.Context, required bool, fn func(context.Context) error) dependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := fn(ctx)
+	check := dependencyCheck{Status: checkHealthy, Required: required, LatencyMS: milliseconds(time.Since(start))}
+	if err != nil {
+		check.Status = checkUnhealthy
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func milliseconds(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+// Health check handlers
+func (r *Router) healthCheck(c *gin.Context) {
+	ctx := c.Request.Context()
+	checks := map[string]dependencyCheck{
+		"database": r.checkDatabase(ctx),
+		"redis":    r.checkRedis(ctx),
+	}
+	status, code := checkHealthy, http.StatusOK
+	for _, chk := range checks {
+		switch {
+		case chk.failing():
+			status, code = checkUnhealthy, http.StatusServiceUnavailable
+		case chk.Status == checkUnhealthy && status == checkHealthy:
+			status = "degraded"
+		}
+	}
+	response := gin.H{
+		"status":    status,
+		"timestamp": time.Now().UTC(),
+		"version":   "0.1.0",
+		"checks":    checks,
+	}
+
+	r.logger.Info("Health check requested", zap.String("status", status))
+	c.JSON(code, response)
+}
+
+func (r *Router) databaseHealth(c *gin.Context) {
+	chk := r.checkDatabase(c.Request.Context())
+	response := gin.H{
+		"status":    chk.Status,
+		"timestamp": time.Now().UTC(),
+	}
+	if r.db == nil {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	stats := r.db.Stats()
+	response["latency"] = time.Duration(chk.LatencyMS * float64(time.Millisecond)).String()
+	response["latency_ms"] = chk.LatencyMS
+	response["connections"] = stats.OpenConnections
+	response["pool"] = gin.H{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     milliseconds(stats.WaitDuration),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+	}
+	if chk.Status != checkHealthy {
+		response["error"] = chk.Error
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (r *Router) redisHealth(c *gin.Context) {
+	ctx := c.Request.Context()
+	chk := r.checkRedis(ctx)
+	response := gin.H{
+		"status":    chk.Status,
+		"timestamp": time.Now().UTC(),
+	}
+	if r.redis == nil {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	response["latency"] = time.Duration(chk.LatencyMS * float64(time.Millisecond)).String()
+	response["latency_ms"] = chk.LatencyMS
+	if chk.Status != checkHealthy {
+		response["error"] = chk.Error
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	infoCtx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+	info, err := r.redis.Info(infoCtx, "server", "clients", "memory", "stats")
+	if err != nil {
+		r.logger.Warn("Redis INFO failed", zap.Error(err))
+		response["info_error"] = err.Error()
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	response["version"] = info["redis_version"]
+	response["memory_usage"] = info["used_memory_human"]
+	response["connected_clients"] = atoi(info["connected_clients"])
+	response["uptime_seconds"] = atoi(info["uptime_in_seconds"])
+	hits, misses := atoi(info["keyspace_hits"]), atoi(info["keyspace_misses"])
+	response["keyspace_hits"] = hits
+	response["keyspace_misses"] = misses
+	if total := hits + misses; total > 0 {
+		response["hit_rate"] = float64(hits) / float64(total)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// livez reports whether the process is able to serve HTTP at all. It never
+// touches dependencies so a flaky database does not trigger pod restarts.
+func (r *Router) livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive", "timestamp": time.Now().UTC()})
+}
+
+// readyz reports whether the pod should receive traffic: required
+// dependencies must be reachable and all migrations applied.
+func (r *Router) readyz(c *gin.Context) {
+	ctx := c.Request.Context()
+	checks := gin.H{}
+	ready := true
+	for name, chk := range map[string]dependencyCheck{
+		"database": r.checkDatabase(ctx),
+		"redis":    r.checkRedis(ctx),
+	} {
+		checks[name] = chk
+		if chk.failing() {
+			ready = false
+		}
+	}
+	if mig := r.checkMigrations(ctx); mig != nil {
+		checks["migrations"] = mig
+		if mig["status"] != checkHealthy {
+			ready = false
+		}
+	}
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "timestamp": time.Now().UTC(), "checks": checks})
+}
+
+// checkMigrations reports pending migrations; nil when the check does not
+// apply. Once everything is applied the result is cached since migrations
+// only run at startup.
+func (r *Router) checkMigrations(ctx context.Context) gin.H {
+	if r.pendingMigrations == nil {
+		return nil
+	}
+	if r.migrationsApplied.Load() {
+		return gin.H{"status": checkHealthy}
+	}
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+	pending, err := r.pendingMigrations(ctx)
+	if err != nil {
+		return gin.H{"status": checkUnhealthy, "error": err.Error()}
+	}
+	if len(pending) > 0 {
+		return gin.H{"status": checkUnhealthy, "pending": pending}
+	}
+	r.migrationsApplied.Store(true)
+	return gin.H{"status": checkHealthy}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func probeStatus(t *testing.T, engine *gin.Engine, path string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body
+}
+
+func TestProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name       string
+		opts       Options
+		path       string
+		wantStatus int
+		wantState  string
+	}{
+		{"livez always alive", Options{RequireDatabase: true}, "/livez", http.StatusOK, "alive"},
+		{"ready without required deps", Options{}, "/readyz", http.StatusOK, "ready"},
+		{"required database missing", Options{RequireDatabase: true}, "/readyz", http.StatusServiceUnavailable, "not_ready"},
+		{"required redis missing", Options{RequireRedis: true}, "/readyz", http.StatusServiceUnavailable, "not_ready"},
+		{"health healthy when optional deps absent", Options{}, "/api/v1/health", http.StatusOK, "healthy"},
+		{"health unhealthy when required dep absent", Options{RequireDatabase: true}, "/api/v1/health", http.StatusServiceUnavailable, "unhealthy"},
+		{"database health not configured", Options{}, "/api/v1/health/database", http.StatusServiceUnavailable, "not_configured"},
+	}
+	for _, tc := range cases {
+		engine := NewRouter(zap.NewNop(), nil, nil, tc.opts)
+		status, body := probeStatus(t, engine, tc.path)
+		if status != tc.wantStatus {
+			t.Errorf("%s: status got=%d want=%d body=%v", tc.name, status, tc.wantStatus, body)
+		}
+		if body["status"] != tc.wantState {
+			t.Errorf("%s: state got=%v want=%s", tc.name, body["status"], tc.wantState)
+		}
+	}
+}
+
+func TestReadyzReportsPendingMigrations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name       string
+		pending    []string
+		err        error
+		wantStatus int
+	}{
+		{"all applied", nil, nil, http.StatusOK},
+		{"pending migrations", []string{"0009_plugin_instances", "0010_ticket_links"}, nil, http.StatusServiceUnavailable},
+		{"check fails", nil, errors.New("connection refused"), http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		r := &Router{logger: zap.NewNop(), pendingMigrations: func(context.Context) ([]string, error) { return tc.pending, tc.err }}
+		engine := gin.New()
+		engine.GET("/readyz", r.readyz)
+		status, body := probeStatus(t, engine, "/readyz")
+		if status != tc.wantStatus {
+			t.Errorf("%s: status got=%d want=%d body=%v", tc.name, status, tc.wantStatus, body)
+		}
+		checks, _ := body["checks"].(map[string]any)
+		mig, _ := checks["migrations"].(map[string]any)
+		if pending, _ := mig["pending"].([]any); len(pending) != len(tc.pending) {
+			t.Errorf("%s: migrations check = %v", tc.name, mig)
+		}
+	}
+}
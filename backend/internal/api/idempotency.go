@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	idempotencyTTL    = 24 * time.Hour
+	// idempotencyLeaseMargin is added to the request timeout to lease a key
+	// while its request runs, so a crashed request frees it soon
+	idempotencyLeaseMargin = 30 * time.Second
+	maxIdempotencyKeyLen   = 255
+)
+
+// capturingWriter tees the response body so it can be stored for replay.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware makes a POST safe to retry: the first response for an
+// Idempotency-Key is stored for idempotencyTTL and replayed verbatim for later
+// requests carrying the same key and body. Server errors are not stored so the
+// client can retry them. While the request runs, the key is only leased for
+// its timeout plus a margin, so a request that never completes (a crash or a
+// panic) does not hold the key for idempotencyTTL.
+func (r *Router) idempotencyMiddleware(timeout time.Duration) gin.HandlerFunc {
+	lease := timeout + idempotencyLeaseMargin
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			respondError(c, ErrValidation, "Idempotency-Key too long", gin.H{"max_length": maxIdempotencyKeyLen})
+			c.Abort()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, ErrValidation, "unreadable request body", nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		scoped := c.Request.Method + " " + c.FullPath() + " " + key
+
+		stored, err := r.idempotency.Reserve(c.Request.Context(), scoped, lease)
+		switch {
+		case errors.Is(err, storage.ErrIdempotencyInFlight):
+			respondError(c, ErrConflict, "a request with this Idempotency-Key is still in progress", nil)
+			c.Abort()
+			return
+		case err != nil:
+			r.logger.Error("Idempotency store unavailable", zap.Error(err))
+			respondError(c, ErrInternal, "idempotency store unavailable", nil)
+			c.Abort()
+			return
+		case stored != nil:
+			if stored.Fingerprint != fingerprint {
+				respondError(c, ErrConflict, "Idempotency-Key was already used with a different request body", nil)
+			} else {
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(stored.Status, stored.ContentType, stored.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		w := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// The request context may already be cancelled; persist on a fresh one.
+		ctx, cancel := context.WithTimeout(context.Background(), dependencyCheckTimeout)
+		defer cancel()
+		if w.Status() >= http.StatusInternalServerError {
+			if err := r.idempotency.Release(ctx, scoped); err != nil {
+				r.logger.Warn("Failed to release idempotency key", zap.Error(err))
+			}
+			return
+		}
+		resp := storage.IdempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.body.Bytes(),
+		}
+		if err := r.idempotency.Complete(ctx, scoped, resp, idempotencyTTL); err != nil {
+			r.logger.Warn("Failed to store idempotent response", zap.Error(err))
+		}
+	}
+}
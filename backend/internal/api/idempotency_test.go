@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func send(engine *gin.Engine, method, path, key, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotencyHeader, key)
+	}
+	engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyKeyReplaysResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	body := `{"service":"api","environment":"prod","status":"success"}`
+
+	first := send(engine, http.MethodPost, "/api/v1/deployments", "retry-1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request: status %d body=%s", first.Code, first.Body.String())
+	}
+	second := send(engine, http.MethodPost, "/api/v1/deployments", "retry-1", body)
+	if second.Code != http.StatusCreated || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("replay: status %d headers=%v", second.Code, second.Header())
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("replayed body differs:\n%s\n%s", first.Body.String(), second.Body.String())
+	}
+
+	mismatch := send(engine, http.MethodPost, "/api/v1/deployments", "retry-1", `{"service":"web","environment":"prod","status":"success"}`)
+	if mismatch.Code != http.StatusConflict {
+		t.Errorf("reused key with new body: status %d want 409", mismatch.Code)
+	}
+
+	// Same key on a different route is independent.
+	inc := send(engine, http.MethodPost, "/api/v1/incidents", "retry-1", `{"title":"x","service":"api","environment":"prod","severity":"low"}`)
+	if inc.Code != http.StatusCreated {
+		t.Errorf("incident with same key: status %d", inc.Code)
+	}
+
+	list := send(engine, http.MethodGet, "/api/v1/deployments", "", "")
+	var out struct {
+		Data struct {
+			Count int `json:"count"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(list.Body.Bytes(), &out)
+	if out.Data.Count != 1 {
+		t.Errorf("expected exactly one stored deployment, got %d", out.Data.Count)
+	}
+}
+
+func TestDuplicateIDIsConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	body := `{"id":"dep-1","service":"api","environment":"prod","status":"success"}`
+	if rec := send(engine, http.MethodPost, "/api/v1/deployments", "", body); rec.Code != http.StatusCreated {
+		t.Fatalf("first create: %d", rec.Code)
+	}
+	if rec := send(engine, http.MethodPost, "/api/v1/deployments", "", body); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate create: status %d want 409", rec.Code)
+	}
+}
+
+func TestUpsertDeploymentByNaturalKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	decode := func(rec *httptest.ResponseRecorder) (string, string) {
+		var out struct {
+			Data struct {
+				Deployment struct {
+					ID     string `json:"id"`
+					Status string `json:"status"`
+				} `json:"deployment"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return out.Data.Deployment.ID, out.Data.Deployment.Status
+	}
+
+	running := send(engine, http.MethodPut, "/api/v1/deployments", "", `{"repository":"org/api","commit_sha":"abc","service":"api","environment":"prod","status":"running","started_at":"2024-05-01T10:00:00Z"}`)
+	if running.Code != http.StatusCreated {
+		t.Fatalf("initial upsert: status %d body=%s", running.Code, running.Body.String())
+	}
+	// A status-only update keeps the stored start and commit times
+	done := send(engine, http.MethodPut, "/api/v1/deployments", "", `{"repository":"org/api","commit_sha":"abc","service":"api","environment":"prod","status":"success","ended_at":"2024-05-01T10:05:00Z"}`)
+	if done.Code != http.StatusOK {
+		t.Fatalf("second upsert: status %d body=%s", done.Code, done.Body.String())
+	}
+	firstID, _ := decode(running)
+	secondID, status := decode(done)
+	if firstID != secondID || status != "success" {
+		t.Errorf("upsert did not update in place: ids %s/%s status %s", firstID, secondID, status)
+	}
+	var times struct {
+		Data struct {
+			Deployment struct {
+				StartTime  time.Time `json:"start_time"`
+				CommitTime time.Time `json:"commit_time"`
+			} `json:"deployment"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(done.Body.Bytes(), &times)
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if dep := times.Data.Deployment; !dep.StartTime.Equal(started) || !dep.CommitTime.Equal(started) {
+		t.Errorf("status-only upsert moved times: start %v commit %v, want %v", dep.StartTime, dep.CommitTime, started)
+	}
+
+	if rec := send(engine, http.MethodPut, "/api/v1/deployments", "", `{"service":"api","environment":"prod","status":"success"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("upsert without natural key: status %d want 400", rec.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/collector"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("unexpected openapi version %q", doc.OpenAPI)
+	}
+	return doc
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	doc := loadSpec(t)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	for _, rt := range engine.Routes() {
+		if rt.Method == "HEAD" || strings.HasPrefix(rt.Path, "/static/") {
+			continue
+		}
+		paths := []string{ginParam.ReplaceAllString(rt.Path, "{$1}")}
+		if rt.Path == "/api/v1/:method" { // custom methods are documented individually
+			paths = paths[:0]
+			for m := range customMethods(&Router{}) {
+				paths = append(paths, "/api/v1/"+m)
+			}
+		}
+		if rt.Path == "/api/v1/admin/:method" {
+			paths = paths[:0]
+			for m := range adminMethods(&Router{}) {
+				paths = append(paths, "/api/v1/admin/"+m)
+			}
+		}
+		if rt.Path == "/api/v1/admin/plugins/:name" && rt.Method == "POST" {
+			paths = paths[:0]
+			for m := range pluginMethods(&Router{}) {
+				paths = append(paths, "/api/v1/admin/plugins/{name}:"+m)
+			}
+		}
+		for _, path := range paths {
+			ops, ok := doc.Paths[path]
+			if !ok {
+				t.Errorf("route %s %s missing from openapi.json (expected path %q)", rt.Method, rt.Path, path)
+				continue
+			}
+			if _, ok := ops[strings.ToLower(rt.Method)]; !ok {
+				t.Errorf("route %s %s missing operation in openapi.json", rt.Method, path)
+			}
+		}
+	}
+}
+
+// TestOpenAPISchemasMatchStructs keeps documented bodies in sync with the Go types.
+func TestOpenAPISchemasMatchStructs(t *testing.T) {
+	doc := loadSpec(t)
+	for name, v := range map[string]any{
+		"DeploymentRequest":     deploymentRequest{},
+		"IncidentRequest":       incidentRequest{},
+		"ErrorPayload":          errorPayload{},
+		"DependencyCheck":       dependencyCheck{},
+		"FieldError":            fieldError{},
+		"BatchResult":           batchResult{},
+		"WebhookStored":         webhooks.Result{},
+		"WebhookMapping":        webhookMappingView{},
+		"MappingConfig":         webhooks.MappingConfig{},
+		"MappingRule":           webhooks.MappingRule{},
+		"MappingStatusCase":     webhooks.StatusCase{},
+		"MappingCondition":      webhooks.Condition{},
+		"DryRunRequest":         dryRunRequest{},
+		"WebhookInboxItem":      webhookInboxView{},
+		"WebhookSecret":         webhookSecretView{},
+		"RotateSecretRequest":   rotateSecretRequest{},
+		"CollectorHealth":       collector.Health{},
+		"PluginType":            pluginTypeView{},
+		"PluginInstance":        pluginInstanceView{},
+		"PluginInstanceRequest": pluginInstanceRequest{},
+		"WASMTransform":         wasmTransformView{},
+		"WASMTransformConfig":   webhooks.WASMTransformConfig{},
+		"WASMTransformRequest":  wasmTransformRequest{},
+		"WASMDryRunRequest":     wasmDryRunRequest{},
+		"BreakerState":          resilience.State{},
+		"TicketLink":            metrics.TicketLink{},
+	} {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s missing", name)
+			continue
+		}
+		typ := reflect.TypeOf(v)
+		fields := map[string]bool{}
+		for i := 0; i < typ.NumField(); i++ {
+			tag, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			fields[tag] = true
+			if _, ok := schema.Properties[tag]; !ok {
+				t.Errorf("schema %s missing property %q", name, tag)
+			}
+		}
+		for prop := range schema.Properties {
+			if !fields[prop] {
+				t.Errorf("schema %s documents unknown property %q", name, prop)
+			}
+		}
+	}
+}
+
+func TestAPIDocsServeBundledSwaggerUI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	page := get("/api/v1/docs").Body.String()
+	if strings.Contains(page, "https://") {
+		t.Errorf("docs page loads remote assets:\n%s", page)
+	}
+	assets := regexp.MustCompile(`(?:src|href)="([^"?]+)`).FindAllStringSubmatch(page, -1)
+	if len(assets) != 2 {
+		t.Fatalf("assets = %v", assets)
+	}
+	for _, m := range assets {
+		rec := get(m[1])
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/") {
+			t.Errorf("GET %s: %d %q (%d bytes)", m[1], rec.Code, rec.Header().Get("Content-Type"), rec.Body.Len())
+		}
+	}
+	for _, path := range []string{"/api/v1/docs/assets/index.html", "/api/v1/docs/assets/..%2fopenapi.json"} {
+		if rec := get(path); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: %d, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+// pluginNamePattern restricts instance names to URL- and log-safe slugs.
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// maxPluginInterval bounds interval_seconds (one day).
+const maxPluginInterval = 24 * 60 * 60
+
+// pluginMethods are the custom methods served under /admin/plugins/:name.
+func pluginMethods(r *Router) map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"enable":  r.enablePluginInstance,
+		"disable": r.disablePluginInstance,
+	}
+}
+
+// pluginTypeView describes a plugin type instances can be created from.
+type pluginTypeView struct {
+	Type         string          `json:"type"`
+	Description  string          `json:"description"`
+	Version      string          `json:"version"`
+	ConfigSchema json.RawMessage `json:"config_schema,omitempty"`
+}
+
+// pluginInstanceRequest creates or updates an instance. Credentials are
+// never part of Config: SecretRef (env:NAME or file:PATH) names where they
+// are read from, and the plugin receives them as the "secret" field.
+type pluginInstanceRequest struct {
+	Name            string          `json:"name"`
+	Type            string          `json:"type"`
+	Config          json.RawMessage `json:"config"`
+	SecretRef       string          `json:"secret_ref"`
+	Enabled         *bool           `json:"enabled"`
+	IntervalSeconds int             `json:"interval_seconds"`
+}
+
+// pluginInstanceView is a stored instance with its runtime state.
+type pluginInstanceView struct {
+	Name                string          `json:"name"`
+	Type                string          `json:"type"`
+	Version             string          `json:"version,omitempty"`
+	Config              json.RawMessage `json:"config"`
+	SecretRef           string          `json:"secret_ref,omitempty"`
+	Enabled             bool            `json:"enabled"`
+	IntervalSeconds     int             `json:"interval_seconds,omitempty"`
+	Running             bool            `json:"running"`
+	NextRunAt           *time.Time      `json:"next_run_at,omitempty"`
+	LastSyncAt          *time.Time      `json:"last_sync_at,omitempty"`
+	LastError           string          `json:"last_error,omitempty"`
+	SuccessCount        int64           `json:"success_count"`
+	FailureCount        int64           `json:"failure_count"`
+	ConsecutiveFailures int             `json:"consecutive_failures"`
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+}
+
+func (r *Router) instanceView(inst storage.PluginInstance) pluginInstanceView {
+	v := pluginInstanceView{
+		Name:                inst.Name,
+		Type:                inst.Type,
+		Config:              inst.Config,
+		SecretRef:           inst.SecretRef,
+		Enabled:             inst.Enabled,
+		IntervalSeconds:     inst.IntervalSeconds,
+		LastSyncAt:          inst.LastSyncAt,
+		LastError:           inst.LastError,
+		SuccessCount:        inst.SuccessCount,
+		FailureCount:        inst.FailureCount,
+		ConsecutiveFailures: inst.ConsecutiveFailures,
+		CreatedAt:           inst.CreatedAt,
+		UpdatedAt:           inst.UpdatedAt,
+	}
+	if p, ok := r.plugins.Get(inst.Name); ok {
+		v.Running, v.Version = r.plugins.Initialized(inst.Name), p.Version()
+	}
+	if next, ok := r.scheduler.NextRun(inst.Name); ok {
+		v.NextRunAt = &next
+	}
+	return v
+}
+
+func (r *Router) listPluginTypes(c *gin.Context) {
+	views := make([]pluginTypeView, 0, len(r.opts.PluginTypes))
+	for typ, factory := range r.opts.PluginTypes {
+		p := factory(typ)
+		views = append(views, pluginTypeView{Type: typ, Description: p.Description(), Version: p.Version(), ConfigSchema: p.ConfigSchema()})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Type < views[j].Type })
+	respondOK(c, views)
+}
+
+func (r *Router) listPluginInstances(c *gin.Context) {
+	instances, err := r.instanceRepo.List(c.Request.Context())
+	if err != nil {
+		r.logger.Error("list plugin instances failed", zap.Error(err))
+		respondError(c, ErrInternal, "failed to list plugins", nil)
+		return
+	}
+	views := make([]pluginInstanceView, 0, len(instances))
+	for _, inst := range instances {
+		views = append(views, r.instanceView(inst))
+	}
+	respondOK(c, views)
+}
+
+// loadInstance returns the :name instance, writing the error response itself
+// when there is none.
+func (r *Router) loadInstance(c *gin.Context) (*storage.PluginInstance, bool) {
+	name := c.Param("name")
+	inst, err := r.instanceRepo.Get(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "plugin not found", gin.H{"name": name})
+		return nil, false
+	}
+	if err != nil {
+		r.logger.Error("load plugin instance failed", zap.String("plugin", name), zap.Error(err))
+		respondError(c, ErrInternal, "failed to load plugin", nil)
+		return nil, false
+	}
+	return inst, true
+}
+
+func (r *Router) getPluginInstance(c *gin.Context) {
+	if inst, ok := r.loadInstance(c); ok {
+		respondOK(c, r.instanceView(*inst))
+	}
+}
+
+// decodeInstance reads a request and checks it against the plugin type:
+// the configuration must pass the plugin's Validate with its secret.
+func (r *Router) decodeInstance(c *gin.Context) (*pluginInstanceRequest, bool) {
+	var req pluginInstanceRequest
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxMappingBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		respondError(c, ErrValidation, "body must be {name, type, config?, secret_ref?, enabled?, interval_seconds?}", gin.H{"reason": err.Error()})
+		return nil, false
+	}
+	var fields []fieldError
+	if req.IntervalSeconds < 0 || req.IntervalSeconds > maxPluginInterval {
+		fields = append(fields, fieldError{Field: "interval_seconds", Message: "must be between 0 (default interval) and 86400"})
+	}
+	if cfg := bytes.TrimSpace(req.Config); len(cfg) > 0 {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(cfg, &obj); err != nil {
+			fields = append(fields, fieldError{Field: "config", Message: "must be an object"})
+		} else if _, ok := obj[plugins.SecretField]; ok {
+			fields = append(fields, fieldError{Field: "config.secret", Message: "credentials must be referenced with secret_ref"})
+		}
+	}
+	factory, ok := r.opts.PluginTypes[req.Type]
+	if !ok {
+		fields = append(fields, fieldError{Field: "type", Message: "unknown plugin type; available: " + strings.Join(r.pluginTypeNames(), ", ")})
+	}
+	if len(fields) > 0 {
+		respondError(c, ErrValidation, "invalid plugin", fields)
+		return nil, false
+	}
+	config, err := plugins.WithSecret(req.Config, req.SecretRef)
+	if err == nil {
+		err = factory(req.Name).Validate(config)
+	}
+	if err != nil {
+		respondError(c, ErrValidation, "invalid plugin configuration", gin.H{"reason": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+func (r *Router) pluginTypeNames() []string {
+	names := make([]string, 0, len(r.opts.PluginTypes))
+	for typ := range r.opts.PluginTypes {
+		names = append(names, typ)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createPluginInstance stores an instance and, when enabled, starts it. An
+// instance that fails to start is kept, with the failure as its last error.
+func (r *Router) createPluginInstance(c *gin.Context) {
+	req, ok := r.decodeInstance(c)
+	if !ok {
+		return
+	}
+	if !pluginNamePattern.MatchString(req.Name) {
+		respondError(c, ErrValidation, "invalid plugin", []fieldError{{Field: "name", Message: "must match " + pluginNamePattern.String()}})
+		return
+	}
+	if _, ok := r.webhooks.Get(req.Name); ok {
+		respondError(c, ErrConflict, "name is taken by a webhook plugin", gin.H{"name": req.Name})
+		return
+	}
+	inst := &storage.PluginInstance{
+		Name:            req.Name,
+		Type:            req.Type,
+		Config:          req.Config,
+		SecretRef:       req.SecretRef,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+		IntervalSeconds: req.IntervalSeconds,
+	}
+	r.pluginMu.Lock()
+	defer r.pluginMu.Unlock()
+	ctx := c.Request.Context()
+	err := storage.ErrConflict
+	if _, running := r.plugins.Get(inst.Name); !running {
+		err = r.instanceRepo.Create(ctx, inst)
+	}
+	if errors.Is(err, storage.ErrConflict) {
+		respondError(c, ErrConflict, "plugin already exists", gin.H{"name": req.Name})
+		return
+	}
+	if err != nil {
+		r.logger.Error("store plugin instance failed", zap.String("plugin", req.Name), zap.Error(err))
+		respondError(c, ErrInternal, "failed to store plugin", nil)
+		return
+	}
+	r.audit.Info("plugin created", zap.String("plugin", inst.Name), zap.String("type", inst.Type), zap.Bool("enabled", inst.Enabled), zap.String("request_id", requestIDFromContext(c)))
+	if inst.Enabled && !r.startInstance(ctx, *inst) {
+		if fresh, err := r.instanceRepo.Get(ctx, inst.Name); err == nil {
+			inst = fresh
+		}
+	}
+	respondCreated(c, r.instanceView(*inst))
+}
+
+// updatePluginInstance replaces an instance's configuration and restarts it.
+func (r *Router) updatePluginInstance(c *gin.Context) {
+	cur, ok := r.loadInstance(c)
+	if !ok {
+		return
+	}
+	req, ok := r.decodeInstance(c)
+	if !ok {
+		return
+	}
+	if req.Name != "" && req.Name != cur.Name || req.Type != cur.Type {
+		respondError(c, ErrValidation, "name and type cannot change; create a new plugin instead", gin.H{"name": cur.Name, "type": cur.Type})
+		return
+	}
+	cur.Config, cur.SecretRef, cur.IntervalSeconds = req.Config, req.SecretRef, req.IntervalSeconds
+	if req.Enabled != nil {
+		cur.Enabled = *req.Enabled
+	}
+	r.applyInstance(c, cur, "plugin updated")
+}
+
+func (r *Router) enablePluginInstance(c *gin.Context)  { r.setPluginEnabled(c, true) }
+func (r *Router) disablePluginInstance(c *gin.Context) { r.setPluginEnabled(c, false) }
+
+func (r *Router) setPluginEnabled(c *gin.Context, enabled bool) {
+	inst, ok := r.loadInstance(c)
+	if !ok {
+		return
+	}
+	inst.Enabled = enabled
+	msg := "plugin disabled"
+	if enabled {
+		msg = "plugin enabled"
+	}
+	r.applyInstance(c, inst, msg)
+}
+
+// applyInstance stores the instance and restarts or stops it to match.
+func (r *Router) applyInstance(c *gin.Context, inst *storage.PluginInstance, msg string) {
+	r.pluginMu.Lock()
+	defer r.pluginMu.Unlock()
+	ctx := c.Request.Context()
+	err := r.instanceRepo.Update(ctx, inst)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "plugin not found", gin.H{"name": inst.Name})
+		return
+	}
+	if err != nil {
+		r.logger.Error("update plugin instance failed", zap.String("plugin", inst.Name), zap.Error(err))
+		respondError(c, ErrInternal, "failed to store plugin", nil)
+		return
+	}
+	r.audit.Info(msg, zap.String("plugin", inst.Name), zap.String("type", inst.Type), zap.Bool("enabled", inst.Enabled), zap.String("request_id", requestIDFromContext(c)))
+	r.stopInstance(ctx, inst.Name)
+	if inst.Enabled && !r.startInstance(ctx, *inst) {
+		if fresh, err := r.instanceRepo.Get(ctx, inst.Name); err == nil {
+			inst = fresh
+		}
+	}
+	respondOK(c, r.instanceView(*inst))
+}
+
+// pluginCustomMethod serves POST /admin/plugins/{name}:{method}.
+func (r *Router) pluginCustomMethod(c *gin.Context) {
+	name, method, ok := strings.Cut(c.Param("name"), ":")
+	h, known := pluginMethods(r)[method]
+	if !ok || !known {
+		respondError(c, ErrNotFound, "endpoint not found", nil)
+		return
+	}
+	for i := range c.Params {
+		if c.Params[i].Key == "name" {
+			c.Params[i].Value = name
+		}
+	}
+	h(c)
+}
+
+func (r *Router) deletePluginInstance(c *gin.Context) {
+	name := c.Param("name")
+	r.pluginMu.Lock()
+	defer r.pluginMu.Unlock()
+	err := r.instanceRepo.Delete(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "plugin not found", gin.H{"name": name})
+		return
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to delete plugin", nil)
+		return
+	}
+	r.stopInstance(c.Request.Context(), name)
+	// A plugin created again under the name must not resume from this one's
+	// cursor or report its runs
+	if err := r.scheduler.Remove(c.Request.Context(), name); err != nil {
+		r.logger.Warn("deleting plugin state failed", zap.String("plugin", name), zap.Error(err))
+	}
+	r.audit.Info("plugin deleted", zap.String("plugin", name), zap.String("request_id", requestIDFromContext(c)))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/collector"
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// feed is a plugin type requiring a service and a secret; it reports one
+// incident per cycle.
+type feed struct {
+	name      string
+	cycles    *atomic.Int32
+	shutdowns *atomic.Int32
+	cfg       struct {
+		Service string `json:"service"`
+		Secret  string `json:"secret"`
+	}
+}
+
+func (f *feed) Name() string                  { return f.name }
+func (f *feed) Description() string           { return "Test feed" }
+func (f *feed) Version() string               { return "0.3.0" }
+func (f *feed) ConfigSchema() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (f *feed) HealthCheck(context.Context) error {
+	return nil
+}
+
+func (f *feed) Validate(config json.RawMessage) error {
+	var cfg struct {
+		Service string `json:"service"`
+		Secret  string `json:"secret"`
+	}
+	if err := plugins.DecodeConfig(config, &cfg); err != nil {
+		return err
+	}
+	if cfg.Service == "" || cfg.Secret == "" {
+		return fmt.Errorf("%w: service and secret are required", plugins.ErrInvalidConfig)
+	}
+	return nil
+}
+
+func (f *feed) Initialize(_ context.Context, config json.RawMessage) error {
+	return plugins.DecodeConfig(config, &f.cfg)
+}
+
+func (f *feed) Collect(context.Context, plugins.Cursor) (*plugins.Batch, error) {
+	n := f.cycles.Add(1)
+	return &plugins.Batch{Incidents: []metrics.Incident{{ID: fmt.Sprintf("%s-%d", f.name, n), Title: "t", Service: f.cfg.Service, StartTime: time.Now()}}}, nil
+}
+
+func (f *feed) Shutdown(context.Context) error { f.shutdowns.Add(1); return nil }
+
+func TestPluginInstances(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("FEED_TOKEN", "s3cret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cycles, shutdowns atomic.Int32
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{
+		InsecureAdmin: true,
+		PluginTypes: map[string]plugins.Factory{
+			"feed": func(name string) plugins.Plugin { return &feed{name: name, cycles: &cycles, shutdowns: &shutdowns} },
+		},
+		Collector:  collector.Config{Interval: 10 * time.Millisecond, PollInterval: time.Millisecond},
+		Background: ctx,
+	})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	instance := func(rec *httptest.ResponseRecorder, want int) pluginInstanceView {
+		t.Helper()
+		var out struct {
+			Data pluginInstanceView `json:"data"`
+		}
+		if rec.Code != want || json.Unmarshal(rec.Body.Bytes(), &out) != nil {
+			t.Fatalf("status %d want %d body=%s", rec.Code, want, rec.Body.String())
+		}
+		return out.Data
+	}
+
+	if body := do(http.MethodGet, "/api/v1/admin/plugin-types", "").Body.String(); !strings.Contains(body, `"type":"feed"`) || !strings.Contains(body, `"config_schema"`) {
+		t.Errorf("plugin types = %s", body)
+	}
+	for _, bad := range []string{
+		`{"name": "ops", "type": "feed", "config": {"service": "api", "secret": "inline"}}`,
+		`{"name": "ops", "type": "ftp", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN"}`,
+		`{"name": "ops", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:MISSING_TOKEN"}`,
+		`{"name": "ops", "type": "feed", "config": {}, "secret_ref": "env:FEED_TOKEN"}`,
+		`{"name": "Ops!", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN"}`,
+		`{"name": "ops", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN", "interval_seconds": -1}`,
+	} {
+		if rec := do(http.MethodPost, "/api/v1/admin/plugins", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status %d body=%s", bad, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Created instances start collecting at once
+	created := instance(do(http.MethodPost, "/api/v1/admin/plugins", `{"name": "ops", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN"}`), http.StatusCreated)
+	if !created.Running || !created.Enabled || created.Version != "0.3.0" || strings.Contains(string(created.Config), "s3cret") {
+		t.Errorf("created = %+v", created)
+	}
+	if rec := do(http.MethodPost, "/api/v1/admin/plugins", `{"name": "ops", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate create: status %d", rec.Code)
+	}
+	var got pluginInstanceView
+	for deadline := time.Now().Add(2 * time.Second); got.SuccessCount < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("instance did not sync: %+v", got)
+		}
+		got = instance(do(http.MethodGet, "/api/v1/admin/plugins/ops", ""), http.StatusOK)
+	}
+	if got.LastSyncAt == nil || got.LastError != "" || got.ConsecutiveFailures != 0 {
+		t.Errorf("synced instance = %+v", got)
+	}
+	if body := do(http.MethodGet, "/api/v1/plugins", "").Body.String(); !strings.Contains(body, `"id":"ops"`) || !strings.Contains(body, `"status":"healthy"`) {
+		t.Errorf("plugins = %s", body)
+	}
+
+	// Disabling stops the instance after its running cycle
+	disabled := instance(do(http.MethodPost, "/api/v1/admin/plugins/ops:disable", ""), http.StatusOK)
+	if disabled.Enabled || disabled.Running || shutdowns.Load() != 1 {
+		t.Errorf("disabled = %+v, shutdowns %d", disabled, shutdowns.Load())
+	}
+	stopped := cycles.Load()
+	time.Sleep(30 * time.Millisecond)
+	if n := cycles.Load(); n != stopped {
+		t.Errorf("disabled instance ran %d more cycles", n-stopped)
+	}
+	if body := do(http.MethodGet, "/api/v1/plugins/ops/health", "").Body.String(); !strings.Contains(body, `"status":"disabled"`) {
+		t.Errorf("disabled health = %s", body)
+	}
+	if rec := do(http.MethodPost, "/api/v1/admin/plugins/ops:restart", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown method: status %d", rec.Code)
+	}
+	if enabled := instance(do(http.MethodPost, "/api/v1/admin/plugins/ops:enable", ""), http.StatusOK); !enabled.Running {
+		t.Errorf("enabled = %+v", enabled)
+	}
+
+	// Updates restart the instance with the new configuration
+	t.Setenv("OTHER_TOKEN", "x")
+	updated := instance(do(http.MethodPut, "/api/v1/admin/plugins/ops", `{"type": "feed", "config": {"service": "web"}, "secret_ref": "env:OTHER_TOKEN", "interval_seconds": 60}`), http.StatusOK)
+	if !updated.Running || updated.IntervalSeconds != 60 || string(updated.Config) != `{"service":"web"}` {
+		t.Errorf("updated = %+v", updated)
+	}
+	if rec := do(http.MethodPut, "/api/v1/admin/plugins/ops", `{"type": "other", "config": {"service": "web"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("type change: status %d", rec.Code)
+	}
+	// A restart that fails keeps the instance, reporting why
+	t.Setenv("OTHER_TOKEN", "")
+	failed := instance(do(http.MethodPost, "/api/v1/admin/plugins/ops:enable", ""), http.StatusOK)
+	if failed.Running || !strings.HasPrefix(failed.LastError, "start: ") || failed.ConsecutiveFailures != 1 {
+		t.Errorf("failed start = %+v", failed)
+	}
+	if body := do(http.MethodGet, "/api/v1/plugins/ops/health", "").Body.String(); !strings.Contains(body, `"status":"failing"`) {
+		t.Errorf("failed health = %s", body)
+	}
+
+	if rec := do(http.MethodDelete, "/api/v1/admin/plugins/ops", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/plugins/ops/health", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted health: status %d", rec.Code)
+	}
+}
+
+// unready is a feed whose first Initialize fails, as when its upstream is
+// not reachable yet at startup.
+type unready struct {
+	*feed
+	attempts *atomic.Int32
+}
+
+func (u unready) Initialize(ctx context.Context, config json.RawMessage) error {
+	if u.attempts.Add(1) == 1 {
+		return fmt.Errorf("dial upstream: connection refused")
+	}
+	return u.feed.Initialize(ctx, config)
+}
+
+func TestPluginInstanceRetriesInitialization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("FEED_TOKEN", "s3cret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cycles, shutdowns, attempts atomic.Int32
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{
+		InsecureAdmin: true,
+		PluginTypes: map[string]plugins.Factory{
+			"feed": func(name string) plugins.Plugin {
+				return unready{feed: &feed{name: name, cycles: &cycles, shutdowns: &shutdowns}, attempts: &attempts}
+			},
+		},
+		Collector:  collector.Config{Interval: 10 * time.Millisecond, PollInterval: time.Millisecond},
+		Background: ctx,
+	})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/v1/admin/plugins", `{"name": "ops", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN"}`)
+	var created struct {
+		Data pluginInstanceView `json:"data"`
+	}
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &created) != nil {
+		t.Fatalf("create: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	if created.Data.Running || !strings.Contains(created.Data.LastError, "connection refused") {
+		t.Errorf("created = %+v, want the initialization error", created.Data)
+	}
+	// The next cycles initialize it and collect
+	for deadline := time.Now().Add(2 * time.Second); cycles.Load() < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("instance was not retried: %d attempts, %d cycles", attempts.Load(), cycles.Load())
+		}
+	}
+	if body := do(http.MethodGet, "/api/v1/plugins/ops/health", "").Body.String(); !strings.Contains(body, `"status":"healthy"`) {
+		t.Errorf("health = %s", body)
+	}
+}
+
+// paged is a feed that pages through its source by cursor.
+type paged struct {
+	*feed
+	seen chan plugins.Cursor
+}
+
+func (p paged) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	p.seen <- since
+	batch, err := p.feed.Collect(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	batch.Cursor = since + "x"
+	return batch, nil
+}
+
+func TestDeletedPluginInstanceStateIsNotReused(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("FEED_TOKEN", "s3cret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cycles, shutdowns atomic.Int32
+	seen := make(chan plugins.Cursor, 100)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{
+		InsecureAdmin: true,
+		PluginTypes: map[string]plugins.Factory{
+			"feed": func(name string) plugins.Plugin {
+				return paged{feed: &feed{name: name, cycles: &cycles, shutdowns: &shutdowns}, seen: seen}
+			},
+		},
+		Collector:  collector.Config{Interval: 10 * time.Millisecond, PollInterval: time.Millisecond},
+		Background: ctx,
+	})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	next := func() plugins.Cursor {
+		t.Helper()
+		select {
+		case cursor := <-seen:
+			return cursor
+		case <-time.After(2 * time.Second):
+			t.Fatal("no collection cycle")
+			return ""
+		}
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/admin/plugins", `{"name": "ops", "type": "feed", "config": {"service": "api"}, "secret_ref": "env:FEED_TOKEN"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	if first, second := next(), next(); first != "" || second != "x" {
+		t.Fatalf("cursors = %q, %q", first, second)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/admin/plugins/ops", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+	for len(seen) > 0 {
+		<-seen
+	}
+
+	// An instance created again under the name has no history and starts
+	// from the beginning
+	if rec := do(http.MethodPost, "/api/v1/admin/plugins", `{"name": "ops", "type": "feed", "config": {"service": "web"}, "secret_ref": "env:FEED_TOKEN", "enabled": false}`); rec.Code != http.StatusCreated {
+		t.Fatalf("re-create: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	if body := do(http.MethodGet, "/api/v1/plugins/ops/health", "").Body.String(); !strings.Contains(body, `"runs":0`) {
+		t.Errorf("re-created health = %s", body)
+	}
+	if rec := do(http.MethodPost, "/api/v1/admin/plugins/ops:enable", ""); rec.Code != http.StatusOK {
+		t.Fatalf("enable: status %d", rec.Code)
+	}
+	if cursor := next(); cursor != "" {
+		t.Errorf("re-created instance resumed from %q", cursor)
+	}
+}
@@ -1,45 +1,171 @@
 package api
 
 import (
+	"context"
 	"github.com/google/uuid"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/collector"
+	"github.com/sirhCC/MetricHub/internal/plugins"
 	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
 	"github.com/sirhCC/MetricHub/pkg/metrics"
 	"go.uber.org/zap"
 )
 
+// Options carries the tunables for NewRouter.
+type Options struct {
+	// RequestTimeout bounds each request; defaults to 5s when zero.
+	RequestTimeout time.Duration
+	// BatchTimeout bounds batch ingestion requests instead; defaults to 5m when zero.
+	BatchTimeout time.Duration
+	// MigrationsDir is checked by /readyz for unapplied migrations; empty disables the check.
+	MigrationsDir string
+	// RequireDatabase and RequireRedis make /readyz fail when the dependency is missing or unreachable.
+	RequireDatabase bool
+	RequireRedis    bool
+	// Webhooks are served under /api/v1/webhook/:plugin by adapter name.
+	Webhooks []webhooks.Adapter
+	// AdminToken is the bearer token for /api/v1/admin. When empty the admin
+	// API is closed, unless InsecureAdmin opens it (development only).
+	AdminToken    string
+	InsecureAdmin bool
+	// RequireSignatures refuses deliveries for plugins without a configured
+	// or managed secret (production) instead of accepting them unverified.
+	RequireSignatures bool
+	// Inbox tunes the workers that process stored webhook deliveries; they
+	// stop when Background is cancelled (defaults to context.Background()).
+	Inbox      webhooks.InboxConfig
+	Background context.Context
+	// Stopped, when set, counts the goroutines that shut down after
+	// Background is cancelled, such as the collector plugins (which stop
+	// external plugin processes); wait on it before exiting.
+	Stopped *sync.WaitGroup
+	// Collectors are collector plugins run by the scheduler, tuned by
+	// Collector, until Background is cancelled.
+	Collectors []collector.Job
+	Collector  collector.Config
+	// PluginTypes are the collector plugin types instances can be created
+	// from through /api/v1/admin/plugins, by type name.
+	PluginTypes map[string]plugins.Factory
+	// WASM bounds every call of a WebAssembly webhook transform.
+	WASM webhooks.WASMLimits
+}
+
 // Router holds the dependencies for API handlers
 type Router struct {
 	logger *zap.Logger
+	// audit records security-relevant events: rejected deliveries and
+	// secret changes
+	audit  *zap.Logger
 	db     *storage.Database
 	redis  *storage.Redis
-	mu     sync.RWMutex
+	opts   Options
+	// migrationsApplied caches a successful readiness migration check
+	migrationsApplied atomic.Bool
+	// pendingMigrations lists unapplied migrations; nil when readiness
+	// does not check them
+	pendingMigrations func(context.Context) ([]string, error)
+	// Repositories are Postgres-backed when a database is configured and
+	// in-memory otherwise (development mode).
 	deploymentRepo storage.DeploymentRepository
 	incidentRepo   storage.IncidentRepository
-	// In-memory development stores
-	deployments []metrics.Deployment
-	incidents   []metrics.Incident
-	calculator  *metrics.DORACalculator
+	commitRepo     storage.CommitRepository
+	ticketRepo     storage.TicketLinkRepository
+	mappingRepo    storage.WebhookMappingRepository
+	secretRepo     storage.WebhookSecretRepository
+	inbox          storage.WebhookInbox
+	pluginState    storage.PluginStateRepository
+	instanceRepo   storage.PluginInstanceRepository
+	wasmRepo       storage.WASMTransformRepository
+	idempotency    storage.IdempotencyStore
+	webhooks       *webhooks.Registry
+	processor      *webhooks.Processor
+	inboxWorker    *webhooks.InboxWorker
+	inboxOnce      sync.Once
+	// wasm runs WebAssembly transforms; it is created on first use
+	wasm           *webhooks.WASMRuntime
+	wasmErr        error
+	wasmOnce       sync.Once
+	plugins        *plugins.Manager
+	scheduler      *collector.Scheduler
+	collectorsOnce sync.Once
+	// pluginMu serializes plugin instance changes with their start and stop
+	pluginMu       sync.Mutex
+	calculator     *metrics.DORACalculator
 }
 
 // NewRouter creates a new API router with all dependencies
-func NewRouter(logger *zap.Logger, db *storage.Database, redis *storage.Redis, requestTimeout time.Duration) *gin.Engine {
+func NewRouter(logger *zap.Logger, db *storage.Database, redis *storage.Redis, opts Options) *gin.Engine {
 	r := &Router{
 		logger:     logger,
+		audit:      logger.Named("audit"),
 		db:         db,
 		redis:      redis,
+		opts:       opts,
 		calculator: metrics.NewDORACalculator(),
 	}
 	if db != nil {
 		sqlDB := db.GetDB()
 		r.deploymentRepo = storage.NewPostgresDeploymentRepo(sqlDB)
 		r.incidentRepo = storage.NewPostgresIncidentRepo(sqlDB)
+		r.commitRepo = storage.NewPostgresCommitRepo(sqlDB)
+		r.ticketRepo = storage.NewPostgresTicketLinkRepo(sqlDB)
+		r.mappingRepo = storage.NewPostgresWebhookMappingRepo(sqlDB)
+		r.secretRepo = storage.NewPostgresWebhookSecretRepo(sqlDB)
+		r.inbox = storage.NewPostgresWebhookInbox(sqlDB)
+		r.pluginState = storage.NewPostgresPluginStateRepo(sqlDB)
+		r.instanceRepo = storage.NewPostgresPluginInstanceRepo(sqlDB)
+		r.wasmRepo = storage.NewPostgresWASMTransformRepo(sqlDB)
+		if opts.MigrationsDir != "" {
+			r.pendingMigrations = func(ctx context.Context) ([]string, error) { return storage.PendingMigrations(ctx, sqlDB, opts.MigrationsDir) }
+		}
+	} else {
+		r.deploymentRepo = storage.NewMemoryDeploymentRepo()
+		r.incidentRepo = storage.NewMemoryIncidentRepo()
+		r.commitRepo = storage.NewMemoryCommitRepo()
+		r.ticketRepo = storage.NewMemoryTicketLinkRepo()
+		r.mappingRepo = storage.NewMemoryWebhookMappingRepo()
+		r.secretRepo = storage.NewMemoryWebhookSecretRepo()
+		r.inbox = storage.NewMemoryWebhookInbox()
+		r.pluginState = storage.NewMemoryPluginStateRepo()
+		r.instanceRepo = storage.NewMemoryPluginInstanceRepo()
+		r.wasmRepo = storage.NewMemoryWASMTransformRepo()
+	}
+	if redis != nil {
+		r.idempotency = storage.NewRedisIdempotencyStore(redis)
+	} else {
+		r.idempotency = storage.NewMemoryIdempotencyStore()
+	}
+
+	r.webhooks = webhooks.NewRegistry(opts.Webhooks...)
+	r.processor = &webhooks.Processor{Deployments: r.deploymentRepo, Incidents: r.incidentRepo, Commits: r.commitRepo, Tickets: r.ticketRepo}
+	if r.opts.Background == nil {
+		r.opts.Background = context.Background()
+	}
+	r.inboxWorker = webhooks.NewInboxWorker(r.inbox, r.resolveAdapter, r.processor, opts.Inbox, logger)
+	if db != nil {
+		// A persistent inbox may hold deliveries from before a restart
+		r.startInboxWorker()
+	}
+	r.plugins = plugins.NewManager(r.processor, logger)
+	r.scheduler = collector.NewScheduler(r.plugins, syncRecorder{r.pluginState, r.instanceRepo}, opts.Collector, logger)
+	for _, job := range opts.Collectors {
+		if err := r.scheduler.Add(job); err != nil {
+			logger.Error("collector plugin rejected", zap.String("plugin", job.Plugin.Name()), zap.Error(err))
+		}
+	}
+	if len(opts.Collectors) > 0 {
+		r.startCollectors()
 	}
+	r.loadPluginInstances(r.opts.Background)
+
+	registerValidators()
 
 	// Create Gin router
 	router := gin.New()
@@ -49,16 +175,23 @@ func NewRouter(logger *zap.Logger, db *storage.Database, redis *storage.Redis, r
 	router.Use(r.requestIDMiddleware())
 	router.Use(r.loggingMiddleware())
 	// Use default timeout of 5s (configurable via REQUEST_TIMEOUT_SECONDS env read by config; fallback here)
+	requestTimeout := opts.RequestTimeout
 	if requestTimeout <= 0 { requestTimeout = 5 * time.Second }
-	router.Use(r.timeoutMiddleware(requestTimeout))
+	batchTimeout := opts.BatchTimeout
+	if batchTimeout <= 0 { batchTimeout = 5 * time.Minute }
+	router.Use(r.timeoutMiddleware(requestTimeout, batchTimeout))
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:5174", "http://localhost:5175"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", idempotencyHeader},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
+	// Kubernetes probes
+	router.GET("/livez", r.livez)
+	router.GET("/readyz", r.readyz)
+
 	// API routes
 	api := router.Group("/api/v1")
 	{
@@ -77,23 +210,70 @@ func NewRouter(logger *zap.Logger, db *storage.Database, redis *storage.Redis, r
 			metricsGroup.GET("/dora/change-failure-rate", r.getChangeFailureRate)
 		}
 
-		// Plugin endpoints (placeholder for now)
+		// Plugins: webhook adapters and collector plugins, with collector health
 		plugins := api.Group("/plugins")
 		{
 			plugins.GET("", r.listPlugins)
 			plugins.GET("/:name/health", r.pluginHealth)
 		}
 
-		// Webhook endpoints (placeholder for now)
+		// Webhook endpoints (see webhook.go); generic sources are admin-mapped
+		// and wasm sources are admin-uploaded transforms
 		api.POST("/webhook/:plugin", r.handleWebhook)
+		api.POST("/webhook/:plugin/:source", r.handleWebhook)
 
-		// Ingestion (in-memory dev only) + listing
-		api.POST("/deployments", r.createDeployment)
+		// Admin endpoints (see admin.go)
+		admin := api.Group("/admin", r.adminAuth())
+		{
+			admin.GET("/webhook-mappings", r.listWebhookMappings)
+			admin.GET("/webhook-mappings/:source", r.getWebhookMapping)
+			admin.PUT("/webhook-mappings/:source", r.putWebhookMapping)
+			admin.DELETE("/webhook-mappings/:source", r.deleteWebhookMapping)
+			admin.GET("/webhook-mappings/:source/secrets", r.listWebhookSecrets)
+			admin.POST("/webhook-mappings/:source/secrets", r.rotateWebhookSecret)
+			admin.DELETE("/webhook-mappings/:source/secrets/:id", r.revokeWebhookSecret)
+			admin.GET("/webhook-secrets/:plugin", r.listWebhookSecrets)
+			admin.POST("/webhook-secrets/:plugin", r.rotateWebhookSecret)
+			admin.DELETE("/webhook-secrets/:plugin/:id", r.revokeWebhookSecret)
+			admin.GET("/wasm-transforms", r.listWASMTransforms)
+			admin.GET("/wasm-transforms/:transform", r.getWASMTransform)
+			admin.PUT("/wasm-transforms/:transform", r.putWASMTransform)
+			admin.DELETE("/wasm-transforms/:transform", r.deleteWASMTransform)
+			admin.GET("/wasm-transforms/:transform/secrets", r.listWebhookSecrets)
+			admin.POST("/wasm-transforms/:transform/secrets", r.rotateWebhookSecret)
+			admin.DELETE("/wasm-transforms/:transform/secrets/:id", r.revokeWebhookSecret)
+			admin.GET("/webhook-inbox", r.listWebhookInbox)
+			admin.GET("/webhook-inbox/:id", r.getWebhookInboxItem)
+			admin.POST("/webhook-inbox/:id/replay", r.replayWebhookInboxItem)
+			admin.GET("/plugin-types", r.listPluginTypes)
+			admin.GET("/plugins", r.listPluginInstances)
+			admin.POST("/plugins", r.createPluginInstance)
+			admin.GET("/plugins/:name", r.getPluginInstance)
+			admin.PUT("/plugins/:name", r.updatePluginInstance)
+			admin.DELETE("/plugins/:name", r.deletePluginInstance)
+			// POST /plugins/{name}:enable and /plugins/{name}:disable
+			admin.POST("/plugins/:name", r.pluginCustomMethod)
+			admin.POST("/:method", r.dispatchCustomMethod(adminMethods(r)))
+		}
+
+		// Ingestion + listing
+		idempotent := r.idempotencyMiddleware(requestTimeout)
+		api.POST("/deployments", idempotent, r.createDeployment)
+		api.PUT("/deployments", r.upsertDeployment)
 		api.GET("/deployments", r.listDeployments)
-		api.POST("/incidents", r.createIncident)
+		api.POST("/incidents", idempotent, r.createIncident)
 		api.GET("/incidents", r.listIncidents)
 		api.POST("/incidents/:id/resolve", r.resolveIncident)
+		api.GET("/incidents/:id/deployments", r.incidentDeployments)
 		api.GET("/state", r.listState)
+
+		// Custom methods such as POST /deployments:batch (see batch.go)
+		api.POST("/:method", r.dispatchCustomMethod(customMethods(r)))
+
+		// API description (OpenAPI 3.1) and Swagger UI
+		api.GET("/openapi.json", r.getOpenAPISpec)
+		api.GET("/docs", r.getAPIDocs)
+		api.GET("/docs/assets/:file", r.getAPIDocsAsset)
 	}
 
 	// Serve static files and handle SPA routing
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// fieldError describes a single failed constraint, keyed by the JSON field name.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var registerValidatorsOnce sync.Once
+
+// registerValidators wires the domain enum rules into gin's shared validator
+// and makes errors report JSON field names instead of Go field names.
+func registerValidators() {
+	registerValidatorsOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		_ = v.RegisterValidation("deployment_status", func(fl validator.FieldLevel) bool {
+			return metrics.DeploymentStatus(fl.Field().String()).Valid()
+		})
+		_ = v.RegisterValidation("incident_severity", func(fl validator.FieldLevel) bool {
+			return metrics.IncidentSeverity(fl.Field().String()).Valid()
+		})
+		_ = v.RegisterValidation("not_before", notBefore)
+	})
+}
+
+// notBefore requires a time field to be at or after the sibling time field named
+// by the rule parameter. It passes when either side is unset.
+func notBefore(fl validator.FieldLevel) bool {
+	cur, ok := timeValue(fl.Field())
+	if !ok {
+		return true
+	}
+	other, ok := timeValue(fl.Parent().FieldByName(fl.Param()))
+	if !ok {
+		return true
+	}
+	return !cur.Before(other)
+}
+
+func timeValue(v reflect.Value) (time.Time, bool) {
+	if !v.IsValid() {
+		return time.Time{}, false
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return time.Time{}, false
+		}
+		v = v.Elem()
+	}
+	t, ok := v.Interface().(time.Time)
+	return t, ok && !t.IsZero()
+}
+
+// bindJSON decodes and validates the request body into dst. On failure it
+// writes a validation_error envelope (with per-field details when available)
+// and returns false.
+func bindJSON(c *gin.Context, dst interface{}) bool {
+	err := c.ShouldBindJSON(dst)
+	if err == nil {
+		return true
+	}
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		respondError(c, ErrValidation, "request validation failed", fieldErrors(verrs))
+		return false
+	}
+	respondError(c, ErrValidation, "invalid json", nil)
+	return false
+}
+
+func fieldErrors(verrs validator.ValidationErrors) []fieldError {
+	out := make([]fieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		out = append(out, fieldError{Field: fe.Field(), Rule: fe.Tag(), Message: ruleMessage(fe)})
+	}
+	return out
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "not_before":
+		return fmt.Sprintf("must not be before %s", toSnake(fe.Param()))
+	case "deployment_status":
+		return "must be one of " + joinValues(metrics.DeploymentStatuses)
+	case "incident_severity":
+		return "must be one of " + joinValues(metrics.IncidentSeverities)
+	}
+	return "failed " + fe.Tag() + " constraint"
+}
+
+// toSnake maps a Go field name used as a rule parameter (e.g. StartedAt) to its JSON name.
+func toSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func joinValues[T ~string](vals []T) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = string(v)
+	}
+	return strings.Join(parts, ", ")
+}
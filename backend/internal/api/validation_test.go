@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func postJSON(engine *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIngestionValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantFields []string
+	}{
+		{"valid deployment", "/api/v1/deployments", `{"service":"api","environment":"prod","status":"success"}`, http.StatusCreated, nil},
+		{"deployment end before start", "/api/v1/deployments", `{"service":"api","environment":"prod","status":"success","started_at":"2024-01-02T00:00:00Z","ended_at":"2024-01-01T00:00:00Z"}`, http.StatusBadRequest, []string{"ended_at"}},
+		{"deployment end without start", "/api/v1/deployments", `{"service":"api","environment":"prod","status":"success","ended_at":"2024-01-01T00:00:00Z"}`, http.StatusCreated, nil},
+		{"deployment bad status and missing fields", "/api/v1/deployments", `{"status":"done"}`, http.StatusBadRequest, []string{"status", "service", "environment"}},
+		{"deployment sha too long", "/api/v1/deployments", `{"service":"api","environment":"prod","status":"failed","commit_sha":"` + strings.Repeat("a", 65) + `"}`, http.StatusBadRequest, []string{"commit_sha"}},
+		{"valid incident", "/api/v1/incidents", `{"title":"Outage","service":"api","environment":"prod","severity":"high"}`, http.StatusCreated, nil},
+		{"incident bad severity", "/api/v1/incidents", `{"title":"Outage","service":"api","environment":"prod","severity":"sev1"}`, http.StatusBadRequest, []string{"severity"}},
+		{"incident resolved before start", "/api/v1/incidents", `{"title":"Outage","service":"api","environment":"prod","severity":"low","started_at":"2024-01-02T00:00:00Z","resolved_at":"2024-01-01T00:00:00Z"}`, http.StatusBadRequest, []string{"resolved_at"}},
+		{"malformed json", "/api/v1/incidents", `{"title":`, http.StatusBadRequest, nil},
+	}
+	for _, tc := range cases {
+		engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+		rec := postJSON(engine, tc.path, tc.body)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s: status got=%d want=%d body=%s", tc.name, rec.Code, tc.wantStatus, rec.Body.String())
+			continue
+		}
+		var body struct {
+			Data  map[string]map[string]any `json:"data"`
+			Error struct {
+				Details []fieldError `json:"details"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code == http.StatusCreated {
+			for _, obj := range body.Data {
+				if id, _ := obj["id"].(string); id == "" {
+					t.Errorf("%s: expected server-generated id, got %v", tc.name, obj)
+				}
+			}
+		}
+		got := map[string]bool{}
+		for _, d := range body.Error.Details {
+			got[d.Field] = true
+		}
+		for _, f := range tc.wantFields {
+			if !got[f] {
+				t.Errorf("%s: expected field error for %q, got %+v", tc.name, f, body.Error.Details)
+			}
+		}
+	}
+}
+
+func TestResolveIncidentStatuses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{})
+	if rec := postJSON(engine, "/api/v1/incidents", `{"id":"inc-1","title":"Outage","service":"api","environment":"prod","severity":"low"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	for _, tc := range []struct {
+		id   string
+		want int
+	}{{"inc-1", http.StatusOK}, {"inc-1", http.StatusConflict}, {"missing", http.StatusNotFound}} {
+		if rec := postJSON(engine, "/api/v1/incidents/"+tc.id+"/resolve", ``); rec.Code != tc.want {
+			t.Errorf("resolve %s: status got=%d want=%d body=%s", tc.id, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// maxWASMModuleBytes bounds uploaded modules. Requests carry them base64
+// encoded, so request bodies may be a third larger.
+const maxWASMModuleBytes = 16 << 20
+
+// wasmTransformRequest creates or replaces a transform. Module is the
+// base64-encoded binary; when omitted the stored module is kept, so
+// settings can change without uploading it again.
+type wasmTransformRequest struct {
+	Module []byte          `json:"module"`
+	Config json.RawMessage `json:"config"`
+}
+
+// wasmTransformView is a stored transform as returned by the admin API,
+// with its token redacted. The module itself is never returned.
+type wasmTransformView struct {
+	Name      string                       `json:"name"`
+	Endpoint  string                       `json:"endpoint"`
+	SHA256    string                       `json:"sha256"`
+	SizeBytes int                          `json:"size_bytes"`
+	Config    webhooks.WASMTransformConfig `json:"config"`
+	CreatedAt time.Time                    `json:"created_at"`
+	UpdatedAt time.Time                    `json:"updated_at"`
+}
+
+func transformView(t storage.WASMTransform) wasmTransformView {
+	var cfg webhooks.WASMTransformConfig
+	_ = json.Unmarshal(t.Config, &cfg)
+	if cfg.Token != "" {
+		cfg.Token = redacted
+	}
+	return wasmTransformView{
+		Name:      t.Name,
+		Endpoint:  "/api/v1/webhook/wasm/" + t.Name,
+		SHA256:    t.SHA256,
+		SizeBytes: t.Size,
+		Config:    cfg,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
+
+// wasmRuntime returns the runtime transforms run in, creating it on first
+// use; it is closed when Background is cancelled.
+func (r *Router) wasmRuntime() (*webhooks.WASMRuntime, error) {
+	r.wasmOnce.Do(func() {
+		r.wasm, r.wasmErr = webhooks.NewWASMRuntime(r.opts.Background, r.opts.WASM)
+		if r.wasmErr != nil {
+			r.logger.Error("wasm runtime unavailable", zap.Error(r.wasmErr))
+			return
+		}
+		limits := r.wasm.Limits()
+		r.logger.Info("wasm runtime started", zap.Int64("memory_bytes", limits.MemoryBytes), zap.Duration("timeout", limits.Timeout))
+		go func() {
+			<-r.opts.Background.Done()
+			_ = r.wasm.Close(context.Background())
+		}()
+	})
+	return r.wasm, r.wasmErr
+}
+
+// loadWASMTransform loads and compiles the stored transform. Transforms that
+// were deleted or no longer load are reported as unknown sources.
+func (r *Router) loadWASMTransform(ctx context.Context, name string) (*webhooks.WASMTransform, error) {
+	rt, err := r.wasmRuntime()
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.wasmRepo.Get(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, webhooks.ErrUnknownSource
+	}
+	if err != nil {
+		return nil, err
+	}
+	tr, err := rt.Load(ctx, t.Name, t.Module, t.Config)
+	if err != nil {
+		return nil, errors.Join(webhooks.ErrUnknownSource, err)
+	}
+	return tr, nil
+}
+
+// wasmAdapter is loadWASMTransform for handlers, writing the error response
+// itself when that fails.
+func (r *Router) wasmAdapter(c *gin.Context, name string) (*webhooks.WASMTransform, error) {
+	tr, err := r.loadWASMTransform(c.Request.Context(), name)
+	switch {
+	case err == nil:
+		return tr, nil
+	case errors.Is(err, webhooks.ErrInvalidTransform):
+		r.logger.Error("stored wasm transform no longer loads", zap.String("transform", name), zap.Error(err))
+		respondError(c, ErrInternal, "stored wasm transform is invalid", nil)
+	case errors.Is(err, webhooks.ErrUnknownSource):
+		respondError(c, ErrNotFound, "wasm transform not found", gin.H{"transform": name})
+	default:
+		respondError(c, ErrInternal, "failed to load wasm transform", nil)
+	}
+	return nil, err
+}
+
+// storedWASMTransform loads the stored transform, writing the error
+// response itself when there is none.
+func (r *Router) storedWASMTransform(c *gin.Context, name string) (*storage.WASMTransform, error) {
+	t, err := r.wasmRepo.Get(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "wasm transform not found", gin.H{"transform": name})
+		return nil, err
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to load wasm transform", nil)
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *Router) listWASMTransforms(c *gin.Context) {
+	stored, err := r.wasmRepo.List(c.Request.Context())
+	if err != nil {
+		r.logger.Error("list wasm transforms failed", zap.Error(err))
+		respondError(c, ErrInternal, "failed to list wasm transforms", nil)
+		return
+	}
+	views := make([]wasmTransformView, 0, len(stored))
+	for _, t := range stored {
+		views = append(views, transformView(t))
+	}
+	respondOK(c, views)
+}
+
+func (r *Router) getWASMTransform(c *gin.Context) {
+	t, err := r.storedWASMTransform(c, c.Param("transform"))
+	if err != nil {
+		return
+	}
+	respondOK(c, transformView(*t))
+}
+
+// putWASMTransform creates or replaces the transform for :transform after
+// compiling its module and checking the transform ABI, so only loadable
+// transforms are ever stored. An omitted module and a redacted token are
+// kept from the stored transform.
+func (r *Router) putWASMTransform(c *gin.Context) {
+	name := c.Param("transform")
+	var req wasmTransformRequest
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxWASMModuleBytes/3*4+maxMappingBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		respondError(c, ErrValidation, "body must be {module, config}", gin.H{"reason": err.Error(), "max_module_bytes": maxWASMModuleBytes})
+		return
+	}
+	if len(req.Module) > maxWASMModuleBytes {
+		respondError(c, ErrValidation, "module too large", gin.H{"max_module_bytes": maxWASMModuleBytes})
+		return
+	}
+	var cfg webhooks.WASMTransformConfig
+	if len(req.Config) > 0 {
+		if err := json.Unmarshal(req.Config, &cfg); err != nil {
+			respondError(c, ErrValidation, "invalid wasm transform", gin.H{"reason": err.Error()})
+			return
+		}
+	}
+	prev, err := r.wasmRepo.Get(c.Request.Context(), name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrInternal, "failed to load wasm transform", nil)
+		return
+	}
+	if len(req.Module) == 0 || cfg.Token == redacted {
+		if prev == nil {
+			respondError(c, ErrValidation, "module is required and token must not be redacted for a new transform", nil)
+			return
+		}
+		if len(req.Module) == 0 {
+			req.Module = prev.Module
+		}
+		if cfg.Token == redacted {
+			var old webhooks.WASMTransformConfig
+			_ = json.Unmarshal(prev.Config, &old)
+			cfg.Token = old.Token
+			if req.Config, err = json.Marshal(cfg); err != nil {
+				respondError(c, ErrInternal, "failed to encode wasm transform", nil)
+				return
+			}
+		}
+	}
+	if len(req.Config) == 0 {
+		req.Config = json.RawMessage(`{}`)
+	}
+
+	rt, err := r.wasmRuntime()
+	if err != nil {
+		respondError(c, ErrUnavailable, "wasm runtime unavailable", nil)
+		return
+	}
+	tr, err := rt.Load(c.Request.Context(), name, req.Module, req.Config)
+	if err != nil {
+		respondError(c, ErrValidation, "invalid wasm transform", gin.H{"reason": err.Error()})
+		return
+	}
+	t := &storage.WASMTransform{Name: name, Module: req.Module, SHA256: tr.SHA256(), Config: req.Config}
+	created, err := r.wasmRepo.Put(c.Request.Context(), t)
+	if err != nil {
+		r.logger.Error("store wasm transform failed", zap.String("transform", name), zap.Error(err))
+		respondError(c, ErrInternal, "failed to store wasm transform", nil)
+		return
+	}
+	if prev != nil && prev.SHA256 != t.SHA256 {
+		rt.Evict(c.Request.Context(), prev.SHA256)
+	}
+	r.audit.Info("wasm transform stored", zap.String("transform", name), zap.String("sha256", t.SHA256), zap.Int("size_bytes", t.Size), zap.Bool("created", created), zap.String("request_id", requestIDFromContext(c)))
+	if created {
+		respondCreated(c, transformView(*t))
+		return
+	}
+	respondOK(c, transformView(*t))
+}
+
+func (r *Router) deleteWASMTransform(c *gin.Context) {
+	name := c.Param("transform")
+	t, err := r.storedWASMTransform(c, name)
+	if err != nil {
+		return
+	}
+	err = r.wasmRepo.Delete(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "wasm transform not found", gin.H{"transform": name})
+		return
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to delete wasm transform", nil)
+		return
+	}
+	if rt, err := r.wasmRuntime(); err == nil {
+		rt.Evict(c.Request.Context(), t.SHA256)
+	}
+	r.audit.Info("wasm transform deleted", zap.String("transform", name), zap.String("request_id", requestIDFromContext(c)))
+	c.Status(http.StatusNoContent)
+}
+
+// wasmDryRunRequest runs Payload through Module (base64) with Config, or
+// through the stored transform Name when Module is omitted.
+type wasmDryRunRequest struct {
+	Name    string          `json:"name"`
+	Module  []byte          `json:"module"`
+	Config  json.RawMessage `json:"config"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// dryRunWASMTransform shows what a payload would become, and what the
+// module logged, without storing anything.
+func (r *Router) dryRunWASMTransform(c *gin.Context) {
+	var req wasmDryRunRequest
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxWASMModuleBytes/3*4+maxMappingBytes))
+	if err := dec.Decode(&req); err != nil || len(req.Payload) == 0 {
+		respondError(c, ErrValidation, "body must be {name, module?, config?, payload}", nil)
+		return
+	}
+	if req.Name == "" {
+		req.Name = "dry-run"
+	}
+	var tr *webhooks.WASMTransform
+	var err error
+	if len(req.Module) > 0 {
+		rt, rerr := r.wasmRuntime()
+		if rerr != nil {
+			respondError(c, ErrUnavailable, "wasm runtime unavailable", nil)
+			return
+		}
+		if tr, err = rt.Load(c.Request.Context(), req.Name, req.Module, req.Config); err != nil {
+			respondError(c, ErrValidation, "invalid wasm transform", gin.H{"reason": err.Error()})
+			return
+		}
+	} else if tr, err = r.wasmAdapter(c, req.Name); err != nil {
+		return
+	}
+
+	// A JSON string payload is the delivery body itself, for non-JSON sources
+	body := []byte(req.Payload)
+	var text string
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte(`"`)) && json.Unmarshal(body, &text) == nil {
+		body = []byte(text)
+	}
+	ev, logs, err := tr.Run(c.Request.Context(), body)
+	switch {
+	case errors.Is(err, webhooks.ErrUnsupportedEvent):
+		respondOK(c, gin.H{"source": tr.Name(), "ignored": true, "reason": err.Error(), "logs": logs})
+		return
+	case err != nil:
+		respondError(c, ErrValidation, "payload does not transform", gin.H{"reason": err.Error(), "logs": logs})
+		return
+	}
+	respondOK(c, gin.H{
+		"source":      tr.Name(),
+		"event":       ev.Type,
+		"delivery_id": ev.DeliveryID,
+		"ignored":     false,
+		"deployments": ev.Deployments,
+		"incidents":   ev.Incidents,
+		"logs":        logs,
+	})
+}
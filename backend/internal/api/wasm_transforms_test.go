@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// buildTransform builds the webhooks package's test transform module.
+func buildTransform(t *testing.T) []byte {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "transform.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, "../webhooks/testdata/transform")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building wasm transform: %v\n%s", err, b)
+	}
+	module, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return module
+}
+
+func TestWASMTransformLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	module := base64.StdEncoding.EncodeToString(buildTransform(t))
+	// Compiling a module takes a while under the race detector
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{AdminToken: "adm1n", RequestTimeout: time.Minute})
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec
+	}
+	admin := map[string]string{"Authorization": "Bearer adm1n"}
+	payload := `{"event": "pipeline.finished", "pipeline": {"id": 42, "app": "billing", "result": "passed"}}`
+
+	type step struct {
+		name, method, path, body string
+		header                   map[string]string
+		code                     int
+		contains                 string
+	}
+	steps := []step{
+		{"module required", http.MethodPut, "/api/v1/admin/wasm-transforms/ci", `{"config": {}}`, admin, http.StatusBadRequest, "module is required"},
+		{"not wasm", http.MethodPut, "/api/v1/admin/wasm-transforms/ci", `{"module": "aGVsbG8="}`, admin, http.StatusBadRequest, "invalid wasm transform"},
+		{"create", http.MethodPut, "/api/v1/admin/wasm-transforms/ci", `{"module": "` + module + `", "config": {"token": "t0ken"}}`, admin, http.StatusCreated, `"endpoint":"/api/v1/webhook/wasm/ci"`},
+		{"token redacted", http.MethodGet, "/api/v1/admin/wasm-transforms/ci", "", admin, http.StatusOK, `"token":"********"`},
+		{"settings only", http.MethodPut, "/api/v1/admin/wasm-transforms/ci", `{"config": {"token": "********", "description": "CI pipelines"}}`, admin, http.StatusOK, `"description":"CI pipelines"`},
+		{"listed", http.MethodGet, "/api/v1/admin/wasm-transforms", "", admin, http.StatusOK, `"name":"ci"`},
+		{"dry run", http.MethodPost, "/api/v1/admin/wasm-transforms:dry-run", `{"name": "ci", "payload": ` + payload + `}`, admin, http.StatusOK, `"id":"ci-42"`},
+		{"dry run logs", http.MethodPost, "/api/v1/admin/wasm-transforms:dry-run", `{"name": "ci", "payload": ` + payload + `}`, admin, http.StatusOK, `transforming \"pipeline.finished\"`},
+		{"dry run inline", http.MethodPost, "/api/v1/admin/wasm-transforms:dry-run", `{"module": "` + module + `", "payload": {"event": "ping"}}`, admin, http.StatusOK, `"ignored":true`},
+		{"dry run failure", http.MethodPost, "/api/v1/admin/wasm-transforms:dry-run", `{"name": "ci", "payload": {"garbage": true}}`, admin, http.StatusBadRequest, "result is not a transform result"},
+		{"delivery without token", http.MethodPost, "/api/v1/webhook/wasm/ci", payload, nil, http.StatusUnauthorized, "unauthorized"},
+		{"delivery", http.MethodPost, "/api/v1/webhook/wasm/ci", payload, map[string]string{"X-Webhook-Token": "t0ken"}, http.StatusAccepted, `"source":"wasm/ci"`},
+	}
+	run := func(steps []step) {
+		for _, st := range steps {
+			rec := do(st.method, st.path, st.body, st.header)
+			if rec.Code != st.code || !strings.Contains(rec.Body.String(), st.contains) {
+				t.Errorf("%s: status %d body=%s", st.name, rec.Code, rec.Body.String())
+			}
+		}
+	}
+	run(steps)
+
+	// Deliveries are transformed by the inbox workers
+	awaitResponse(t, engine, "/api/v1/deployments", `"id":"ci-42"`)
+
+	run([]step{
+		{"listed as plugin", http.MethodGet, "/api/v1/plugins", "", nil, http.StatusOK, `"id":"wasm/ci"`},
+		{"rotate secret", http.MethodPost, "/api/v1/admin/wasm-transforms/ci/secrets", `{"secret": "n3w-shared-secret"}`, admin, http.StatusCreated, `"plugin":"wasm/ci"`},
+		{"delivery with managed secret", http.MethodPost, "/api/v1/webhook/wasm/ci", `{"event": "x"}`, map[string]string{"X-Webhook-Token": "n3w-shared-secret"}, http.StatusAccepted, `"source":"wasm/ci"`},
+		{"delete", http.MethodDelete, "/api/v1/admin/wasm-transforms/ci", "", admin, http.StatusNoContent, ""},
+		{"gone", http.MethodPost, "/api/v1/webhook/wasm/ci", payload, map[string]string{"X-Webhook-Token": "t0ken"}, http.StatusNotFound, "not_found"},
+		{"secrets gone", http.MethodGet, "/api/v1/admin/wasm-transforms/ci/secrets", "", admin, http.StatusNotFound, "not_found"},
+	})
+}
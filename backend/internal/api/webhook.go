@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// maxWebhookBytes matches GitHub's 25 MB delivery cap.
+const maxWebhookBytes = 25 << 20
+
+// handleWebhook verifies a delivery with the adapter named by :plugin (or
+// the generic mapping or WebAssembly transform named by :source) and stores it raw in the webhook inbox,
+// where workers parse and process it with retries (see inbox.go). A
+// redelivery of a stored delivery is acknowledged without being queued again.
+// When the inbox is unreachable the delivery is refused with 503 so the
+// provider retries it instead of it being lost.
+func (r *Router) handleWebhook(c *gin.Context) {
+	adapter, ok := r.webhookAdapter(c)
+	if !ok {
+		return
+	}
+	name := adapter.Name()
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		respondError(c, ErrValidation, "webhook body too large or unreadable", gin.H{"max_bytes": maxWebhookBytes})
+		return
+	}
+	if !r.verifyDelivery(c, adapter, body) {
+		return
+	}
+
+	item := &storage.InboxItem{
+		Source:      name,
+		DeliveryKey: webhooks.DeliveryKey(c.Request.Header, body),
+		Headers:     webhooks.StoredHeaders(c.Request.Header),
+		Body:        body,
+	}
+	duplicate, err := r.inbox.Enqueue(c.Request.Context(), item)
+	if err != nil {
+		r.logger.Error("webhook inbox write failed", zap.String("plugin", name), zap.String("delivery_key", item.DeliveryKey), zap.Error(err))
+		c.Header("Retry-After", "30")
+		respondError(c, ErrUnavailable, "webhook inbox unavailable; retry the delivery", nil)
+		return
+	}
+	accepted := gin.H{"source": name, "inbox_id": item.ID, "delivery_key": item.DeliveryKey, "duplicate": duplicate, "status": item.Status}
+	if duplicate {
+		respondOK(c, accepted)
+		return
+	}
+	r.startInboxWorker()
+	r.inboxWorker.Notify()
+	c.JSON(http.StatusAccepted, gin.H{"data": accepted, "trace_id": requestIDFromContext(c)})
+}
+
+// errSignatureRequired rejects unsigned deliveries for plugins without a
+// secret when signatures are required (production).
+var errSignatureRequired = errors.New("no webhook secret configured")
+
+// verifyDelivery authenticates a delivery, writing the rejection itself.
+// Plugins with managed secrets (see webhook_secrets.go) are verified against
+// those, so a rotation keeps the previous secret valid during its grace
+// period; otherwise the adapter's configured secret applies.
+func (r *Router) verifyDelivery(c *gin.Context, adapter webhooks.Adapter, body []byte) bool {
+	name := adapter.Name()
+	managed, err := r.secretRepo.Active(c.Request.Context(), name)
+	if err != nil {
+		r.logger.Error("load webhook secrets failed", zap.String("plugin", name), zap.Error(err))
+		c.Header("Retry-After", "30")
+		respondError(c, ErrUnavailable, "webhook secrets unavailable; retry the delivery", nil)
+		return false
+	}
+	switch {
+	case len(managed) > 0:
+		secrets := make([][]byte, len(managed))
+		for i, s := range managed {
+			secrets[i] = []byte(s.Secret)
+		}
+		err = adapter.Verifier().Verify(c.Request.Header, body, secrets)
+	case adapter.Verifies():
+		err = adapter.Verify(c.Request.Header, body)
+	case r.opts.RequireSignatures:
+		err = errSignatureRequired
+	}
+	if err == nil {
+		return true
+	}
+
+	reason, message := "invalid_signature", "invalid webhook signature"
+	switch {
+	case errors.Is(err, webhooks.ErrStaleTimestamp):
+		reason, message = "stale_timestamp", "webhook signature timestamp outside tolerance"
+	case errors.Is(err, errSignatureRequired):
+		reason, message = "signature_required", "webhook secret not configured; unsigned deliveries are refused"
+	}
+	r.audit.Warn("webhook delivery rejected",
+		zap.String("plugin", name),
+		zap.String("scheme", adapter.Verifier().Scheme()),
+		zap.String("reason", reason),
+		zap.Int("managed_secrets", len(managed)),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("user_agent", c.Request.UserAgent()),
+		zap.String("request_id", requestIDFromContext(c)),
+	)
+	respondError(c, ErrUnauthorized, message, gin.H{"reason": reason})
+	return false
+}
+
+// webhookAdapter resolves the adapter for a delivery, writing the error
+// response itself when there is none.
+func (r *Router) webhookAdapter(c *gin.Context) (webhooks.Adapter, bool) {
+	name, source := c.Param("plugin"), c.Param("source")
+	if source == "" {
+		if a, ok := r.webhooks.Get(name); ok {
+			return a, true
+		}
+		respondError(c, ErrNotFound, "unknown webhook source", gin.H{"plugin": name, "available": r.webhooks.Names()})
+		return nil, false
+	}
+	switch name {
+	case "generic":
+		g, err := r.genericAdapter(c, source)
+		return g, err == nil
+	case "wasm":
+		t, err := r.wasmAdapter(c, source)
+		return t, err == nil
+	}
+	respondError(c, ErrNotFound, "endpoint not found", nil)
+	return nil, false
+}
+
+// resolveAdapter finds the adapter for an inbox source name: a registered
+// adapter, "generic/<source>" for an admin-defined mapping or "wasm/<name>"
+// for an uploaded transform.
+func (r *Router) resolveAdapter(ctx context.Context, name string) (webhooks.Adapter, error) {
+	if a, ok := r.webhooks.Get(name); ok {
+		return a, nil
+	}
+	if transform, ok := strings.CutPrefix(name, "wasm/"); ok {
+		return r.loadWASMTransform(ctx, transform)
+	}
+	source, ok := strings.CutPrefix(name, "generic/")
+	if !ok {
+		return nil, webhooks.ErrUnknownSource
+	}
+	m, err := r.mappingRepo.Get(ctx, source)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, webhooks.ErrUnknownSource
+	}
+	if err != nil {
+		return nil, err
+	}
+	g, err := webhooks.CompileMapping(m.Source, m.Config)
+	if err != nil {
+		// A mapping that no longer compiles will not until an admin fixes it
+		return nil, errors.Join(webhooks.ErrUnknownSource, err)
+	}
+	return g, nil
+}
+
+// startInboxWorker starts the inbox workers once. Without a database they
+// start on first use, so routers that never receive webhooks run no
+// background goroutines.
+func (r *Router) startInboxWorker() {
+	r.inboxOnce.Do(func() {
+		r.logger.Info("webhook inbox workers started", zap.Stringer("config", r.opts.Inbox))
+		go r.inboxWorker.Run(r.opts.Background)
+	})
+}
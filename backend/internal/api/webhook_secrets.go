@@ -0,0 +1,185 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultSecretGrace keeps the previous secret valid after a rotation
+	// long enough to update the sender.
+	defaultSecretGrace = 24 * time.Hour
+	maxSecretGrace     = 30 * 24 * time.Hour
+	minSecretLength    = 16
+)
+
+// webhookSecretView describes a managed secret without revealing it; Secret
+// is only set in the response that created it.
+type webhookSecretView struct {
+	ID          int64      `json:"id"`
+	Plugin      string     `json:"plugin"`
+	Fingerprint string     `json:"fingerprint"`
+	Active      bool       `json:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Secret      string     `json:"secret,omitempty"`
+}
+
+func secretView(s storage.WebhookSecret, now time.Time) webhookSecretView {
+	sum := sha256.Sum256([]byte(s.Secret))
+	return webhookSecretView{
+		ID:          s.ID,
+		Plugin:      s.Plugin,
+		Fingerprint: "sha256:" + hex.EncodeToString(sum[:4]),
+		Active:      s.ActiveAt(now),
+		CreatedAt:   s.CreatedAt,
+		ExpiresAt:   s.ExpiresAt,
+	}
+}
+
+// rotateSecretRequest adds a secret; an empty Secret is generated.
+// GraceSeconds (default 86400) is how long the previous secret stays valid.
+type rotateSecretRequest struct {
+	Secret       string `json:"secret"`
+	GraceSeconds *int   `json:"grace_seconds"`
+}
+
+// secretPlugin resolves the plugin instance whose secrets are managed: a
+// registered adapter (:plugin), a generic source (:source) or a WebAssembly
+// transform (:transform), writing the error response itself when there is
+// none.
+func (r *Router) secretPlugin(c *gin.Context) (string, bool) {
+	if source := c.Param("source"); source != "" {
+		if _, err := r.genericAdapter(c, source); err != nil {
+			return "", false
+		}
+		return "generic/" + source, true
+	}
+	if name := c.Param("transform"); name != "" {
+		if _, err := r.storedWASMTransform(c, name); err != nil {
+			return "", false
+		}
+		return "wasm/" + name, true
+	}
+	name := c.Param("plugin")
+	if _, ok := r.webhooks.Get(name); !ok {
+		respondError(c, ErrNotFound, "unknown webhook plugin", gin.H{"plugin": name, "available": r.webhooks.Names()})
+		return "", false
+	}
+	return name, true
+}
+
+func (r *Router) listWebhookSecrets(c *gin.Context) {
+	plugin, ok := r.secretPlugin(c)
+	if !ok {
+		return
+	}
+	secrets, err := r.secretRepo.List(c.Request.Context(), plugin)
+	if err != nil {
+		r.logger.Error("list webhook secrets failed", zap.String("plugin", plugin), zap.Error(err))
+		respondError(c, ErrInternal, "failed to list webhook secrets", nil)
+		return
+	}
+	now := time.Now()
+	views := make([]webhookSecretView, 0, len(secrets))
+	for _, s := range secrets {
+		views = append(views, secretView(s, now))
+	}
+	respondOK(c, views)
+}
+
+// rotateWebhookSecret adds a secret for the plugin. Senders can switch to it
+// while the previous secret stays valid for the grace period; older secrets
+// are expired, so at most two are active. The secret is only returned here.
+func (r *Router) rotateWebhookSecret(c *gin.Context) {
+	plugin, ok := r.secretPlugin(c)
+	if !ok {
+		return
+	}
+	var req rotateSecretRequest
+	raw, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 64<<10))
+	if err == nil && len(raw) > 0 {
+		err = json.Unmarshal(raw, &req)
+	}
+	if err != nil {
+		respondError(c, ErrValidation, "body must be {secret?, grace_seconds?}", nil)
+		return
+	}
+	grace := defaultSecretGrace
+	if req.GraceSeconds != nil {
+		grace = time.Duration(*req.GraceSeconds) * time.Second
+		if grace < 0 || grace > maxSecretGrace {
+			respondError(c, ErrValidation, "grace_seconds must be between 0 and 2592000", nil)
+			return
+		}
+	}
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			respondError(c, ErrInternal, "failed to generate secret", nil)
+			return
+		}
+		req.Secret = hex.EncodeToString(buf)
+	} else if len(req.Secret) < minSecretLength {
+		respondError(c, ErrValidation, "secret must be at least 16 characters", nil)
+		return
+	}
+
+	s, err := r.secretRepo.Rotate(c.Request.Context(), plugin, req.Secret, grace)
+	if err != nil {
+		r.logger.Error("rotate webhook secret failed", zap.String("plugin", plugin), zap.Error(err))
+		respondError(c, ErrInternal, "failed to store webhook secret", nil)
+		return
+	}
+	view := secretView(*s, time.Now())
+	r.audit.Info("webhook secret rotated",
+		zap.String("plugin", plugin),
+		zap.Int64("secret_id", s.ID),
+		zap.String("fingerprint", view.Fingerprint),
+		zap.Duration("grace", grace),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", requestIDFromContext(c)),
+	)
+	view.Secret = s.Secret
+	respondCreated(c, view)
+}
+
+// revokeWebhookSecret expires a secret immediately, e.g. after a leak.
+func (r *Router) revokeWebhookSecret(c *gin.Context) {
+	plugin, ok := r.secretPlugin(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, ErrValidation, "id must be an integer", gin.H{"id": c.Param("id")})
+		return
+	}
+	err = r.secretRepo.Revoke(c.Request.Context(), plugin, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(c, ErrNotFound, "webhook secret not found", gin.H{"plugin": plugin, "id": id})
+		return
+	}
+	if err != nil {
+		respondError(c, ErrInternal, "failed to revoke webhook secret", nil)
+		return
+	}
+	r.audit.Info("webhook secret revoked",
+		zap.String("plugin", plugin),
+		zap.Int64("secret_id", id),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", requestIDFromContext(c)),
+	)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWebhookSecretRotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	github, err := webhooks.NewGitHub(webhooks.GitHubConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	engine := NewRouter(zap.New(core), nil, nil, Options{Webhooks: []webhooks.Adapter{github}, InsecureAdmin: true, RequireSignatures: true})
+	do := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"zen":"hi"}`
+	deliveries := 0
+	deliver := func(secret string) *httptest.ResponseRecorder {
+		h := http.Header{"X-Github-Event": {"ping"}}
+		if secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(body))
+			h.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		// Distinct delivery ids so the inbox does not answer with duplicates
+		deliveries++
+		h.Set("X-GitHub-Delivery", strconv.Itoa(deliveries))
+		return do(http.MethodPost, "/api/v1/webhook/github", body, h)
+	}
+	rotate := func(req string) string {
+		rec := do(http.MethodPost, "/api/v1/admin/webhook-secrets/github", req, nil)
+		var out struct {
+			Data webhookSecretView `json:"data"`
+		}
+		if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &out) != nil || out.Data.Secret == "" {
+			t.Fatalf("rotate %s: status %d body=%s", req, rec.Code, rec.Body.String())
+		}
+		return out.Data.Secret
+	}
+
+	if rec := deliver(""); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"reason":"signature_required"`) {
+		t.Errorf("unsigned delivery: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/plugins", "", nil); !strings.Contains(rec.Body.String(), `"status":"disabled"`) {
+		t.Errorf("plugin without secret should be disabled: %s", rec.Body.String())
+	}
+
+	first := rotate(`{"secret": "first-secret-0123456789"}`)
+	if rec := deliver(first); rec.Code != http.StatusAccepted {
+		t.Errorf("first secret: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	// During the grace period both secrets verify
+	second := rotate(``)
+	for _, secret := range []string{first, second} {
+		if rec := deliver(secret); rec.Code != http.StatusAccepted {
+			t.Errorf("secret %s during rotation: status %d body=%s", secret, rec.Code, rec.Body.String())
+		}
+	}
+	// A rotation without grace retires the previous secret, and the one before it
+	third := rotate(`{"secret": "third-secret-0123456789", "grace_seconds": 0}`)
+	for secret, code := range map[string]int{first: http.StatusUnauthorized, second: http.StatusUnauthorized, third: http.StatusAccepted} {
+		if rec := deliver(secret); rec.Code != code {
+			t.Errorf("secret %s after rotation: status %d want %d", secret, rec.Code, code)
+		}
+	}
+
+	rec := do(http.MethodGet, "/api/v1/admin/webhook-secrets/github", "", nil)
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"active":true`) != 1 || strings.Contains(rec.Body.String(), third) {
+		t.Errorf("list: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/api/v1/admin/webhook-secrets/github/3", "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("revoke: status %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := deliver(third); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked secret: status %d", rec.Code)
+	}
+
+	for _, tc := range []struct {
+		name, method, path, body string
+		code                     int
+	}{
+		{"short secret", http.MethodPost, "/api/v1/admin/webhook-secrets/github", `{"secret": "short"}`, http.StatusBadRequest},
+		{"grace too long", http.MethodPost, "/api/v1/admin/webhook-secrets/github", `{"grace_seconds": 99999999}`, http.StatusBadRequest},
+		{"unknown plugin", http.MethodPost, "/api/v1/admin/webhook-secrets/nope", ``, http.StatusNotFound},
+		{"unknown mapping", http.MethodGet, "/api/v1/admin/webhook-mappings/nope/secrets", ``, http.StatusNotFound},
+		{"unknown secret", http.MethodDelete, "/api/v1/admin/webhook-secrets/github/99", ``, http.StatusNotFound},
+	} {
+		if rec := do(tc.method, tc.path, tc.body, nil); rec.Code != tc.code {
+			t.Errorf("%s: status %d want %d body=%s", tc.name, rec.Code, tc.code, rec.Body.String())
+		}
+	}
+
+	// Rejections and secret changes are audit-logged without the secrets
+	audit := logs.Filter(func(e observer.LoggedEntry) bool { return e.LoggerName == "audit" })
+	if n := audit.FilterMessage("webhook delivery rejected").Len(); n != 4 {
+		t.Errorf("audited rejections = %d want 4", n)
+	}
+	if n := audit.FilterMessage("webhook secret rotated").Len(); n != 3 {
+		t.Errorf("audited rotations = %d want 3", n)
+	}
+	for _, e := range audit.All() {
+		for _, f := range e.Context {
+			if f.String == first || f.String == second || f.String == third {
+				t.Errorf("audit entry %q leaks a secret", e.Message)
+			}
+		}
+	}
+}
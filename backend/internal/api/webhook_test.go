@@ -0,0 +1,81 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+func TestGitHubWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	github, err := webhooks.NewGitHub(webhooks.GitHubConfig{Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewRouter(zap.NewNop(), nil, nil, Options{Webhooks: []webhooks.Adapter{github}, InsecureAdmin: true})
+
+	post := func(path, event, body, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", event)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"deployment":{"id":5,"sha":"abc","ref":"main","environment":"production","created_at":"` +
+		time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + `"},"repository":{"name":"api","full_name":"acme/api"}}`
+	cases := []struct {
+		name, path, event, body, secret string
+		code                            int
+		contains                        string
+	}{
+		{"stored", "/api/v1/webhook/github", "deployment", body, "s3cret", http.StatusAccepted, `"inbox_id":1`},
+		{"bad signature", "/api/v1/webhook/github", "deployment", body, "wrong", http.StatusUnauthorized, "unauthorized"},
+		{"ignored", "/api/v1/webhook/github", "ping", `{"zen":"hi"}`, "s3cret", http.StatusAccepted, `"inbox_id":2`},
+		{"malformed", "/api/v1/webhook/github", "deployment", `{}`, "s3cret", http.StatusAccepted, `"inbox_id":3`},
+		{"unknown source", "/api/v1/webhook/nope", "deployment", body, "s3cret", http.StatusNotFound, "not_found"},
+		{"redelivery", "/api/v1/webhook/github", "deployment", body, "s3cret", http.StatusOK, `"duplicate":true`},
+	}
+	for _, tc := range cases {
+		rec := post(tc.path, tc.event, tc.body, tc.secret)
+		if rec.Code != tc.code || !strings.Contains(rec.Body.String(), tc.contains) {
+			t.Errorf("%s: status %d body=%s", tc.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	awaitResponse(t, engine, "/api/v1/admin/webhook-inbox/1", `"status":"done"`)
+	awaitResponse(t, engine, "/api/v1/admin/webhook-inbox/2", `"status":"ignored"`)
+	awaitResponse(t, engine, "/api/v1/admin/webhook-inbox/3", `"status":"dead"`)
+	awaitResponse(t, engine, "/api/v1/deployments", `"id":"gh-deploy-5"`)
+}
+
+// awaitResponse polls GET path until the body contains want, since webhook
+// deliveries are processed asynchronously.
+func awaitResponse(t *testing.T, engine http.Handler, path, want string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if strings.Contains(rec.Body.String(), want) {
+			return rec.Body.String()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET %s never contained %s: %s", path, want, rec.Body.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
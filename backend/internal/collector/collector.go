@@ -1,8 +1,6 @@
+// Package collector coordinates metric collection cycles across plugins.
 package collector
 
-// Package collector will coordinate metric collection cycles across plugins.
-// Phase 1 placeholder: defines basic interface and noop implementation.
-
 import "context"
 
 // CycleCollector defines the minimal interface for a metric collection cycle.
@@ -10,7 +8,7 @@ type CycleCollector interface {
 	Collect(ctx context.Context) error
 }
 
-// NoopCollector is a stub used until real implementations arrive.
+// NoopCollector is a stub for setups without collector plugins.
 type NoopCollector struct{}
 
 func (n *NoopCollector) Collect(ctx context.Context) error { return nil }
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+)
+
+const (
+	// healthWindow is how many recent cycles plugin health is computed from.
+	healthWindow = 20
+	// failingAfter consecutive failed cycles turns a degraded plugin failing.
+	failingAfter = 3
+)
+
+// Plugin health statuses.
+const (
+	StatusPending  = "pending"  // no cycle has run yet
+	StatusHealthy  = "healthy"  // the last cycle succeeded
+	StatusDegraded = "degraded" // the last cycle failed
+	StatusFailing  = "failing"  // the last failingAfter cycles failed
+)
+
+// Health summarizes a plugin's recent collection cycles.
+type Health struct {
+	Status              string     `json:"status"`
+	LastRunAt           *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	NextRunAt           *time.Time `json:"next_run_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// Runs, ErrorRate, AvgDurationMs and ItemsIngested cover the latest
+	// healthWindow cycles.
+	Runs          int     `json:"runs"`
+	ErrorRate     float64 `json:"error_rate"`
+	AvgDurationMs int64   `json:"avg_duration_ms"`
+	ItemsIngested int     `json:"items_ingested"`
+}
+
+// HealthFromRuns computes health from cycles ordered newest first.
+func HealthFromRuns(runs []storage.PluginRun) Health {
+	h := Health{Status: StatusPending, Runs: len(runs)}
+	if len(runs) == 0 {
+		return h
+	}
+	last := runs[0].StartedAt
+	h.LastRunAt = &last
+	var failures int
+	var total time.Duration
+	streak := true
+	for _, run := range runs {
+		total += run.Duration
+		h.ItemsIngested += run.Items
+		if run.Error == "" {
+			streak = false
+			if h.LastSuccessAt == nil {
+				at := run.StartedAt
+				h.LastSuccessAt = &at
+			}
+			continue
+		}
+		failures++
+		if streak {
+			h.ConsecutiveFailures++
+		}
+	}
+	h.LastError = runs[0].Error
+	h.ErrorRate = float64(failures) / float64(len(runs))
+	h.AvgDurationMs = (total / time.Duration(len(runs))).Milliseconds()
+	switch {
+	case h.ConsecutiveFailures >= failingAfter:
+		h.Status = StatusFailing
+	case h.ConsecutiveFailures > 0:
+		h.Status = StatusDegraded
+	default:
+		h.Status = StatusHealthy
+	}
+	return h
+}
+
+// Health reports the plugin's health from its recorded cycles.
+func (s *Scheduler) Health(ctx context.Context, name string) (Health, error) {
+	runs, err := s.state.Runs(ctx, name, healthWindow)
+	if err != nil {
+		return Health{}, err
+	}
+	h := HealthFromRuns(runs)
+	if next, ok := s.NextRun(name); ok {
+		h.NextRunAt = &next
+	}
+	return h, nil
+}
@@ -0,0 +1,298 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Config tunes the Scheduler; zero values take the defaults.
+type Config struct {
+	// Concurrency bounds how many plugins collect at once (default 4).
+	Concurrency int
+	// Interval is the time between a plugin's cycles when its Job sets none
+	// (default 15m).
+	Interval time.Duration
+	// Jitter spreads cycles by up to this fraction of the interval, so
+	// plugins scheduled together do not poll together (default 0.1).
+	Jitter float64
+	// Timeout bounds one cycle (default 5m).
+	Timeout time.Duration
+	// PollInterval bounds how long a due cycle waits to start (default 1s).
+	PollInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	if c.Interval <= 0 {
+		c.Interval = 15 * time.Minute
+	}
+	if c.Jitter <= 0 {
+		c.Jitter = 0.1
+	}
+	if c.Jitter > 1 {
+		c.Jitter = 1
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	return c
+}
+
+// Job is a collector plugin to run with its configuration. A zero Interval
+// takes the scheduler's default.
+type Job struct {
+	Plugin   plugins.Plugin
+	Config   json.RawMessage
+	Interval time.Duration
+}
+
+type schedule struct {
+	interval time.Duration
+	next     time.Time
+	running  bool
+}
+
+// Scheduler runs each scheduled plugin's collection every interval, with
+// jitter and at most Concurrency at a time. Cursors are persisted after
+// every successful cycle, so a restart resumes where the last one stopped,
+// and every cycle's outcome is recorded for plugin health.
+type Scheduler struct {
+	manager *plugins.Manager
+	state   storage.PluginStateRepository
+	cfg     Config
+	logger  *zap.Logger
+	sem     chan struct{}
+
+	mu        sync.Mutex
+	schedules map[string]*schedule
+	// cycles holds a channel per running cycle, closed when it finishes.
+	cycles map[string]chan struct{}
+}
+
+var _ CycleCollector = (*Scheduler)(nil)
+
+// NewScheduler builds a scheduler for plugins registered with manager; call
+// Schedule for each plugin and Run to start it.
+func NewScheduler(manager *plugins.Manager, state storage.PluginStateRepository, cfg Config, logger *zap.Logger) *Scheduler {
+	cfg = cfg.withDefaults()
+	return &Scheduler{
+		manager:   manager,
+		state:     state,
+		cfg:       cfg,
+		logger:    logger,
+		sem:       make(chan struct{}, cfg.Concurrency),
+		schedules: make(map[string]*schedule),
+		cycles:    make(map[string]chan struct{}),
+	}
+}
+
+// Add registers the job's plugin with the manager and schedules it.
+func (s *Scheduler) Add(job Job) error {
+	if err := s.manager.Register(job.Plugin, job.Config); err != nil {
+		return err
+	}
+	s.Schedule(job.Plugin.Name(), job.Interval)
+	return nil
+}
+
+// Schedule runs the registered plugin every interval (the default when
+// zero). The first cycle starts within the jitter window, and rescheduling
+// a plugin keeps its next cycle.
+func (s *Scheduler) Schedule(name string, interval time.Duration) {
+	if interval <= 0 {
+		interval = s.cfg.Interval
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc, ok := s.schedules[name]; ok {
+		sc.interval = interval
+		return
+	}
+	first := time.Duration(rand.Float64() * s.cfg.Jitter * float64(interval))
+	s.schedules[name] = &schedule{interval: interval, next: time.Now().Add(first)}
+}
+
+// Unschedule stops future cycles of the plugin and waits for its running
+// cycle, if any, to finish and record its outcome.
+func (s *Scheduler) Unschedule(ctx context.Context, name string) error {
+	s.mu.Lock()
+	delete(s.schedules, name)
+	done := s.cycles[name]
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Remove unschedules the plugin and deletes its cursor and cycle history, so
+// a plugin scheduled again under the name starts afresh.
+func (s *Scheduler) Remove(ctx context.Context, name string) error {
+	if err := s.Unschedule(ctx, name); err != nil {
+		return err
+	}
+	return s.state.Delete(ctx, name)
+}
+
+// Scheduled returns the scheduled plugin names in sorted order.
+func (s *Scheduler) Scheduled() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.schedules))
+	for name := range s.schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NextRun returns when the plugin's next cycle is due.
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.schedules[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	return sc.next, true
+}
+
+// due claims the plugins whose cycle is due and not already running.
+func (s *Scheduler) due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name, sc := range s.schedules {
+		if !sc.running && !sc.next.After(now) {
+			sc.running = true
+			s.cycles[name] = make(chan struct{})
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// finish schedules the plugin's next cycle one jittered interval after the
+// end of this one, so slow cycles never overlap.
+func (s *Scheduler) finish(name string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if done, ok := s.cycles[name]; ok {
+		close(done)
+		delete(s.cycles, name)
+	}
+	sc, ok := s.schedules[name]
+	if !ok {
+		return
+	}
+	sc.running = false
+	spread := (rand.Float64()*2 - 1) * s.cfg.Jitter * float64(sc.interval)
+	sc.next = now.Add(sc.interval + time.Duration(spread))
+}
+
+// Collect runs every due cycle, at most Concurrency at a time, and waits for
+// them; it returns their errors joined.
+func (s *Scheduler) Collect(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, name := range s.due(time.Now()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.cycle(ctx, name); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Run starts due cycles until ctx is cancelled, then waits for running
+// cycles to finish.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, name := range s.due(time.Now()) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = s.cycle(ctx, name)
+			}()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cycle runs one collection from the plugin's saved cursor, saves the new
+// cursor and records the outcome.
+func (s *Scheduler) cycle(ctx context.Context, name string) error {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		s.finish(name, time.Now())
+		return ctx.Err()
+	}
+	defer func() { <-s.sem }()
+
+	start := time.Now()
+	run := storage.PluginRun{Plugin: name, StartedAt: start.UTC()}
+	cursor, err := s.state.Cursor(ctx, name)
+	if err == nil {
+		cctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+		res, next, cerr := s.manager.Collect(cctx, name, plugins.Cursor(cursor))
+		cancel()
+		run.Items = res.Deployments + res.Incidents + res.Commits
+		err = cerr
+		// A failed cycle may still have stored part of its records and
+		// advanced the cursor past them
+		if string(next) != cursor {
+			err = errors.Join(err, s.state.SaveCursor(ctx, name, string(next)))
+		}
+	}
+	run.Duration = time.Since(start)
+	if err != nil {
+		run.Error = err.Error()
+		s.logger.Warn("plugin collection failed", zap.String("plugin", name), zap.Duration("duration", run.Duration), zap.Error(err))
+	} else {
+		s.logger.Info("plugin collection finished", zap.String("plugin", name), zap.Duration("duration", run.Duration), zap.Int("items", run.Items))
+	}
+	// Record the outcome even when ctx was cancelled mid-cycle (shutdown)
+	if rerr := s.state.RecordRun(context.WithoutCancel(ctx), run); rerr != nil {
+		s.logger.Warn("recording plugin run failed", zap.String("plugin", name), zap.Error(rerr))
+	}
+	s.finish(name, time.Now())
+	return err
+}
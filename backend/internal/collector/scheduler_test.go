@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// counter emits one incident per cycle, numbering them by cursor.
+type counter struct {
+	name  string
+	fail  atomic.Bool
+	block chan struct{}
+	// active tracks concurrent cycles across plugins sharing it
+	active, peak *atomic.Int32
+	mu           sync.Mutex
+	seen         []plugins.Cursor
+}
+
+func (c *counter) Name() string                                      { return c.name }
+func (c *counter) Description() string                               { return "test counter" }
+func (c *counter) Version() string                                   { return "0.1.0" }
+func (c *counter) ConfigSchema() json.RawMessage                     { return nil }
+func (c *counter) Validate(json.RawMessage) error                    { return nil }
+func (c *counter) Initialize(context.Context, json.RawMessage) error { return nil }
+func (c *counter) HealthCheck(context.Context) error                 { return nil }
+func (c *counter) Shutdown(context.Context) error                    { return nil }
+
+func (c *counter) cursors() []plugins.Cursor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]plugins.Cursor(nil), c.seen...)
+}
+
+func (c *counter) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	c.mu.Lock()
+	c.seen = append(c.seen, since)
+	c.mu.Unlock()
+	if c.active != nil {
+		n := c.active.Add(1)
+		defer c.active.Add(-1)
+		for p := c.peak.Load(); n > p && !c.peak.CompareAndSwap(p, n); p = c.peak.Load() {
+		}
+	}
+	if c.block != nil {
+		select {
+		case <-c.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if c.fail.Load() {
+		return nil, errors.New("upstream unavailable")
+	}
+	n, _ := strconv.Atoi(string(since))
+	return &plugins.Batch{
+		Incidents: []metrics.Incident{{ID: c.name + "-" + strconv.Itoa(n), Title: "t", Service: "api", StartTime: time.Now()}},
+		Cursor:    plugins.Cursor(strconv.Itoa(n + 1)),
+	}, nil
+}
+
+func newScheduler(t *testing.T, state storage.PluginStateRepository, cfg Config, ps ...*counter) *Scheduler {
+	t.Helper()
+	proc := &webhooks.Processor{Deployments: storage.NewMemoryDeploymentRepo(), Incidents: storage.NewMemoryIncidentRepo(), Commits: storage.NewMemoryCommitRepo()}
+	m := plugins.NewManager(proc, zap.NewNop())
+	s := NewScheduler(m, state, cfg, zap.NewNop())
+	for _, p := range ps {
+		if err := s.Add(Job{Plugin: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.InitializeAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// collectUntil runs cycles until cond holds, failing after a second.
+func collectUntil(t *testing.T, s *Scheduler, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		_ = s.Collect(context.Background())
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	state := storage.NewMemoryPluginStateRepo()
+	cfg := Config{Interval: time.Millisecond}
+
+	first := &counter{name: "tracker"}
+	s := newScheduler(t, state, cfg, first)
+	collectUntil(t, s, func() bool { return len(first.cursors()) == 3 })
+	if got := first.cursors(); got[0] != "" || got[1] != "1" || got[2] != "2" {
+		t.Fatalf("cursors = %q", got)
+	}
+
+	// A new scheduler over the same state resumes from the saved cursor
+	restarted := &counter{name: "tracker"}
+	s = newScheduler(t, state, cfg, restarted)
+	collectUntil(t, s, func() bool { return len(restarted.cursors()) == 1 })
+	if got := restarted.cursors()[0]; got != "3" {
+		t.Errorf("resumed from %q want 3", got)
+	}
+
+	// Failures keep the cursor and degrade health until a cycle succeeds
+	restarted.fail.Store(true)
+	collectUntil(t, s, func() bool { return len(restarted.cursors()) == 4 })
+	h, err := s.Health(ctx, "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Status != StatusFailing || h.ConsecutiveFailures != 3 || h.LastError == "" || h.NextRunAt == nil {
+		t.Errorf("health after failures = %+v", h)
+	}
+	if got := restarted.cursors()[3]; got != "4" {
+		t.Errorf("retried from %q want 4", got)
+	}
+	restarted.fail.Store(false)
+	collectUntil(t, s, func() bool { return len(restarted.cursors()) == 5 })
+	if h, _ := s.Health(ctx, "tracker"); h.Status != StatusHealthy || h.Runs != 8 || h.ItemsIngested != 5 || h.ErrorRate != 3.0/8 {
+		t.Errorf("health after recovery = %+v", h)
+	}
+	if cursor, _ := state.Cursor(ctx, "tracker"); cursor != "5" {
+		t.Errorf("saved cursor = %q", cursor)
+	}
+}
+
+func TestSchedulerRemoveDeletesState(t *testing.T) {
+	ctx := context.Background()
+	state := storage.NewMemoryPluginStateRepo()
+	p := &counter{name: "tracker", block: make(chan struct{})}
+	s := newScheduler(t, state, Config{Interval: time.Millisecond}, p)
+	if err := state.SaveCursor(ctx, "tracker", "7"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Past the first cycle's jitter window, so Collect runs it
+	time.Sleep(time.Millisecond)
+	collected := make(chan error, 1)
+	go func() { collected <- s.Collect(ctx) }()
+	for len(p.cursors()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Remove waits for the running cycle, so it cannot save state afterwards
+	removed := make(chan error, 1)
+	go func() { removed <- s.Remove(ctx, "tracker") }()
+	select {
+	case err := <-removed:
+		t.Fatalf("Remove returned %v during a running cycle", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(p.block)
+	if err := <-collected; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-removed; err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Scheduled(); len(got) != 0 {
+		t.Errorf("scheduled = %q", got)
+	}
+	if cursor, _ := state.Cursor(ctx, "tracker"); cursor != "" {
+		t.Errorf("cursor after Remove = %q", cursor)
+	}
+	if runs, _ := state.Runs(ctx, "tracker", 10); len(runs) != 0 {
+		t.Errorf("runs after Remove = %+v", runs)
+	}
+}
+
+func TestSchedulerBoundsConcurrency(t *testing.T) {
+	var active, peak atomic.Int32
+	block := make(chan struct{})
+	var ps []*counter
+	for i := 0; i < 4; i++ {
+		ps = append(ps, &counter{name: "p" + strconv.Itoa(i), block: block, active: &active, peak: &peak})
+	}
+	s := newScheduler(t, storage.NewMemoryPluginStateRepo(), Config{Concurrency: 2, Interval: time.Hour, PollInterval: time.Millisecond}, ps...)
+	for _, p := range ps {
+		// Start now rather than within the jitter window
+		s.schedules[p.Name()].next = time.Now()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	// Two cycles run while the others wait for a slot
+	for deadline := time.Now().Add(time.Second); active.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		block <- struct{}{}
+	}
+	cancel()
+	<-done
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak concurrency = %d want 2", p)
+	}
+	for _, p := range ps {
+		if n := len(p.cursors()); n != 1 {
+			t.Errorf("%s ran %d cycles want 1 per hour", p.Name(), n)
+		}
+		if next, ok := s.NextRun(p.Name()); !ok || time.Until(next) < 50*time.Minute {
+			t.Errorf("%s next run %s", p.Name(), next)
+		}
+	}
+}
+
+func TestHealthFromRuns(t *testing.T) {
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	run := func(min int, err string) storage.PluginRun {
+		return storage.PluginRun{StartedAt: at.Add(time.Duration(min) * time.Minute), Duration: time.Second, Items: 1, Error: err}
+	}
+	if h := HealthFromRuns(nil); h.Status != StatusPending || h.LastRunAt != nil {
+		t.Errorf("no runs: %+v", h)
+	}
+	h := HealthFromRuns([]storage.PluginRun{run(3, "timeout"), run(2, ""), run(1, "timeout")})
+	if h.Status != StatusDegraded || h.ConsecutiveFailures != 1 || !h.LastSuccessAt.Equal(at.Add(2*time.Minute)) || h.AvgDurationMs != 1000 {
+		t.Errorf("degraded: %+v", h)
+	}
+}
@@ -0,0 +1,191 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// samplePlugin is cmd/sample-plugin, built once for the package's tests.
+var samplePlugin string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "sample-plugin")
+	if err != nil {
+		panic(err)
+	}
+	samplePlugin = filepath.Join(dir, "sample-plugin")
+	if out, err := exec.Command("go", "build", "-o", samplePlugin, "../../../cmd/sample-plugin").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building sample plugin: %v\n%s", err, out)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func start(t *testing.T, p *Plugin, config string) {
+	t.Helper()
+	if err := p.Initialize(context.Background(), json.RawMessage(config)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	ctx := context.Background()
+	core, logs := observer.New(zap.InfoLevel)
+	p := New("synthetic", Config{Path: samplePlugin}, zap.New(core))
+
+	if p.Version() != "1.0.0" || !strings.Contains(string(p.ConfigSchema()), `"per_cycle"`) {
+		t.Errorf("metadata: version %q schema %s", p.Version(), p.ConfigSchema())
+	}
+	if err := p.Validate(json.RawMessage(`{"per_cycle": 2}`)); !errors.Is(err, plugins.ErrInvalidConfig) || !strings.Contains(err.Error(), "service is required") {
+		t.Errorf("Validate(invalid) = %v", err)
+	}
+	if err := p.Validate(json.RawMessage(`{"service": "api"}`)); err != nil {
+		t.Errorf("Validate = %v", err)
+	}
+	if _, err := p.Collect(ctx, ""); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Collect before Initialize = %v", err)
+	}
+
+	start(t, p, `{"service": "api", "per_cycle": 2}`)
+	if err := p.HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck = %v", err)
+	}
+	var cursor plugins.Cursor
+	for _, want := range []string{"sample-api-0", "sample-api-2"} {
+		batch, err := p.Collect(ctx, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch.Deployments) != 2 || batch.Deployments[0].ID != want {
+			t.Fatalf("Collect(%q) = %+v", cursor, batch)
+		}
+		cursor = batch.Cursor
+	}
+	if cursor != "4" {
+		t.Errorf("cursor = %q", cursor)
+	}
+	// The plugin's stderr is logged
+	if got := logs.FilterMessage("plugin stderr").FilterField(zap.String("plugin", "synthetic")); got.Len() == 0 || !strings.Contains(got.All()[0].ContextMap()["line"].(string), "for api") {
+		t.Errorf("stderr not logged: %v", logs.All())
+	}
+
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-proc.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process did not exit after Shutdown")
+	}
+	if _, err := p.Collect(ctx, ""); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Collect after Shutdown = %v", err)
+	}
+}
+
+func TestPluginRestartsAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	p := New("crashy", Config{Path: samplePlugin, MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}, zap.NewNop())
+	start(t, p, `{"service": "web"}`)
+
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+	if err := proc.cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Restarts() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("plugin was not restarted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// The new process got the same configuration
+	batch, err := p.Collect(ctx, "7")
+	if err != nil || len(batch.Deployments) != 1 || batch.Deployments[0].ID != "sample-web-7" {
+		t.Fatalf("Collect after restart = %+v, %v", batch, err)
+	}
+}
+
+func TestPluginCallDeadline(t *testing.T) {
+	p := New("slow", Config{Path: samplePlugin, CollectTimeout: 50 * time.Millisecond}, zap.NewNop())
+	start(t, p, `{"service": "api", "delay_ms": 2000}`)
+	began := time.Now()
+	if _, err := p.Collect(context.Background(), ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Collect = %v want deadline exceeded", err)
+	}
+	if d := time.Since(began); d > time.Second {
+		t.Errorf("Collect returned after %s", d)
+	}
+	// The deadline ends the call, not the plugin
+	if err := p.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck = %v", err)
+	}
+}
+
+func TestPluginHandshakeFailures(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	for name, script := range map[string]string{
+		"exits":        "echo starting >&2; exit 3",
+		"not a plugin": "echo hello; exec sleep 10",
+		"old protocol": "echo 'METRICHUB_PLUGIN|0|tcp|127.0.0.1:1'; exec sleep 10",
+		"silent":       "exec sleep 10",
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := New("broken", Config{Path: sh, Args: []string{"-c", script}, StartTimeout: 200 * time.Millisecond}, zap.NewNop())
+			if err := p.Initialize(context.Background(), nil); err == nil {
+				t.Error("Initialize succeeded")
+			}
+		})
+	}
+}
+
+// links collects ticket links only.
+type links struct{ plugins.Plugin }
+
+func (links) Collect(context.Context, plugins.Cursor) (*plugins.Batch, error) {
+	return &plugins.Batch{TicketLinks: []metrics.TicketLink{{Ticket: "SHOP-1", DeploymentID: "d1"}, {Ticket: "SHOP-1", IncidentID: "i1"}}, Cursor: "1"}, nil
+}
+
+func TestCollectResponseCarriesTicketLinks(t *testing.T) {
+	resp, err := (&collectorServer{plugin: links{}}).collect(context.Background(), &collectRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := jsonCodec{}.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got collectResponse
+	if err := (jsonCodec{}).Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.TicketLinks) != 2 || got.TicketLinks[1].IncidentID != "i1" || got.Cursor != "1" {
+		t.Errorf("response = %s", b)
+	}
+	if n := (&plugins.Batch{TicketLinks: got.TicketLinks}).Len(); n != 2 {
+		t.Errorf("Len = %d, want ticket links counted", n)
+	}
+}
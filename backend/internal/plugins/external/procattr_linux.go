@@ -0,0 +1,13 @@
+package external
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// stopWithHost has the kernel send the plugin process SIGTERM when the
+// host dies without calling Shutdown, such as when it is killed. Serve
+// handles it like an interrupt.
+func stopWithHost(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package external
+
+import "os/exec"
+
+// stopWithHost is a no-op outside Linux, which has no parent death signal:
+// plugin processes are stopped by Shutdown only, and outlive a host that
+// is killed.
+func stopWithHost(*exec.Cmd) {}
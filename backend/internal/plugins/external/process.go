@@ -0,0 +1,443 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ErrNotRunning means the plugin process is not running: it was not
+// initialized, or it exited and is being restarted.
+var ErrNotRunning = errors.New("external: plugin process is not running")
+
+// Config describes how to run a plugin binary.
+type Config struct {
+	// Path is the plugin executable; Args and Env (KEY=VALUE) are added to
+	// its command line and to the server's environment.
+	Path string
+	Args []string
+	Env  []string
+	// StartTimeout bounds starting the process through the handshake.
+	StartTimeout time.Duration
+	// CallTimeout bounds each call but Collect, which CollectTimeout bounds.
+	CallTimeout    time.Duration
+	CollectTimeout time.Duration
+	// A process that exits is restarted after MinBackoff, doubling up to
+	// MaxBackoff while restarts fail.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.StartTimeout <= 0 {
+		c.StartTimeout = 10 * time.Second
+	}
+	if c.CallTimeout <= 0 {
+		c.CallTimeout = 30 * time.Second
+	}
+	if c.CollectTimeout <= 0 {
+		c.CollectTimeout = 5 * time.Minute
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = 500 * time.Millisecond
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = max(time.Minute, c.MinBackoff)
+	}
+	return c
+}
+
+// Plugin is a plugins.Plugin served by a plugin process. Initialize starts
+// the process, which is restarted with backoff, and initialized again, when
+// it exits; Shutdown stops it. Validate and the metadata methods start a
+// short-lived process when none is running.
+type Plugin struct {
+	name   string
+	cfg    Config
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	proc     *process
+	meta     *metaCache
+	config   json.RawMessage
+	restarts int
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+var _ plugins.Plugin = (*Plugin)(nil)
+
+// New returns the plugin instance name served by the binary in cfg.
+func New(name string, cfg Config, logger *zap.Logger) *Plugin {
+	return newPlugin(name, cfg, logger, &metaCache{})
+}
+
+// Factory registers a plugin binary as a plugin type. Its instances share
+// the binary's metadata, so listing plugin types does not start processes.
+func Factory(cfg Config, logger *zap.Logger) plugins.Factory {
+	meta := &metaCache{}
+	return func(name string) plugins.Plugin { return newPlugin(name, cfg, logger, meta) }
+}
+
+func newPlugin(name string, cfg Config, logger *zap.Logger, meta *metaCache) *Plugin {
+	return &Plugin{name: name, cfg: cfg.withDefaults(), logger: logger.With(zap.String("plugin", name)), meta: meta, stopped: make(chan struct{})}
+}
+
+// metaCache holds the handshake of the binary's latest process.
+type metaCache struct {
+	mu   sync.Mutex
+	meta *handshakeResponse
+}
+
+func (c *metaCache) get() *handshakeResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.meta
+}
+
+func (c *metaCache) set(meta *handshakeResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.meta = meta
+}
+
+// process is a running plugin binary and its connection.
+type process struct {
+	cmd     *exec.Cmd
+	conn    *grpc.ClientConn
+	started time.Time
+	// exited is closed once the process is reaped; err is its exit error
+	exited chan struct{}
+	err    error
+}
+
+// launch starts the binary and completes the handshake.
+func (p *Plugin) launch(ctx context.Context) (*process, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.StartTimeout)
+	defer cancel()
+	cmd := exec.Command(p.cfg.Path, p.cfg.Args...)
+	cmd.Env = append(append(os.Environ(), p.cfg.Env...), MagicCookieKey+"="+MagicCookieValue)
+	stopWithHost(cmd)
+	// Output is read until the process exits, and a little longer from
+	// children it leaves behind
+	cmd.WaitDelay = time.Second
+
+	// The first stdout line is the handshake; later output and stderr are
+	// logged
+	handshake := make(chan string, 1)
+	first := true
+	stdout := &lineWriter{fn: func(line string) {
+		if first {
+			first = false
+			handshake <- line
+			return
+		}
+		p.logger.Info("plugin stdout", zap.String("line", line))
+	}}
+	stderr := &lineWriter{fn: func(line string) { p.logger.Info("plugin stderr", zap.String("line", line)) }}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", p.name, err)
+	}
+	proc := &process{cmd: cmd, started: time.Now(), exited: make(chan struct{})}
+	go func() {
+		proc.err = cmd.Wait()
+		stdout.flush()
+		stderr.flush()
+		close(proc.exited)
+	}()
+
+	meta, err := p.handshake(ctx, proc, handshake)
+	if err != nil {
+		p.kill(proc)
+		return nil, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	p.logger.Info("plugin process started", zap.Int("pid", cmd.Process.Pid), zap.String("version", meta.Version))
+	p.meta.set(meta)
+	return proc, nil
+}
+
+func (p *Plugin) handshake(ctx context.Context, proc *process, lines <-chan string) (*handshakeResponse, error) {
+	var line string
+	select {
+	case line = <-lines:
+	case <-proc.exited:
+		return nil, fmt.Errorf("exited before the handshake: %v", proc.err)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no handshake within %s", p.cfg.StartTimeout)
+	}
+	parts := strings.Split(line, "|")
+	if len(parts) != 4 || parts[0] != handshakePrefix {
+		return nil, fmt.Errorf("invalid handshake %q", line)
+	}
+	if parts[1] != strconv.Itoa(ProtocolVersion) {
+		return nil, fmt.Errorf("protocol version %s is not supported (want %d)", parts[1], ProtocolVersion)
+	}
+	if parts[2] != "tcp" {
+		return nil, fmt.Errorf("network %q is not supported", parts[2])
+	}
+	conn, err := grpc.NewClient(parts[3], grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})))
+	if err != nil {
+		return nil, err
+	}
+	proc.conn = conn
+	var meta handshakeResponse
+	if err := p.invokeOn(ctx, proc, "Handshake", p.cfg.StartTimeout, &handshakeRequest{ProtocolVersion: ProtocolVersion}, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// lineWriter calls fn with each line written to it. Lines longer than
+// maxLine are split.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	fn  func(string)
+}
+
+const maxLine = 64 << 10
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 && len(w.buf) < maxLine {
+			return len(b), nil
+		}
+		if i < 0 {
+			i = maxLine
+		}
+		w.fn(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[min(i+1, len(w.buf)):]
+	}
+}
+
+// flush passes on a last line without a newline.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// kill ends the process at once.
+func (p *Plugin) kill(proc *process) {
+	if proc.conn != nil {
+		_ = proc.conn.Close()
+	}
+	_ = proc.cmd.Process.Kill()
+	<-proc.exited
+}
+
+// invokeOn calls a method on proc with a deadline.
+func (p *Plugin) invokeOn(ctx context.Context, proc *process, method string, timeout time.Duration, req, resp any) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := proc.conn.Invoke(ctx, "/"+serviceName+"/"+method, req, resp); err != nil {
+		return fromStatus(p.name, method, err)
+	}
+	return nil
+}
+
+// invoke calls a method on the running process.
+func (p *Plugin) invoke(ctx context.Context, method string, timeout time.Duration, req, resp any) error {
+	p.mu.Lock()
+	proc, restarts := p.proc, p.restarts
+	p.mu.Unlock()
+	if proc == nil {
+		return fmt.Errorf("%w: %s (restarted %d times)", ErrNotRunning, p.name, restarts)
+	}
+	return p.invokeOn(ctx, proc, method, timeout, req, resp)
+}
+
+// withProcess runs fn on the running process, or on a short-lived one.
+func (p *Plugin) withProcess(ctx context.Context, fn func(*process) error) error {
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+	if proc != nil {
+		return fn(proc)
+	}
+	proc, err := p.launch(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.kill(proc)
+	return fn(proc)
+}
+
+// metadata returns the binary's handshake, starting a process if none
+// ran yet.
+func (p *Plugin) metadata() handshakeResponse {
+	if meta := p.meta.get(); meta != nil {
+		return *meta
+	}
+	if err := p.withProcess(context.Background(), func(*process) error { return nil }); err != nil {
+		p.logger.Warn("plugin handshake failed", zap.Error(err))
+		return handshakeResponse{}
+	}
+	return *p.meta.get()
+}
+
+func (p *Plugin) Name() string                  { return p.name }
+func (p *Plugin) Description() string           { return p.metadata().Description }
+func (p *Plugin) Version() string               { return p.metadata().Version }
+func (p *Plugin) ConfigSchema() json.RawMessage { return p.metadata().ConfigSchema }
+
+// Restarts is the number of times the process was restarted after exiting.
+func (p *Plugin) Restarts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.restarts
+}
+
+func (p *Plugin) Validate(config json.RawMessage) error {
+	return p.withProcess(context.Background(), func(proc *process) error {
+		return p.invokeOn(context.Background(), proc, "Validate", p.cfg.CallTimeout, &configRequest{Config: config}, &empty{})
+	})
+}
+
+func (p *Plugin) Initialize(ctx context.Context, config json.RawMessage) error {
+	proc, err := p.launch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.invokeOn(ctx, proc, "Initialize", p.cfg.CallTimeout, &configRequest{Config: config}, &empty{}); err != nil {
+		p.kill(proc)
+		return err
+	}
+	p.mu.Lock()
+	p.proc, p.config = proc, config
+	p.mu.Unlock()
+	go p.supervise(proc)
+	return nil
+}
+
+func (p *Plugin) HealthCheck(ctx context.Context) error {
+	return p.invoke(ctx, "HealthCheck", p.cfg.CallTimeout, &empty{}, &empty{})
+}
+
+func (p *Plugin) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	var resp collectResponse
+	if err := p.invoke(ctx, "Collect", p.cfg.CollectTimeout, &collectRequest{Cursor: string(since)}, &resp); err != nil {
+		return nil, err
+	}
+	return &plugins.Batch{Deployments: resp.Deployments, Incidents: resp.Incidents, Commits: resp.Commits, TicketLinks: resp.TicketLinks, Cursor: plugins.Cursor(resp.Cursor)}, nil
+}
+
+// Shutdown asks the process to shut down and waits for it to exit, killing
+// it when ctx ends first. Restarts stop.
+func (p *Plugin) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stopped) })
+	p.mu.Lock()
+	proc := p.proc
+	p.proc = nil
+	p.mu.Unlock()
+	if proc == nil {
+		return nil
+	}
+	err := p.invokeOn(ctx, proc, "Shutdown", p.cfg.CallTimeout, &empty{}, &empty{})
+	select {
+	case <-proc.exited:
+		_ = proc.conn.Close()
+	case <-ctx.Done():
+		p.logger.Warn("plugin process did not exit; killing it")
+		p.kill(proc)
+	}
+	return err
+}
+
+// supervise restarts the process when it exits until Shutdown.
+func (p *Plugin) supervise(proc *process) {
+	backoff := p.cfg.MinBackoff
+	for {
+		select {
+		case <-p.stopped:
+			return
+		case <-proc.exited:
+		}
+		p.mu.Lock()
+		current := p.proc == proc
+		if current {
+			p.proc = nil
+		}
+		p.mu.Unlock()
+		if !current {
+			return
+		}
+		_ = proc.conn.Close()
+		uptime := time.Since(proc.started)
+		p.logger.Warn("plugin process exited", zap.Error(proc.err), zap.Duration("uptime", uptime))
+		// A process that ran for a while crashed; one that did not is
+		// crash-looping and waits longer each time
+		if uptime > p.cfg.MaxBackoff {
+			backoff = p.cfg.MinBackoff
+		}
+		for {
+			select {
+			case <-p.stopped:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, p.cfg.MaxBackoff)
+			next, err := p.restart()
+			if err == nil {
+				proc = next
+				break
+			}
+			select {
+			case <-p.stopped:
+				return
+			default:
+			}
+			p.logger.Error("plugin restart failed", zap.Error(err), zap.Duration("retry_in", backoff))
+		}
+	}
+}
+
+// restart starts and initializes a new process with the applied config.
+func (p *Plugin) restart() (*process, error) {
+	p.mu.Lock()
+	config := p.config
+	p.mu.Unlock()
+	ctx := context.Background()
+	proc, err := p.launch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.invokeOn(ctx, proc, "Initialize", p.cfg.CallTimeout, &configRequest{Config: config}, &empty{}); err != nil {
+		p.kill(proc)
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.stopped:
+		// Shut down while restarting
+		go p.kill(proc)
+		return nil, errors.New("plugin shut down")
+	default:
+	}
+	p.proc = proc
+	p.restarts++
+	p.logger.Info("plugin process restarted", zap.Int("restarts", p.restarts))
+	return proc, nil
+}
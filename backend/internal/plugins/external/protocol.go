@@ -0,0 +1,186 @@
+// Package external runs collector plugins as separate processes that serve
+// the plugin contract over gRPC, so they can be written in any language and
+// a crashing plugin does not take the API process down.
+//
+// The host starts the plugin binary with MagicCookieKey set, and the plugin
+// listens on a loopback port and prints one handshake line on stdout:
+//
+//	METRICHUB_PLUGIN|1|tcp|127.0.0.1:41234
+//
+// The host then calls Handshake and the plugin's other methods on that
+// address. Messages are JSON (content type application/grpc+json, see
+// plugin.proto), so no generated code is needed on either side. Anything
+// the plugin writes to stderr is logged by the host.
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ProtocolVersion is the plugin protocol version; the host refuses
+	// plugins that speak another one.
+	ProtocolVersion = 1
+	// MagicCookieKey and MagicCookieValue are set in the plugin's
+	// environment, so a plugin binary run by hand explains itself instead
+	// of waiting for a host.
+	MagicCookieKey   = "METRICHUB_PLUGIN_COOKIE"
+	MagicCookieValue = "5b1f3c0e-dora-collector"
+	// handshakePrefix starts the line a plugin prints once it listens.
+	handshakePrefix = "METRICHUB_PLUGIN"
+	serviceName     = "metrichub.plugin.v1.Collector"
+)
+
+type handshakeRequest struct {
+	ProtocolVersion int `json:"protocol_version"`
+}
+
+type handshakeResponse struct {
+	ProtocolVersion int             `json:"protocol_version"`
+	Description     string          `json:"description"`
+	Version         string          `json:"version"`
+	ConfigSchema    json.RawMessage `json:"config_schema,omitempty"`
+}
+
+type configRequest struct {
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+type collectRequest struct {
+	Cursor string `json:"cursor"`
+}
+
+type collectResponse struct {
+	Deployments []metrics.Deployment `json:"deployments,omitempty"`
+	Incidents   []metrics.Incident   `json:"incidents,omitempty"`
+	Commits     []metrics.Commit     `json:"commits,omitempty"`
+	TicketLinks []metrics.TicketLink `json:"ticket_links,omitempty"`
+	Cursor      string               `json:"cursor,omitempty"`
+}
+
+type empty struct{}
+
+// jsonCodec encodes messages as JSON instead of protobuf.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// collectorServer is the plugin side of the service.
+type collectorServer struct {
+	plugin   plugins.Plugin
+	shutdown func()
+}
+
+func (s *collectorServer) handshake(_ context.Context, req *handshakeRequest) (*handshakeResponse, error) {
+	if req.ProtocolVersion != ProtocolVersion {
+		return nil, status.Errorf(codes.FailedPrecondition, "protocol version %d is not supported (want %d)", req.ProtocolVersion, ProtocolVersion)
+	}
+	return &handshakeResponse{ProtocolVersion: ProtocolVersion, Description: s.plugin.Description(), Version: s.plugin.Version(), ConfigSchema: s.plugin.ConfigSchema()}, nil
+}
+
+func (s *collectorServer) validate(_ context.Context, req *configRequest) (*empty, error) {
+	return &empty{}, toStatus(s.plugin.Validate(req.Config))
+}
+
+func (s *collectorServer) initialize(ctx context.Context, req *configRequest) (*empty, error) {
+	return &empty{}, toStatus(s.plugin.Initialize(ctx, req.Config))
+}
+
+func (s *collectorServer) healthCheck(ctx context.Context, _ *empty) (*empty, error) {
+	return &empty{}, toStatus(s.plugin.HealthCheck(ctx))
+}
+
+func (s *collectorServer) collect(ctx context.Context, req *collectRequest) (*collectResponse, error) {
+	batch, err := s.plugin.Collect(ctx, plugins.Cursor(req.Cursor))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &collectResponse{Deployments: batch.Deployments, Incidents: batch.Incidents, Commits: batch.Commits, TicketLinks: batch.TicketLinks, Cursor: string(batch.Cursor)}, nil
+}
+
+// shutdownPlugin shuts the plugin down, then stops serving once the
+// response is sent.
+func (s *collectorServer) shutdownPlugin(ctx context.Context, _ *empty) (*empty, error) {
+	err := s.plugin.Shutdown(ctx)
+	go s.shutdown()
+	return &empty{}, toStatus(err)
+}
+
+// unary adapts a typed handler to a grpc.MethodDesc.
+func unary[Req, Resp any](name string, h func(*collectorServer, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			s := srv.(*collectorServer)
+			if interceptor == nil {
+				return h(s, ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return h(s, ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("Handshake", (*collectorServer).handshake),
+		unary("Validate", (*collectorServer).validate),
+		unary("Initialize", (*collectorServer).initialize),
+		unary("HealthCheck", (*collectorServer).healthCheck),
+		unary("Collect", (*collectorServer).collect),
+		unary("Shutdown", (*collectorServer).shutdownPlugin),
+	},
+	Metadata: "plugin.proto",
+}
+
+// toStatus carries a plugin error over the wire: invalid configurations as
+// InvalidArgument, so the host can tell them apart.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, plugins.ErrInvalidConfig):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus turns an RPC error back into a plugin error.
+func fromStatus(name, method string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("plugin %s: %s: %w", name, method, err)
+	}
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return fmt.Errorf("%w: %s", plugins.ErrInvalidConfig, st.Message())
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("plugin %s: %s: %w", name, method, context.DeadlineExceeded)
+	case codes.Canceled:
+		return fmt.Errorf("plugin %s: %s: %w", name, method, context.Canceled)
+	}
+	return fmt.Errorf("plugin %s: %s: %s", name, method, st.Message())
+}
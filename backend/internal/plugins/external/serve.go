@@ -0,0 +1,47 @@
+package external
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"google.golang.org/grpc"
+)
+
+// ErrNotLaunched means Serve was called outside a host.
+var ErrNotLaunched = errors.New("external: this is a MetricHub plugin; it is started by the server (see docs/plugins.md)")
+
+// Serve runs p as a plugin process: it listens on a loopback port, prints
+// the handshake line and serves until the host calls Shutdown or the
+// process is interrupted. Plugin binaries written in Go call it from main.
+func Serve(p plugins.Plugin) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return ErrNotLaunched
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	var once sync.Once
+	stop := func() { once.Do(srv.GracefulStop) }
+	srv.RegisterService(&serviceDesc, &collectorServer{plugin: p, shutdown: stop})
+
+	// The host stops plugins through Shutdown. Signals cover interrupts and,
+	// on Linux, a host that dies without calling it (see stopWithHost)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		stop()
+	}()
+
+	fmt.Printf("%s|%d|%s|%s\n", handshakePrefix, ProtocolVersion, lis.Addr().Network(), lis.Addr())
+	return srv.Serve(lis)
+}
@@ -0,0 +1,186 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// errNotFound is a 404 from the API, for deployments and runs that were
+// deleted while they were tracked.
+var errNotFound = errors.New("github: not found")
+
+// maxPages bounds the pages read from one list per cycle, so a runaway
+// backfill ends in an error instead of running until the cycle timeout.
+const maxPages = 200
+
+type user struct {
+	Login string `json:"login"`
+}
+
+type deployment struct {
+	ID          int64     `json:"id"`
+	SHA         string    `json:"sha"`
+	Ref         string    `json:"ref"`
+	Environment string    `json:"environment"`
+	Creator     user      `json:"creator"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type deploymentStatus struct {
+	State     string    `json:"state"`
+	TargetURL string    `json:"target_url"`
+	LogURL    string    `json:"log_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type commitAuthor struct {
+	Name string `json:"name"`
+}
+
+type headCommit struct {
+	ID        string       `json:"id"`
+	Message   string       `json:"message"`
+	Timestamp time.Time    `json:"timestamp"`
+	Author    commitAuthor `json:"author"`
+}
+
+type workflowRun struct {
+	ID           int64       `json:"id"`
+	Name         string      `json:"name"`
+	Path         string      `json:"path"`
+	Event        string      `json:"event"`
+	HeadBranch   string      `json:"head_branch"`
+	HeadSHA      string      `json:"head_sha"`
+	Status       string      `json:"status"`
+	Conclusion   string      `json:"conclusion"`
+	HTMLURL      string      `json:"html_url"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	RunStartedAt time.Time   `json:"run_started_at"`
+	Actor        user        `json:"actor"`
+	HeadCommit   *headCommit `json:"head_commit"`
+}
+
+type workflowRuns struct {
+	WorkflowRuns []workflowRun `json:"workflow_runs"`
+}
+
+type release struct {
+	ID              int64      `json:"id"`
+	TagName         string     `json:"tag_name"`
+	TargetCommitish string     `json:"target_commitish"`
+	Draft           bool       `json:"draft"`
+	Prerelease      bool       `json:"prerelease"`
+	Author          user       `json:"author"`
+	HTMLURL         string     `json:"html_url"`
+	CreatedAt       time.Time  `json:"created_at"`
+	PublishedAt     *time.Time `json:"published_at"`
+}
+
+type pullRequest struct {
+	Number         int        `json:"number"`
+	Title          string     `json:"title"`
+	User           user       `json:"user"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+}
+
+// get fetches path (relative to the API URL, or absolute for pagination
+// links) into v. With an etag it is a conditional request, and a 304
+// reports notModified without touching v.
+func (p *Plugin) get(ctx context.Context, path, etag string, v any) (resp *http.Response, notModified bool, err error) {
+	url := path
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = p.cfg.APIURL + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "MetricHub")
+	if p.cfg.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Secret)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err = p.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return resp, true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return resp, false, fmt.Errorf("%w: GET %s", errNotFound, path)
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return resp, false, fmt.Errorf("github: GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp, false, fmt.Errorf("github: GET %s: %w", path, err)
+	}
+	return resp, false, nil
+}
+
+// list pages through a list that is ordered newest first, stopping at the
+// first page that reaches items older than since. The first page is
+// requested with etag; when it is not modified, list returns no items and
+// the same etag. decode extracts the items from a page.
+func list[T any](ctx context.Context, p *Plugin, path, etag string, since time.Time, decode func([]byte) ([]T, error), at func(T) time.Time) (items []T, newETag string, err error) {
+	next := path
+	for n := 0; next != ""; n++ {
+		if n == maxPages {
+			return nil, "", fmt.Errorf("github: GET %s: more than %d pages", path, maxPages)
+		}
+		var raw json.RawMessage
+		resp, notModified, err := p.get(ctx, next, etag, &raw)
+		if err != nil {
+			return nil, "", err
+		}
+		if notModified {
+			return nil, etag, nil
+		}
+		if n == 0 {
+			newETag, etag = resp.Header.Get("ETag"), ""
+		}
+		pageItems, err := decode(raw)
+		if err != nil {
+			return nil, "", fmt.Errorf("github: GET %s: %w", next, err)
+		}
+		items = append(items, pageItems...)
+		if len(pageItems) == 0 || at(pageItems[len(pageItems)-1]).Before(since) {
+			break
+		}
+		next = nextLink(resp.Header.Get("Link"))
+	}
+	return items, newETag, nil
+}
+
+// array decodes a page that is a JSON array.
+func array[T any](raw []byte) ([]T, error) {
+	var items []T
+	err := json.Unmarshal(raw, &items)
+	return items, err
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextLink returns the rel="next" URL of a Link header.
+func nextLink(header string) string {
+	if m := linkNext.FindStringSubmatch(header); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,441 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// trackFor is how long an unfinished deployment or workflow run is checked
+// again each cycle; after that it is stored as it last was.
+const trackFor = 7 * 24 * time.Hour
+
+// cursor is the plugin's Cursor, JSON encoded: how far each repository's
+// lists have been read.
+type cursor struct {
+	Repos map[string]*repoCursor `json:"repos"`
+}
+
+type repoCursor struct {
+	Deployments stream `json:"deployments"`
+	Runs        stream `json:"runs"`
+	Releases    stream `json:"releases"`
+	Pulls       stream `json:"pulls"`
+}
+
+// stream is how far one list has been read.
+type stream struct {
+	// Since is the newest item seen; older items were already collected.
+	Since time.Time `json:"since"`
+	// ETag is the first page's, so an unchanged list costs a 304.
+	ETag string `json:"etag,omitempty"`
+	// Open are the unfinished deployments or runs checked again each cycle.
+	Open []int64 `json:"open,omitempty"`
+}
+
+// Collect reads each repository's lists from where its cursor left off.
+// Repositories without one, such as those added to the configuration since
+// the last cycle, are backfilled. A repository that fails keeps its cursor
+// and contributes no records, while the others' are returned with the
+// failures joined, so one repository cannot hold the rest back.
+func (p *Plugin) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	var cur cursor
+	if since != "" {
+		if err := json.Unmarshal([]byte(since), &cur); err != nil {
+			p.logger.Warn("discarding unreadable cursor, backfilling", zap.Error(err))
+		}
+	}
+	batch := &plugins.Batch{}
+	next := cursor{Repos: make(map[string]*repoCursor, len(p.repos))}
+	var errs []error
+	for _, r := range p.repos {
+		prev := cur.Repos[r.Repo]
+		rc := prev
+		if rc == nil {
+			start := p.now().Add(-p.backfill).UTC()
+			p.logger.Info("backfilling repository", zap.String("repo", r.Repo), zap.Time("since", start))
+			rc = &repoCursor{Deployments: stream{Since: start}, Runs: stream{Since: start}, Releases: stream{Since: start}, Pulls: stream{Since: start}}
+		}
+		// Streams are advanced on a copy, kept only if the whole repository
+		// is read
+		work, repoBatch := *rc, &plugins.Batch{}
+		if err := p.collectRepo(ctx, r, &work, repoBatch); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Repo, err))
+			if prev != nil {
+				next.Repos[r.Repo] = prev
+			}
+			continue
+		}
+		batch.Deployments = append(batch.Deployments, repoBatch.Deployments...)
+		batch.Commits = append(batch.Commits, repoBatch.Commits...)
+		next.Repos[r.Repo] = &work
+	}
+	b, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+	batch.Cursor = plugins.Cursor(b)
+	return batch, errors.Join(errs...)
+}
+
+func (p *Plugin) collectRepo(ctx context.Context, r repo, rc *repoCursor, batch *plugins.Batch) error {
+	if err := p.collectDeployments(ctx, r, &rc.Deployments, batch); err != nil {
+		return fmt.Errorf("deployments: %w", err)
+	}
+	if r.workflows != nil {
+		if err := p.collectRuns(ctx, r, &rc.Runs, batch); err != nil {
+			return fmt.Errorf("workflow runs: %w", err)
+		}
+	}
+	if r.Production.Releases {
+		if err := p.collectReleases(ctx, r, &rc.Releases, batch); err != nil {
+			return fmt.Errorf("releases: %w", err)
+		}
+	}
+	if err := p.collectPulls(ctx, r, &rc.Pulls, batch); err != nil {
+		return fmt.Errorf("pull requests: %w", err)
+	}
+	return nil
+}
+
+// tracker keeps a stream's open items across a cycle.
+type tracker struct {
+	st     *stream
+	now    time.Time
+	seen   map[int64]bool
+	open   []int64
+	newest time.Time
+}
+
+func newTracker(st *stream, now time.Time) *tracker {
+	return &tracker{st: st, now: now, seen: map[int64]bool{}, newest: st.Since}
+}
+
+// fresh reports whether an item listed at t is new or still open, marking
+// it seen.
+func (t *tracker) fresh(id int64, at time.Time) bool {
+	if at.After(t.newest) {
+		t.newest = at
+	}
+	if at.Before(t.st.Since) && !t.wasOpen(id) {
+		return false
+	}
+	t.seen[id] = true
+	return true
+}
+
+func (t *tracker) wasOpen(id int64) bool {
+	for _, o := range t.st.Open {
+		if o == id {
+			return true
+		}
+	}
+	return false
+}
+
+// unseen returns the open items that were not listed this cycle.
+func (t *tracker) unseen() []int64 {
+	var ids []int64
+	for _, id := range t.st.Open {
+		if !t.seen[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// track keeps an unfinished item open, unless it started too long ago.
+func (t *tracker) track(id int64, status metrics.DeploymentStatus, started time.Time) {
+	if !status.IsTerminal() && t.now.Sub(started) < trackFor {
+		t.open = append(t.open, id)
+	}
+}
+
+func (t *tracker) done(etag string) {
+	t.st.Since, t.st.ETag, t.st.Open = t.newest, etag, t.open
+}
+
+func (p *Plugin) collectDeployments(ctx context.Context, r repo, st *stream, batch *plugins.Batch) error {
+	items, etag, err := list(ctx, p, "/repos/"+r.Repo+"/deployments?per_page=100", st.ETag, st.Since, array[deployment], func(d deployment) time.Time { return d.CreatedAt })
+	if err != nil {
+		return err
+	}
+	t := newTracker(st, p.now())
+	add := func(d deployment) error {
+		if !r.environments.MatchString(d.Environment) {
+			return nil
+		}
+		dep, err := p.deployment(ctx, r, d)
+		if err != nil {
+			return err
+		}
+		batch.Deployments = append(batch.Deployments, dep)
+		t.track(d.ID, dep.Status, d.CreatedAt)
+		return nil
+	}
+	for _, d := range items {
+		if t.fresh(d.ID, d.CreatedAt) {
+			if err := add(d); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range t.unseen() {
+		var d deployment
+		_, _, err := p.get(ctx, "/repos/"+r.Repo+"/deployments/"+strconv.FormatInt(id, 10), "", &d)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := add(d); err != nil {
+			return err
+		}
+	}
+	t.done(etag)
+	return nil
+}
+
+// deploymentStates maps deployment status states, as the webhook adapter
+// does. "inactive" marks a deployment superseded by a newer one and is
+// skipped in favour of the status before it.
+var deploymentStates = map[string]metrics.DeploymentStatus{
+	"queued":      metrics.DeploymentStatusPending,
+	"pending":     metrics.DeploymentStatusPending,
+	"in_progress": metrics.DeploymentStatusRunning,
+	"success":     metrics.DeploymentStatusSuccess,
+	"failure":     metrics.DeploymentStatusFailed,
+	"error":       metrics.DeploymentStatusFailed,
+}
+
+// deployment maps a deployment with its latest status.
+func (p *Plugin) deployment(ctx context.Context, r repo, d deployment) (metrics.Deployment, error) {
+	var statuses []deploymentStatus
+	if _, _, err := p.get(ctx, fmt.Sprintf("/repos/%s/deployments/%d/statuses?per_page=10", r.Repo, d.ID), "", &statuses); err != nil {
+		return metrics.Deployment{}, err
+	}
+	dep := metrics.Deployment{
+		ID:          "gh-deploy-" + strconv.FormatInt(d.ID, 10),
+		Service:     r.Service,
+		Environment: d.Environment,
+		Version:     d.Ref,
+		Status:      metrics.DeploymentStatusPending,
+		StartTime:   d.CreatedAt,
+		CommitSHA:   d.SHA,
+		Author:      d.Creator.Login,
+		Repository:  r.Repo,
+		Branch:      d.Ref,
+	}
+	for _, st := range statuses {
+		status, ok := deploymentStates[st.State]
+		if !ok {
+			continue
+		}
+		dep.Status = status
+		if status.IsTerminal() {
+			end := st.CreatedAt
+			dep.EndTime = &end
+		}
+		dep.BuildURL = firstNonEmpty(st.LogURL, st.TargetURL)
+		break
+	}
+	return dep, nil
+}
+
+func (p *Plugin) collectRuns(ctx context.Context, r repo, st *stream, batch *plugins.Batch) error {
+	path := "/repos/" + r.Repo + "/actions/runs?per_page=100&created=" + url.QueryEscape(">="+st.Since.UTC().Format("2006-01-02"))
+	decode := func(raw []byte) ([]workflowRun, error) {
+		var page workflowRuns
+		err := json.Unmarshal(raw, &page)
+		return page.WorkflowRuns, err
+	}
+	items, etag, err := list(ctx, p, path, st.ETag, st.Since, decode, func(run workflowRun) time.Time { return run.CreatedAt })
+	if err != nil {
+		return err
+	}
+	t := newTracker(st, p.now())
+	add := func(run workflowRun) {
+		if !matches(r.workflows, run.Name, run.Path) || r.branches != nil && !r.branches.MatchString(run.HeadBranch) {
+			return
+		}
+		d, ok := deploymentFromRun(r, run)
+		if !ok {
+			return
+		}
+		if hc := run.HeadCommit; hc != nil && hc.ID == run.HeadSHA {
+			d.CommitTime = hc.Timestamp
+			batch.Commits = append(batch.Commits, metrics.Commit{
+				Repository: r.Repo, SHA: hc.ID, Author: hc.Author.Name, Message: hc.Message,
+				AuthoredAt: hc.Timestamp, CommittedAt: hc.Timestamp,
+			})
+		}
+		batch.Deployments = append(batch.Deployments, d)
+		t.track(run.ID, d.Status, run.CreatedAt)
+	}
+	for _, run := range items {
+		if t.fresh(run.ID, run.CreatedAt) {
+			add(run)
+		}
+	}
+	for _, id := range t.unseen() {
+		var run workflowRun
+		_, _, err := p.get(ctx, "/repos/"+r.Repo+"/actions/runs/"+strconv.FormatInt(id, 10), "", &run)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		add(run)
+	}
+	t.done(etag)
+	return nil
+}
+
+// workflowConclusions maps completed run conclusions, as the webhook
+// adapter does; neutral, skipped, stale and action_required runs did not
+// deploy.
+var workflowConclusions = map[string]metrics.DeploymentStatus{
+	"success":         metrics.DeploymentStatusSuccess,
+	"failure":         metrics.DeploymentStatusFailed,
+	"timed_out":       metrics.DeploymentStatusFailed,
+	"startup_failure": metrics.DeploymentStatusFailed,
+	"cancelled":       metrics.DeploymentStatusCancelled,
+}
+
+func deploymentFromRun(r repo, run workflowRun) (metrics.Deployment, bool) {
+	var status metrics.DeploymentStatus
+	switch run.Status {
+	case "completed":
+		var ok bool
+		if status, ok = workflowConclusions[run.Conclusion]; !ok {
+			return metrics.Deployment{}, false
+		}
+	case "in_progress":
+		status = metrics.DeploymentStatusRunning
+	default: // requested, queued, waiting, pending
+		status = metrics.DeploymentStatusPending
+	}
+	started := run.RunStartedAt
+	if started.IsZero() {
+		started = run.CreatedAt
+	}
+	d := metrics.Deployment{
+		ID:          "gh-run-" + strconv.FormatInt(run.ID, 10),
+		Service:     r.Service,
+		Environment: "production",
+		Version:     shortSHA(run.HeadSHA),
+		Status:      status,
+		StartTime:   started,
+		CommitSHA:   run.HeadSHA,
+		Author:      run.Actor.Login,
+		Repository:  r.Repo,
+		Branch:      run.HeadBranch,
+		BuildURL:    run.HTMLURL,
+	}
+	if status.IsTerminal() {
+		end := run.UpdatedAt
+		d.EndTime = &end
+	}
+	return d, true
+}
+
+var fullSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// collectReleases records published releases as production deployments.
+// Releases are listed by creation, so a draft published later is found by
+// its publication time as long as it is on a page that is read.
+func (p *Plugin) collectReleases(ctx context.Context, r repo, st *stream, batch *plugins.Batch) error {
+	items, etag, err := list(ctx, p, "/repos/"+r.Repo+"/releases?per_page=100", st.ETag, st.Since, array[release], func(rel release) time.Time { return rel.CreatedAt })
+	if err != nil {
+		return err
+	}
+	t := newTracker(st, p.now())
+	for _, rel := range items {
+		if rel.Draft || rel.Prerelease || rel.PublishedAt == nil || !t.fresh(rel.ID, *rel.PublishedAt) {
+			continue
+		}
+		published := *rel.PublishedAt
+		d := metrics.Deployment{
+			ID:          "gh-release-" + strconv.FormatInt(rel.ID, 10),
+			Service:     r.Service,
+			Environment: "production",
+			Version:     rel.TagName,
+			Status:      metrics.DeploymentStatusSuccess,
+			StartTime:   published,
+			EndTime:     &published,
+			Author:      rel.Author.Login,
+			Repository:  r.Repo,
+			BuildURL:    rel.HTMLURL,
+		}
+		// target_commitish is usually a branch; only a SHA pins the commit
+		if fullSHA.MatchString(rel.TargetCommitish) {
+			d.CommitSHA = rel.TargetCommitish
+		} else {
+			d.Branch = rel.TargetCommitish
+		}
+		batch.Deployments = append(batch.Deployments, d)
+	}
+	t.done(etag)
+	return nil
+}
+
+// collectPulls records merged pull requests as commits, as the webhook
+// adapter does, so deployments of their merge commits get a commit time.
+func (p *Plugin) collectPulls(ctx context.Context, r repo, st *stream, batch *plugins.Batch) error {
+	items, etag, err := list(ctx, p, "/repos/"+r.Repo+"/pulls?state=closed&sort=updated&direction=desc&per_page=100", st.ETag, st.Since, array[pullRequest], func(pr pullRequest) time.Time { return pr.UpdatedAt })
+	if err != nil {
+		return err
+	}
+	t := newTracker(st, p.now())
+	for _, pr := range items {
+		if !t.fresh(int64(pr.Number), pr.UpdatedAt) || pr.MergedAt == nil || pr.MergeCommitSHA == "" {
+			continue
+		}
+		batch.Commits = append(batch.Commits, metrics.Commit{
+			Repository:  r.Repo,
+			SHA:         pr.MergeCommitSHA,
+			Author:      pr.User.Login,
+			Message:     pr.Title,
+			AuthoredAt:  *pr.MergedAt,
+			CommittedAt: *pr.MergedAt,
+		})
+	}
+	t.done(etag)
+	return nil
+}
+
+func matches(re *regexp.Regexp, values ...string) bool {
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
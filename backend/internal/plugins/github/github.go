@@ -0,0 +1,225 @@
+// Package github is the built-in GitHub collector plugin. It polls the REST
+// API of the configured repositories for deployments and their statuses,
+// Actions workflow runs, releases and merged pull requests. The first
+// cycle backfills a number of months of history; later cycles only read
+// what changed, using ETags and a cursor per repository.
+//
+// Records carry the IDs the GitHub webhook adapter gives them, so a
+// repository that is both polled and sends webhooks stores one record per
+// deployment.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"go.uber.org/zap"
+)
+
+const schema = `{
+  "type": "object",
+  "required": ["repositories"],
+  "additionalProperties": false,
+  "properties": {
+    "repositories": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "required": ["repo"],
+        "additionalProperties": false,
+        "properties": {
+          "repo": {"type": "string", "pattern": "^[\\w.-]+/[\\w.-]+$", "description": "owner/name"},
+          "service": {"type": "string", "description": "Service the records belong to; defaults to the repository name"},
+          "production": {
+            "type": "object",
+            "additionalProperties": false,
+            "description": "What counts as a production deployment in this repository",
+            "properties": {
+              "environments": {"type": "string", "default": "^(production|prod)$", "description": "Pattern matching the environments of Deployments API deployments"},
+              "workflows": {"type": "string", "description": "Pattern matching the name or path of deploying workflow runs; unset, workflow runs are not deployments"},
+              "branches": {"type": "string", "description": "Pattern the head branch of deploying workflow runs must match"},
+              "releases": {"type": "boolean", "default": false, "description": "Count published releases (not drafts or prereleases) as deployments"}
+            }
+          }
+        }
+      }
+    },
+    "backfill_months": {"type": "integer", "minimum": 0, "maximum": 24, "default": 3, "description": "History read on the first cycle, and when a repository is added"},
+    "api_url": {"type": "string", "default": "https://api.github.com", "description": "REST API root, for GitHub Enterprise Server use https://HOST/api/v3"}
+  }
+}`
+
+// defaultEnvironments matches production deployment environments.
+const defaultEnvironments = "^(production|prod)$"
+
+// Config is the plugin configuration.
+type Config struct {
+	Repositories   []Repository `json:"repositories"`
+	BackfillMonths *int         `json:"backfill_months"`
+	APIURL         string       `json:"api_url"`
+	// Secret is the access token, from the instance's secret reference.
+	// Without one only public repositories can be read, at a low rate.
+	Secret string `json:"secret"`
+}
+
+// Repository is a polled repository.
+type Repository struct {
+	Repo       string         `json:"repo"`
+	Service    string         `json:"service"`
+	Production ProductionRule `json:"production"`
+}
+
+// ProductionRule decides which of a repository's deployments, workflow
+// runs and releases are production deployments; only those are collected.
+type ProductionRule struct {
+	Environments string `json:"environments"`
+	Workflows    string `json:"workflows"`
+	Branches     string `json:"branches"`
+	Releases     bool   `json:"releases"`
+}
+
+// repo is a Repository with its rule compiled.
+type repo struct {
+	Repository
+	environments *regexp.Regexp
+	workflows    *regexp.Regexp // nil: workflow runs are not deployments
+	branches     *regexp.Regexp // nil: any branch
+}
+
+// Plugin collects from the GitHub REST API.
+type Plugin struct {
+	name   string
+	logger *zap.Logger
+	client *resilience.Client
+	now    func() time.Time
+
+	cfg      Config
+	backfill time.Duration
+	repos    []repo
+}
+
+// Factory registers the plugin as a plugin type; resilience tunes each
+// instance's HTTP client.
+func Factory(rc resilience.Config, logger *zap.Logger) plugins.Factory {
+	return func(name string) plugins.Plugin { return New(name, rc, logger) }
+}
+
+// New returns an unconfigured plugin instance.
+func New(name string, rc resilience.Config, logger *zap.Logger) *Plugin {
+	logger = logger.With(zap.String("plugin", name))
+	return &Plugin{name: name, logger: logger, client: resilience.New(name, rc, logger), now: time.Now}
+}
+
+func (p *Plugin) Name() string { return p.name }
+
+func (p *Plugin) Description() string {
+	return "GitHub deployments, workflow runs, releases and merged pull requests, polled from the REST API"
+}
+
+func (p *Plugin) Version() string               { return "1.0.0" }
+func (p *Plugin) ConfigSchema() json.RawMessage { return json.RawMessage(schema) }
+
+// Breaker reports the circuit breaker of the plugin's API client.
+func (p *Plugin) Breaker() resilience.State { return p.client.Breaker() }
+
+func (p *Plugin) Validate(raw json.RawMessage) error {
+	_, _, err := parseConfig(raw)
+	return err
+}
+
+// parseConfig decodes and checks a configuration, filling its defaults.
+func parseConfig(raw json.RawMessage) (Config, []repo, error) {
+	var cfg Config
+	if err := plugins.DecodeConfig(raw, &cfg); err != nil {
+		return cfg, nil, err
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.github.com"
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	if u, err := url.Parse(cfg.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, nil, fmt.Errorf("%w: api_url must be an http(s) URL", plugins.ErrInvalidConfig)
+	}
+	if cfg.BackfillMonths == nil {
+		months := 3
+		cfg.BackfillMonths = &months
+	}
+	if *cfg.BackfillMonths < 0 || *cfg.BackfillMonths > 24 {
+		return cfg, nil, fmt.Errorf("%w: backfill_months must be between 0 and 24", plugins.ErrInvalidConfig)
+	}
+	if len(cfg.Repositories) == 0 {
+		return cfg, nil, fmt.Errorf("%w: repositories is required", plugins.ErrInvalidConfig)
+	}
+	repos := make([]repo, 0, len(cfg.Repositories))
+	seen := map[string]bool{}
+	for _, r := range cfg.Repositories {
+		owner, name, ok := strings.Cut(r.Repo, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return cfg, nil, fmt.Errorf("%w: repo %q must be owner/name", plugins.ErrInvalidConfig, r.Repo)
+		}
+		if seen[r.Repo] {
+			return cfg, nil, fmt.Errorf("%w: repo %q is listed twice", plugins.ErrInvalidConfig, r.Repo)
+		}
+		seen[r.Repo] = true
+		if r.Service == "" {
+			r.Service = name
+		}
+		compiled := repo{Repository: r}
+		var err error
+		rule := r.Production
+		if rule.Environments == "" {
+			rule.Environments = defaultEnvironments
+		}
+		if compiled.environments, err = regexp.Compile(rule.Environments); err != nil {
+			return cfg, nil, fmt.Errorf("%w: %s production.environments: %v", plugins.ErrInvalidConfig, r.Repo, err)
+		}
+		if rule.Workflows != "" {
+			if compiled.workflows, err = regexp.Compile(rule.Workflows); err != nil {
+				return cfg, nil, fmt.Errorf("%w: %s production.workflows: %v", plugins.ErrInvalidConfig, r.Repo, err)
+			}
+		}
+		if rule.Branches != "" {
+			if compiled.branches, err = regexp.Compile(rule.Branches); err != nil {
+				return cfg, nil, fmt.Errorf("%w: %s production.branches: %v", plugins.ErrInvalidConfig, r.Repo, err)
+			}
+		}
+		repos = append(repos, compiled)
+	}
+	return cfg, repos, nil
+}
+
+func (p *Plugin) Initialize(_ context.Context, raw json.RawMessage) error {
+	cfg, repos, err := parseConfig(raw)
+	if err != nil {
+		return err
+	}
+	p.cfg, p.repos = cfg, repos
+	p.backfill = time.Duration(*cfg.BackfillMonths) * 30 * 24 * time.Hour
+	if cfg.Secret == "" {
+		p.logger.Warn("no GitHub token configured: only public repositories can be read, at 60 requests an hour")
+	}
+	return nil
+}
+
+// HealthCheck checks that each repository can be read.
+func (p *Plugin) HealthCheck(ctx context.Context) error {
+	for _, r := range p.repos {
+		var v struct {
+			FullName string `json:"full_name"`
+		}
+		if _, _, err := p.get(ctx, "/repos/"+r.Repo, "", &v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) Shutdown(context.Context) error { return nil }
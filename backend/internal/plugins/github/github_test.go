@@ -0,0 +1,284 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// fake serves recorded API responses: GET /repos/acme/shop/deployments is
+// answered with acme/shop/deployments.json from the first of dirs that has
+// it, and ?page=2 with deployments.2.json. Other query parameters are
+// ignored. Responses carry ETags and honour If-None-Match, and lists with
+// a next page link to it.
+type fake struct {
+	dirs []string
+
+	mu       sync.Mutex
+	requests []string // "path status"
+}
+
+func (f *fake) read(name string) []byte {
+	for _, dir := range f.dirs {
+		if b, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+func (f *fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := f.serve(w, r)
+	f.mu.Lock()
+	f.requests = append(f.requests, r.URL.Path+" "+strconv.Itoa(status))
+	f.mu.Unlock()
+}
+
+func (f *fake) serve(w http.ResponseWriter, r *http.Request) int {
+	if r.Header.Get("Authorization") != "Bearer t0ken" || r.Header.Get("X-GitHub-Api-Version") == "" {
+		http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+		return http.StatusUnauthorized
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/repos/")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	file := name + ".json"
+	if page > 1 {
+		file = fmt.Sprintf("%s.%d.json", name, page)
+	}
+	body := f.read(file)
+	if body == nil {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return http.StatusNotFound
+	}
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified
+	}
+	if f.read(fmt.Sprintf("%s.%d.json", name, page+1)) != nil {
+		next := *r.URL
+		next.Scheme, next.Host = "http", r.Host
+		q := next.Query()
+		q.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <%s>; rel="last"`, next.String(), next.String()))
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+	return http.StatusOK
+}
+
+// took reports the requests made since the last call.
+func (f *fake) took() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reqs := f.requests
+	f.requests = nil
+	return reqs
+}
+
+func newTestPlugin(t *testing.T, config string) (*Plugin, *fake) {
+	t.Helper()
+	f := &fake{dirs: []string{"testdata/recorded"}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	p := New("gh-acme", resilience.Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, zap.NewNop())
+	p.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	raw := strings.TrimSuffix(config, "}") + `, "api_url": "` + srv.URL + `", "secret": "t0ken"}`
+	if err := p.Initialize(context.Background(), json.RawMessage(raw)); err != nil {
+		t.Fatal(err)
+	}
+	return p, f
+}
+
+func byID(ds []metrics.Deployment) map[string]metrics.Deployment {
+	out := map[string]metrics.Deployment{}
+	for _, d := range ds {
+		out[d.ID] = d
+	}
+	return out
+}
+
+func TestCollectBackfillsThenPolls(t *testing.T) {
+	p, f := newTestPlugin(t, `{"repositories": [{"repo": "acme/shop", "production": {"workflows": "(?i)deploy", "branches": "^main$", "releases": true}}]}`)
+	ctx := context.Background()
+
+	batch, err := p.Collect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := byID(batch.Deployments)
+	ids := make([]string, 0, len(got))
+	for id := range got {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	// Staging, non-deploy and feature-branch runs, drafts, prereleases and
+	// anything older than the backfill are left out
+	if want := []string{"gh-deploy-1000", "gh-deploy-1001", "gh-deploy-1003", "gh-release-70", "gh-run-501"}; !slices.Equal(ids, want) {
+		t.Fatalf("deployments = %v, want %v", ids, want)
+	}
+	if d := got["gh-deploy-1001"]; d.Status != metrics.DeploymentStatusSuccess || d.EndTime == nil || !d.EndTime.Equal(time.Date(2024, 5, 10, 12, 10, 0, 0, time.UTC)) ||
+		d.Service != "shop" || d.Repository != "acme/shop" || d.Author != "hubot" || d.BuildURL != "https://ci.acme.test/1001" {
+		t.Errorf("superseded deployment = %+v", d)
+	}
+	if d := got["gh-deploy-1000"]; d.Status != metrics.DeploymentStatusFailed || d.Environment != "prod" {
+		t.Errorf("second page deployment = %+v", d)
+	}
+	if d := got["gh-deploy-1003"]; d.Status != metrics.DeploymentStatusRunning || d.EndTime != nil {
+		t.Errorf("running deployment = %+v", d)
+	}
+	if d := got["gh-run-501"]; d.Status != metrics.DeploymentStatusSuccess || d.Environment != "production" || !d.CommitTime.Equal(time.Date(2024, 5, 27, 9, 55, 0, 0, time.UTC)) {
+		t.Errorf("workflow run = %+v", d)
+	}
+	if d := got["gh-release-70"]; d.Version != "v1.4.0" || d.CommitSHA != "1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e" || d.EndTime == nil {
+		t.Errorf("release = %+v", d)
+	}
+	if len(batch.Commits) != 2 || batch.Commits[1].Message != "Add cart checkout" {
+		t.Errorf("commits = %+v", batch.Commits)
+	}
+	reqs := f.took()
+	for _, skipped := range []string{"/deployments/900/statuses", "/deployments/1002/statuses"} {
+		if slices.ContainsFunc(reqs, func(r string) bool { return strings.Contains(r, skipped) }) {
+			t.Errorf("requested %s: %v", skipped, reqs)
+		}
+	}
+	var cur cursor
+	if err := json.Unmarshal([]byte(batch.Cursor), &cur); err != nil {
+		t.Fatal(err)
+	}
+	if rc := cur.Repos["acme/shop"]; rc == nil || !slices.Equal(rc.Deployments.Open, []int64{1003}) || rc.Runs.ETag == "" ||
+		!rc.Deployments.Since.Equal(time.Date(2024, 5, 30, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("cursor = %s", batch.Cursor)
+	}
+
+	// A day later only the deployments changed; the other lists cost a 304
+	f.dirs = []string{"testdata/later", "testdata/recorded"}
+	p.now = func() time.Time { return time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC) }
+	batch, err = p.Collect(ctx, batch.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = byID(batch.Deployments)
+	if len(got) != 2 || got["gh-deploy-1003"].Status != metrics.DeploymentStatusSuccess || got["gh-deploy-1004"].Status != metrics.DeploymentStatusPending || len(batch.Commits) != 0 {
+		t.Errorf("second cycle = %+v %+v", batch.Deployments, batch.Commits)
+	}
+	reqs = f.took()
+	for _, list := range []string{"/repos/acme/shop/actions/runs 304", "/repos/acme/shop/releases 304", "/repos/acme/shop/pulls 304"} {
+		if !slices.Contains(reqs, list) {
+			t.Errorf("%q not in %v", list, reqs)
+		}
+	}
+	if err := json.Unmarshal([]byte(batch.Cursor), &cur); err != nil || !slices.Equal(cur.Repos["acme/shop"].Deployments.Open, []int64{1004}) {
+		t.Errorf("cursor = %s", batch.Cursor)
+	}
+}
+
+func TestCollectTracksOpenDeployments(t *testing.T) {
+	p, f := newTestPlugin(t, `{"repositories": [{"repo": "acme/shop"}]}`)
+	f.dirs = []string{"testdata/later", "testdata/recorded"}
+	// 1000 is past the pages that are read, so it is read directly; 999 was
+	// deleted and is dropped
+	since := `{"repos": {"acme/shop": {"deployments": {"since": "2024-06-01T00:00:00Z", "open": [1000, 999]}, "pulls": {"since": "2024-06-01T00:00:00Z"}}}}`
+	batch, err := p.Collect(context.Background(), plugins.Cursor(since))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := byID(batch.Deployments)
+	if len(got) != 2 || got["gh-deploy-1000"].Status != metrics.DeploymentStatusFailed || got["gh-deploy-1004"].Status != metrics.DeploymentStatusPending {
+		t.Errorf("deployments = %+v", batch.Deployments)
+	}
+	reqs := f.took()
+	if !slices.Contains(reqs, "/repos/acme/shop/deployments/1000 200") || !slices.Contains(reqs, "/repos/acme/shop/deployments/999 404") {
+		t.Errorf("requests = %v", reqs)
+	}
+	var cur cursor
+	if err := json.Unmarshal([]byte(batch.Cursor), &cur); err != nil || !slices.Equal(cur.Repos["acme/shop"].Deployments.Open, []int64{1004}) {
+		t.Errorf("cursor = %s", batch.Cursor)
+	}
+}
+
+func TestCollectKeepsOtherRepositoriesWhenOneFails(t *testing.T) {
+	p, _ := newTestPlugin(t, `{"repositories": [{"repo": "acme/gone"}, {"repo": "acme/shop"}]}`)
+	// acme/gone has no recorded responses, so its lists are 404s
+	since := `{"repos": {"acme/gone": {"deployments": {"since": "2024-05-01T00:00:00Z", "open": [7]}}}}`
+	batch, err := p.Collect(context.Background(), plugins.Cursor(since))
+	if err == nil || !strings.Contains(err.Error(), "acme/gone") {
+		t.Fatalf("err = %v, want the acme/gone failure", err)
+	}
+	if batch == nil || len(byID(batch.Deployments)) == 0 {
+		t.Fatalf("batch = %+v, want acme/shop's deployments", batch)
+	}
+	for _, d := range batch.Deployments {
+		if d.Repository != "acme/shop" {
+			t.Errorf("deployment of %s collected", d.Repository)
+		}
+	}
+	var cur cursor
+	if err := json.Unmarshal([]byte(batch.Cursor), &cur); err != nil {
+		t.Fatal(err)
+	}
+	if rc := cur.Repos["acme/gone"]; rc == nil || !rc.Deployments.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) || !slices.Equal(rc.Deployments.Open, []int64{7}) {
+		t.Errorf("failed repository cursor = %+v, want it unchanged", rc)
+	}
+	if rc := cur.Repos["acme/shop"]; rc == nil || rc.Deployments.Since.IsZero() || rc.Runs.ETag == "" && rc.Pulls.ETag == "" {
+		t.Errorf("acme/shop cursor = %+v, want it advanced", rc)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, tc := range []struct {
+		config, err string
+	}{
+		{`{"repositories": [{"repo": "acme/shop"}]}`, ""},
+		{`{"repositories": [{"repo": "acme/shop", "service": "storefront", "production": {"environments": "^live$", "workflows": "release", "branches": "^main$", "releases": true}}], "backfill_months": 12, "api_url": "https://ghe.acme.test/api/v3"}`, ""},
+		{`{}`, "repositories is required"},
+		{`{"repositories": [{"repo": "shop"}]}`, "must be owner/name"},
+		{`{"repositories": [{"repo": "acme/shop"}, {"repo": "acme/shop"}]}`, "listed twice"},
+		{`{"repositories": [{"repo": "acme/shop", "production": {"workflows": "("}}]}`, "production.workflows"},
+		{`{"repositories": [{"repo": "acme/shop"}], "backfill_months": 30}`, "backfill_months"},
+		{`{"repositories": [{"repo": "acme/shop"}], "api_url": "ftp://x"}`, "api_url"},
+		{`{"repositories": [{"repo": "acme/shop"}], "token": "x"}`, "unknown field"},
+	} {
+		err := New("gh", resilience.Config{}, zap.NewNop()).Validate(json.RawMessage(tc.config))
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: %v", tc.config, err)
+		case tc.err != "" && (!errors.Is(err, plugins.ErrInvalidConfig) || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: err = %v, want %q", tc.config, err, tc.err)
+		}
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	p, _ := newTestPlugin(t, `{"repositories": [{"repo": "acme/shop"}]}`)
+	if err := p.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck: %v", err)
+	}
+	p, _ = newTestPlugin(t, `{"repositories": [{"repo": "acme/gone"}]}`)
+	if err := p.HealthCheck(context.Background()); !errors.Is(err, errNotFound) {
+		t.Errorf("HealthCheck = %v, want not found", err)
+	}
+	if p.Breaker().State != resilience.StateClosed {
+		t.Errorf("breaker = %+v", p.Breaker())
+	}
+}
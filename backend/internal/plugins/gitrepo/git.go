@@ -0,0 +1,88 @@
+package gitrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// errUnknownCommit means the repository does not have a commit (yet).
+var errUnknownCommit = errors.New("gitrepo: unknown commit")
+
+// shaPattern matches abbreviated and full commit SHAs; deployments carrying
+// anything else are skipped, so no deployment field reaches git as an option.
+var shaPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+func validSHA(sha string) bool { return shaPattern.MatchString(sha) }
+
+// git runs a git command in dir and returns its standard output.
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	// Never wait for credentials, and keep messages parseable
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// hasCommit reports whether the repository in dir has the commit.
+func hasCommit(ctx context.Context, dir, sha string) (bool, error) {
+	_, err := git(ctx, dir, "cat-file", "-e", sha+"^{commit}")
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && ctx.Err() == nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// logFormat separates fields with US and commits with RS, which commit
+// subjects do not contain.
+const logFormat = "--format=%H%x1f%an%x1f%aI%x1f%cI%x1f%s%x1e"
+
+// logCommits runs git log with args and parses the commits it lists.
+func logCommits(ctx context.Context, dir, repository string, args ...string) ([]metrics.Commit, error) {
+	out, err := git(ctx, dir, append([]string{"log", "--no-color", logFormat}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []metrics.Commit
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		rec = strings.TrimSpace(rec)
+		if rec == "" {
+			continue
+		}
+		f := strings.Split(rec, "\x1f")
+		if len(f) != 5 {
+			return nil, fmt.Errorf("git log: unexpected record %q", rec)
+		}
+		authored, err := time.Parse(time.RFC3339, f[2])
+		if err != nil {
+			return nil, fmt.Errorf("git log: %w", err)
+		}
+		committed, err := time.Parse(time.RFC3339, f[3])
+		if err != nil {
+			return nil, fmt.Errorf("git log: %w", err)
+		}
+		commits = append(commits, metrics.Commit{
+			Repository:  repository,
+			SHA:         f[0],
+			Author:      f[1],
+			Message:     f[4],
+			AuthoredAt:  authored.UTC(),
+			CommittedAt: committed.UTC(),
+		})
+	}
+	return commits, nil
+}
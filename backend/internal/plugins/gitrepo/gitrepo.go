@@ -0,0 +1,274 @@
+// Package gitrepo is the built-in git collector plugin. It reads local
+// clones or mirrors of repositories with the git command and, for each
+// successful deployment stored for one of them, records the commits that
+// deployment shipped: those between the previous deployment's commit and
+// its own. Their author and committer times give deployments an accurate
+// commit time, and so lead time, without a hosted API.
+package gitrepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const schema = `{
+  "type": "object",
+  "required": ["repositories"],
+  "additionalProperties": false,
+  "properties": {
+    "repositories": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "required": ["path", "repository"],
+        "additionalProperties": false,
+        "properties": {
+          "path": {"type": "string", "description": "Absolute path of a clone or mirror on the server"},
+          "repository": {"type": "string", "description": "Repository name deployments carry, e.g. acme/shop"},
+          "fetch": {"type": "boolean", "default": false, "description": "Fetch all remotes before each cycle"}
+        }
+      }
+    },
+    "lookback_days": {"type": "integer", "minimum": 1, "maximum": 365, "default": 30, "description": "Age of the oldest deployment given commits"},
+    "max_commits": {"type": "integer", "minimum": 1, "maximum": 10000, "default": 500, "description": "Commits recorded per deployment at most"}
+  }
+}`
+
+// Config is the plugin configuration.
+type Config struct {
+	Repositories []Repository `json:"repositories"`
+	LookbackDays int          `json:"lookback_days"`
+	MaxCommits   int          `json:"max_commits"`
+}
+
+// Repository is a local repository and the name deployments give it.
+type Repository struct {
+	Path       string `json:"path"`
+	Repository string `json:"repository"`
+	Fetch      bool   `json:"fetch"`
+}
+
+// Plugin records commit times from local git repositories.
+type Plugin struct {
+	name        string
+	logger      *zap.Logger
+	now         func() time.Time
+	deployments plugins.DeploymentLister
+
+	cfg   Config
+	repos map[string]Repository // by Repository
+}
+
+// Factory registers the plugin as a plugin type.
+func Factory(logger *zap.Logger) plugins.Factory {
+	return func(name string) plugins.Plugin { return New(name, logger) }
+}
+
+// New returns an unconfigured plugin instance.
+func New(name string, logger *zap.Logger) *Plugin {
+	return &Plugin{name: name, logger: logger.With(zap.String("plugin", name)), now: time.Now}
+}
+
+func (p *Plugin) Name() string { return p.name }
+
+func (p *Plugin) Description() string {
+	return "Commits shipped by each deployment, read from local git repositories"
+}
+
+func (p *Plugin) Version() string               { return "1.0.0" }
+func (p *Plugin) ConfigSchema() json.RawMessage { return json.RawMessage(schema) }
+
+// UseDeployments implements plugins.DeploymentConsumer.
+func (p *Plugin) UseDeployments(d plugins.DeploymentLister) { p.deployments = d }
+
+func (p *Plugin) Validate(raw json.RawMessage) error {
+	_, err := parseConfig(raw)
+	return err
+}
+
+func parseConfig(raw json.RawMessage) (Config, error) {
+	cfg := Config{LookbackDays: 30, MaxCommits: 500}
+	if err := plugins.DecodeConfig(raw, &cfg); err != nil {
+		return cfg, err
+	}
+	switch {
+	case len(cfg.Repositories) == 0:
+		return cfg, fmt.Errorf("%w: repositories is required", plugins.ErrInvalidConfig)
+	case cfg.LookbackDays < 1 || cfg.LookbackDays > 365:
+		return cfg, fmt.Errorf("%w: lookback_days must be between 1 and 365", plugins.ErrInvalidConfig)
+	case cfg.MaxCommits < 1 || cfg.MaxCommits > 10000:
+		return cfg, fmt.Errorf("%w: max_commits must be between 1 and 10000", plugins.ErrInvalidConfig)
+	}
+	seen := map[string]bool{}
+	for _, r := range cfg.Repositories {
+		switch {
+		case r.Repository == "":
+			return cfg, fmt.Errorf("%w: repository is required", plugins.ErrInvalidConfig)
+		case !filepath.IsAbs(r.Path):
+			return cfg, fmt.Errorf("%w: %s: path must be absolute", plugins.ErrInvalidConfig, r.Repository)
+		case seen[r.Repository]:
+			return cfg, fmt.Errorf("%w: repository %q is listed twice", plugins.ErrInvalidConfig, r.Repository)
+		}
+		seen[r.Repository] = true
+	}
+	return cfg, nil
+}
+
+// Initialize checks that each path is a git repository.
+func (p *Plugin) Initialize(ctx context.Context, raw json.RawMessage) error {
+	cfg, err := parseConfig(raw)
+	if err != nil {
+		return err
+	}
+	p.cfg, p.repos = cfg, make(map[string]Repository, len(cfg.Repositories))
+	for _, r := range cfg.Repositories {
+		p.repos[r.Repository] = r
+	}
+	return p.HealthCheck(ctx)
+}
+
+// HealthCheck checks that each path is a git repository.
+func (p *Plugin) HealthCheck(ctx context.Context) error {
+	for _, r := range p.cfg.Repositories {
+		if _, err := git(ctx, r.Path, "rev-parse", "--git-dir"); err != nil {
+			return fmt.Errorf("%s: %w", r.Repository, err)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) Shutdown(context.Context) error { return nil }
+
+// cursor is the plugin's Cursor, JSON encoded: the deployments whose
+// commits were recorded, with their start times, so they are forgotten once
+// they leave the lookback window.
+type cursor struct {
+	Done map[string]time.Time `json:"done"`
+}
+
+// key groups deployments that succeed one another.
+type key struct{ repository, service, environment string }
+
+// Collect records the commits of successful deployments within the lookback
+// window that have not been handled yet. A deployment's commits are those
+// reachable from its commit but not from the commit of the previous
+// successful deployment of the same service to the same environment; the
+// first one known only ships its own commit. Deployments whose commit is not
+// in the local repository yet are retried next cycle.
+func (p *Plugin) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	if p.deployments == nil {
+		return nil, errors.New("gitrepo: no deployment store")
+	}
+	var cur cursor
+	if since != "" {
+		if err := json.Unmarshal([]byte(since), &cur); err != nil {
+			p.logger.Warn("discarding unreadable cursor", zap.Error(err))
+		}
+	}
+	for _, r := range p.cfg.Repositories {
+		if r.Fetch {
+			if _, err := git(ctx, r.Path, "fetch", "--all", "--prune", "--quiet"); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.Repository, err)
+			}
+		}
+	}
+
+	now := p.now()
+	lookback := time.Duration(p.cfg.LookbackDays) * 24 * time.Hour
+	windowStart := now.Add(-lookback)
+	// Deployments up to one window earlier are read as predecessors only
+	deployments, err := p.deployments.ListRange(ctx, windowStart.Add(-lookback), now)
+	if err != nil {
+		return nil, fmt.Errorf("list deployments: %w", err)
+	}
+	sort.SliceStable(deployments, func(i, j int) bool { return deployments[i].StartTime.Before(deployments[j].StartTime) })
+
+	batch := &plugins.Batch{}
+	next := cursor{Done: map[string]time.Time{}}
+	previous := map[key]string{}
+	for _, d := range deployments {
+		r, ok := p.repos[d.Repository]
+		if !ok || d.Status != metrics.DeploymentStatusSuccess || !validSHA(d.CommitSHA) {
+			continue
+		}
+		k := key{d.Repository, d.Service, d.Environment}
+		prev := previous[k]
+		previous[k] = d.CommitSHA
+		if d.StartTime.Before(windowStart) {
+			continue
+		}
+		if _, done := cur.Done[d.ID]; done {
+			next.Done[d.ID] = d.StartTime
+			continue
+		}
+		commits, err := p.shipped(ctx, r, prev, d.CommitSHA)
+		if errors.Is(err, errUnknownCommit) {
+			p.logger.Debug("deployed commit not in repository yet", zap.String("deployment", d.ID), zap.String("sha", d.CommitSHA))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: deployment %s: %w", r.Repository, d.ID, err)
+		}
+		next.Done[d.ID] = d.StartTime
+		batch.Commits = append(batch.Commits, commits...)
+		// The earliest shipped commit waited longest, as in the webhook
+		// adapters; stored commit times only ever move earlier
+		earliest := d.CommitTime
+		for _, c := range commits {
+			if earliest.IsZero() || c.CommittedAt.Before(earliest) {
+				earliest = c.CommittedAt
+			}
+		}
+		if !earliest.Equal(d.CommitTime) {
+			d.CommitTime, d.UpdatedAt = earliest, time.Time{}
+			batch.Deployments = append(batch.Deployments, d)
+		}
+	}
+	b, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+	batch.Cursor = plugins.Cursor(b)
+	return batch, nil
+}
+
+// shipped returns the commits reachable from sha but not from prev, newest
+// first and at most MaxCommits. Without prev, or when prev is not in the
+// repository (e.g. it was force-pushed away), it is sha's commit alone.
+func (p *Plugin) shipped(ctx context.Context, r Repository, prev, sha string) ([]metrics.Commit, error) {
+	ok, err := hasCommit(ctx, r.Path, sha)
+	if err != nil || !ok {
+		if err == nil {
+			err = errUnknownCommit
+		}
+		return nil, err
+	}
+	args := []string{"-1", sha}
+	if prev != "" {
+		known, err := hasCommit(ctx, r.Path, prev)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			args = []string{fmt.Sprintf("--max-count=%d", p.cfg.MaxCommits), prev + ".." + sha}
+		}
+	}
+	commits, err := logCommits(ctx, r.Path, r.Repository, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == p.cfg.MaxCommits {
+		p.logger.Warn("deployment shipped more commits than max_commits; recording the newest", zap.String("repository", r.Repository), zap.String("sha", sha), zap.Int("max_commits", p.cfg.MaxCommits))
+	}
+	return commits, nil
+}
@@ -0,0 +1,203 @@
+package gitrepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+var base = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// repo is a scratch repository whose commits are made at fixed times.
+type repo struct {
+	t   *testing.T
+	dir string
+}
+
+func newRepo(t *testing.T) *repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	r := &repo{t: t, dir: t.TempDir()}
+	r.run(time.Time{}, "init", "--quiet")
+	return r
+}
+
+func (r *repo) run(at time.Time, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null",
+		"GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com",
+		"GIT_COMMITTER_NAME=Bot", "GIT_COMMITTER_EMAIL=bot@example.com",
+	)
+	if !at.IsZero() {
+		// Authored an hour before committed, as after a rebase
+		cmd.Env = append(cmd.Env,
+			"GIT_AUTHOR_DATE="+at.Add(-time.Hour).Format(time.RFC3339),
+			"GIT_COMMITTER_DATE="+at.Format(time.RFC3339))
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit commits a change at the time and returns its SHA.
+func (r *repo) commit(msg string, at time.Time) string {
+	r.t.Helper()
+	if err := os.WriteFile(filepath.Join(r.dir, "log.txt"), []byte(msg), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+	r.run(at, "add", "log.txt")
+	r.run(at, "commit", "--quiet", "-m", msg)
+	return r.run(time.Time{}, "rev-parse", "HEAD")
+}
+
+type lister []metrics.Deployment
+
+func (l lister) ListRange(_ context.Context, start, end time.Time) ([]metrics.Deployment, error) {
+	var out []metrics.Deployment
+	for _, d := range l {
+		if !d.StartTime.Before(start) && !d.StartTime.After(end) {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func deploy(id, sha string, at time.Time) metrics.Deployment {
+	return metrics.Deployment{
+		ID: id, Service: "shop", Environment: "production", Repository: "acme/shop",
+		CommitSHA: sha, CommitTime: at, StartTime: at, Status: metrics.DeploymentStatusSuccess,
+	}
+}
+
+func start(t *testing.T, dir string, deployments lister) *Plugin {
+	t.Helper()
+	p := New("git", zap.NewNop())
+	p.now = func() time.Time { return base.Add(10 * 24 * time.Hour) }
+	p.UseDeployments(deployments)
+	cfg := `{"repositories": [{"path": "` + dir + `", "repository": "acme/shop"}]}`
+	if err := p.Initialize(context.Background(), json.RawMessage(cfg)); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func shas(commits []metrics.Commit) []string {
+	var out []string
+	for _, c := range commits {
+		out = append(out, c.SHA)
+	}
+	return out
+}
+
+func TestCollectRecordsShippedCommits(t *testing.T) {
+	r := newRepo(t)
+	c1 := r.commit("first", base)
+	c2 := r.commit("second", base.Add(24*time.Hour))
+	c3 := r.commit("third", base.Add(25*time.Hour))
+	deployments := lister{
+		deploy("d1", c1, base.Add(2*time.Hour)),
+		deploy("d2", c3, base.Add(2*24*time.Hour)),
+		// A rollback ships nothing
+		deploy("d3", c1[:12], base.Add(3*24*time.Hour)),
+	}
+	failed := deploy("d4", c2, base.Add(4*24*time.Hour))
+	failed.Status = metrics.DeploymentStatusFailed
+	deployments = append(deployments, failed)
+	p := start(t, r.dir, deployments)
+
+	batch, err := p.Collect(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(shas(batch.Commits), " "), c1+" "+c3+" "+c2; got != want {
+		t.Fatalf("commits = %s, want %s", got, want)
+	}
+	second := batch.Commits[2]
+	if second.Repository != "acme/shop" || second.Author != "Ada" || second.Message != "second" ||
+		!second.CommittedAt.Equal(base.Add(24*time.Hour)) || !second.AuthoredAt.Equal(base.Add(23*time.Hour)) {
+		t.Errorf("commit = %+v", second)
+	}
+	// Commit times move back to the earliest shipped commit; the rollback's
+	// stays as it was
+	if len(batch.Deployments) != 2 || batch.Deployments[0].ID != "d1" || batch.Deployments[1].ID != "d2" ||
+		!batch.Deployments[0].CommitTime.Equal(base) || !batch.Deployments[1].CommitTime.Equal(base.Add(24*time.Hour)) {
+		t.Fatalf("deployments = %+v", batch.Deployments)
+	}
+
+	// Handled deployments are not read again
+	batch, err = p.Collect(context.Background(), batch.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Commits) != 0 || len(batch.Deployments) != 0 {
+		t.Errorf("second cycle = %+v", batch)
+	}
+}
+
+func TestCollectWaitsForUnknownCommits(t *testing.T) {
+	r := newRepo(t)
+	c1 := r.commit("first", base)
+	missing := strings.Repeat("ab", 20)
+	p := start(t, r.dir, lister{
+		deploy("d1", c1, base.Add(time.Hour)),
+		deploy("d2", missing, base.Add(24*time.Hour)),
+		deploy("d3", "--output=/tmp/x", base.Add(48*time.Hour)),
+	})
+
+	batch, err := p.Collect(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cur cursor
+	if err := json.Unmarshal([]byte(batch.Cursor), &cur); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cur.Done["d1"]; !ok || len(cur.Done) != 1 {
+		t.Errorf("done = %v, want only d1", cur.Done)
+	}
+}
+
+func TestCollectNeedsDeployments(t *testing.T) {
+	r := newRepo(t)
+	p := start(t, r.dir, nil)
+	p.deployments = nil
+	if _, err := p.Collect(context.Background(), ""); err == nil {
+		t.Error("Collect without a deployment store succeeded")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, raw := range []string{
+		`{}`,
+		`{"repositories": [{"path": "relative", "repository": "acme/shop"}]}`,
+		`{"repositories": [{"path": "/srv/shop"}]}`,
+		`{"repositories": [{"path": "/a", "repository": "acme/shop"}, {"path": "/b", "repository": "acme/shop"}]}`,
+		`{"repositories": [{"path": "/srv/shop", "repository": "acme/shop"}], "lookback_days": 0}`,
+		`{"repositories": [{"path": "/srv/shop", "repository": "acme/shop"}], "unknown": 1}`,
+	} {
+		if err := New("git", zap.NewNop()).Validate(json.RawMessage(raw)); !errors.Is(err, plugins.ErrInvalidConfig) {
+			t.Errorf("Validate(%s) = %v, want ErrInvalidConfig", raw, err)
+		}
+	}
+	p := New("git", zap.NewNop())
+	err := p.Initialize(context.Background(), json.RawMessage(`{"repositories": [{"path": "`+t.TempDir()+`", "repository": "acme/shop"}]}`))
+	if err == nil {
+		t.Error("Initialize accepted a directory that is not a repository")
+	}
+}
@@ -0,0 +1,185 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPages bounds the search result pages read per cycle, so a runaway
+// backfill ends in an error instead of running until the cycle timeout.
+const maxPages = 100
+
+// pageSize is the issues requested per search page.
+const pageSize = 100
+
+// searchFields are the issue fields the plugin reads.
+const searchFields = "summary,description,priority,status,created,updated,resolutiondate,components,labels,assignee,issuelinks"
+
+// timestamp is a Jira date-time, such as 2024-05-01T10:00:00.000+0000.
+type timestamp struct{ time.Time }
+
+func (t *timestamp) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		return err
+	}
+	v, err := time.Parse("2006-01-02T15:04:05.000-0700", s)
+	if err != nil {
+		return err
+	}
+	t.Time = v.UTC()
+	return nil
+}
+
+type named struct {
+	Name string `json:"name"`
+}
+
+type linkedIssue struct {
+	Key string `json:"key"`
+}
+
+type issueLink struct {
+	InwardIssue  *linkedIssue `json:"inwardIssue"`
+	OutwardIssue *linkedIssue `json:"outwardIssue"`
+}
+
+type issueFields struct {
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Priority    *named `json:"priority"`
+	Status      struct {
+		Name           string `json:"name"`
+		StatusCategory struct {
+			Key string `json:"key"`
+		} `json:"statusCategory"`
+	} `json:"status"`
+	Created        timestamp `json:"created"`
+	Updated        timestamp `json:"updated"`
+	ResolutionDate timestamp `json:"resolutiondate"`
+	Components     []named   `json:"components"`
+	Labels         []string  `json:"labels"`
+	Assignee       *struct {
+		DisplayName string `json:"displayName"`
+	} `json:"assignee"`
+	IssueLinks []issueLink `json:"issuelinks"`
+}
+
+type history struct {
+	Created timestamp `json:"created"`
+	Items   []struct {
+		Field    string `json:"field"`
+		ToString string `json:"toString"`
+	} `json:"items"`
+}
+
+type issue struct {
+	Key       string      `json:"key"`
+	Fields    issueFields `json:"fields"`
+	Changelog struct {
+		Histories []history `json:"histories"`
+	} `json:"changelog"`
+}
+
+// searchPage is a page of either search API: Cloud's enhanced search pages
+// with tokens, Data Center's with offsets.
+type searchPage struct {
+	Issues        []issue `json:"issues"`
+	NextPageToken string  `json:"nextPageToken"`
+	IsLast        bool    `json:"isLast"`
+	StartAt       int     `json:"startAt"`
+	Total         int     `json:"total"`
+}
+
+// get fetches path (relative to the base URL) with query q into v.
+func (p *Plugin) get(ctx context.Context, path string, q url.Values, v any) error {
+	u := p.cfg.BaseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "MetricHub")
+	switch {
+	case p.cfg.Secret == "":
+	case p.cfg.Email != "":
+		req.SetBasicAuth(p.cfg.Email, p.cfg.Secret)
+	default:
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Secret)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("jira: GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("jira: GET %s: %w", path, err)
+	}
+	return nil
+}
+
+// search pages through the issues matching jql, with their changelogs.
+func (p *Plugin) search(ctx context.Context, jql string) ([]issue, error) {
+	path := "/rest/api/2/search/jql"
+	if p.cfg.Edition == editionDataCenter {
+		path = "/rest/api/2/search"
+	}
+	q := url.Values{
+		"jql":        {jql},
+		"fields":     {searchFields},
+		"expand":     {"changelog"},
+		"maxResults": {strconv.Itoa(pageSize)},
+	}
+	var issues []issue
+	for n := 0; ; n++ {
+		if n == maxPages {
+			return nil, fmt.Errorf("jira: search: more than %d pages", maxPages)
+		}
+		var page searchPage
+		if err := p.get(ctx, path, q, &page); err != nil {
+			return nil, err
+		}
+		issues = append(issues, page.Issues...)
+		if p.cfg.Edition == editionDataCenter {
+			next := page.StartAt + len(page.Issues)
+			if len(page.Issues) == 0 || next >= page.Total {
+				return issues, nil
+			}
+			q.Set("startAt", strconv.Itoa(next))
+			continue
+		}
+		if page.IsLast || page.NextPageToken == "" {
+			return issues, nil
+		}
+		q.Set("nextPageToken", page.NextPageToken)
+	}
+}
+
+// projectKeys lists the keys of the projects the user can see.
+func (p *Plugin) projectKeys(ctx context.Context) (map[string]bool, error) {
+	var projects []struct {
+		Key string `json:"key"`
+	}
+	if err := p.get(ctx, "/rest/api/2/project", nil, &projects); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(projects))
+	for _, pr := range projects {
+		keys[strings.ToUpper(pr.Key)] = true
+	}
+	return keys, nil
+}
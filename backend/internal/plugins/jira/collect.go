@@ -0,0 +1,240 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// overlap is read again each cycle, for issues Jira indexed late and for
+// clock skew between MetricHub and Jira.
+const overlap = 10 * time.Minute
+
+var (
+	projectKey = regexp.MustCompile(`^[A-Z][A-Z0-9_]+$`)
+	// ticketRef matches ticket keys in text; branch names often spell
+	// them in lower case, as in feature/shop-123-retry.
+	ticketRef = regexp.MustCompile(`\b([A-Za-z][A-Za-z0-9_]+-[1-9][0-9]*)\b`)
+)
+
+// cursor is the plugin's Cursor, JSON encoded: when issues were last
+// searched, and the deployments whose tickets were recorded, with their
+// start times, so they are forgotten once they leave the lookback window.
+type cursor struct {
+	Updated     time.Time            `json:"updated"`
+	Deployments map[string]time.Time `json:"deployments"`
+}
+
+// Collect reads the incident issues updated since the last cycle, or within
+// the lookback window on the first one, and links the deployments of the
+// lookback window to the tickets their commits name. Deployments whose
+// commit is not stored yet are linked by branch only, and tried again next
+// cycle.
+func (p *Plugin) Collect(ctx context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	if p.deployments == nil || p.commits == nil {
+		return nil, errors.New("jira: no deployment or commit store")
+	}
+	var cur cursor
+	if since != "" {
+		if err := json.Unmarshal([]byte(since), &cur); err != nil {
+			p.logger.Warn("discarding unreadable cursor", zap.Error(err))
+		}
+	}
+	projects, err := p.projects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+
+	now := p.now().UTC()
+	lookback := time.Duration(p.cfg.LookbackDays) * 24 * time.Hour
+	from := cur.Updated
+	if from.IsZero() || from.Before(now.Add(-lookback)) {
+		from = now.Add(-lookback)
+	}
+	minutes := int((now.Sub(from) + overlap + time.Minute - 1) / time.Minute)
+	jql := fmt.Sprintf(`(%s) AND updated >= "-%dm" ORDER BY updated ASC`, p.cfg.IncidentJQL, minutes)
+	issues, err := p.search(ctx, jql)
+	if err != nil {
+		return nil, fmt.Errorf("search incidents: %w", err)
+	}
+
+	batch := &plugins.Batch{}
+	for _, is := range issues {
+		inc := p.incident(is)
+		batch.Incidents = append(batch.Incidents, inc)
+		for _, t := range incidentTickets(is, projects) {
+			batch.TicketLinks = append(batch.TicketLinks, metrics.TicketLink{Ticket: t, IncidentID: inc.ID})
+		}
+	}
+
+	deployments, err := p.deployments.ListRange(ctx, now.Add(-lookback), now)
+	if err != nil {
+		return nil, fmt.Errorf("list deployments: %w", err)
+	}
+	next := cursor{Updated: now, Deployments: map[string]time.Time{}}
+	for _, d := range deployments {
+		if _, done := cur.Deployments[d.ID]; done {
+			next.Deployments[d.ID] = d.StartTime
+			continue
+		}
+		text := d.Branch
+		done := d.Repository == "" || d.CommitSHA == ""
+		if !done {
+			c, err := p.commits.Get(ctx, d.Repository, d.CommitSHA)
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				p.logger.Debug("deployed commit not stored yet", zap.String("deployment", d.ID), zap.String("sha", d.CommitSHA))
+			case err != nil:
+				return nil, fmt.Errorf("deployment %s: commit: %w", d.ID, err)
+			default:
+				text += "\n" + c.Message
+				done = true
+			}
+		}
+		if done {
+			next.Deployments[d.ID] = d.StartTime
+		}
+		for _, t := range tickets(text, projects) {
+			batch.TicketLinks = append(batch.TicketLinks, metrics.TicketLink{Ticket: t, DeploymentID: d.ID})
+		}
+	}
+	b, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+	batch.Cursor = plugins.Cursor(b)
+	return batch, nil
+}
+
+// projects returns the project keys ticket references are matched against.
+func (p *Plugin) projects(ctx context.Context) (map[string]bool, error) {
+	if len(p.cfg.TicketProjects) == 0 {
+		return p.projectKeys(ctx)
+	}
+	keys := make(map[string]bool, len(p.cfg.TicketProjects))
+	for _, k := range p.cfg.TicketProjects {
+		keys[k] = true
+	}
+	return keys, nil
+}
+
+// incident maps an incident issue. A done issue was resolved by its last
+// status change; without a changelog, its resolution date or last update
+// stands in.
+func (p *Plugin) incident(is issue) metrics.Incident {
+	f := is.Fields
+	severity := metrics.SeverityMedium
+	if f.Priority != nil {
+		if s, ok := p.severities[strings.ToLower(f.Priority.Name)]; ok {
+			severity = s
+		}
+	}
+	var service string
+	if len(f.Components) > 0 {
+		service = f.Components[0].Name
+	}
+	inc := metrics.Incident{
+		ID:          "jira-" + is.Key,
+		Title:       firstNonEmpty(f.Summary, "Jira issue "+is.Key),
+		Description: f.Description,
+		Service:     firstNonEmpty(label(f.Labels, "service"), service, "unknown"),
+		Environment: firstNonEmpty(label(f.Labels, "environment"), label(f.Labels, "env"), p.cfg.Environment),
+		Severity:    severity,
+		StartTime:   f.Created.Time,
+		Tags:        map[string]string{"jira_key": is.Key, "status": f.Status.Name},
+	}
+	if f.Assignee != nil {
+		inc.Assignee = f.Assignee.DisplayName
+	}
+	if f.Status.StatusCategory.Key == "done" {
+		var resolved time.Time
+		for _, h := range is.Changelog.Histories {
+			for _, item := range h.Items {
+				if item.Field == "status" && h.Created.After(resolved) {
+					resolved = h.Created.Time
+				}
+			}
+		}
+		if resolved.IsZero() {
+			resolved = f.ResolutionDate.Time
+		}
+		if resolved.IsZero() {
+			resolved = f.Updated.Time
+		}
+		inc.ResolvedTime = &resolved
+	}
+	return inc
+}
+
+// incidentTickets are the tickets an incident refers to: its own key, the
+// issues linked to it and the keys in its summary and description.
+func incidentTickets(is issue, projects map[string]bool) []string {
+	keys := []string{is.Key}
+	for _, l := range is.Fields.IssueLinks {
+		if l.InwardIssue != nil {
+			keys = append(keys, l.InwardIssue.Key)
+		}
+		if l.OutwardIssue != nil {
+			keys = append(keys, l.OutwardIssue.Key)
+		}
+	}
+	keys = append(keys, tickets(is.Fields.Summary+"\n"+is.Fields.Description, projects)...)
+	return unique(keys)
+}
+
+// tickets returns the keys of the known projects' tickets named in text,
+// upper-cased and sorted.
+func tickets(text string, projects map[string]bool) []string {
+	var keys []string
+	for _, m := range ticketRef.FindAllString(text, -1) {
+		key := strings.ToUpper(m)
+		project, _, _ := strings.Cut(key, "-")
+		if projects[project] {
+			keys = append(keys, key)
+		}
+	}
+	return unique(keys)
+}
+
+// unique sorts keys and drops duplicates and empty keys.
+func unique(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	out := keys[:0]
+	for _, k := range keys {
+		if k != "" && !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// label returns the value of the first "name:value" label.
+func label(labels []string, name string) string {
+	for _, l := range labels {
+		if k, v, ok := strings.Cut(l, ":"); ok && strings.EqualFold(k, name) && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
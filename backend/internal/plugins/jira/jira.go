@@ -0,0 +1,193 @@
+// Package jira is the built-in Jira collector plugin. It reads incident
+// issues through Jira's REST search API and stores them as incidents, with
+// their severity taken from the issue priority and their resolution time
+// from the status change that closed them.
+//
+// It also links incidents and deployments through ticket keys such as
+// SHOP-123: an incident is linked to its own key, the issues it links to and
+// the keys in its text; a deployment to the keys in its branch and in the
+// message of the commit it deployed. Incidents and deployments sharing a
+// ticket are listed by GET /api/v1/incidents/{id}/deployments.
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const schema = `{
+  "type": "object",
+  "required": ["base_url"],
+  "additionalProperties": false,
+  "properties": {
+    "base_url": {"type": "string", "description": "Site URL, such as https://acme.atlassian.net"},
+    "edition": {"type": "string", "enum": ["cloud", "datacenter"], "default": "cloud", "description": "Jira Cloud, or Jira Server and Data Center"},
+    "email": {"type": "string", "description": "Account the secret is an API token of (Cloud); unset, the secret is sent as a bearer personal access token"},
+    "incident_jql": {"type": "string", "default": "issuetype = Incident", "description": "JQL selecting incident issues"},
+    "severities": {"type": "object", "additionalProperties": {"type": "string", "enum": ["low", "medium", "high", "critical"]}, "description": "Severity of each priority name, over the defaults"},
+    "environment": {"type": "string", "default": "production", "description": "Environment of incidents without an environment label"},
+    "lookback_days": {"type": "integer", "minimum": 1, "maximum": 365, "default": 30, "description": "History read on the first cycle, and deployments linked to tickets"},
+    "ticket_projects": {"type": "array", "items": {"type": "string", "pattern": "^[A-Z][A-Z0-9_]+$"}, "description": "Project keys recognized in ticket references; unset, all projects the account can see"}
+  }
+}`
+
+// Editions, as configured.
+const (
+	editionCloud      = "cloud"
+	editionDataCenter = "datacenter"
+)
+
+// defaultSeverities maps the priority names of Jira's default schemes,
+// lower-cased; other priorities are medium.
+var defaultSeverities = map[string]metrics.IncidentSeverity{
+	"highest":  metrics.SeverityCritical,
+	"blocker":  metrics.SeverityCritical,
+	"critical": metrics.SeverityCritical,
+	"high":     metrics.SeverityHigh,
+	"major":    metrics.SeverityHigh,
+	"medium":   metrics.SeverityMedium,
+	"low":      metrics.SeverityLow,
+	"lowest":   metrics.SeverityLow,
+	"minor":    metrics.SeverityLow,
+	"trivial":  metrics.SeverityLow,
+}
+
+// Config is the plugin configuration.
+type Config struct {
+	BaseURL        string                              `json:"base_url"`
+	Edition        string                              `json:"edition"`
+	Email          string                              `json:"email"`
+	IncidentJQL    string                              `json:"incident_jql"`
+	Severities     map[string]metrics.IncidentSeverity `json:"severities"`
+	Environment    string                              `json:"environment"`
+	LookbackDays   int                                 `json:"lookback_days"`
+	TicketProjects []string                            `json:"ticket_projects"`
+	// Secret is the API token or personal access token, from the
+	// instance's secret reference.
+	Secret string `json:"secret"`
+}
+
+// Plugin collects incidents and ticket links from Jira.
+type Plugin struct {
+	name        string
+	logger      *zap.Logger
+	client      *resilience.Client
+	now         func() time.Time
+	deployments plugins.DeploymentLister
+	commits     plugins.CommitGetter
+
+	cfg        Config
+	severities map[string]metrics.IncidentSeverity // by lower-cased priority
+}
+
+// Factory registers the plugin as a plugin type; resilience tunes each
+// instance's HTTP client.
+func Factory(rc resilience.Config, logger *zap.Logger) plugins.Factory {
+	return func(name string) plugins.Plugin { return New(name, rc, logger) }
+}
+
+// New returns an unconfigured plugin instance.
+func New(name string, rc resilience.Config, logger *zap.Logger) *Plugin {
+	logger = logger.With(zap.String("plugin", name))
+	return &Plugin{name: name, logger: logger, client: resilience.New(name, rc, logger), now: time.Now}
+}
+
+func (p *Plugin) Name() string { return p.name }
+
+func (p *Plugin) Description() string {
+	return "Jira incident issues, and the tickets linking them to deployments"
+}
+
+func (p *Plugin) Version() string               { return "1.0.0" }
+func (p *Plugin) ConfigSchema() json.RawMessage { return json.RawMessage(schema) }
+
+// Breaker reports the circuit breaker of the plugin's API client.
+func (p *Plugin) Breaker() resilience.State { return p.client.Breaker() }
+
+// UseDeployments implements plugins.DeploymentConsumer.
+func (p *Plugin) UseDeployments(d plugins.DeploymentLister) { p.deployments = d }
+
+// UseCommits implements plugins.CommitConsumer.
+func (p *Plugin) UseCommits(c plugins.CommitGetter) { p.commits = c }
+
+func (p *Plugin) Validate(raw json.RawMessage) error {
+	_, err := parseConfig(raw)
+	return err
+}
+
+// parseConfig decodes and checks a configuration, filling its defaults.
+func parseConfig(raw json.RawMessage) (Config, error) {
+	cfg := Config{Edition: editionCloud, IncidentJQL: "issuetype = Incident", Environment: "production", LookbackDays: 30}
+	if err := plugins.DecodeConfig(raw, &cfg); err != nil {
+		return cfg, err
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if u, err := url.Parse(cfg.BaseURL); cfg.BaseURL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, fmt.Errorf("%w: base_url must be an http(s) URL", plugins.ErrInvalidConfig)
+	}
+	switch {
+	case cfg.Edition != editionCloud && cfg.Edition != editionDataCenter:
+		return cfg, fmt.Errorf("%w: edition must be cloud or datacenter", plugins.ErrInvalidConfig)
+	case strings.TrimSpace(cfg.IncidentJQL) == "":
+		return cfg, fmt.Errorf("%w: incident_jql must not be empty", plugins.ErrInvalidConfig)
+	case cfg.Environment == "":
+		return cfg, fmt.Errorf("%w: environment must not be empty", plugins.ErrInvalidConfig)
+	case cfg.LookbackDays < 1 || cfg.LookbackDays > 365:
+		return cfg, fmt.Errorf("%w: lookback_days must be between 1 and 365", plugins.ErrInvalidConfig)
+	}
+	for priority, s := range cfg.Severities {
+		if !s.Valid() {
+			return cfg, fmt.Errorf("%w: severities: %q is not a severity for priority %q", plugins.ErrInvalidConfig, s, priority)
+		}
+	}
+	for _, key := range cfg.TicketProjects {
+		if !projectKey.MatchString(key) {
+			return cfg, fmt.Errorf("%w: ticket_projects: %q is not a project key", plugins.ErrInvalidConfig, key)
+		}
+	}
+	return cfg, nil
+}
+
+func (p *Plugin) Initialize(_ context.Context, raw json.RawMessage) error {
+	cfg, err := parseConfig(raw)
+	if err != nil {
+		return err
+	}
+	p.cfg = cfg
+	p.severities = make(map[string]metrics.IncidentSeverity, len(defaultSeverities)+len(cfg.Severities))
+	for priority, s := range defaultSeverities {
+		p.severities[priority] = s
+	}
+	for priority, s := range cfg.Severities {
+		p.severities[strings.ToLower(priority)] = s
+	}
+	if cfg.Secret == "" {
+		p.logger.Warn("no Jira token configured: only issues visible anonymously can be read")
+	}
+	return nil
+}
+
+// HealthCheck checks that the site answers and accepts the credentials.
+func (p *Plugin) HealthCheck(ctx context.Context) error {
+	if p.cfg.Secret == "" {
+		var v struct {
+			Version string `json:"version"`
+		}
+		return p.get(ctx, "/rest/api/2/serverInfo", nil, &v)
+	}
+	var v struct {
+		DisplayName string `json:"displayName"`
+	}
+	return p.get(ctx, "/rest/api/2/myself", nil, &v)
+}
+
+func (p *Plugin) Shutdown(context.Context) error { return nil }
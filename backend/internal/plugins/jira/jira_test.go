@@ -0,0 +1,311 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fake is a Jira site serving its issues one per search page, with Cloud's
+// page tokens or Data Center's offsets.
+type fake struct {
+	auth   string // expected Authorization header
+	issues []string
+
+	mu       sync.Mutex
+	searches []url.Values
+	requests []string
+}
+
+func (f *fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.URL.Path)
+	f.mu.Unlock()
+	if r.Header.Get("Authorization") != f.auth {
+		http.Error(w, `{"errorMessages": ["unauthorized"]}`, http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	switch r.URL.Path {
+	case "/rest/api/2/myself":
+		w.Write([]byte(`{"displayName": "MetricHub"}`))
+	case "/rest/api/2/project":
+		w.Write([]byte(`[{"key": "INC"}, {"key": "SHOP"}]`))
+	case "/rest/api/2/search/jql":
+		f.record(q)
+		i, _ := strconv.Atoi(q.Get("nextPageToken"))
+		page := map[string]any{"issues": f.page(i), "isLast": i+1 >= len(f.issues)}
+		if i+1 < len(f.issues) {
+			page["nextPageToken"] = strconv.Itoa(i + 1)
+		}
+		json.NewEncoder(w).Encode(page)
+	case "/rest/api/2/search":
+		f.record(q)
+		i, _ := strconv.Atoi(q.Get("startAt"))
+		json.NewEncoder(w).Encode(map[string]any{"issues": f.page(i), "startAt": i, "total": len(f.issues)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fake) record(q url.Values) {
+	f.mu.Lock()
+	f.searches = append(f.searches, q)
+	f.mu.Unlock()
+}
+
+func (f *fake) page(i int) []json.RawMessage {
+	if i >= len(f.issues) {
+		return []json.RawMessage{}
+	}
+	return []json.RawMessage{json.RawMessage(f.issues[i])}
+}
+
+func newTestPlugin(t *testing.T, config string, f *fake) *Plugin {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	p := New("jira-acme", resilience.Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, zap.NewNop())
+	p.now = func() time.Time { return now }
+	raw := `{"base_url": "` + srv.URL + `/", "secret": "t0ken", ` + strings.TrimPrefix(config, "{")
+	raw = strings.Replace(raw, ", }", "}", 1)
+	if err := p.Initialize(context.Background(), json.RawMessage(raw)); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// stores hands the plugin memory stores holding deployments.
+func stores(t *testing.T, p *Plugin, deployments ...metrics.Deployment) *storage.MemoryCommitRepo {
+	t.Helper()
+	repo := storage.NewMemoryDeploymentRepo()
+	for i := range deployments {
+		if err := repo.Create(context.Background(), &deployments[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commits := storage.NewMemoryCommitRepo()
+	p.UseDeployments(repo)
+	p.UseCommits(commits)
+	return commits
+}
+
+const resolvedIssue = `{
+  "key": "INC-1",
+  "fields": {
+    "summary": "Checkout returns 500s after SHOP-12 rollout",
+    "description": "Payments time out. See also utf-8 handling and FOO-1.",
+    "priority": {"name": "Highest"},
+    "status": {"name": "Closed", "statusCategory": {"key": "done"}},
+    "created": "2024-05-31T10:00:00.000+0200",
+    "updated": "2024-05-31T12:30:00.000+0000",
+    "resolutiondate": "2024-05-31T12:30:00.000+0000",
+    "labels": ["service:checkout", "env:staging"],
+    "components": [{"name": "storefront"}],
+    "assignee": {"displayName": "Dana Ops"},
+    "issuelinks": [{"outwardIssue": {"key": "SHOP-7"}}, {"inwardIssue": {"key": "INC-0"}}]
+  },
+  "changelog": {"histories": [
+    {"created": "2024-05-31T09:00:00.000+0000", "items": [{"field": "status", "toString": "In Progress"}]},
+    {"created": "2024-05-31T11:45:00.000+0000", "items": [{"field": "status", "toString": "Closed"}]},
+    {"created": "2024-05-31T12:30:00.000+0000", "items": [{"field": "labels", "toString": "env:staging"}]}
+  ]}
+}`
+
+const openIssue = `{
+  "key": "INC-2",
+  "fields": {
+    "summary": "",
+    "priority": {"name": "P9"},
+    "status": {"name": "Investigating", "statusCategory": {"key": "indeterminate"}},
+    "created": "2024-06-01T08:00:00.000+0000",
+    "updated": "2024-06-01T08:00:00.000+0000",
+    "components": [{"name": "payments"}]
+  }
+}`
+
+func TestCollectIncidentsAndLinks(t *testing.T) {
+	f := &fake{auth: "Basic b3BzQGFjbWUudGVzdDp0MGtlbg==", issues: []string{resolvedIssue, openIssue}}
+	p := newTestPlugin(t, `{"email": "ops@acme.test"}`, f)
+	commits := stores(t, p,
+		metrics.Deployment{ID: "d1", Service: "shop", Environment: "production", Status: metrics.DeploymentStatusSuccess, Repository: "acme/shop", CommitSHA: "aaa", StartTime: now.Add(-2 * time.Hour)},
+		metrics.Deployment{ID: "d2", Service: "shop", Environment: "production", Status: metrics.DeploymentStatusSuccess, Repository: "acme/shop", CommitSHA: "bbb", Branch: "feature/shop-9-retry", StartTime: now.Add(-time.Hour)},
+		metrics.Deployment{ID: "d3", Service: "shop", Environment: "production", Status: metrics.DeploymentStatusSuccess, Branch: "release/SHOP-3", StartTime: now.Add(-time.Hour)},
+	)
+	ctx := context.Background()
+	if err := commits.Save(ctx, []metrics.Commit{{Repository: "acme/shop", SHA: "aaa", Message: "Retry payment calls (SHOP-12)\n\nRefs shop-7, OPS-1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := p.Collect(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.searches) != 2 || f.searches[1].Get("nextPageToken") != "1" {
+		t.Fatalf("searches = %v", f.searches)
+	}
+	if jql := f.searches[0].Get("jql"); jql != `(issuetype = Incident) AND updated >= "-43210m" ORDER BY updated ASC` {
+		t.Errorf("jql = %s", jql)
+	}
+	if f.searches[0].Get("expand") != "changelog" {
+		t.Errorf("changelog not expanded: %v", f.searches[0])
+	}
+
+	if len(batch.Incidents) != 2 {
+		t.Fatalf("incidents = %+v", batch.Incidents)
+	}
+	resolved, open := batch.Incidents[0], batch.Incidents[1]
+	if resolved.ID != "jira-INC-1" || resolved.Severity != metrics.SeverityCritical || resolved.Service != "checkout" || resolved.Environment != "staging" || resolved.Assignee != "Dana Ops" {
+		t.Errorf("resolved incident = %+v", resolved)
+	}
+	if !resolved.StartTime.Equal(time.Date(2024, 5, 31, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("start = %v", resolved.StartTime)
+	}
+	// The last status change, not the later label edit
+	if resolved.ResolvedTime == nil || !resolved.ResolvedTime.Equal(time.Date(2024, 5, 31, 11, 45, 0, 0, time.UTC)) {
+		t.Errorf("resolved = %v", resolved.ResolvedTime)
+	}
+	if open.Title != "Jira issue INC-2" || open.Severity != metrics.SeverityMedium || open.Service != "payments" || open.Environment != "production" || open.ResolvedTime != nil {
+		t.Errorf("open incident = %+v", open)
+	}
+
+	want := []metrics.TicketLink{
+		{Ticket: "INC-0", IncidentID: "jira-INC-1"},
+		{Ticket: "INC-1", IncidentID: "jira-INC-1"},
+		{Ticket: "SHOP-12", IncidentID: "jira-INC-1"},
+		{Ticket: "SHOP-7", IncidentID: "jira-INC-1"},
+		{Ticket: "INC-2", IncidentID: "jira-INC-2"},
+		{Ticket: "SHOP-12", DeploymentID: "d1"},
+		{Ticket: "SHOP-7", DeploymentID: "d1"},
+		{Ticket: "SHOP-9", DeploymentID: "d2"},
+		{Ticket: "SHOP-3", DeploymentID: "d3"},
+	}
+	if !slices.Equal(batch.TicketLinks, want) {
+		t.Errorf("links = %+v\nwant %+v", batch.TicketLinks, want)
+	}
+	var cur cursor
+	if err := json.Unmarshal([]byte(batch.Cursor), &cur); err != nil || !cur.Updated.Equal(now) || len(cur.Deployments) != 2 {
+		t.Errorf("cursor = %s", batch.Cursor)
+	}
+
+	// d2's commit arrives; only it is linked again, and only recent
+	// updates are searched
+	if err := commits.Save(ctx, []metrics.Commit{{Repository: "acme/shop", SHA: "bbb", Message: "Back off on SHOP-10"}}); err != nil {
+		t.Fatal(err)
+	}
+	f.searches, f.issues = nil, nil
+	p.now = func() time.Time { return now.Add(5 * time.Minute) }
+	batch, err = p.Collect(ctx, batch.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jql := f.searches[0].Get("jql"); !strings.Contains(jql, `updated >= "-15m"`) {
+		t.Errorf("jql = %s", jql)
+	}
+	want = []metrics.TicketLink{{Ticket: "SHOP-10", DeploymentID: "d2"}, {Ticket: "SHOP-9", DeploymentID: "d2"}}
+	if len(batch.Incidents) != 0 || !slices.Equal(batch.TicketLinks, want) {
+		t.Errorf("second batch = %+v", batch)
+	}
+}
+
+func TestCollectDataCenter(t *testing.T) {
+	issues := []string{openIssue, strings.Replace(openIssue, "INC-2", "INC-3", 1)}
+	f := &fake{auth: "Bearer t0ken", issues: issues}
+	p := newTestPlugin(t, `{"edition": "datacenter", "incident_jql": "project = OPS", "severities": {"p9": "low"}, "environment": "prod", "ticket_projects": ["SHOP"]}`, f)
+	stores(t, p)
+
+	batch, err := p.Collect(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.searches) != 2 || f.searches[1].Get("startAt") != "1" || !strings.HasPrefix(f.searches[0].Get("jql"), "(project = OPS) AND") {
+		t.Errorf("searches = %v", f.searches)
+	}
+	if slices.Contains(f.requests, "/rest/api/2/project") {
+		t.Errorf("projects listed despite ticket_projects: %v", f.requests)
+	}
+	if len(batch.Incidents) != 2 || batch.Incidents[1].ID != "jira-INC-3" {
+		t.Fatalf("incidents = %+v", batch.Incidents)
+	}
+	for _, inc := range batch.Incidents {
+		if inc.Severity != metrics.SeverityLow || inc.Environment != "prod" {
+			t.Errorf("incident = %+v", inc)
+		}
+	}
+}
+
+func TestCollectNeedsStores(t *testing.T) {
+	p := newTestPlugin(t, `{}`, &fake{auth: "Bearer t0ken"})
+	if _, err := p.Collect(context.Background(), ""); err == nil {
+		t.Error("Collect without stores succeeded")
+	}
+}
+
+func TestCollectReportsSearchErrors(t *testing.T) {
+	p := newTestPlugin(t, `{"email": "ops@acme.test"}`, &fake{auth: "Bearer other"})
+	stores(t, p)
+	if _, err := p.Collect(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Collect = %v, want 401", err)
+	}
+}
+
+func TestTickets(t *testing.T) {
+	projects := map[string]bool{"SHOP": true, "PAY_2": true}
+	got := tickets("SHOP-12: fix; feature/shop-9-retry, PAY_2-1, SHOP-0, XSHOP-1, utf-8, SHOP-12", projects)
+	if want := []string{"PAY_2-1", "SHOP-12", "SHOP-9"}; !slices.Equal(got, want) {
+		t.Errorf("tickets = %v, want %v", got, want)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, tc := range []struct {
+		config, err string
+	}{
+		{`{"base_url": "https://acme.atlassian.net"}`, ""},
+		{`{"base_url": "https://jira.acme.test", "edition": "datacenter", "incident_jql": "project = OPS", "severities": {"P1": "critical"}, "environment": "prod", "lookback_days": 7, "ticket_projects": ["SHOP"]}`, ""},
+		{`{}`, "base_url"},
+		{`{"base_url": "ftp://x"}`, "base_url"},
+		{`{"base_url": "https://x", "edition": "server"}`, "edition"},
+		{`{"base_url": "https://x", "incident_jql": " "}`, "incident_jql"},
+		{`{"base_url": "https://x", "severities": {"P1": "urgent"}}`, "severities"},
+		{`{"base_url": "https://x", "lookback_days": 0}`, "lookback_days"},
+		{`{"base_url": "https://x", "ticket_projects": ["shop"]}`, "ticket_projects"},
+		{`{"base_url": "https://x", "token": "x"}`, "unknown field"},
+	} {
+		err := New("jira", resilience.Config{}, zap.NewNop()).Validate(json.RawMessage(tc.config))
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: %v", tc.config, err)
+		case tc.err != "" && (!errors.Is(err, plugins.ErrInvalidConfig) || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: err = %v, want %q", tc.config, err, tc.err)
+		}
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	p := newTestPlugin(t, `{}`, &fake{auth: "Bearer t0ken"})
+	if err := p.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck: %v", err)
+	}
+	p = newTestPlugin(t, `{}`, &fake{auth: "Bearer other"})
+	if err := p.HealthCheck(context.Background()); err == nil {
+		t.Error("HealthCheck with a rejected token succeeded")
+	}
+}
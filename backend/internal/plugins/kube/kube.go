@@ -0,0 +1,522 @@
+// Package kube is the built-in Kubernetes collector plugin, for clusters
+// deployed to without GitOps. It watches Deployments, StatefulSets and Argo
+// Rollouts through the Kubernetes API and records a deployment each time a
+// rollout of a new pod template completes or fails. Commit SHA, repository
+// and service come from the workloads' annotations, the version from their
+// image tags.
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const schema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "kubeconfig": {"type": "string", "description": "Absolute path of a kubeconfig file; unset, the in-cluster service account is used"},
+    "context": {"type": "string", "description": "kubeconfig context; defaults to the current one"},
+    "cluster": {"type": "string", "description": "Cluster name in environments and IDs; defaults to the context, or in-cluster"},
+    "namespaces": {"type": "array", "items": {"type": "string"}, "description": "Namespaces to watch; unset, all of them"},
+    "label_selector": {"type": "string", "description": "Only watch workloads matching this label selector"},
+    "kinds": {
+      "type": "array",
+      "items": {"enum": ["Deployment", "StatefulSet", "Rollout"]},
+      "description": "Workload kinds to watch; unset, all three, with Rollout only where Argo Rollouts is installed"
+    },
+    "annotations": {
+      "type": "object",
+      "additionalProperties": false,
+      "description": "Workload or pod template annotations carrying deployment metadata",
+      "properties": {
+        "commit": {"type": "string", "default": "metrichub.io/commit-sha"},
+        "repository": {"type": "string", "default": "metrichub.io/repository"},
+        "service": {"type": "string", "default": "metrichub.io/service"},
+        "environment": {"type": "string", "default": "metrichub.io/environment"}
+      }
+    }
+  }
+}`
+
+// Config is the plugin configuration.
+type Config struct {
+	Kubeconfig    string      `json:"kubeconfig"`
+	Context       string      `json:"context"`
+	Cluster       string      `json:"cluster"`
+	Namespaces    []string    `json:"namespaces"`
+	LabelSelector string      `json:"label_selector"`
+	Kinds         []string    `json:"kinds"`
+	Annotations   Annotations `json:"annotations"`
+}
+
+// Annotations name the annotations deployment metadata is read from.
+type Annotations struct {
+	Commit      string `json:"commit"`
+	Repository  string `json:"repository"`
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+}
+
+// clients are a cluster's API clients.
+type clients struct {
+	kube    kubernetes.Interface
+	dynamic dynamic.Interface
+	cluster string // name of the cluster when none is configured
+}
+
+// rollout is the last seen state of a workload's current revision.
+type rollout struct {
+	workload
+	started  time.Time // zero when first seen finished
+	finished time.Time // when it was first seen in its current final state
+}
+
+// Plugin watches workload rollouts in a cluster.
+type Plugin struct {
+	name    string
+	logger  *zap.Logger
+	now     func() time.Time
+	connect func(Config) (clients, error)
+
+	cfg       Config
+	cluster   string
+	clients   clients
+	stop      chan struct{}
+	factories []interface{ Shutdown() }
+
+	mu      sync.Mutex
+	tracked map[string]*rollout // by workload key
+}
+
+// Factory registers the plugin as a plugin type.
+func Factory(logger *zap.Logger) plugins.Factory {
+	return func(name string) plugins.Plugin { return New(name, logger) }
+}
+
+// New returns an unconfigured plugin instance.
+func New(name string, logger *zap.Logger) *Plugin {
+	return &Plugin{name: name, logger: logger.With(zap.String("plugin", name)), now: time.Now, connect: connect}
+}
+
+func (p *Plugin) Name() string { return p.name }
+
+func (p *Plugin) Description() string {
+	return "Deployment, StatefulSet and Argo Rollout rollouts, watched through the Kubernetes API"
+}
+
+func (p *Plugin) Version() string               { return "1.0.0" }
+func (p *Plugin) ConfigSchema() json.RawMessage { return json.RawMessage(schema) }
+
+func (p *Plugin) Validate(raw json.RawMessage) error {
+	_, err := parseConfig(raw)
+	return err
+}
+
+// parseConfig decodes and checks a configuration, filling its defaults;
+// Kinds stays empty when unset.
+func parseConfig(raw json.RawMessage) (Config, error) {
+	var cfg Config
+	if err := plugins.DecodeConfig(raw, &cfg); err != nil {
+		return cfg, err
+	}
+	switch {
+	case cfg.Kubeconfig != "" && !filepath.IsAbs(cfg.Kubeconfig):
+		return cfg, fmt.Errorf("%w: kubeconfig must be an absolute path", plugins.ErrInvalidConfig)
+	case cfg.Context != "" && cfg.Kubeconfig == "":
+		return cfg, fmt.Errorf("%w: context needs a kubeconfig", plugins.ErrInvalidConfig)
+	}
+	if _, err := labels.Parse(cfg.LabelSelector); err != nil {
+		return cfg, fmt.Errorf("%w: label_selector: %v", plugins.ErrInvalidConfig, err)
+	}
+	for _, ns := range cfg.Namespaces {
+		if ns == "" {
+			return cfg, fmt.Errorf("%w: namespaces must not be empty", plugins.ErrInvalidConfig)
+		}
+	}
+	seen := map[string]bool{}
+	for _, k := range cfg.Kinds {
+		if k != kindDeployment && k != kindStatefulSet && k != kindRollout {
+			return cfg, fmt.Errorf("%w: unknown kind %q", plugins.ErrInvalidConfig, k)
+		}
+		if seen[k] {
+			return cfg, fmt.Errorf("%w: kind %q is listed twice", plugins.ErrInvalidConfig, k)
+		}
+		seen[k] = true
+	}
+	a := &cfg.Annotations
+	for _, f := range []struct {
+		v   *string
+		def string
+	}{
+		{&a.Commit, "metrichub.io/commit-sha"},
+		{&a.Repository, "metrichub.io/repository"},
+		{&a.Service, "metrichub.io/service"},
+		{&a.Environment, "metrichub.io/environment"},
+	} {
+		if *f.v == "" {
+			*f.v = f.def
+		}
+	}
+	return cfg, nil
+}
+
+// connect builds clients from the kubeconfig, or the in-cluster service
+// account.
+func connect(cfg Config) (clients, error) {
+	var (
+		rc      *rest.Config
+		cluster = "in-cluster"
+		err     error
+	)
+	if cfg.Kubeconfig == "" {
+		rc, err = rest.InClusterConfig()
+	} else {
+		cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: cfg.Kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: cfg.Context})
+		if rc, err = cc.ClientConfig(); err == nil {
+			cluster = cfg.Context
+			if raw, err := cc.RawConfig(); cluster == "" && err == nil {
+				cluster = raw.CurrentContext
+			}
+		}
+	}
+	if err != nil {
+		return clients{}, err
+	}
+	rc.UserAgent = "metrichub"
+	kube, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		return clients{}, err
+	}
+	dyn, err := dynamic.NewForConfig(rc)
+	if err != nil {
+		return clients{}, err
+	}
+	return clients{kube: kube, dynamic: dyn, cluster: cluster}, nil
+}
+
+// Initialize connects to the cluster and starts watching, returning once
+// the current state of the workloads has been read.
+func (p *Plugin) Initialize(ctx context.Context, raw json.RawMessage) error {
+	cfg, err := parseConfig(raw)
+	if err != nil {
+		return err
+	}
+	c, err := p.connect(cfg)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	p.cfg, p.clients, p.cluster = cfg, c, cfg.Cluster
+	if p.cluster == "" {
+		p.cluster = c.cluster
+	}
+	kinds := map[string]bool{}
+	for _, k := range cfg.Kinds {
+		kinds[k] = true
+	}
+	if len(cfg.Kinds) == 0 {
+		kinds[kindDeployment], kinds[kindStatefulSet] = true, true
+		kinds[kindRollout] = p.servesRollouts() == nil
+		if !kinds[kindRollout] {
+			p.logger.Info("Argo Rollouts is not installed; not watching rollouts")
+		}
+	} else if kinds[kindRollout] {
+		if err := p.servesRollouts(); err != nil {
+			return err
+		}
+	}
+
+	p.tracked = map[string]*rollout{}
+	p.stop = make(chan struct{})
+	namespaces := cfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	tweak := func(o *metav1.ListOptions) { o.LabelSelector = cfg.LabelSelector }
+	var synced []func(<-chan struct{}) bool
+	for _, ns := range namespaces {
+		f := informers.NewSharedInformerFactoryWithOptions(c.kube, 0, informers.WithNamespace(ns), informers.WithTweakListOptions(tweak))
+		var watches []watch
+		if kinds[kindDeployment] {
+			watches = append(watches, watch{f.Apps().V1().Deployments().Informer(), readDeployment})
+		}
+		if kinds[kindStatefulSet] {
+			watches = append(watches, watch{f.Apps().V1().StatefulSets().Informer(), readStatefulSet})
+		}
+		var df dynamicinformer.DynamicSharedInformerFactory
+		if kinds[kindRollout] {
+			df = dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamic, 0, ns, tweak)
+			watches = append(watches, watch{df.ForResource(rollouts).Informer(), readRollout})
+		}
+		for _, w := range watches {
+			if _, err := w.informer.AddEventHandler(p.handler(w.read)); err != nil {
+				p.shutdown()
+				return err
+			}
+		}
+		f.Start(p.stop)
+		p.factories = append(p.factories, f)
+		synced = append(synced, func(stop <-chan struct{}) bool { return allSynced(f.WaitForCacheSync(stop)) })
+		if df != nil {
+			df.Start(p.stop)
+			p.factories = append(p.factories, df)
+			synced = append(synced, func(stop <-chan struct{}) bool { return allSynced(df.WaitForCacheSync(stop)) })
+		}
+	}
+	for _, wait := range synced {
+		if !wait(ctx.Done()) {
+			p.shutdown()
+			return fmt.Errorf("workloads not listed: %w", context.Cause(ctx))
+		}
+	}
+	return nil
+}
+
+func allSynced[T comparable](m map[T]bool) bool {
+	for _, ok := range m {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// servesRollouts checks that the cluster serves Argo Rollouts.
+func (p *Plugin) servesRollouts() error {
+	list, err := p.clients.kube.Discovery().ServerResourcesForGroupVersion(rollouts.GroupVersion().String())
+	if err != nil {
+		return fmt.Errorf("argo rollouts: %w", err)
+	}
+	for _, r := range list.APIResources {
+		if r.Name == rollouts.Resource {
+			return nil
+		}
+	}
+	return errors.New("argo rollouts: rollouts are not served")
+}
+
+// watch is an informer with the function reading its objects.
+type watch struct {
+	informer cache.SharedIndexInformer
+	read     func(interface{}) (workload, bool)
+}
+
+func readDeployment(obj interface{}) (workload, bool) {
+	if d, ok := obj.(*appsv1.Deployment); ok {
+		return fromDeployment(d)
+	}
+	return workload{}, false
+}
+
+func readStatefulSet(obj interface{}) (workload, bool) {
+	if s, ok := obj.(*appsv1.StatefulSet); ok {
+		return fromStatefulSet(s)
+	}
+	return workload{}, false
+}
+
+func readRollout(obj interface{}) (workload, bool) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return fromRollout(u)
+	}
+	return workload{}, false
+}
+
+func (p *Plugin) handler(read func(interface{}) (workload, bool)) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { p.observe(read(obj)) },
+		UpdateFunc: func(_, obj interface{}) { p.observe(read(obj)) },
+		DeleteFunc: func(obj interface{}) {
+			if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tomb.Obj
+			}
+			if w, ok := read(obj); ok {
+				p.mu.Lock()
+				delete(p.tracked, w.key())
+				p.mu.Unlock()
+			}
+		},
+	}
+}
+
+// observe tracks a workload's state, timing the rollout of each revision
+// from when it was first seen in progress to when it was first seen
+// finished.
+func (p *Plugin) observe(w workload, ok bool) {
+	if !ok {
+		return
+	}
+	now := p.now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.tracked[w.key()]
+	switch {
+	case r == nil || r.revision != w.revision:
+		r = &rollout{}
+		p.tracked[w.key()] = r
+		if w.state.IsTerminal() {
+			r.finished = now
+		} else {
+			r.started = now
+		}
+	case w.state != r.state && w.state.IsTerminal():
+		r.finished = now
+	}
+	r.workload = w
+}
+
+// HealthCheck checks that the API server answers.
+func (p *Plugin) HealthCheck(context.Context) error {
+	if p.clients.kube == nil {
+		return errors.New("not connected")
+	}
+	_, err := p.clients.kube.Discovery().ServerVersion()
+	return err
+}
+
+// Shutdown stops watching.
+func (p *Plugin) Shutdown(context.Context) error {
+	p.shutdown()
+	return nil
+}
+
+func (p *Plugin) shutdown() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	for _, f := range p.factories {
+		f.Shutdown()
+	}
+	p.stop, p.factories = nil, nil
+}
+
+// cursor is the plugin's Cursor, JSON encoded: the last recorded outcome of
+// each workload.
+type cursor struct {
+	Recorded map[string]outcome `json:"recorded"`
+}
+
+type outcome struct {
+	Revision string                   `json:"revision"`
+	Status   metrics.DeploymentStatus `json:"status"`
+}
+
+// Collect returns the rollouts that finished since the outcomes in the
+// cursor were recorded. The first cycle only records the workloads'
+// current outcomes: rollouts that finished before the plugin watched them
+// have no known start.
+func (p *Plugin) Collect(_ context.Context, since plugins.Cursor) (*plugins.Batch, error) {
+	var cur cursor
+	first := since == ""
+	if !first {
+		if err := json.Unmarshal([]byte(since), &cur); err != nil {
+			p.logger.Warn("discarding unreadable cursor", zap.Error(err))
+			first = true
+		}
+	}
+	p.mu.Lock()
+	tracked := make([]rollout, 0, len(p.tracked))
+	for _, r := range p.tracked {
+		tracked = append(tracked, *r)
+	}
+	p.mu.Unlock()
+	sort.Slice(tracked, func(i, j int) bool { return tracked[i].key() < tracked[j].key() })
+
+	batch := &plugins.Batch{}
+	next := cursor{Recorded: map[string]outcome{}}
+	for _, r := range tracked {
+		last, ok := cur.Recorded[r.key()]
+		if !r.state.IsTerminal() {
+			if ok {
+				next.Recorded[r.key()] = last
+			}
+			continue
+		}
+		now := outcome{Revision: r.revision, Status: r.state}
+		next.Recorded[r.key()] = now
+		if !first && (!ok || last != now) {
+			batch.Deployments = append(batch.Deployments, p.deployment(r))
+		}
+	}
+	b, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+	batch.Cursor = plugins.Cursor(b)
+	return batch, nil
+}
+
+// shaPattern matches image tags that are commit SHAs.
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// deployment maps a finished rollout. The environment defaults to
+// <cluster>/<namespace>, as for GitOps deployments, the service to the
+// app.kubernetes.io/name label or the workload name, and the version to
+// the app.kubernetes.io/version label or the first container's image tag.
+func (p *Plugin) deployment(r rollout) metrics.Deployment {
+	a := p.cfg.Annotations
+	var image string
+	if len(r.images) > 0 {
+		image = r.images[0]
+	}
+	tag := imageTag(image)
+	sha := r.annotations[a.Commit]
+	if sha == "" && shaPattern.MatchString(tag) {
+		sha = tag
+	}
+	start, end := r.started, r.finished
+	if start.IsZero() {
+		start = end
+	}
+	tags := map[string]string{"cluster": p.cluster, "namespace": r.namespace, "workload": r.kind + "/" + r.name}
+	if image != "" {
+		tags["image"] = image
+	}
+	return metrics.Deployment{
+		ID:          fmt.Sprintf("k8s-%s-%s-%s-%s-%s", p.cluster, r.namespace, strings.ToLower(r.kind), r.name, r.revision),
+		Service:     firstOf(r.annotations[a.Service], r.labels["app.kubernetes.io/name"], r.name),
+		Environment: firstOf(r.annotations[a.Environment], p.cluster+"/"+r.namespace),
+		Version:     firstOf(r.labels["app.kubernetes.io/version"], tag),
+		Status:      r.state,
+		StartTime:   start,
+		EndTime:     &end,
+		CommitSHA:   sha,
+		Repository:  r.annotations[a.Repository],
+		Tags:        tags,
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
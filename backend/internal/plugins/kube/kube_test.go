@@ -0,0 +1,277 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var shaA = "0a1b2c3d4e5f60718293a4b5c6d7e8f901234567"
+
+func replicas(n int32) *int32 { return &n }
+
+// deployment is a Deployment at a revision, rolled out or not.
+func deployment(revision, image string, done bool) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "shop", Namespace: "web", Generation: 2,
+			Labels:      map[string]string{"app.kubernetes.io/name": "storefront"},
+			Annotations: map[string]string{deploymentRevision: revision, "metrichub.io/repository": "acme/shop"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: replicas(2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"metrichub.io/commit-sha": shaA}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2},
+	}
+	if done {
+		d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+	}
+	return d
+}
+
+func argoRollout(revision, phase string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata": map[string]interface{}{
+			"name": "checkout", "namespace": "web", "generation": int64(4),
+			"annotations": map[string]interface{}{rolloutRevision: revision},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "app", "image": "ghcr.io/acme/checkout:" + shaA[:12]}},
+				},
+			},
+		},
+		"status": map[string]interface{}{"observedGeneration": "4", "phase": phase},
+	}}
+	return u
+}
+
+// cluster is a fake cluster serving Argo Rollouts.
+type cluster struct {
+	kube    *fake.Clientset
+	dynamic *dynamicfake.FakeDynamicClient
+}
+
+func newCluster(objs ...runtime.Object) *cluster {
+	c := &cluster{kube: fake.NewSimpleClientset(objs...)}
+	c.kube.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "argoproj.io/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "rollouts", Kind: "Rollout", Namespaced: true}},
+	}}
+	c.dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[k8sschema.GroupVersionResource]string{rollouts: "RolloutList"})
+	return c
+}
+
+func start(t *testing.T, c *cluster, config string) *Plugin {
+	t.Helper()
+	p := New("k8s", zap.NewNop())
+	p.connect = func(Config) (clients, error) {
+		return clients{kube: c.kube, dynamic: c.dynamic, cluster: "in-cluster"}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Initialize(ctx, json.RawMessage(config)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Shutdown(context.Background()) })
+	return p
+}
+
+// waitFor waits until the plugin has seen a workload's revision in a state.
+func waitFor(t *testing.T, p *Plugin, key, revision string, state metrics.DeploymentStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		r := p.tracked[key]
+		seen := r != nil && r.revision == revision && r.state == state
+		p.mu.Unlock()
+		if seen {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s never reached revision %s %s", key, revision, state)
+}
+
+func collect(t *testing.T, p *Plugin, cur plugins.Cursor) *plugins.Batch {
+	t.Helper()
+	batch, err := p.Collect(context.Background(), cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return batch
+}
+
+func TestCollectRecordsFinishedRollouts(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(deployment("1", "ghcr.io/acme/shop:1.4.1", true))
+	if _, err := c.dynamic.Resource(rollouts).Namespace("web").Create(ctx, argoRollout("7", "Healthy"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	p := start(t, c, `{}`)
+
+	// The first cycle only records what is already rolled out
+	batch := collect(t, p, "")
+	if len(batch.Deployments) != 0 {
+		t.Fatalf("first cycle recorded %+v", batch.Deployments)
+	}
+
+	deployments := c.kube.AppsV1().Deployments("web")
+	if _, err := deployments.Update(ctx, deployment("2", "ghcr.io/acme/shop:1.4.2", false), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, p, "Deployment/web/shop", "2", metrics.DeploymentStatusRunning)
+	// Nothing is recorded while a rollout progresses
+	if got := collect(t, p, batch.Cursor); len(got.Deployments) != 0 {
+		t.Fatalf("running rollout recorded %+v", got.Deployments)
+	}
+	if _, err := deployments.Update(ctx, deployment("2", "ghcr.io/acme/shop:1.4.2", true), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.dynamic.Resource(rollouts).Namespace("web").Update(ctx, argoRollout("8", "Degraded"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, p, "Deployment/web/shop", "2", metrics.DeploymentStatusSuccess)
+	waitFor(t, p, "Rollout/web/checkout", "8", metrics.DeploymentStatusFailed)
+
+	batch = collect(t, p, batch.Cursor)
+	if len(batch.Deployments) != 2 {
+		t.Fatalf("recorded %+v", batch.Deployments)
+	}
+	d := batch.Deployments[0]
+	if d.ID != "k8s-in-cluster-web-deployment-shop-2" || d.Service != "storefront" || d.Environment != "in-cluster/web" ||
+		d.Version != "1.4.2" || d.Status != metrics.DeploymentStatusSuccess || d.CommitSHA != shaA || d.Repository != "acme/shop" ||
+		d.Tags["image"] != "ghcr.io/acme/shop:1.4.2" || d.EndTime == nil || d.EndTime.Before(d.StartTime) {
+		t.Errorf("deployment = %+v", d)
+	}
+	r := batch.Deployments[1]
+	if r.ID != "k8s-in-cluster-web-rollout-checkout-8" || r.Service != "checkout" || r.Status != metrics.DeploymentStatusFailed ||
+		r.CommitSHA != shaA[:12] || r.Version != shaA[:12] {
+		t.Errorf("rollout = %+v", r)
+	}
+
+	// Scaling does not start a rollout, and recorded outcomes are not
+	// recorded again
+	scaled := deployment("2", "ghcr.io/acme/shop:1.4.2", true)
+	scaled.Spec.Replicas, scaled.Status.Replicas, scaled.Status.UpdatedReplicas, scaled.Status.AvailableReplicas = replicas(3), 3, 3, 3
+	if _, err := deployments.Update(ctx, scaled, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, p, batch.Cursor); len(got.Deployments) != 0 {
+		t.Errorf("recorded again: %+v", got.Deployments)
+	}
+}
+
+func TestDeploymentStates(t *testing.T) {
+	failed := deployment("3", "shop:1", false)
+	failed.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"}}
+	unobserved := deployment("3", "shop:1", true)
+	unobserved.Generation = 3
+	for name, tc := range map[string]struct {
+		d    *appsv1.Deployment
+		want metrics.DeploymentStatus
+	}{
+		"progressing": {deployment("3", "shop:1", false), metrics.DeploymentStatusRunning},
+		"complete":    {deployment("3", "shop:1", true), metrics.DeploymentStatusSuccess},
+		"deadline":    {failed, metrics.DeploymentStatusFailed},
+		"unobserved":  {unobserved, metrics.DeploymentStatusRunning},
+	} {
+		if w, ok := fromDeployment(tc.d); !ok || w.state != tc.want {
+			t.Errorf("%s: state %s (%v), want %s", name, w.state, ok, tc.want)
+		}
+	}
+	if _, ok := fromDeployment(deployment("", "shop:1", true)); ok {
+		t.Error("a Deployment without a revision was read")
+	}
+}
+
+func TestStatefulSetStates(t *testing.T) {
+	set := func(current, update string, ready int32) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data", Generation: 5},
+			Spec:       appsv1.StatefulSetSpec{Replicas: replicas(3)},
+			Status: appsv1.StatefulSetStatus{ObservedGeneration: 5, ReadyReplicas: ready, UpdatedReplicas: ready,
+				CurrentRevision: current, UpdateRevision: update},
+		}
+	}
+	for name, tc := range map[string]struct {
+		s    *appsv1.StatefulSet
+		want metrics.DeploymentStatus
+	}{
+		"updating": {set("db-1", "db-2", 3), metrics.DeploymentStatusRunning},
+		"unready":  {set("db-2", "db-2", 2), metrics.DeploymentStatusRunning},
+		"complete": {set("db-2", "db-2", 3), metrics.DeploymentStatusSuccess},
+	} {
+		if w, ok := fromStatefulSet(tc.s); !ok || w.state != tc.want || w.revision != tc.s.Status.UpdateRevision {
+			t.Errorf("%s: state %s revision %s (%v), want %s", name, w.state, w.revision, ok, tc.want)
+		}
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	for image, want := range map[string]string{
+		"ghcr.io/acme/shop:1.4.2":                "1.4.2",
+		"localhost:5000/shop":                    "",
+		"localhost:5000/shop:v2@sha256:abcdef01": "v2",
+		"shop@sha256:abcdef01":                   "",
+	} {
+		if got := imageTag(image); got != want {
+			t.Errorf("imageTag(%s) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, raw := range []string{
+		`{"kubeconfig": "relative/config"}`,
+		`{"context": "prod"}`,
+		`{"kinds": ["DaemonSet"]}`,
+		`{"kinds": ["Deployment", "Deployment"]}`,
+		`{"label_selector": "app in ("}`,
+		`{"unknown": true}`,
+	} {
+		if err := New("k8s", zap.NewNop()).Validate(json.RawMessage(raw)); !errors.Is(err, plugins.ErrInvalidConfig) {
+			t.Errorf("Validate(%s) = %v, want ErrInvalidConfig", raw, err)
+		}
+	}
+
+	// Rollouts must be served when asked for
+	c := newCluster()
+	c.kube.Discovery().(*fakediscovery.FakeDiscovery).Resources = nil
+	p := New("k8s", zap.NewNop())
+	p.connect = func(Config) (clients, error) { return clients{kube: c.kube, dynamic: c.dynamic}, nil }
+	if err := p.Initialize(context.Background(), json.RawMessage(`{"kinds": ["Rollout"]}`)); err == nil {
+		t.Error("Initialize watched rollouts on a cluster without them")
+	}
+	if err := p.Initialize(context.Background(), json.RawMessage(`{"cluster": "eu-1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background())
+	if p.cluster != "eu-1" || p.HealthCheck(context.Background()) != nil {
+		t.Errorf("cluster %q, health %v", p.cluster, p.HealthCheck(context.Background()))
+	}
+}
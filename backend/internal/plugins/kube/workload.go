@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Workload kinds, as configured.
+const (
+	kindDeployment  = "Deployment"
+	kindStatefulSet = "StatefulSet"
+	kindRollout     = "Rollout"
+)
+
+// rollouts are Argo Rollouts, read through the dynamic client so the
+// plugin does not depend on Argo's API module.
+var rollouts = k8sschema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+// Revision annotations the controllers maintain; they change with the pod
+// template only, not when a workload is scaled.
+const (
+	deploymentRevision = "deployment.kubernetes.io/revision"
+	rolloutRevision    = "rollout.argoproj.io/revision"
+)
+
+// workload is the rollout state of a Deployment, StatefulSet or Rollout.
+type workload struct {
+	kind, namespace, name string
+	revision              string
+	state                 metrics.DeploymentStatus // running, success or failed
+	images                []string
+	labels                map[string]string
+	// annotations of the workload, over those of its pod template
+	annotations map[string]string
+}
+
+func (w workload) key() string { return w.kind + "/" + w.namespace + "/" + w.name }
+
+// fromDeployment reads a Deployment the way kubectl rollout status does.
+// It reports false until the controller has given it a revision.
+func fromDeployment(d *appsv1.Deployment) (workload, bool) {
+	w := newWorkload(kindDeployment, d.Namespace, d.Name, d.Labels, d.Annotations, d.Spec.Template)
+	w.revision = d.Annotations[deploymentRevision]
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	st := d.Status
+	w.state = metrics.DeploymentStatusRunning
+	switch {
+	case st.ObservedGeneration < d.Generation:
+	case progressDeadlineExceeded(d):
+		w.state = metrics.DeploymentStatusFailed
+	case st.UpdatedReplicas < replicas, st.Replicas > st.UpdatedReplicas, st.AvailableReplicas < st.UpdatedReplicas:
+	default:
+		w.state = metrics.DeploymentStatusSuccess
+	}
+	return w, w.revision != ""
+}
+
+func progressDeadlineExceeded(d *appsv1.Deployment) bool {
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing {
+			return c.Reason == "ProgressDeadlineExceeded"
+		}
+	}
+	return false
+}
+
+// fromStatefulSet reads a StatefulSet the way kubectl rollout status does.
+// StatefulSets report no failure, so their rollouts only ever succeed.
+func fromStatefulSet(s *appsv1.StatefulSet) (workload, bool) {
+	w := newWorkload(kindStatefulSet, s.Namespace, s.Name, s.Labels, s.Annotations, s.Spec.Template)
+	w.revision = s.Status.UpdateRevision
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	st := s.Status
+	w.state = metrics.DeploymentStatusRunning
+	var partition int32
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+		partition = *ru.Partition
+	}
+	switch {
+	case st.ObservedGeneration < s.Generation, st.ReadyReplicas < replicas:
+	case partition > 0:
+		// A partitioned rollout is done once the replicas above the
+		// partition are updated
+		if st.UpdatedReplicas >= replicas-partition {
+			w.state = metrics.DeploymentStatusSuccess
+		}
+	case st.UpdateRevision == st.CurrentRevision:
+		w.state = metrics.DeploymentStatusSuccess
+	}
+	return w, w.revision != ""
+}
+
+// fromRollout reads an Argo Rollout: phase Healthy is a completed rollout,
+// Degraded or an abort a failed one.
+func fromRollout(u *unstructured.Unstructured) (workload, bool) {
+	var tmpl corev1.PodTemplateSpec
+	tmpl.Annotations, _, _ = unstructured.NestedStringMap(u.Object, "spec", "template", "metadata", "annotations")
+	containers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	for _, c := range containers {
+		if m, ok := c.(map[string]interface{}); ok {
+			image, _ := m["image"].(string)
+			tmpl.Spec.Containers = append(tmpl.Spec.Containers, corev1.Container{Image: image})
+		}
+	}
+	w := newWorkload(kindRollout, u.GetNamespace(), u.GetName(), u.GetLabels(), u.GetAnnotations(), tmpl)
+	w.revision = u.GetAnnotations()[rolloutRevision]
+	// Argo reports the observed generation as a string
+	observed, _, _ := unstructured.NestedFieldNoCopy(u.Object, "status", "observedGeneration")
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	aborted, _, _ := unstructured.NestedBool(u.Object, "status", "abort")
+	w.state = metrics.DeploymentStatusRunning
+	switch {
+	case fmt.Sprint(observed) != fmt.Sprint(u.GetGeneration()):
+	case aborted, phase == "Degraded":
+		w.state = metrics.DeploymentStatusFailed
+	case phase == "Healthy":
+		w.state = metrics.DeploymentStatusSuccess
+	}
+	return w, w.revision != ""
+}
+
+func newWorkload(kind, namespace, name string, labels, annotations map[string]string, tmpl corev1.PodTemplateSpec) workload {
+	w := workload{kind: kind, namespace: namespace, name: name, labels: labels, annotations: map[string]string{}}
+	for k, v := range tmpl.Annotations {
+		w.annotations[k] = v
+	}
+	for k, v := range annotations {
+		w.annotations[k] = v
+	}
+	for _, c := range tmpl.Spec.Containers {
+		w.images = append(w.images, c.Image)
+	}
+	return w
+}
+
+// imageTag returns the tag of an image reference such as
+// "ghcr.io/acme/shop:1.4.2@sha256:...", or "" when it has none.
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
@@ -1,41 +1,291 @@
 package plugins
 
-// Package plugins will host the plugin manager and plugin interface definitions.
-// Phase 1 placeholder.
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 
-import "context"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"go.uber.org/zap"
+)
 
-// Plugin defines the minimal contract all metric source plugins must satisfy.
-type Plugin interface {
-	Name() string
-	Description() string
-	Initialize(ctx context.Context) error
-	Shutdown(ctx context.Context) error
+// Manager orchestrates registered plugins and stores what they collect
+// through the same Processor as webhook deliveries, so collected and pushed
+// records merge on the same keys.
+type Manager struct {
+	processor *webhooks.Processor
+	logger    *zap.Logger
+
+	mu      sync.RWMutex
+	order   []string
+	entries map[string]*entry
+}
+
+type entry struct {
+	plugin      Plugin
+	config      json.RawMessage
+	initialized bool
+	// initializing is set while Start or InitializeAll runs Initialize, so
+	// the plugin is only initialized once
+	initializing bool
+	// initErr is the last failed initialization; Collect retries it and
+	// reports it until it succeeds
+	initErr error
+	// inflight counts running Collect and HealthCheck calls, so Stop can
+	// wait for them before shutting the plugin down
+	inflight sync.WaitGroup
+}
+
+// NewManager builds a manager that stores collected records with processor.
+func NewManager(processor *webhooks.Processor, logger *zap.Logger) *Manager {
+	return &Manager{processor: processor, logger: logger, entries: make(map[string]*entry)}
+}
+
+// Register validates config and adds the plugin; it is initialized by the
+// next InitializeAll.
+func (m *Manager) Register(p Plugin, config json.RawMessage) error {
+	_, err := m.register(p, config, false)
+	return err
+}
+
+func (m *Manager) register(p Plugin, config json.RawMessage, initializing bool) (*entry, error) {
+	if err := p.Validate(config); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.Name(), err)
+	}
+	if dc, ok := p.(DeploymentConsumer); ok && m.processor != nil {
+		dc.UseDeployments(m.processor.Deployments)
+	}
+	if cc, ok := p.(CommitConsumer); ok && m.processor != nil {
+		cc.UseCommits(m.processor.Commits)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[p.Name()]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicatePlugin, p.Name())
+	}
+	e := &entry{plugin: p, config: config, initializing: initializing}
+	m.entries[p.Name()] = e
+	m.order = append(m.order, p.Name())
+	return e, nil
+}
+
+// Start validates config, registers the plugin and initializes it at once,
+// for plugins added while the server runs. The plugin is not registered
+// when config is invalid. When initialization fails it stays registered, as
+// with InitializeAll: Collect retries it.
+func (m *Manager) Start(ctx context.Context, p Plugin, config json.RawMessage) error {
+	e, err := m.register(p, config, true)
+	if err != nil {
+		return err
+	}
+	return m.runInitialize(ctx, p.Name(), e)
+}
+
+// Stop unregisters the plugin and, once its running calls return, shuts it
+// down.
+func (m *Manager) Stop(ctx context.Context, name string) error {
+	m.mu.Lock()
+	e, ok := m.entries[name]
+	initialized := ok && e.initialized
+	if ok {
+		m.remove(name)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPlugin, name)
+	}
+	e.inflight.Wait()
+	if !initialized {
+		// Not initialized yet, or shut down by whoever is initializing it
+		return nil
+	}
+	return e.plugin.Shutdown(ctx)
 }
 
-// Manager orchestrates registered plugins.
-type Manager struct{ plugins []Plugin }
+// remove drops the plugin; m.mu must be held.
+func (m *Manager) remove(name string) {
+	delete(m.entries, name)
+	for i, n := range m.order {
+		if n == name {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+}
 
-// Register adds a plugin to the manager.
-func (m *Manager) Register(p Plugin) { m.plugins = append(m.plugins, p) }
+// Get returns the plugin registered under name.
+func (m *Manager) Get(name string) (Plugin, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, false
+	}
+	return e.plugin, true
+}
+
+// Initialized reports whether the plugin is registered and initialized.
+func (m *Manager) Initialized(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[name]
+	return ok && e.initialized
+}
 
-// InitializeAll runs Initialize on all registered plugins.
+// Names returns the registered plugin names in sorted order.
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := append([]string(nil), m.order...)
+	sort.Strings(names)
+	return names
+}
+
+// InitializeAll runs Initialize, in registration order, on plugins that are
+// not initialized yet. A plugin that fails stays registered: its cycles
+// report the error and retry initializing it. It returns the failures
+// joined.
 func (m *Manager) InitializeAll(ctx context.Context) error {
-	for _, p := range m.plugins {
-		if err := p.Initialize(ctx); err != nil {
-			return err
+	m.mu.RLock()
+	names := append([]string(nil), m.order...)
+	m.mu.RUnlock()
+	var errs []error
+	for _, name := range names {
+		if err := m.initialize(ctx, name, false); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// initialize runs Initialize on the registered plugin unless it is
+// initialized or being initialized, or, with retry, unless its last
+// initialization did not fail. m.mu is not held during Initialize, which
+// may take as long as a network round trip.
+func (m *Manager) initialize(ctx context.Context, name string, retry bool) error {
+	m.mu.Lock()
+	e, ok := m.entries[name]
+	if !ok || e.initialized || e.initializing || (retry && e.initErr == nil) {
+		m.mu.Unlock()
+		return nil
+	}
+	e.initializing = true
+	m.mu.Unlock()
+	return m.runInitialize(ctx, name, e)
+}
+
+// runInitialize initializes e, which the caller marked initializing, and
+// records the outcome.
+func (m *Manager) runInitialize(ctx context.Context, name string, e *entry) error {
+	err := e.plugin.Initialize(ctx, e.config)
+	m.mu.Lock()
+	stopped := m.entries[name] != e
+	e.initializing, e.initialized, e.initErr = false, err == nil && !stopped, err
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("initialize plugin %s: %w", name, err)
+	}
+	if stopped {
+		// Stopped while initializing
+		return e.plugin.Shutdown(ctx)
+	}
 	return nil
 }
 
-// ShutdownAll runs Shutdown on all registered plugins (best-effort).
+// ShutdownAll runs Shutdown on all initialized plugins (best-effort).
 func (m *Manager) ShutdownAll(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	var firstErr error
-	for _, p := range m.plugins {
-		if err := p.Shutdown(ctx); err != nil && firstErr == nil {
-			firstErr = err
+	for _, name := range m.order {
+		e := m.entries[name]
+		if !e.initialized {
+			continue
 		}
+		if err := e.plugin.Shutdown(ctx); err != nil {
+			m.logger.Warn("plugin shutdown failed", zap.String("plugin", name), zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		e.initialized = false
 	}
 	return firstErr
 }
+
+// acquire returns the plugin if it is registered and initialized, counting
+// a running call until release.
+func (m *Manager) acquire(name string) (Plugin, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownPlugin, name)
+	}
+	if e.initErr != nil {
+		return nil, nil, fmt.Errorf("plugin %s is not initialized: %w", name, e.initErr)
+	}
+	if !e.initialized {
+		return nil, nil, fmt.Errorf("plugin %s is not initialized", name)
+	}
+	e.inflight.Add(1)
+	return e.plugin, e.inflight.Done, nil
+}
+
+// HealthCheck runs the plugin's health check.
+func (m *Manager) HealthCheck(ctx context.Context, name string) error {
+	p, release, err := m.acquire(name)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.HealthCheck(ctx)
+}
+
+// Collect runs one collection for the plugin and stores the records. It
+// returns the plugin's next cursor only once they are stored; on error the
+// caller keeps since and the same records are collected again. A batch
+// without a cursor keeps since. A batch returned with an error is stored
+// too, and its cursor returned with the error. A plugin whose
+// initialization failed is initialized again first.
+func (m *Manager) Collect(ctx context.Context, name string, since Cursor) (webhooks.Result, Cursor, error) {
+	if err := m.initialize(ctx, name, true); err != nil {
+		return webhooks.Result{}, since, err
+	}
+	p, release, err := m.acquire(name)
+	if err != nil {
+		return webhooks.Result{}, since, err
+	}
+	defer release()
+	batch, cerr := p.Collect(ctx, since)
+	if cerr != nil {
+		cerr = fmt.Errorf("collect %s: %w", name, cerr)
+	}
+	if batch == nil {
+		return webhooks.Result{}, since, cerr
+	}
+	ev := &webhooks.Event{
+		Source:      name,
+		Type:        "collect",
+		Deployments: batch.Deployments,
+		Incidents:   batch.Incidents,
+		Commits:     batch.Commits,
+		TicketLinks: batch.TicketLinks,
+	}
+	res, err := m.processor.Process(ctx, ev)
+	if err != nil {
+		return res, since, errors.Join(cerr, fmt.Errorf("store %s records: %w", name, err))
+	}
+	m.logger.Debug("plugin collected",
+		zap.String("plugin", name),
+		zap.Int("records", batch.Len()),
+		zap.String("cursor", string(batch.Cursor)),
+	)
+	if batch.Cursor == "" {
+		return res, since, cerr
+	}
+	return res, batch.Cursor, cerr
+}
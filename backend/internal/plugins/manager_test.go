@@ -0,0 +1,294 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/internal/webhooks"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// pager serves one deployment per Collect, numbering pages by cursor.
+type pager struct {
+	cfg struct {
+		Service string `json:"service"`
+		Pages   int    `json:"pages"`
+	}
+	failInit    error
+	failCollect error
+	shutdowns   int
+}
+
+func (p *pager) Name() string                  { return "pager" }
+func (p *pager) Description() string           { return "test pager" }
+func (p *pager) Version() string               { return "1.0.0" }
+func (p *pager) ConfigSchema() json.RawMessage { return json.RawMessage(`{"type": "object"}`) }
+
+func (p *pager) Validate(config json.RawMessage) error {
+	var cfg struct {
+		Service string `json:"service"`
+		Pages   int    `json:"pages"`
+	}
+	if err := DecodeConfig(config, &cfg); err != nil {
+		return err
+	}
+	if cfg.Service == "" {
+		return fmt.Errorf("%w: service is required", ErrInvalidConfig)
+	}
+	return nil
+}
+
+func (p *pager) Initialize(_ context.Context, config json.RawMessage) error {
+	if p.failInit != nil {
+		return p.failInit
+	}
+	return DecodeConfig(config, &p.cfg)
+}
+
+func (p *pager) HealthCheck(context.Context) error { return nil }
+
+func (p *pager) Collect(_ context.Context, since Cursor) (*Batch, error) {
+	if p.failCollect != nil {
+		return nil, p.failCollect
+	}
+	page, _ := strconv.Atoi(string(since))
+	if page >= p.cfg.Pages {
+		return &Batch{}, nil
+	}
+	start := time.Date(2024, 5, 1, 10, page, 0, 0, time.UTC)
+	return &Batch{
+		Deployments: []metrics.Deployment{{
+			ID: "pager-" + strconv.Itoa(page), Service: p.cfg.Service, Environment: "production",
+			Status: metrics.DeploymentStatusSuccess, StartTime: start, EndTime: &start,
+			Repository: "acme/api", CommitSHA: "sha" + strconv.Itoa(page),
+		}},
+		Commits: []metrics.Commit{{Repository: "acme/api", SHA: "sha" + strconv.Itoa(page), CommittedAt: start.Add(-time.Hour)}},
+		Cursor:  Cursor(strconv.Itoa(page + 1)),
+	}, nil
+}
+
+func (p *pager) Shutdown(context.Context) error { p.shutdowns++; return nil }
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	deployments := storage.NewMemoryDeploymentRepo()
+	proc := &webhooks.Processor{Deployments: deployments, Incidents: storage.NewMemoryIncidentRepo(), Commits: storage.NewMemoryCommitRepo()}
+	m := NewManager(proc, zap.NewNop())
+
+	p := &pager{}
+	for _, bad := range []string{`{"pages": 2}`, `{"service": "api", "extra": 1}`, `{"service": "api"} {}`} {
+		if err := m.Register(p, json.RawMessage(bad)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Register(%s) = %v want ErrInvalidConfig", bad, err)
+		}
+	}
+	if err := m.Register(p, json.RawMessage(`{"service": "api", "pages": 2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register(&pager{}, json.RawMessage(`{"service": "api"}`)); !errors.Is(err, ErrDuplicatePlugin) {
+		t.Errorf("duplicate Register = %v", err)
+	}
+	if _, _, err := m.Collect(ctx, "pager", ""); err == nil {
+		t.Error("Collect before InitializeAll should fail")
+	}
+	if _, _, err := m.Collect(ctx, "missing", ""); !errors.Is(err, ErrUnknownPlugin) {
+		t.Errorf("Collect(missing) = %v", err)
+	}
+	if err := m.InitializeAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.HealthCheck(ctx, "pager"); err != nil {
+		t.Errorf("HealthCheck = %v", err)
+	}
+
+	// Collect until the plugin has nothing new; the cursor advances per page
+	var cursor Cursor
+	for i, want := range []Cursor{"1", "2", "2"} {
+		res, next, err := m.Collect(ctx, "pager", cursor)
+		if err != nil || next != want {
+			t.Fatalf("cycle %d: cursor %q err %v, want %q", i, next, err, want)
+		}
+		if wantDeploys := map[bool]int{true: 1, false: 0}[i < 2]; res.Deployments != wantDeploys || res.Commits != wantDeploys {
+			t.Errorf("cycle %d: result %+v", i, res)
+		}
+		cursor = next
+	}
+	stored, err := deployments.ListRange(ctx, time.Time{}, time.Now())
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("stored %d deployments, err %v", len(stored), err)
+	}
+	d := stored[0]
+	if stored[1].ID == "pager-1" {
+		d = stored[1]
+	}
+	if want := time.Date(2024, 5, 1, 9, 1, 0, 0, time.UTC); !d.CommitTime.Equal(want) {
+		t.Errorf("commit time = %s want %s from the collected commit", d.CommitTime, want)
+	}
+
+	// A failed collection keeps the cursor so the cycle is repeated
+	p.failCollect = errors.New("upstream down")
+	if _, next, err := m.Collect(ctx, "pager", "1"); err == nil || next != "1" {
+		t.Errorf("failed Collect: cursor %q err %v", next, err)
+	}
+
+	if err := m.ShutdownAll(ctx); err != nil || p.shutdowns != 1 {
+		t.Errorf("ShutdownAll = %v, shutdowns %d", err, p.shutdowns)
+	}
+	if names := m.Names(); len(names) != 1 || names[0] != "pager" {
+		t.Errorf("Names = %v", names)
+	}
+}
+
+// renamed registers a pager under another name.
+type renamed struct {
+	*pager
+	name string
+}
+
+func (r renamed) Name() string { return r.name }
+
+func TestManagerInitializeAllRetriesFailures(t *testing.T) {
+	ctx := context.Background()
+	proc := &webhooks.Processor{Deployments: storage.NewMemoryDeploymentRepo(), Incidents: storage.NewMemoryIncidentRepo(), Commits: storage.NewMemoryCommitRepo()}
+	m := NewManager(proc, zap.NewNop())
+	boom := errors.New("boom")
+	broken := &pager{failInit: boom}
+	if err := m.Register(broken, json.RawMessage(`{"service": "api", "pages": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register(renamed{&pager{}, "second"}, json.RawMessage(`{"service": "web"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.InitializeAll(ctx); !errors.Is(err, boom) {
+		t.Fatalf("InitializeAll = %v want boom", err)
+	}
+	// The failure does not keep later plugins from initializing
+	if err := m.HealthCheck(ctx, "second"); err != nil {
+		t.Errorf("HealthCheck(second) = %v", err)
+	}
+	if err := m.HealthCheck(ctx, "pager"); !errors.Is(err, boom) {
+		t.Errorf("HealthCheck(pager) = %v want boom", err)
+	}
+	if _, _, err := m.Collect(ctx, "pager", ""); !errors.Is(err, boom) {
+		t.Errorf("Collect while failing = %v want boom", err)
+	}
+	// The next cycle initializes it again
+	broken.failInit = nil
+	if _, next, err := m.Collect(ctx, "pager", ""); err != nil || next != "1" {
+		t.Errorf("Collect after recovery: cursor %q err %v", next, err)
+	}
+}
+
+func TestManagerStartKeepsPluginWhoseInitializeFails(t *testing.T) {
+	ctx := context.Background()
+	proc := &webhooks.Processor{Deployments: storage.NewMemoryDeploymentRepo(), Incidents: storage.NewMemoryIncidentRepo(), Commits: storage.NewMemoryCommitRepo()}
+	m := NewManager(proc, zap.NewNop())
+	boom := errors.New("boom")
+	p := &pager{failInit: boom}
+	if err := m.Start(ctx, p, json.RawMessage(`{"service": "api", "pages": 1}`)); !errors.Is(err, boom) {
+		t.Fatalf("Start = %v want boom", err)
+	}
+	if _, ok := m.Get("pager"); !ok || m.Initialized("pager") {
+		t.Fatalf("registered %v initialized %v, want registered only", ok, m.Initialized("pager"))
+	}
+	p.failInit = nil
+	if _, next, err := m.Collect(ctx, "pager", ""); err != nil || next != "1" || !m.Initialized("pager") {
+		t.Errorf("Collect after recovery: cursor %q err %v", next, err)
+	}
+}
+
+// partial collects a page but reports another source failing.
+type partial struct{ *pager }
+
+func (p partial) Collect(ctx context.Context, since Cursor) (*Batch, error) {
+	batch, _ := p.pager.Collect(ctx, since)
+	return batch, errors.New("one source failed")
+}
+
+func TestManagerStoresPartialBatch(t *testing.T) {
+	ctx := context.Background()
+	deployments := storage.NewMemoryDeploymentRepo()
+	proc := &webhooks.Processor{Deployments: deployments, Incidents: storage.NewMemoryIncidentRepo(), Commits: storage.NewMemoryCommitRepo()}
+	m := NewManager(proc, zap.NewNop())
+	if err := m.Start(ctx, partial{&pager{}}, json.RawMessage(`{"service": "api", "pages": 2}`)); err != nil {
+		t.Fatal(err)
+	}
+	res, next, err := m.Collect(ctx, "pager", "")
+	if err == nil || !strings.Contains(err.Error(), "one source failed") {
+		t.Errorf("Collect err = %v", err)
+	}
+	if next != "1" || res.Deployments != 1 {
+		t.Errorf("Collect = %+v cursor %q, want the batch stored and its cursor", res, next)
+	}
+	if stored, err := deployments.ListRange(ctx, time.Time{}, time.Now()); err != nil || len(stored) != 1 || stored[0].ID != "pager-0" {
+		t.Errorf("stored = %+v %v, want the partial batch", stored, err)
+	}
+}
+
+func TestManagerStartStop(t *testing.T) {
+	ctx := context.Background()
+	proc := &webhooks.Processor{Deployments: storage.NewMemoryDeploymentRepo(), Incidents: storage.NewMemoryIncidentRepo(), Commits: storage.NewMemoryCommitRepo()}
+	m := NewManager(proc, zap.NewNop())
+
+	p := &pager{}
+	if err := m.Start(ctx, p, json.RawMessage(`{"pages": 1}`)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Start(invalid) = %v", err)
+	}
+	if err := m.Start(ctx, p, json.RawMessage(`{"service": "api", "pages": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Started plugins collect without InitializeAll
+	if _, next, err := m.Collect(ctx, "pager", ""); err != nil || next != "1" {
+		t.Fatalf("Collect after Start: cursor %q err %v", next, err)
+	}
+	if err := m.Stop(ctx, "pager"); err != nil || p.shutdowns != 1 {
+		t.Errorf("Stop = %v, shutdowns %d", err, p.shutdowns)
+	}
+	if _, _, err := m.Collect(ctx, "pager", ""); !errors.Is(err, ErrUnknownPlugin) {
+		t.Errorf("Collect after Stop = %v", err)
+	}
+	if err := m.Stop(ctx, "pager"); !errors.Is(err, ErrUnknownPlugin) {
+		t.Errorf("second Stop = %v", err)
+	}
+	// The name is free again
+	if err := m.Start(ctx, &pager{}, json.RawMessage(`{"service": "api"}`)); err != nil {
+		t.Errorf("restart = %v", err)
+	}
+	if names := m.Names(); len(names) != 1 {
+		t.Errorf("Names = %v", names)
+	}
+}
+
+// consumer is a pager that reads stored deployments and commits.
+type consumer struct {
+	pager
+	deployments DeploymentLister
+	commits     CommitGetter
+}
+
+func (c *consumer) UseDeployments(d DeploymentLister) { c.deployments = d }
+func (c *consumer) UseCommits(g CommitGetter)         { c.commits = g }
+
+func TestManagerHandsStoresToConsumers(t *testing.T) {
+	deployments, commits := storage.NewMemoryDeploymentRepo(), storage.NewMemoryCommitRepo()
+	proc := &webhooks.Processor{Deployments: deployments, Incidents: storage.NewMemoryIncidentRepo(), Commits: commits}
+	m := NewManager(proc, zap.NewNop())
+
+	c := &consumer{}
+	if err := m.Start(context.Background(), c, json.RawMessage(`{"service": "api"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if c.deployments != deployments {
+		t.Errorf("consumer was given %v, want the processor's deployment store", c.deployments)
+	}
+	if c.commits != commits {
+		t.Errorf("consumer was given %v, want the processor's commit store", c.commits)
+	}
+}
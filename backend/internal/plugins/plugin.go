@@ -0,0 +1,133 @@
+// Package plugins defines the contract for collector plugins, which pull
+// DORA records from an external system (a CI server, an issue tracker, ...),
+// and the Manager that runs them and stores what they collect.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/plugins/resilience"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+var (
+	// ErrInvalidConfig means a plugin configuration was rejected by Validate.
+	ErrInvalidConfig = errors.New("plugins: invalid config")
+	// ErrUnknownPlugin means no plugin is registered under the name.
+	ErrUnknownPlugin = errors.New("plugins: unknown plugin")
+	// ErrDuplicatePlugin means a plugin is already registered under the name.
+	ErrDuplicatePlugin = errors.New("plugins: duplicate plugin")
+)
+
+// Cursor is a plugin's opaque checkpoint: Collect returns records newer than
+// the cursor it is given, and a cursor to pass next time. The empty cursor
+// means "from the beginning" (whatever history the plugin backfills).
+type Cursor string
+
+// Batch is the result of one Collect call.
+type Batch struct {
+	Deployments []metrics.Deployment
+	Incidents   []metrics.Incident
+	Commits     []metrics.Commit
+	// TicketLinks tie issue tracker tickets to deployments and incidents.
+	TicketLinks []metrics.TicketLink
+	// Cursor is the checkpoint after these records. It is only persisted
+	// once they are stored, so a failed cycle is collected again; empty
+	// keeps the previous cursor.
+	Cursor Cursor
+}
+
+// Len is the number of records in the batch.
+func (b *Batch) Len() int {
+	return len(b.Deployments) + len(b.Incidents) + len(b.Commits) + len(b.TicketLinks)
+}
+
+// Plugin is the contract all collector plugins satisfy. The Manager calls
+// Validate and Initialize with the plugin's configuration, then Collect
+// repeatedly, and Shutdown when the plugin is removed or the server stops.
+type Plugin interface {
+	// Name identifies the plugin instance; it must be unique in a Manager.
+	Name() string
+	// Description is a human-readable summary for plugin listings.
+	Description() string
+	// Version is the plugin's semantic version.
+	Version() string
+	// ConfigSchema is a JSON Schema document describing the configuration,
+	// used by the API and UI to render and check plugin settings.
+	ConfigSchema() json.RawMessage
+	// Validate checks a configuration without applying it; errors wrap
+	// ErrInvalidConfig.
+	Validate(config json.RawMessage) error
+	// Initialize applies a validated configuration and acquires resources.
+	Initialize(ctx context.Context, config json.RawMessage) error
+	// HealthCheck reports whether the upstream system is reachable with the
+	// configured credentials.
+	HealthCheck(ctx context.Context) error
+	// Collect returns the records after since and the next cursor. A
+	// plugin that read only part of its sources may return a batch with
+	// an error: the batch is stored and its cursor kept, and the error
+	// fails the cycle.
+	Collect(ctx context.Context, since Cursor) (*Batch, error)
+	// Shutdown releases the plugin's resources.
+	Shutdown(ctx context.Context) error
+}
+
+// BreakerReporter is implemented by plugins that call their upstream through
+// a resilience.Client; its circuit breaker is then part of the plugin's
+// health.
+type BreakerReporter interface {
+	Breaker() resilience.State
+}
+
+// DeploymentLister reads stored deployments started within [start, end].
+type DeploymentLister interface {
+	ListRange(ctx context.Context, start, end time.Time) ([]metrics.Deployment, error)
+}
+
+// DeploymentConsumer is implemented by plugins that derive records from the
+// deployments already stored, such as commit times read from a git
+// repository. The Manager hands them the deployment store before they are
+// initialized.
+type DeploymentConsumer interface {
+	UseDeployments(DeploymentLister)
+}
+
+// CommitGetter reads a stored commit; it returns storage.ErrNotFound for
+// unknown commits.
+type CommitGetter interface {
+	Get(ctx context.Context, repository, sha string) (*metrics.Commit, error)
+}
+
+// CommitConsumer is implemented by plugins that read stored commits, such
+// as their messages. The Manager hands them the commit store before they
+// are initialized.
+type CommitConsumer interface {
+	UseCommits(CommitGetter)
+}
+
+// Factory creates an unconfigured plugin instance with the given name; one
+// is registered per plugin type (e.g. "github").
+type Factory func(name string) Plugin
+
+// DecodeConfig strictly decodes a JSON configuration into v for Validate and
+// Initialize implementations: unknown fields and trailing data are errors,
+// and an empty configuration leaves v unchanged.
+func DecodeConfig(config json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(config)) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("%w: trailing data after configuration", ErrInvalidConfig)
+	}
+	return nil
+}
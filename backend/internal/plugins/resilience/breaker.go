@@ -0,0 +1,122 @@
+package resilience
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Breaker states.
+const (
+	StateClosed   = "closed"    // calls go through
+	StateOpen     = "open"      // calls fail fast until the open timeout passes
+	StateHalfOpen = "half-open" // one probe call decides whether to close
+)
+
+// State is a snapshot of a Breaker, as reported in plugin health.
+type State struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	// RetryAt is when an open breaker lets a probe call through.
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Breaker is a circuit breaker: after threshold consecutive failures it
+// opens and rejects calls for the open timeout, then lets one probe call
+// through (half-open). A successful probe closes it; a failed one opens it
+// again. It is safe for concurrent use.
+type Breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probeAt  time.Time
+	lastErr  string
+	// onChange is called with the new state, outside the lock
+	onChange func(from, to string)
+}
+
+// NewBreaker returns a closed breaker that opens after threshold
+// consecutive failures and stays open for openTimeout.
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{threshold: max(threshold, 1), openTimeout: openTimeout, now: time.Now, state: StateClosed}
+}
+
+// Allow reports whether a call may proceed, returning an error wrapping
+// ErrCircuitOpen when it may not. A call that is allowed must be followed
+// by Success or Failure.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	now := b.now()
+	from := b.state
+	switch b.state {
+	case StateOpen:
+		retryAt := b.openedAt.Add(b.openTimeout)
+		if now.Before(retryAt) {
+			b.mu.Unlock()
+			return fmt.Errorf("%w until %s: %s", ErrCircuitOpen, retryAt.UTC().Format(time.RFC3339), b.lastErr)
+		}
+		b.state, b.probeAt = StateHalfOpen, now
+	case StateHalfOpen:
+		// One probe at a time; a probe that never reported is replaced
+		if now.Before(b.probeAt.Add(b.openTimeout)) {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: waiting for the probe call", ErrCircuitOpen)
+		}
+		b.probeAt = now
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+	return nil
+}
+
+// Success records a successful call, closing the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.state, b.failures, b.lastErr = StateClosed, 0, ""
+	b.mu.Unlock()
+	b.changed(from, StateClosed)
+}
+
+// Failure records a failed call, opening the breaker after threshold
+// consecutive failures or a failed probe.
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	from := b.state
+	b.failures++
+	if err != nil {
+		b.lastErr = err.Error()
+	}
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = StateOpen, b.now()
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+}
+
+// State returns a snapshot of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := State{State: b.state, ConsecutiveFailures: b.failures, LastError: b.lastErr}
+	if b.state != StateClosed {
+		opened, retry := b.openedAt, b.openedAt.Add(b.openTimeout)
+		s.OpenedAt, s.RetryAt = &opened, &retry
+	}
+	return s
+}
+
+func (b *Breaker) changed(from, to string) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,357 @@
+// Package resilience is the toolkit collector plugins use to call upstream
+// APIs without hammering them: an HTTP client that retries with
+// exponential backoff and jitter, honours Retry-After and rate-limit
+// headers, bounds concurrent requests per host and fails fast through a
+// circuit breaker while the upstream is down. The breaker's state is part
+// of the plugin's health (see plugins.BreakerReporter).
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrCircuitOpen means a call was rejected because the upstream failed
+	// repeatedly; it is retried once the breaker's open timeout passes.
+	ErrCircuitOpen = errors.New("resilience: circuit breaker open")
+	// ErrRateLimited means the upstream's rate limit resets later than the
+	// client is willing to wait, or than the request's deadline.
+	ErrRateLimited = errors.New("resilience: rate limited")
+)
+
+// Config tunes a Client. Zero values use the defaults.
+type Config struct {
+	// MaxRetries is how often a failed request is retried (default 3;
+	// negative disables retries). Only idempotent requests are retried:
+	// GET, HEAD, OPTIONS, PUT and DELETE, or any request with an
+	// Idempotency-Key header, as long as its body can be replayed.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// retries (defaults 500ms and 30s). Each wait is drawn at random from
+	// [0, backoff], so clients that failed together do not retry together.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxWait caps how long a Retry-After or rate-limit reset is waited for
+	// (default 5m). A longer Retry-After returns the response; a later
+	// reset fails with ErrRateLimited.
+	MaxWait time.Duration
+	// FailureThreshold consecutive failed attempts open the breaker
+	// (default 5); it stays open for OpenTimeout (default 30s).
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// MaxPerHost bounds concurrent requests to one host (default 4).
+	MaxPerHost int
+	// Transport sends the requests (default http.DefaultTransport).
+	Transport http.RoundTripper
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = 500 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 30 * time.Second
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = 5 * time.Minute
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.MaxPerHost <= 0 {
+		c.MaxPerHost = 4
+	}
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+	return c
+}
+
+// Client sends a plugin's HTTP requests. It is an http.RoundTripper, so it
+// can be used as an http.Client's Transport (see HTTPClient). Network
+// errors and 5xx responses are failures: they are retried and counted by
+// the breaker. 429 responses, and 403 responses with X-RateLimit-Remaining
+// 0, are retried after Retry-After or X-RateLimit-Reset without counting
+// as failures. Other responses are returned as they are.
+type Client struct {
+	name    string
+	cfg     Config
+	breaker *Breaker
+	logger  *zap.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// host is the state kept per upstream host.
+type host struct {
+	slots chan struct{}
+	// pausedUntil is when the host's rate limit resets after it ran out
+	pausedUntil time.Time
+}
+
+// New returns a client for the named plugin.
+func New(name string, cfg Config, logger *zap.Logger) *Client {
+	cfg = cfg.withDefaults()
+	c := &Client{
+		name:    name,
+		cfg:     cfg,
+		breaker: NewBreaker(cfg.FailureThreshold, cfg.OpenTimeout),
+		logger:  logger.With(zap.String("plugin", name)),
+		hosts:   make(map[string]*host),
+	}
+	c.breaker.onChange = func(from, to string) {
+		c.logger.Warn("circuit breaker "+to, zap.String("from", from), zap.String("last_error", c.breaker.State().LastError))
+	}
+	return c
+}
+
+// HTTPClient returns an http.Client sending its requests through c.
+func (c *Client) HTTPClient() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Breaker returns the state of the client's circuit breaker.
+func (c *Client) Breaker() State { return c.breaker.State() }
+
+// Do sends req through c.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.HTTPClient().Do(req)
+}
+
+// RoundTrip sends req, retrying it as described on Client.
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	h := c.host(req.URL.Host)
+	retries := c.cfg.MaxRetries
+	if !replayable(req) {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForReset(ctx, h); err != nil {
+			return nil, err
+		}
+		if err := c.breaker.Allow(); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		resp, err := c.send(ctx, h, req, attempt)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait, failed := c.classify(h, resp, err)
+		if failed {
+			c.breaker.Failure(attemptError(resp, err))
+		} else {
+			c.breaker.Success()
+		}
+		if wait < 0 || attempt >= retries {
+			return resp, err
+		}
+		if wait == 0 {
+			wait = backoff(attempt, c.cfg.MinBackoff, c.cfg.MaxBackoff)
+		}
+		if wait > c.cfg.MaxWait {
+			if resp != nil {
+				return resp, nil
+			}
+			return nil, err
+		}
+		c.logger.Debug("retrying request", zap.String("host", req.URL.Host), zap.Int("attempt", attempt+1), zap.Duration("wait", wait), zap.Error(attemptError(resp, err)))
+		if resp != nil {
+			drain(resp.Body)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send makes one attempt, holding one of the host's slots until the
+// response body is closed.
+func (c *Client) send(ctx context.Context, h *host, req *http.Request, attempt int) (*http.Response, error) {
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-h.slots }
+	if attempt > 0 && req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			release()
+			return nil, err
+		}
+		req = req.Clone(ctx)
+		req.Body = body
+	}
+	resp, err := c.cfg.Transport.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// classify decides whether an attempt failed and whether to retry it: a
+// negative wait returns the result, zero retries after the backoff and a
+// positive wait retries after that long.
+func (c *Client) classify(h *host, resp *http.Response, err error) (wait time.Duration, failed bool) {
+	if err != nil {
+		return 0, true
+	}
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	exhausted := resp.Header.Get("X-RateLimit-Remaining") == "0"
+	if exhausted {
+		reset := time.Now().Add(time.Minute)
+		if n, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			reset = time.Unix(n, 0)
+		}
+		if retryAfter > 0 {
+			reset = time.Now().Add(retryAfter)
+		}
+		c.mu.Lock()
+		h.pausedUntil = reset
+		c.mu.Unlock()
+		c.logger.Info("rate limit exhausted", zap.String("host", resp.Request.URL.Host), zap.Time("reset", reset))
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusForbidden && exhausted:
+		// waitForReset waits for the reset; otherwise Retry-After or backoff
+		if exhausted {
+			return time.Nanosecond, false
+		}
+		return retryAfter, false
+	case resp.StatusCode >= 500:
+		return retryAfter, true
+	}
+	return -1, false
+}
+
+// waitForReset waits until the host's rate limit resets, failing with
+// ErrRateLimited when that is beyond MaxWait or the request's deadline.
+func (c *Client) waitForReset(ctx context.Context, h *host) error {
+	c.mu.Lock()
+	until := h.pausedUntil
+	c.mu.Unlock()
+	wait := time.Until(until)
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); wait > c.cfg.MaxWait || ok && until.After(deadline) {
+		return fmt.Errorf("%w until %s", ErrRateLimited, until.UTC().Format(time.RFC3339))
+	}
+	return sleep(ctx, wait)
+}
+
+func (c *Client) host(name string) *host {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.hosts[name]
+	if !ok {
+		h = &host{slots: make(chan struct{}, c.cfg.MaxPerHost)}
+		c.hosts[name] = h
+	}
+	return h
+}
+
+// replayable reports whether req may be sent again.
+func replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// backoff returns the wait before retry attempt+1: min doubled per attempt
+// up to max, with full jitter.
+func backoff(attempt int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+// Backoff is the wait before retry attempt+1 (0-based) of any operation,
+// for plugins retrying calls that are not HTTP requests: MinBackoff doubled
+// per attempt up to MaxBackoff, with full jitter.
+func (c Config) Backoff(attempt int) time.Duration {
+	c = c.withDefaults()
+	return backoff(attempt, c.MinBackoff, c.MaxBackoff)
+}
+
+// parseRetryAfter parses a Retry-After value in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(n, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func attemptError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain reads a little of a discarded body so the connection can be reused.
+func drain(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64<<10))
+	_ = body.Close()
+}
+
+// releasingBody releases a host slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,304 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fast retries quickly so tests do not wait on the backoff.
+var fast = Config{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func get(t *testing.T, c *Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	c := New("test", fast, zap.NewNop())
+	resp, err := get(t, c, srv.URL)
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("resp=%v err=%v calls=%d", resp, err, calls.Load())
+	}
+	if s := c.Breaker(); s.State != StateClosed || s.ConsecutiveFailures != 0 {
+		t.Errorf("breaker = %+v", s)
+	}
+
+	// POST bodies are replayed only with an idempotency key
+	calls.Store(0)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+	resp, err = c.Do(req)
+	if err != nil || resp.StatusCode != http.StatusBadGateway || calls.Load() != 1 {
+		t.Fatalf("POST: resp=%v err=%v calls=%d", resp, err, calls.Load())
+	}
+	resp.Body.Close()
+	calls.Store(0)
+	req, _ = http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err = c.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("POST with key: resp=%v err=%v calls=%d", resp, err, calls.Load())
+	}
+	if b, _ := io.ReadAll(resp.Body); string(b) != "payload" {
+		t.Errorf("replayed body = %q", b)
+	}
+	resp.Body.Close()
+
+	// Client errors are not retried
+	calls.Store(0)
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer notFound.Close()
+	if resp, err := get(t, c, notFound.URL); err != nil || resp.StatusCode != http.StatusNotFound || calls.Load() != 1 {
+		t.Errorf("404: resp=%v err=%v calls=%d", resp, err, calls.Load())
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var first time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if time.Since(first) < time.Second {
+			t.Errorf("retried after %s", time.Since(first))
+		}
+	}))
+	defer srv.Close()
+
+	c := New("test", fast, zap.NewNop())
+	resp, err := get(t, c, srv.URL)
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("resp=%v err=%v calls=%d", resp, err, calls.Load())
+	}
+	// Being throttled is not a failure
+	if s := c.Breaker(); s.ConsecutiveFailures != 0 {
+		t.Errorf("breaker = %+v", s)
+	}
+
+	// Waits beyond MaxWait return the response instead
+	calls.Store(0)
+	c = New("test", Config{MaxWait: 500 * time.Millisecond}, zap.NewNop())
+	resp, err = get(t, c, srv.URL)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+		t.Errorf("beyond MaxWait: resp=%v err=%v calls=%d", resp, err, calls.Load())
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	var remaining atomic.Int32
+	remaining.Store(1)
+	var reset atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		left := remaining.Add(-1)
+		if left < 0 && time.Now().Unix() < reset.Load() {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Load(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(max(left, 0))))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Load(), 10))
+	}))
+	defer srv.Close()
+
+	// The last request of the window pauses the host until the reset
+	reset.Store(time.Now().Add(time.Second).Unix() + 1)
+	c := New("test", fast, zap.NewNop())
+	if resp, err := get(t, c, srv.URL); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("resp=%v err=%v", resp, err)
+	}
+	start := time.Now()
+	if resp, err := get(t, c, srv.URL); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("after reset: resp=%v err=%v", resp, err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("waited %s for the reset", waited)
+	}
+
+	// Resets beyond MaxWait or the request's deadline fail fast, without
+	// calling the upstream again
+	remaining.Store(0)
+	reset.Store(time.Now().Add(time.Hour).Unix())
+	if _, err := get(t, c, srv.URL); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	if _, err := get(t, c, srv.URL); !errors.Is(err, ErrRateLimited) || remaining.Load() != -1 {
+		t.Errorf("paused: err=%v requests=%d", err, -remaining.Load())
+	}
+	c = New("test", fast, zap.NewNop())
+	reset.Store(time.Now().Add(3 * time.Second).Unix())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := c.Do(req); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := fast
+	cfg.MaxRetries, cfg.FailureThreshold, cfg.OpenTimeout = -1, 3, 100*time.Millisecond
+	c := New("test", cfg, zap.NewNop())
+	for i := 0; i < 3; i++ {
+		if resp, err := get(t, c, srv.URL); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("call %d: resp=%v err=%v", i, resp, err)
+		}
+	}
+	s := c.Breaker()
+	if s.State != StateOpen || s.ConsecutiveFailures != 3 || s.RetryAt == nil || !strings.Contains(s.LastError, "503") {
+		t.Fatalf("breaker = %+v", s)
+	}
+	// Open: calls fail fast without reaching the upstream
+	if _, err := get(t, c, srv.URL); !errors.Is(err, ErrCircuitOpen) || calls.Load() != 3 {
+		t.Fatalf("open: err=%v calls=%d", err, calls.Load())
+	}
+
+	// Half-open: a failed probe opens it again
+	time.Sleep(120 * time.Millisecond)
+	if resp, err := get(t, c, srv.URL); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("probe: resp=%v err=%v", resp, err)
+	}
+	if s := c.Breaker(); s.State != StateOpen {
+		t.Fatalf("after failed probe: %+v", s)
+	}
+
+	// A successful probe closes it
+	time.Sleep(120 * time.Millisecond)
+	healthy.Store(true)
+	if resp, err := get(t, c, srv.URL); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("probe: resp=%v err=%v", resp, err)
+	}
+	if s := c.Breaker(); s.State != StateClosed || s.ConsecutiveFailures != 0 || s.LastError != "" {
+		t.Errorf("after probe: %+v", s)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Failure(errors.New("boom"))
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if b.State().State != StateHalfOpen {
+		t.Fatalf("state = %+v", b.State())
+	}
+	// One probe at a time, until it is presumed lost
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second probe: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Errorf("replacement probe: %v", err)
+	}
+}
+
+func TestClientPerHostLimit(t *testing.T) {
+	var active, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	cfg := fast
+	cfg.MaxPerHost = 2
+	c := New("test", cfg, zap.NewNop())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := get(t, c, srv.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak.Load())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, limit := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		for i := 0; i < 50; i++ {
+			if d := backoff(attempt, time.Second, 5*time.Second); d < 0 || d > limit {
+				t.Fatalf("backoff(%d) = %s, want <= %s", attempt, d, limit)
+			}
+		}
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-3":                            0,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretField is the configuration field a resolved secret is passed in.
+// Stored configurations never hold it; they reference the secret instead.
+const SecretField = "secret"
+
+// ResolveSecret reads the secret a reference points to: "env:NAME" is an
+// environment variable and "file:/path" a file (e.g. a mounted Kubernetes
+// secret), with surrounding whitespace trimmed.
+func ResolveSecret(ref string) (string, error) {
+	kind, target, ok := strings.Cut(ref, ":")
+	if !ok || target == "" {
+		return "", fmt.Errorf("%w: secret reference %q must be env:NAME or file:PATH", ErrInvalidConfig, ref)
+	}
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(target)
+		if !ok || v == "" {
+			return "", fmt.Errorf("%w: environment variable %s is not set", ErrInvalidConfig, target)
+		}
+		return v, nil
+	case "file":
+		b, err := os.ReadFile(target)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", fmt.Errorf("%w: unknown secret reference kind %q", ErrInvalidConfig, kind)
+}
+
+// WithSecret returns config with the secret ref resolves to set as
+// SecretField; an empty ref returns config unchanged.
+func WithSecret(config json.RawMessage, ref string) (json.RawMessage, error) {
+	if ref == "" {
+		return config, nil
+	}
+	secret, err := ResolveSecret(ref)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if len(strings.TrimSpace(string(config))) > 0 {
+		if err := json.Unmarshal(config, &fields); err != nil {
+			return nil, fmt.Errorf("%w: configuration must be an object: %v", ErrInvalidConfig, err)
+		}
+	}
+	fields[SecretField], _ = json.Marshal(secret)
+	return json.Marshal(fields)
+}
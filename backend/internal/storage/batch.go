@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// batchChunkSize bounds rows per INSERT statement, keeping the bind parameter
+// count (rows x columns) well under Postgres' 65535 limit.
+const batchChunkSize = 500
+
+// CreateBatch inserts deployments with multi-row INSERTs. The returned slice
+// has one entry per input: nil when the row was created, ErrConflict when it
+// collided with an existing (or earlier in-batch) ID or natural key, or the
+// error inserting that row.
+func (r *PostgresDeploymentRepo) CreateBatch(ctx context.Context, ds []metrics.Deployment) []error {
+	const cols = `id, service, environment, version, status, start_time, end_time, commit_sha, commit_time, author, repository, branch, build_url, tags, created_at, updated_at`
+	return insertBatch(ctx, r.db, "deployments", cols, len(ds), func(i int) []interface{} {
+		d := ds[i]
+		return []interface{}{d.ID, d.Service, d.Environment, d.Version, d.Status, d.StartTime, d.EndTime, d.CommitSHA, d.CommitTime,
+			d.Author, d.Repository, d.Branch, d.BuildURL, tagsJSON(d.Tags), d.CreatedAt, d.UpdatedAt}
+	}, func(i int) string { return ds[i].ID })
+}
+
+// CreateBatch inserts incidents with multi-row INSERTs; see PostgresDeploymentRepo.CreateBatch.
+func (r *PostgresIncidentRepo) CreateBatch(ctx context.Context, is []metrics.Incident) []error {
+	const cols = `id, title, description, service, environment, severity, start_time, resolved_time, root_cause, assignee, tags, created_at, updated_at`
+	return insertBatch(ctx, r.db, "incidents", cols, len(is), func(i int) []interface{} {
+		inc := is[i]
+		return []interface{}{inc.ID, inc.Title, inc.Description, inc.Service, inc.Environment, inc.Severity, inc.StartTime, inc.ResolvedTime,
+			inc.RootCause, inc.Assignee, tagsJSON(inc.Tags), inc.CreatedAt, inc.UpdatedAt}
+	}, func(i int) string { return is[i].ID })
+}
+
+// insertBatch runs one INSERT ... ON CONFLICT DO NOTHING RETURNING id per chunk
+// and attributes skipped rows to ErrConflict. When a chunk fails as a whole,
+// such as on a value a column rejects, its rows are inserted one by one so
+// the error is reported for the offending row only.
+func insertBatch(ctx context.Context, db *sql.DB, table, cols string, n int, row func(int) []interface{}, id func(int) string) []error {
+	results := make([]error, n)
+	for start := 0; start < n; start += batchChunkSize {
+		end := min(start+batchChunkSize, n)
+		inserted, err := insertRows(ctx, db, table, cols, start, end, row)
+		if err != nil && end-start > 1 && ctx.Err() == nil {
+			for i := start; i < end; i++ {
+				ids, err := insertRows(ctx, db, table, cols, i, i+1, row)
+				if err != nil {
+					results[i] = err
+					continue
+				}
+				attribute(results, i, i+1, ids, id)
+			}
+			continue
+		}
+		if err != nil {
+			for i := start; i < end; i++ {
+				results[i] = err
+			}
+			continue
+		}
+		attribute(results, start, end, inserted, id)
+	}
+	return results
+}
+
+// insertRows inserts rows [start, end) in one statement, returning the IDs
+// of the rows inserted.
+func insertRows(ctx context.Context, db *sql.DB, table, cols string, start, end int, row func(int) []interface{}) (map[string]bool, error) {
+	width := len(strings.Split(cols, ","))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES ", table, cols)
+	args := make([]interface{}, 0, (end-start)*width)
+	for i := start; i < end; i++ {
+		if i > start {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('(')
+		for c := 0; c < width; c++ {
+			if c > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(&sb, "$%d", len(args)+c+1)
+		}
+		sb.WriteByte(')')
+		args = append(args, row(i)...)
+	}
+	sb.WriteString(" ON CONFLICT DO NOTHING RETURNING id")
+	return queryIDs(ctx, db, sb.String(), args)
+}
+
+// attribute marks rows [start, end) that were not inserted as conflicts.
+func attribute(results []error, start, end int, inserted map[string]bool, id func(int) string) {
+	for i := start; i < end; i++ {
+		if inserted[id(i)] {
+			// First occurrence claims the row; later duplicates in the batch conflict.
+			delete(inserted, id(i))
+			continue
+		}
+		results[i] = ErrConflict
+	}
+}
+
+func queryIDs(ctx context.Context, db *sql.DB, q string, args []interface{}) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
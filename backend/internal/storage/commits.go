@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// CommitRepository records commit timestamps used for lead time.
+type CommitRepository interface {
+	// Save inserts or refreshes commits keyed by (repository, sha).
+	Save(ctx context.Context, commits []metrics.Commit) error
+	// Get returns the commit or ErrNotFound.
+	Get(ctx context.Context, repository, sha string) (*metrics.Commit, error)
+}
+
+// PostgresCommitRepo implements CommitRepository.
+type PostgresCommitRepo struct{ db *sql.DB }
+
+func NewPostgresCommitRepo(db *sql.DB) *PostgresCommitRepo { return &PostgresCommitRepo{db: db} }
+
+func (r *PostgresCommitRepo) Save(ctx context.Context, commits []metrics.Commit) error {
+	const q = `INSERT INTO commits (repository, sha, author, message, authored_at, committed_at)
+VALUES ($1,$2,$3,$4,$5,$6)
+ON CONFLICT (repository, sha) DO UPDATE SET
+  author=COALESCE(NULLIF(EXCLUDED.author, ''), commits.author),
+  message=COALESCE(NULLIF(EXCLUDED.message, ''), commits.message),
+  authored_at=EXCLUDED.authored_at, committed_at=EXCLUDED.committed_at`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range commits {
+		if _, err := stmt.ExecContext(ctx, c.Repository, c.SHA, c.Author, c.Message, c.AuthoredAt, c.CommittedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresCommitRepo) Get(ctx context.Context, repository, sha string) (*metrics.Commit, error) {
+	const q = `SELECT repository, sha, COALESCE(author, ''), COALESCE(message, ''), authored_at, committed_at FROM commits WHERE repository=$1 AND sha=$2`
+	var c metrics.Commit
+	err := r.db.QueryRowContext(ctx, q, repository, sha).Scan(&c.Repository, &c.SHA, &c.Author, &c.Message, &c.AuthoredAt, &c.CommittedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
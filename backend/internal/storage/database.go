@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -38,9 +39,14 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-// Health checks the database health
-func (d *Database) Health() error {
-	return d.db.Ping()
+// Health checks the database health, bounded by the context deadline
+func (d *Database) Health(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+// Stats returns connection pool statistics
+func (d *Database) Stats() sql.DBStats {
+	return d.db.Stats()
 }
 
 // GetDB returns the underlying sql.DB instance
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrIdempotencyInFlight is returned by Reserve when another request holding the
+// same key has not finished yet.
+var ErrIdempotencyInFlight = errors.New("storage: idempotency key in flight")
+
+// IdempotentResponse is a stored HTTP response replayed for a repeated Idempotency-Key.
+type IdempotentResponse struct {
+	// Fingerprint identifies the original request body; a replay with a different
+	// body is rejected instead of returning an unrelated response.
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// IdempotencyStore records responses keyed by client-supplied idempotency keys.
+type IdempotencyStore interface {
+	// Reserve claims key for a new request. It returns the stored response when the
+	// key already completed, ErrIdempotencyInFlight when it is still being
+	// processed, or (nil, nil) when the caller now owns the key. The
+	// reservation lapses after lease unless the key is completed first.
+	Reserve(ctx context.Context, key string, lease time.Duration) (*IdempotentResponse, error)
+	// Complete stores the response for a reserved key, kept for ttl.
+	Complete(ctx context.Context, key string, resp IdempotentResponse, ttl time.Duration) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// inFlightMarker is stored while a reserved request is processing.
+const inFlightMarker = "in_flight"
+
+// RedisIdempotencyStore keeps idempotent responses in Redis with a TTL.
+type RedisIdempotencyStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisIdempotencyStore creates a Redis-backed idempotency store.
+func NewRedisIdempotencyStore(r *Redis) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: r.client, prefix: "metrichub:idempotency:"}
+}
+
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key string, lease time.Duration) (*IdempotentResponse, error) {
+	ok, err := s.client.SetNX(ctx, s.prefix+key, inFlightMarker, lease).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+	raw, err := s.client.Get(ctx, s.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		// Expired between SETNX and GET; try once more.
+		return s.Reserve(ctx, key, lease)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if raw == inFlightMarker {
+		return nil, ErrIdempotencyInFlight
+	}
+	var resp IdempotentResponse
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, resp IdempotentResponse, ttl time.Duration) error {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, raw, ttl).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// MemoryIdempotencyStore is a process-local store used when Redis is not configured.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	resp      *IdempotentResponse // nil while in flight
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore creates an in-memory idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]memoryIdempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key string, lease time.Duration) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.entries { // opportunistic expiry keeps the map bounded
+		if now.After(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	if e, ok := s.entries[key]; ok {
+		if e.resp == nil {
+			return nil, ErrIdempotencyInFlight
+		}
+		resp := *e.resp
+		return &resp, nil
+	}
+	s.entries[key] = memoryIdempotencyEntry{expiresAt: now.Add(lease)}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, resp IdempotentResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryIdempotencyEntry{resp: &resp, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyLeaseLapses(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryIdempotencyStore()
+	if resp, err := s.Reserve(ctx, "k", 20*time.Millisecond); resp != nil || err != nil {
+		t.Fatalf("Reserve = %v, %v", resp, err)
+	}
+	if _, err := s.Reserve(ctx, "k", time.Minute); !errors.Is(err, ErrIdempotencyInFlight) {
+		t.Fatalf("Reserve while leased = %v, want in flight", err)
+	}
+	// The holder never completes; once its lease lapses the key is free
+	time.Sleep(30 * time.Millisecond)
+	if resp, err := s.Reserve(ctx, "k", 20*time.Millisecond); resp != nil || err != nil {
+		t.Fatalf("Reserve after lease = %v, %v", resp, err)
+	}
+	// A completed response outlives the lease
+	if err := s.Complete(ctx, "k", IdempotentResponse{Status: 201}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if resp, err := s.Reserve(ctx, "k", time.Minute); err != nil || resp == nil || resp.Status != 201 {
+		t.Errorf("Reserve after Complete = %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// InboxStatus is the processing state of a stored webhook delivery.
+type InboxStatus string
+
+const (
+	InboxPending    InboxStatus = "pending"
+	InboxProcessing InboxStatus = "processing"
+	InboxDone       InboxStatus = "done"
+	InboxIgnored    InboxStatus = "ignored"
+	InboxDead       InboxStatus = "dead"
+)
+
+// InboxItem is one raw webhook delivery and its processing state.
+type InboxItem struct {
+	ID            int64           `json:"id"`
+	Source        string          `json:"source"`
+	DeliveryKey   string          `json:"delivery_key"`
+	Headers       http.Header     `json:"headers"`
+	Body          []byte          `json:"-"`
+	Status        InboxStatus     `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	ReceivedAt    time.Time       `json:"received_at"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty"`
+}
+
+// WebhookInbox persists deliveries and hands them to workers.
+type WebhookInbox interface {
+	// Enqueue stores a pending delivery. When (source, delivery key) is
+	// already stored it reports a duplicate and fills item from the
+	// existing row instead.
+	Enqueue(ctx context.Context, item *InboxItem) (duplicate bool, err error)
+	// Claim leases up to limit due deliveries, including ones whose lease
+	// expired, and counts the attempt.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]InboxItem, error)
+	// Complete finishes a delivery as done or ignored.
+	Complete(ctx context.Context, id int64, status InboxStatus, result json.RawMessage) error
+	// Fail records an error and schedules a retry at retryAt, or moves the
+	// delivery to the dead-letter state when retryAt is nil.
+	Fail(ctx context.Context, id int64, reason string, retryAt *time.Time) error
+	// Get returns the delivery or ErrNotFound.
+	Get(ctx context.Context, id int64) (*InboxItem, error)
+	// List returns the newest deliveries, optionally filtered by status.
+	List(ctx context.Context, status InboxStatus, limit int) ([]InboxItem, error)
+	// Replay makes a dead delivery pending again with a fresh attempt
+	// budget; ErrNotFound or ErrConflict when it is not dead.
+	Replay(ctx context.Context, id int64) error
+	// Purge deletes done and ignored deliveries processed before the cutoff.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PostgresWebhookInbox implements WebhookInbox.
+type PostgresWebhookInbox struct{ db *sql.DB }
+
+func NewPostgresWebhookInbox(db *sql.DB) *PostgresWebhookInbox { return &PostgresWebhookInbox{db: db} }
+
+const inboxColumns = `id, source, delivery_key, headers, body, status, attempts, next_attempt_at, COALESCE(last_error, ''), result, received_at, processed_at`
+
+func scanInboxItem(row interface{ Scan(...interface{}) error }) (*InboxItem, error) {
+	var it InboxItem
+	var headers, result []byte
+	var processed sql.NullTime
+	if err := row.Scan(&it.ID, &it.Source, &it.DeliveryKey, &headers, &it.Body, &it.Status, &it.Attempts,
+		&it.NextAttemptAt, &it.LastError, &result, &it.ReceivedAt, &processed); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(headers, &it.Headers); err != nil {
+		return nil, err
+	}
+	if len(result) > 0 {
+		it.Result = result
+	}
+	if processed.Valid {
+		it.ProcessedAt = &processed.Time
+	}
+	return &it, nil
+}
+
+func (r *PostgresWebhookInbox) Enqueue(ctx context.Context, item *InboxItem) (bool, error) {
+	headers, err := json.Marshal(item.Headers)
+	if err != nil {
+		return false, err
+	}
+	const q = `INSERT INTO webhook_inbox (source, delivery_key, headers, body) VALUES ($1,$2,$3,$4)
+ON CONFLICT (source, delivery_key) DO NOTHING
+RETURNING ` + inboxColumns
+	stored, err := scanInboxItem(r.db.QueryRowContext(ctx, q, item.Source, item.DeliveryKey, headers, item.Body))
+	duplicate := errors.Is(err, sql.ErrNoRows)
+	if duplicate {
+		stored, err = scanInboxItem(r.db.QueryRowContext(ctx,
+			`SELECT `+inboxColumns+` FROM webhook_inbox WHERE source=$1 AND delivery_key=$2`, item.Source, item.DeliveryKey))
+	}
+	if err != nil {
+		return false, err
+	}
+	*item = *stored
+	return duplicate, nil
+}
+
+func (r *PostgresWebhookInbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]InboxItem, error) {
+	const q = `WITH due AS (
+  SELECT id FROM webhook_inbox
+  WHERE (status = 'pending' AND next_attempt_at <= NOW()) OR (status = 'processing' AND locked_until < NOW())
+  ORDER BY next_attempt_at, id
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+UPDATE webhook_inbox w SET status = 'processing', attempts = w.attempts + 1, locked_until = NOW() + make_interval(secs => $2)
+FROM due WHERE w.id = due.id
+RETURNING w.id, w.source, w.delivery_key, w.headers, w.body, w.status, w.attempts, w.next_attempt_at, COALESCE(w.last_error, ''), w.result, w.received_at, w.processed_at`
+	rows, err := r.db.QueryContext(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []InboxItem
+	for rows.Next() {
+		it, err := scanInboxItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *it)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresWebhookInbox) Complete(ctx context.Context, id int64, status InboxStatus, result json.RawMessage) error {
+	var res interface{}
+	if len(result) > 0 {
+		res = []byte(result)
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE webhook_inbox SET status=$2, result=$3, last_error=NULL, locked_until=NULL, processed_at=NOW() WHERE id=$1`,
+		id, status, res)
+	return err
+}
+
+func (r *PostgresWebhookInbox) Fail(ctx context.Context, id int64, reason string, retryAt *time.Time) error {
+	if retryAt == nil {
+		_, err := r.db.ExecContext(ctx, `UPDATE webhook_inbox SET status='dead', last_error=$2, locked_until=NULL, processed_at=NOW() WHERE id=$1`, id, reason)
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE webhook_inbox SET status='pending', last_error=$2, next_attempt_at=$3, locked_until=NULL WHERE id=$1`, id, reason, *retryAt)
+	return err
+}
+
+func (r *PostgresWebhookInbox) Get(ctx context.Context, id int64) (*InboxItem, error) {
+	it, err := scanInboxItem(r.db.QueryRowContext(ctx, `SELECT `+inboxColumns+` FROM webhook_inbox WHERE id=$1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return it, err
+}
+
+func (r *PostgresWebhookInbox) List(ctx context.Context, status InboxStatus, limit int) ([]InboxItem, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+inboxColumns+` FROM webhook_inbox WHERE ($1 = '' OR status = $1) ORDER BY id DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []InboxItem
+	for rows.Next() {
+		it, err := scanInboxItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *it)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresWebhookInbox) Replay(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE webhook_inbox SET status='pending', attempts=0, next_attempt_at=NOW(), last_error=NULL, processed_at=NULL WHERE id=$1 AND status='dead'`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := r.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+func (r *PostgresWebhookInbox) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhook_inbox WHERE status IN ('done', 'ignored') AND processed_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// WebhookMapping is the stored configuration of one generic webhook source.
+// Config is opaque here; the webhooks package compiles and validates it.
+type WebhookMapping struct {
+	Source    string          `json:"source"`
+	Config    json.RawMessage `json:"config"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// WebhookMappingRepository stores generic webhook mappings keyed by source.
+type WebhookMappingRepository interface {
+	List(ctx context.Context) ([]WebhookMapping, error)
+	// Get returns the mapping or ErrNotFound.
+	Get(ctx context.Context, source string) (*WebhookMapping, error)
+	// Put creates or replaces the mapping, filling its timestamps, and
+	// reports whether it was created.
+	Put(ctx context.Context, m *WebhookMapping) (bool, error)
+	// Delete removes the mapping or returns ErrNotFound.
+	Delete(ctx context.Context, source string) error
+}
+
+// PostgresWebhookMappingRepo implements WebhookMappingRepository.
+type PostgresWebhookMappingRepo struct{ db *sql.DB }
+
+func NewPostgresWebhookMappingRepo(db *sql.DB) *PostgresWebhookMappingRepo {
+	return &PostgresWebhookMappingRepo{db: db}
+}
+
+func (r *PostgresWebhookMappingRepo) List(ctx context.Context) ([]WebhookMapping, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT source, config, created_at, updated_at FROM webhook_mappings ORDER BY source`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WebhookMapping
+	for rows.Next() {
+		var m WebhookMapping
+		if err := rows.Scan(&m.Source, &m.Config, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresWebhookMappingRepo) Get(ctx context.Context, source string) (*WebhookMapping, error) {
+	var m WebhookMapping
+	err := r.db.QueryRowContext(ctx, `SELECT source, config, created_at, updated_at FROM webhook_mappings WHERE source=$1`, source).
+		Scan(&m.Source, &m.Config, &m.CreatedAt, &m.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *PostgresWebhookMappingRepo) Put(ctx context.Context, m *WebhookMapping) (bool, error) {
+	// xmax = 0 only for a freshly inserted row
+	const q = `INSERT INTO webhook_mappings (source, config) VALUES ($1, $2)
+ON CONFLICT (source) DO UPDATE SET config=EXCLUDED.config, updated_at=NOW()
+RETURNING created_at, updated_at, (xmax = 0)`
+	var created bool
+	if err := r.db.QueryRowContext(ctx, q, m.Source, []byte(m.Config)).Scan(&m.CreatedAt, &m.UpdatedAt, &created); err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+func (r *PostgresWebhookMappingRepo) Delete(ctx context.Context, source string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhook_mappings WHERE source=$1`, source)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,833 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// The Memory* repositories back the API when no database is configured
+// (development mode). They follow the same conflict and merge rules as the
+// Postgres implementations but keep everything in process memory.
+
+// sameNaturalKey mirrors the uq_deployments_natural_key partial index.
+func sameNaturalKey(a, b metrics.Deployment) bool {
+	return a.Repository != "" && a.CommitSHA != "" &&
+		a.Repository == b.Repository && a.CommitSHA == b.CommitSHA && a.Environment == b.Environment
+}
+
+// mergeDeployment applies a later observation of the same deployment onto the
+// stored one; it is the in-memory twin of the ON CONFLICT clause in
+// PostgresDeploymentRepo.Upsert. Finished deployments never regress to
+// pending/running, times widen rather than shrink, tags are merged, and blank
+// fields keep their stored values.
+func mergeDeployment(stored, in metrics.Deployment) metrics.Deployment {
+	out := stored
+	out.Service = in.Service
+	if in.Version != "" {
+		out.Version = in.Version
+	}
+	if !(stored.Status.IsTerminal() && !in.Status.IsTerminal()) {
+		out.Status = in.Status
+	}
+	if !in.StartTime.IsZero() && in.StartTime.Before(stored.StartTime) {
+		out.StartTime = in.StartTime
+	}
+	if in.EndTime != nil {
+		out.EndTime = in.EndTime
+	}
+	if !in.CommitTime.IsZero() && in.CommitTime.Before(stored.CommitTime) {
+		out.CommitTime = in.CommitTime
+	}
+	if in.Author != "" {
+		out.Author = in.Author
+	}
+	if in.Branch != "" {
+		out.Branch = in.Branch
+	}
+	if in.BuildURL != "" {
+		out.BuildURL = in.BuildURL
+	}
+	out.Tags = mergeTags(stored.Tags, in.Tags)
+	out.UpdatedAt = in.UpdatedAt
+	return out
+}
+
+// defaultDeploymentTimes returns the start and commit times a new deployment
+// is stored with when they are unknown (zero): a deployment reported only by
+// its completion started no later than that, or else now, and its commit is
+// assumed to be as old as its start.
+func defaultDeploymentTimes(d metrics.Deployment, now time.Time) (start, commit time.Time) {
+	start = d.StartTime
+	if start.IsZero() {
+		start = now
+		if d.EndTime != nil && d.EndTime.Before(now) {
+			start = *d.EndTime
+		}
+	}
+	commit = d.CommitTime
+	if commit.IsZero() {
+		commit = start
+	}
+	return start, commit
+}
+
+// nullTime maps an unknown (zero) time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// mergeTags overlays in's tags onto stored's, like jsonb || in Postgres.
+func mergeTags(stored, in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return stored
+	}
+	out := make(map[string]string, len(stored)+len(in))
+	maps.Copy(out, stored)
+	maps.Copy(out, in)
+	return out
+}
+
+// mergeIncident is the in-memory twin of the ON CONFLICT clause in
+// PostgresIncidentRepo.Upsert.
+func mergeIncident(stored, in metrics.Incident) metrics.Incident {
+	out := stored
+	out.Service, out.Severity = in.Service, in.Severity
+	if in.Title != "" {
+		out.Title = in.Title
+	}
+	if in.Description != "" {
+		out.Description = in.Description
+	}
+	if in.StartTime.Before(stored.StartTime) {
+		out.StartTime = in.StartTime
+	}
+	if stored.ResolvedTime == nil {
+		out.ResolvedTime = in.ResolvedTime
+	}
+	if in.RootCause != "" {
+		out.RootCause = in.RootCause
+	}
+	if in.Assignee != "" {
+		out.Assignee = in.Assignee
+	}
+	out.Tags = mergeTags(stored.Tags, in.Tags)
+	out.UpdatedAt = in.UpdatedAt
+	return out
+}
+
+// MemoryDeploymentRepo implements DeploymentRepository in memory.
+type MemoryDeploymentRepo struct {
+	mu    sync.RWMutex
+	items []metrics.Deployment
+}
+
+func NewMemoryDeploymentRepo() *MemoryDeploymentRepo { return &MemoryDeploymentRepo{} }
+
+func (r *MemoryDeploymentRepo) Create(_ context.Context, d *metrics.Deployment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.insertLocked(*d)
+}
+
+func (r *MemoryDeploymentRepo) insertLocked(d metrics.Deployment) error {
+	for _, existing := range r.items {
+		if existing.ID == d.ID || sameNaturalKey(existing, d) {
+			return ErrConflict
+		}
+	}
+	r.items = append(r.items, d)
+	return nil
+}
+
+func (r *MemoryDeploymentRepo) Upsert(_ context.Context, d *metrics.Deployment) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byID := d.Repository == "" || d.CommitSHA == ""
+	for i := range r.items {
+		if sameNaturalKey(r.items[i], *d) || byID && r.items[i].ID == d.ID {
+			r.items[i] = mergeDeployment(r.items[i], *d)
+			*d = r.items[i]
+			return false, nil
+		}
+	}
+	d.StartTime, d.CommitTime = defaultDeploymentTimes(*d, time.Now())
+	return true, r.insertLocked(*d)
+}
+
+func (r *MemoryDeploymentRepo) CreateBatch(_ context.Context, ds []metrics.Deployment) []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errs := make([]error, len(ds))
+	for i, d := range ds {
+		errs[i] = r.insertLocked(d)
+	}
+	return errs
+}
+
+func (r *MemoryDeploymentRepo) ListRange(_ context.Context, start, end time.Time) ([]metrics.Deployment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []metrics.Deployment
+	for _, d := range r.items {
+		if !d.StartTime.Before(start) && !d.StartTime.After(end) {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartTime.Before(out[j].StartTime) })
+	return out, nil
+}
+
+// MemoryIncidentRepo implements IncidentRepository in memory.
+type MemoryIncidentRepo struct {
+	mu    sync.RWMutex
+	items []metrics.Incident
+}
+
+func NewMemoryIncidentRepo() *MemoryIncidentRepo { return &MemoryIncidentRepo{} }
+
+func (r *MemoryIncidentRepo) Create(_ context.Context, i *metrics.Incident) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.insertLocked(*i)
+}
+
+func (r *MemoryIncidentRepo) insertLocked(i metrics.Incident) error {
+	for _, existing := range r.items {
+		if existing.ID == i.ID {
+			return ErrConflict
+		}
+	}
+	r.items = append(r.items, i)
+	return nil
+}
+
+func (r *MemoryIncidentRepo) CreateBatch(_ context.Context, is []metrics.Incident) []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errs := make([]error, len(is))
+	for n, i := range is {
+		errs[n] = r.insertLocked(i)
+	}
+	return errs
+}
+
+func (r *MemoryIncidentRepo) Upsert(_ context.Context, i *metrics.Incident) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n := range r.items {
+		if r.items[n].ID == i.ID {
+			r.items[n] = mergeIncident(r.items[n], *i)
+			*i = r.items[n]
+			return false, nil
+		}
+	}
+	r.items = append(r.items, *i)
+	return true, nil
+}
+
+func (r *MemoryIncidentRepo) Resolve(_ context.Context, id string, resolvedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n := range r.items {
+		if r.items[n].ID != id {
+			continue
+		}
+		if r.items[n].ResolvedTime != nil {
+			return ErrConflict
+		}
+		r.items[n].ResolvedTime = &resolvedAt
+		r.items[n].UpdatedAt = resolvedAt
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryIncidentRepo) ListRange(_ context.Context, start, end time.Time) ([]metrics.Incident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []metrics.Incident
+	for _, i := range r.items {
+		if !i.StartTime.Before(start) && !i.StartTime.After(end) {
+			out = append(out, i)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].StartTime.Before(out[b].StartTime) })
+	return out, nil
+}
+
+// MemoryCommitRepo implements CommitRepository in memory.
+type MemoryCommitRepo struct {
+	mu    sync.RWMutex
+	items map[[2]string]metrics.Commit
+}
+
+func NewMemoryCommitRepo() *MemoryCommitRepo {
+	return &MemoryCommitRepo{items: make(map[[2]string]metrics.Commit)}
+}
+
+func (r *MemoryCommitRepo) Save(_ context.Context, commits []metrics.Commit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range commits {
+		key := [2]string{c.Repository, c.SHA}
+		if prev, ok := r.items[key]; ok {
+			if c.Author == "" {
+				c.Author = prev.Author
+			}
+			if c.Message == "" {
+				c.Message = prev.Message
+			}
+		}
+		r.items[key] = c
+	}
+	return nil
+}
+
+func (r *MemoryCommitRepo) Get(_ context.Context, repository, sha string) (*metrics.Commit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.items[[2]string{repository, sha}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &c, nil
+}
+
+// MemoryWebhookMappingRepo implements WebhookMappingRepository in memory.
+type MemoryWebhookMappingRepo struct {
+	mu    sync.RWMutex
+	items map[string]WebhookMapping
+}
+
+func NewMemoryWebhookMappingRepo() *MemoryWebhookMappingRepo {
+	return &MemoryWebhookMappingRepo{items: make(map[string]WebhookMapping)}
+}
+
+func (r *MemoryWebhookMappingRepo) List(_ context.Context) ([]WebhookMapping, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]WebhookMapping, 0, len(r.items))
+	for _, m := range r.items {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out, nil
+}
+
+func (r *MemoryWebhookMappingRepo) Get(_ context.Context, source string) (*WebhookMapping, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.items[source]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &m, nil
+}
+
+func (r *MemoryWebhookMappingRepo) Put(_ context.Context, m *WebhookMapping) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	prev, exists := r.items[m.Source]
+	m.CreatedAt, m.UpdatedAt = now, now
+	if exists {
+		m.CreatedAt = prev.CreatedAt
+	}
+	r.items[m.Source] = *m
+	return !exists, nil
+}
+
+func (r *MemoryWebhookMappingRepo) Delete(_ context.Context, source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[source]; !ok {
+		return ErrNotFound
+	}
+	delete(r.items, source)
+	return nil
+}
+
+// MemoryWebhookInbox implements WebhookInbox in memory.
+type MemoryWebhookInbox struct {
+	mu     sync.Mutex
+	nextID int64
+	items  map[int64]*InboxItem
+	leases map[int64]time.Time
+	keys   map[[2]string]int64
+}
+
+func NewMemoryWebhookInbox() *MemoryWebhookInbox {
+	return &MemoryWebhookInbox{items: make(map[int64]*InboxItem), leases: make(map[int64]time.Time), keys: make(map[[2]string]int64)}
+}
+
+func (r *MemoryWebhookInbox) Enqueue(_ context.Context, item *InboxItem) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := [2]string{item.Source, item.DeliveryKey}
+	if id, ok := r.keys[key]; ok {
+		*item = *r.items[id]
+		return true, nil
+	}
+	r.nextID++
+	now := time.Now().UTC()
+	stored := *item
+	stored.ID, stored.Status, stored.Attempts = r.nextID, InboxPending, 0
+	stored.NextAttemptAt, stored.ReceivedAt = now, now
+	r.items[stored.ID] = &stored
+	r.keys[key] = stored.ID
+	*item = stored
+	return false, nil
+}
+
+func (r *MemoryWebhookInbox) Claim(_ context.Context, limit int, lease time.Duration) ([]InboxItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var due []*InboxItem
+	for id, it := range r.items {
+		if (it.Status == InboxPending && !it.NextAttemptAt.After(now)) ||
+			(it.Status == InboxProcessing && r.leases[id].Before(now)) {
+			due = append(due, it)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	out := make([]InboxItem, 0, len(due))
+	for _, it := range due {
+		it.Status = InboxProcessing
+		it.Attempts++
+		r.leases[it.ID] = now.Add(lease)
+		out = append(out, *it)
+	}
+	return out, nil
+}
+
+func (r *MemoryWebhookInbox) Complete(_ context.Context, id int64, status InboxStatus, result json.RawMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	it, ok := r.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	it.Status, it.Result, it.LastError, it.ProcessedAt = status, result, "", &now
+	delete(r.leases, id)
+	return nil
+}
+
+func (r *MemoryWebhookInbox) Fail(_ context.Context, id int64, reason string, retryAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	it, ok := r.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	it.LastError = reason
+	delete(r.leases, id)
+	if retryAt == nil {
+		now := time.Now().UTC()
+		it.Status, it.ProcessedAt = InboxDead, &now
+		return nil
+	}
+	it.Status, it.NextAttemptAt = InboxPending, *retryAt
+	return nil
+}
+
+func (r *MemoryWebhookInbox) Get(_ context.Context, id int64) (*InboxItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	it, ok := r.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *it
+	return &cp, nil
+}
+
+func (r *MemoryWebhookInbox) List(_ context.Context, status InboxStatus, limit int) ([]InboxItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []InboxItem{}
+	for _, it := range r.items {
+		if status == "" || it.Status == status {
+			out = append(out, *it)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *MemoryWebhookInbox) Replay(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	it, ok := r.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if it.Status != InboxDead {
+		return ErrConflict
+	}
+	it.Status, it.Attempts, it.NextAttemptAt, it.LastError, it.ProcessedAt = InboxPending, 0, time.Now().UTC(), "", nil
+	return nil
+}
+
+func (r *MemoryWebhookInbox) Purge(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, it := range r.items {
+		if (it.Status == InboxDone || it.Status == InboxIgnored) && it.ProcessedAt != nil && it.ProcessedAt.Before(before) {
+			delete(r.items, id)
+			delete(r.keys, [2]string{it.Source, it.DeliveryKey})
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MemoryWebhookSecretRepo implements WebhookSecretRepository in memory.
+type MemoryWebhookSecretRepo struct {
+	mu      sync.Mutex
+	nextID  int64
+	secrets []WebhookSecret // oldest first
+}
+
+func NewMemoryWebhookSecretRepo() *MemoryWebhookSecretRepo { return &MemoryWebhookSecretRepo{} }
+
+func (r *MemoryWebhookSecretRepo) list(plugin string, activeOnly bool) []WebhookSecret {
+	now := time.Now()
+	out := []WebhookSecret{}
+	for i := len(r.secrets) - 1; i >= 0; i-- {
+		s := r.secrets[i]
+		if s.Plugin == plugin && (!activeOnly || s.ActiveAt(now)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (r *MemoryWebhookSecretRepo) Active(_ context.Context, plugin string) ([]WebhookSecret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list(plugin, true), nil
+}
+
+func (r *MemoryWebhookSecretRepo) List(_ context.Context, plugin string) ([]WebhookSecret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list(plugin, false), nil
+}
+
+func (r *MemoryWebhookSecretRepo) Rotate(_ context.Context, plugin, secret string, grace time.Duration) (*WebhookSecret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	kept := false
+	for i := len(r.secrets) - 1; i >= 0; i-- {
+		s := &r.secrets[i]
+		if s.Plugin != plugin || !s.ActiveAt(now) {
+			continue
+		}
+		expires := now
+		if !kept {
+			kept = true
+			expires = now.Add(grace)
+			if s.ExpiresAt != nil && s.ExpiresAt.Before(expires) {
+				expires = *s.ExpiresAt
+			}
+		}
+		s.ExpiresAt = &expires
+	}
+	r.nextID++
+	s := WebhookSecret{ID: r.nextID, Plugin: plugin, Secret: secret, CreatedAt: now}
+	r.secrets = append(r.secrets, s)
+	return &s, nil
+}
+
+func (r *MemoryWebhookSecretRepo) Revoke(_ context.Context, plugin string, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	for i := range r.secrets {
+		s := &r.secrets[i]
+		if s.Plugin == plugin && s.ID == id {
+			if s.ActiveAt(now) {
+				s.ExpiresAt = &now
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MemoryPluginStateRepo implements PluginStateRepository in memory.
+type MemoryPluginStateRepo struct {
+	mu      sync.Mutex
+	nextID  int64
+	cursors map[string]string
+	runs    map[string][]PluginRun // oldest first
+}
+
+func NewMemoryPluginStateRepo() *MemoryPluginStateRepo {
+	return &MemoryPluginStateRepo{cursors: make(map[string]string), runs: make(map[string][]PluginRun)}
+}
+
+func (r *MemoryPluginStateRepo) Cursor(_ context.Context, plugin string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursors[plugin], nil
+}
+
+func (r *MemoryPluginStateRepo) SaveCursor(_ context.Context, plugin, cursor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursors[plugin] = cursor
+	return nil
+}
+
+func (r *MemoryPluginStateRepo) RecordRun(_ context.Context, run PluginRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	run.ID = r.nextID
+	runs := append(r.runs[run.Plugin], run)
+	if len(runs) > maxPluginRuns {
+		runs = runs[len(runs)-maxPluginRuns:]
+	}
+	r.runs[run.Plugin] = runs
+	return nil
+}
+
+func (r *MemoryPluginStateRepo) Runs(_ context.Context, plugin string, limit int) ([]PluginRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := r.runs[plugin]
+	out := []PluginRun{}
+	for i := len(runs) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, runs[i])
+	}
+	return out, nil
+}
+
+func (r *MemoryPluginStateRepo) Delete(_ context.Context, plugin string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cursors, plugin)
+	delete(r.runs, plugin)
+	return nil
+}
+
+// MemoryPluginInstanceRepo implements PluginInstanceRepository in memory.
+type MemoryPluginInstanceRepo struct {
+	mu    sync.RWMutex
+	items map[string]PluginInstance
+}
+
+func NewMemoryPluginInstanceRepo() *MemoryPluginInstanceRepo {
+	return &MemoryPluginInstanceRepo{items: make(map[string]PluginInstance)}
+}
+
+func (r *MemoryPluginInstanceRepo) List(_ context.Context) ([]PluginInstance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]PluginInstance, 0, len(r.items))
+	for _, p := range r.items {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (r *MemoryPluginInstanceRepo) Get(_ context.Context, name string) (*PluginInstance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.items[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r *MemoryPluginInstanceRepo) Create(_ context.Context, p *PluginInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[p.Name]; ok {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	p.Config = configOrEmpty(p.Config)
+	p.CreatedAt, p.UpdatedAt = now, now
+	r.items[p.Name] = *p
+	return nil
+}
+
+func (r *MemoryPluginInstanceRepo) Update(_ context.Context, p *PluginInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.items[p.Name]
+	if !ok {
+		return ErrNotFound
+	}
+	cur.Config = configOrEmpty(p.Config)
+	cur.SecretRef = p.SecretRef
+	cur.Enabled = p.Enabled
+	cur.IntervalSeconds = p.IntervalSeconds
+	cur.UpdatedAt = time.Now().UTC()
+	r.items[p.Name] = cur
+	*p = cur
+	return nil
+}
+
+func (r *MemoryPluginInstanceRepo) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[name]; !ok {
+		return ErrNotFound
+	}
+	delete(r.items, name)
+	return nil
+}
+
+func (r *MemoryPluginInstanceRepo) RecordSync(_ context.Context, name string, at time.Time, syncErr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	p.LastError = syncErr
+	if syncErr == "" {
+		p.LastSyncAt = &at
+		p.SuccessCount++
+		p.ConsecutiveFailures = 0
+	} else {
+		p.FailureCount++
+		p.ConsecutiveFailures++
+	}
+	r.items[name] = p
+	return nil
+}
+
+// MemoryWASMTransformRepo implements WASMTransformRepository in memory.
+type MemoryWASMTransformRepo struct {
+	mu    sync.RWMutex
+	items map[string]WASMTransform
+}
+
+func NewMemoryWASMTransformRepo() *MemoryWASMTransformRepo {
+	return &MemoryWASMTransformRepo{items: make(map[string]WASMTransform)}
+}
+
+func (r *MemoryWASMTransformRepo) List(_ context.Context) ([]WASMTransform, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]WASMTransform, 0, len(r.items))
+	for _, t := range r.items {
+		t.Module = nil
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (r *MemoryWASMTransformRepo) Get(_ context.Context, name string) (*WASMTransform, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.items[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (r *MemoryWASMTransformRepo) Put(_ context.Context, t *WASMTransform) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	prev, exists := r.items[t.Name]
+	t.CreatedAt, t.UpdatedAt = now, now
+	if exists {
+		t.CreatedAt = prev.CreatedAt
+	}
+	t.Size = len(t.Module)
+	r.items[t.Name] = *t
+	return !exists, nil
+}
+
+func (r *MemoryWASMTransformRepo) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[name]; !ok {
+		return ErrNotFound
+	}
+	delete(r.items, name)
+	return nil
+}
+
+// MemoryTicketLinkRepo implements TicketLinkRepository in memory.
+type MemoryTicketLinkRepo struct {
+	mu    sync.RWMutex
+	items map[metrics.TicketLink]bool
+}
+
+func NewMemoryTicketLinkRepo() *MemoryTicketLinkRepo {
+	return &MemoryTicketLinkRepo{items: make(map[metrics.TicketLink]bool)}
+}
+
+func (r *MemoryTicketLinkRepo) Save(_ context.Context, links []metrics.TicketLink) error {
+	for _, l := range links {
+		if err := checkLink(l); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range links {
+		r.items[l] = true
+	}
+	return nil
+}
+
+func (r *MemoryTicketLinkRepo) IncidentDeployments(_ context.Context, incidentID string) ([]metrics.TicketLink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tickets := map[string]bool{}
+	for l := range r.items {
+		if l.IncidentID == incidentID {
+			tickets[l.Ticket] = true
+		}
+	}
+	out := []metrics.TicketLink{}
+	for l := range r.items {
+		if l.DeploymentID != "" && tickets[l.Ticket] {
+			l.IncidentID = incidentID
+			out = append(out, l)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Ticket != out[j].Ticket {
+			return out[i].Ticket < out[j].Ticket
+		}
+		return out[i].DeploymentID < out[j].DeploymentID
+	})
+	return out, nil
+}
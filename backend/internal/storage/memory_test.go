@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+func TestMemoryUpsertMergesTags(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	deployments := NewMemoryDeploymentRepo()
+	d := &metrics.Deployment{ID: "d-1", Service: "api", Environment: "prod", Status: metrics.DeploymentStatusRunning, StartTime: now,
+		Tags: map[string]string{"image": "api:1.2", "trigger": "push"}}
+	if _, err := deployments.Upsert(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	later := &metrics.Deployment{ID: "d-1", Service: "api", Environment: "prod", Status: metrics.DeploymentStatusSuccess,
+		Tags: map[string]string{"trigger": "manual"}}
+	if _, err := deployments.Upsert(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"image": "api:1.2", "trigger": "manual"}; !maps.Equal(later.Tags, want) {
+		t.Errorf("deployment tags = %v want %v", later.Tags, want)
+	}
+
+	incidents := NewMemoryIncidentRepo()
+	inc := &metrics.Incident{ID: "i-1", Service: "api", StartTime: now, Tags: map[string]string{"urgency": "low"}}
+	if _, err := incidents.Upsert(ctx, inc); err != nil {
+		t.Fatal(err)
+	}
+	bump := &metrics.Incident{ID: "i-1", Service: "api", StartTime: now}
+	if _, err := incidents.Upsert(ctx, bump); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"urgency": "low"}; !maps.Equal(bump.Tags, want) {
+		t.Errorf("incident tags = %v want %v", bump.Tags, want)
+	}
+}
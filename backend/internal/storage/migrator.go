@@ -23,15 +23,8 @@ func ApplyMigrations(ctx context.Context, db *sql.DB, dir string, logger func(ms
     }
     applied, err := loadApplied(ctx, db)
     if err != nil { return err }
-    var files []string
-    err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
-        if walkErr != nil { return walkErr }
-        if d.IsDir() { return nil }
-        if strings.HasSuffix(d.Name(), ".up.sql") { files = append(files, path) }
-        return nil
-    })
-    if err != nil { return fmt.Errorf("scan migrations: %w", err) }
-    sort.Strings(files)
+    files, err := listMigrations(dir)
+    if err != nil { return err }
     for _, f := range files {
         base := filepath.Base(f)
         versionKey := strings.TrimSuffix(base, ".up.sql")
@@ -49,6 +42,42 @@ func ApplyMigrations(ctx context.Context, db *sql.DB, dir string, logger func(ms
     return nil
 }
 
+// PendingMigrations returns the versions found in dir that are not yet recorded in schema_migrations.
+// A missing schema_migrations table means every migration is pending.
+func PendingMigrations(ctx context.Context, db *sql.DB, dir string) ([]string, error) {
+    files, err := listMigrations(dir)
+    if err != nil { return nil, err }
+    var exists bool
+    if err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+        return nil, fmt.Errorf("check schema_migrations: %w", err)
+    }
+    applied := map[string]bool{}
+    if exists {
+        if applied, err = loadApplied(ctx, db); err != nil { return nil, err }
+    }
+    var pending []string
+    for _, f := range files {
+        v := strings.TrimSuffix(filepath.Base(f), ".up.sql")
+        if !applied[v] { pending = append(pending, v) }
+    }
+    return pending, nil
+}
+
+// listMigrations returns the sorted *.up.sql paths under dir.
+func listMigrations(dir string) ([]string, error) {
+    if _, err := os.Stat(dir); err != nil { return nil, fmt.Errorf("migrations directory: %w", err) }
+    var files []string
+    err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
+        if walkErr != nil { return walkErr }
+        if d.IsDir() { return nil }
+        if strings.HasSuffix(d.Name(), ".up.sql") { files = append(files, path) }
+        return nil
+    })
+    if err != nil { return nil, fmt.Errorf("scan migrations: %w", err) }
+    sort.Strings(files)
+    return files, nil
+}
+
 func loadApplied(ctx context.Context, db *sql.DB) (map[string]bool, error) {
     rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
     if err != nil { return nil, fmt.Errorf("select schema_migrations: %w", err) }
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PluginInstance is a configured collector plugin. Config is opaque here;
+// the plugin validates it. SecretRef names where its credentials are read
+// from, so they are never stored.
+type PluginInstance struct {
+	Name            string          `json:"name"`
+	Type            string          `json:"type"`
+	Config          json.RawMessage `json:"config"`
+	SecretRef       string          `json:"secret_ref,omitempty"`
+	Enabled         bool            `json:"enabled"`
+	IntervalSeconds int             `json:"interval_seconds,omitempty"`
+	// Sync status: LastSyncAt is the end of the last successful cycle and
+	// LastError the error of the last cycle ("" when it succeeded).
+	LastSyncAt          *time.Time `json:"last_sync_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	SuccessCount        int64      `json:"success_count"`
+	FailureCount        int64      `json:"failure_count"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// PluginInstanceRepository stores collector plugin instances keyed by name.
+type PluginInstanceRepository interface {
+	List(ctx context.Context) ([]PluginInstance, error)
+	// Get returns the instance or ErrNotFound.
+	Get(ctx context.Context, name string) (*PluginInstance, error)
+	// Create stores a new instance, filling its timestamps; ErrConflict when
+	// the name is taken.
+	Create(ctx context.Context, p *PluginInstance) error
+	// Update replaces the configuration (config, secret_ref, enabled and
+	// interval) of an instance, keeping its sync status; ErrNotFound when
+	// there is none.
+	Update(ctx context.Context, p *PluginInstance) error
+	// Delete removes the instance or returns ErrNotFound.
+	Delete(ctx context.Context, name string) error
+	// RecordSync updates the sync status and health counters after a cycle
+	// that ended at; ErrNotFound when there is no such instance.
+	RecordSync(ctx context.Context, name string, at time.Time, syncErr string) error
+}
+
+const pluginInstanceColumns = `name, type, config, secret_ref, enabled, interval_seconds, last_sync_at, last_error,
+success_count, failure_count, consecutive_failures, created_at, updated_at`
+
+// PostgresPluginInstanceRepo implements PluginInstanceRepository.
+type PostgresPluginInstanceRepo struct{ db *sql.DB }
+
+func NewPostgresPluginInstanceRepo(db *sql.DB) *PostgresPluginInstanceRepo {
+	return &PostgresPluginInstanceRepo{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPluginInstance(row rowScanner) (*PluginInstance, error) {
+	var p PluginInstance
+	var lastSync sql.NullTime
+	var config []byte
+	if err := row.Scan(&p.Name, &p.Type, &config, &p.SecretRef, &p.Enabled, &p.IntervalSeconds, &lastSync, &p.LastError,
+		&p.SuccessCount, &p.FailureCount, &p.ConsecutiveFailures, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.Config = config
+	if lastSync.Valid {
+		p.LastSyncAt = &lastSync.Time
+	}
+	return &p, nil
+}
+
+func (r *PostgresPluginInstanceRepo) List(ctx context.Context) ([]PluginInstance, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+pluginInstanceColumns+` FROM plugin_instances ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PluginInstance
+	for rows.Next() {
+		p, err := scanPluginInstance(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresPluginInstanceRepo) Get(ctx context.Context, name string) (*PluginInstance, error) {
+	p, err := scanPluginInstance(r.db.QueryRowContext(ctx, `SELECT `+pluginInstanceColumns+` FROM plugin_instances WHERE name=$1`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+func (r *PostgresPluginInstanceRepo) Create(ctx context.Context, p *PluginInstance) error {
+	const q = `INSERT INTO plugin_instances (name, type, config, secret_ref, enabled, interval_seconds)
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at, updated_at`
+	err := r.db.QueryRowContext(ctx, q, p.Name, p.Type, []byte(configOrEmpty(p.Config)), p.SecretRef, p.Enabled, p.IntervalSeconds).
+		Scan(&p.CreatedAt, &p.UpdatedAt)
+	return mapWriteErr(err)
+}
+
+func (r *PostgresPluginInstanceRepo) Update(ctx context.Context, p *PluginInstance) error {
+	const q = `UPDATE plugin_instances SET config=$2, secret_ref=$3, enabled=$4, interval_seconds=$5, updated_at=NOW()
+WHERE name=$1 RETURNING ` + pluginInstanceColumns
+	updated, err := scanPluginInstance(r.db.QueryRowContext(ctx, q, p.Name, []byte(configOrEmpty(p.Config)), p.SecretRef, p.Enabled, p.IntervalSeconds))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*p = *updated
+	return nil
+}
+
+func (r *PostgresPluginInstanceRepo) Delete(ctx context.Context, name string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM plugin_instances WHERE name=$1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresPluginInstanceRepo) RecordSync(ctx context.Context, name string, at time.Time, syncErr string) error {
+	const q = `UPDATE plugin_instances SET
+  last_sync_at = CASE WHEN $3::text = '' THEN $2::timestamptz ELSE last_sync_at END,
+  last_error = $3,
+  success_count = success_count + CASE WHEN $3 = '' THEN 1 ELSE 0 END,
+  failure_count = failure_count + CASE WHEN $3 = '' THEN 0 ELSE 1 END,
+  consecutive_failures = CASE WHEN $3 = '' THEN 0 ELSE consecutive_failures + 1 END
+WHERE name=$1`
+	res, err := r.db.ExecContext(ctx, q, name, at, syncErr)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func configOrEmpty(config json.RawMessage) json.RawMessage {
+	if len(config) == 0 {
+		return json.RawMessage(`{}`)
+	}
+	return config
+}
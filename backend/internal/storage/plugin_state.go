@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// maxPluginRuns is how many collection cycles are kept per plugin.
+const maxPluginRuns = 100
+
+// PluginRun is the outcome of one collection cycle.
+type PluginRun struct {
+	ID        int64         `json:"id"`
+	Plugin    string        `json:"plugin"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	// Items is the number of records stored by the cycle.
+	Items int    `json:"items"`
+	Error string `json:"error,omitempty"`
+}
+
+// PluginStateRepository persists collector plugin cursors and cycle history.
+type PluginStateRepository interface {
+	// Cursor returns the plugin's saved cursor, or "" when there is none.
+	Cursor(ctx context.Context, plugin string) (string, error)
+	SaveCursor(ctx context.Context, plugin, cursor string) error
+	// RecordRun appends a cycle outcome, keeping the latest maxPluginRuns.
+	RecordRun(ctx context.Context, run PluginRun) error
+	// Runs returns up to limit of the plugin's latest cycles, newest first.
+	Runs(ctx context.Context, plugin string, limit int) ([]PluginRun, error)
+	// Delete removes the plugin's cursor and cycle history.
+	Delete(ctx context.Context, plugin string) error
+}
+
+// PostgresPluginStateRepo implements PluginStateRepository.
+type PostgresPluginStateRepo struct{ db *sql.DB }
+
+func NewPostgresPluginStateRepo(db *sql.DB) *PostgresPluginStateRepo {
+	return &PostgresPluginStateRepo{db: db}
+}
+
+func (r *PostgresPluginStateRepo) Cursor(ctx context.Context, plugin string) (string, error) {
+	var cursor string
+	err := r.db.QueryRowContext(ctx, `SELECT cursor FROM plugin_checkpoints WHERE plugin=$1`, plugin).Scan(&cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return cursor, err
+}
+
+func (r *PostgresPluginStateRepo) SaveCursor(ctx context.Context, plugin, cursor string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO plugin_checkpoints (plugin, cursor) VALUES ($1, $2)
+ON CONFLICT (plugin) DO UPDATE SET cursor=EXCLUDED.cursor, updated_at=NOW()`, plugin, cursor)
+	return err
+}
+
+func (r *PostgresPluginStateRepo) RecordRun(ctx context.Context, run PluginRun) error {
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO plugin_runs (plugin, started_at, duration_ms, items, error)
+VALUES ($1, $2, $3, $4, $5)`, run.Plugin, run.StartedAt, run.Duration.Milliseconds(), run.Items, run.Error); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM plugin_runs WHERE plugin=$1 AND id <= (
+  SELECT id FROM plugin_runs WHERE plugin=$1 ORDER BY id DESC OFFSET $2 LIMIT 1)`, run.Plugin, maxPluginRuns)
+	return err
+}
+
+func (r *PostgresPluginStateRepo) Runs(ctx context.Context, plugin string, limit int) ([]PluginRun, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, plugin, started_at, duration_ms, items, error FROM plugin_runs
+WHERE plugin=$1 ORDER BY id DESC LIMIT $2`, plugin, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PluginRun
+	for rows.Next() {
+		var run PluginRun
+		var ms int64
+		if err := rows.Scan(&run.ID, &run.Plugin, &run.StartedAt, &ms, &run.Items, &run.Error); err != nil {
+			return nil, err
+		}
+		run.Duration = time.Duration(ms) * time.Millisecond
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresPluginStateRepo) Delete(ctx context.Context, plugin string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM plugin_checkpoints WHERE plugin=$1`, plugin); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM plugin_runs WHERE plugin=$1`, plugin); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -38,13 +39,35 @@ func (r *Redis) Close() error {
 	return r.client.Close()
 }
 
-// Health checks the Redis health
-func (r *Redis) Health() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Health checks the Redis health, bounded by the context deadline
+func (r *Redis) Health(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
 
+// Info returns the key/value pairs reported by the Redis INFO command
+func (r *Redis) Info(ctx context.Context, sections ...string) (map[string]string, error) {
+	raw, err := r.client.Info(ctx, sections...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseRedisInfo(raw), nil
+}
+
+// parseRedisInfo parses the INFO reply format ("# Section" headers followed by key:value lines)
+func parseRedisInfo(raw string) map[string]string {
+	out := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
 // GetClient returns the underlying Redis client
 func (r *Redis) GetClient() *redis.Client {
 	return r.client
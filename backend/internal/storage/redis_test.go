@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseRedisInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name, raw string
+		want      map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"sections and CRLF", "# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:42\r\n\r\n# Memory\r\nused_memory_human:1.05M\r\n", map[string]string{"redis_version": "7.2.4", "uptime_in_seconds": "42", "used_memory_human": "1.05M"}},
+		{"values containing colons", "db0:keys=3,expires=0\nexecutable:/usr/bin/redis-server\nrole:master", map[string]string{"db0": "keys=3,expires=0", "executable": "/usr/bin/redis-server", "role": "master"}},
+		{"lines without a colon", "# Stats\ngarbage\nkeyspace_hits:10", map[string]string{"keyspace_hits": "10"}},
+	} {
+		if got := parseRedisInfo(tc.raw); !maps.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
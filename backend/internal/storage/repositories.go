@@ -3,20 +3,71 @@ package storage
 import (
     "context"
     "database/sql"
+    "encoding/json"
+    "errors"
     "fmt"
     "time"
+    "github.com/lib/pq"
     "github.com/sirhCC/MetricHub/pkg/metrics"
 )
 
+// ErrConflict is returned when a write collides with an existing row (duplicate ID or natural key).
+var ErrConflict = errors.New("storage: conflict")
+
+// ErrNotFound is returned when the addressed row does not exist.
+var ErrNotFound = errors.New("storage: not found")
+
+// uniqueViolation is the Postgres SQLSTATE for unique constraint violations.
+const uniqueViolation = "23505"
+
+// mapWriteErr translates driver errors into storage sentinels.
+func mapWriteErr(err error) error {
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+        return fmt.Errorf("%w: %s", ErrConflict, pqErr.Constraint)
+    }
+    return err
+}
+
+// tagsJSON encodes tags for a JSONB column, storing no tags as NULL.
+func tagsJSON(tags map[string]string) interface{} {
+    if len(tags) == 0 { return nil }
+    b, _ := json.Marshal(tags) // a map of strings always encodes
+    return b
+}
+
+// scanTags decodes a JSONB tags column; NULL leaves tags nil.
+func scanTags(raw []byte, tags *map[string]string) error {
+    if len(raw) == 0 { return nil }
+    return json.Unmarshal(raw, tags)
+}
+
 // DeploymentRepository defines persistence for deployments.
 type DeploymentRepository interface {
     Create(ctx context.Context, d *metrics.Deployment) error
+    // Upsert inserts or updates the deployment identified by its natural key
+    // (repository, commit_sha, environment), or by ID when it has no repository
+    // or commit SHA. Updates follow mergeDeployment so
+    // out-of-order events never regress a finished deployment. A zero StartTime
+    // or CommitTime is unknown: an update keeps the stored time, and a new row
+    // gets the defaults of defaultDeploymentTimes. On update d is replaced with
+    // the merged row. It reports whether a new row was created.
+    Upsert(ctx context.Context, d *metrics.Deployment) (bool, error)
+    // CreateBatch inserts many deployments and reports a per-item error (nil on success).
+    CreateBatch(ctx context.Context, ds []metrics.Deployment) []error
     ListRange(ctx context.Context, start, end time.Time) ([]metrics.Deployment, error)
 }
 
 // IncidentRepository defines persistence for incidents.
 type IncidentRepository interface {
     Create(ctx context.Context, i *metrics.Incident) error
+    // CreateBatch inserts many incidents and reports a per-item error (nil on success).
+    CreateBatch(ctx context.Context, is []metrics.Incident) []error
+    // Upsert inserts the incident or merges it into the stored one with the same
+    // ID, reporting whether it was created. A resolved incident stays resolved.
+    Upsert(ctx context.Context, i *metrics.Incident) (bool, error)
+    // Resolve sets the resolution time; ErrNotFound for an unknown incident,
+    // ErrConflict for one that is already resolved.
     Resolve(ctx context.Context, id string, resolvedAt time.Time) error
     ListRange(ctx context.Context, start, end time.Time) ([]metrics.Incident, error)
 }
@@ -31,13 +82,50 @@ func (r *PostgresDeploymentRepo) Create(ctx context.Context, d *metrics.Deployme
 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`
     _, err := r.db.ExecContext(ctx, q,
         d.ID, d.Service, d.Environment, d.Version, d.Status, d.StartTime, d.EndTime, d.CommitSHA, d.CommitTime,
-        d.Author, d.Repository, d.Branch, d.BuildURL, nil, d.CreatedAt, d.UpdatedAt,
+        d.Author, d.Repository, d.Branch, d.BuildURL, tagsJSON(d.Tags), d.CreatedAt, d.UpdatedAt,
     )
-    return err
+    return mapWriteErr(err)
+}
+
+// The natural key conflict target matches the partial unique index from
+// migration 0002.
+const (
+    deploymentNaturalKey = `(repository, commit_sha, environment) WHERE repository <> '' AND commit_sha <> ''`
+    deploymentIDKey      = `(id)`
+)
+
+func (r *PostgresDeploymentRepo) Upsert(ctx context.Context, d *metrics.Deployment) (bool, error) {
+    target := deploymentNaturalKey
+    if d.Repository == "" || d.CommitSHA == "" { target = deploymentIDKey }
+    q := `INSERT INTO deployments (id, service, environment, version, status, start_time, end_time, commit_sha, commit_time, author, repository, branch, build_url, tags, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5,COALESCE($6::timestamptz,$17),$7,$8,COALESCE($9::timestamptz,$18),$10,$11,$12,$13,$14,$15,$16)
+ON CONFLICT ` + target + ` DO UPDATE SET
+  service=EXCLUDED.service,
+  version=COALESCE(NULLIF(EXCLUDED.version, ''), deployments.version),
+  status=CASE WHEN deployments.status IN ('success','failed','cancelled') AND EXCLUDED.status IN ('pending','running') THEN deployments.status ELSE EXCLUDED.status END,
+  start_time=LEAST(deployments.start_time, $6::timestamptz),
+  end_time=COALESCE(EXCLUDED.end_time, deployments.end_time),
+  commit_time=LEAST(deployments.commit_time, $9::timestamptz),
+  author=COALESCE(NULLIF(EXCLUDED.author, ''), deployments.author),
+  branch=COALESCE(NULLIF(EXCLUDED.branch, ''), deployments.branch),
+  build_url=COALESCE(NULLIF(EXCLUDED.build_url, ''), deployments.build_url),
+  tags=COALESCE(deployments.tags || EXCLUDED.tags, EXCLUDED.tags, deployments.tags),
+  updated_at=EXCLUDED.updated_at
+RETURNING id, service, environment, version, status, start_time, end_time, commit_sha, commit_time, author, repository, branch, build_url, tags, created_at, updated_at, (xmax = 0)`
+    // Unknown times are NULL, which LEAST ignores, so updates keep the stored ones
+    start, commitTime := defaultDeploymentTimes(*d, time.Now())
+    var created bool
+    var tags []byte
+    err := r.db.QueryRowContext(ctx, q,
+        d.ID, d.Service, d.Environment, d.Version, d.Status, nullTime(d.StartTime), d.EndTime, d.CommitSHA, nullTime(d.CommitTime),
+        d.Author, d.Repository, d.Branch, d.BuildURL, tagsJSON(d.Tags), d.CreatedAt, d.UpdatedAt, start, commitTime,
+    ).Scan(&d.ID, &d.Service, &d.Environment, &d.Version, &d.Status, &d.StartTime, &d.EndTime, &d.CommitSHA, &d.CommitTime, &d.Author, &d.Repository, &d.Branch, &d.BuildURL, &tags, &d.CreatedAt, &d.UpdatedAt, &created)
+    if err != nil { return false, mapWriteErr(err) }
+    return created, scanTags(tags, &d.Tags)
 }
 
 func (r *PostgresDeploymentRepo) ListRange(ctx context.Context, start, end time.Time) ([]metrics.Deployment, error) {
-    const q = `SELECT id, service, environment, version, status, start_time, end_time, commit_sha, commit_time, author, repository, branch, build_url, created_at, updated_at FROM deployments
+    const q = `SELECT id, service, environment, version, status, start_time, end_time, commit_sha, commit_time, author, repository, branch, build_url, tags, created_at, updated_at FROM deployments
 WHERE start_time BETWEEN $1 AND $2 ORDER BY start_time`
     rows, err := r.db.QueryContext(ctx, q, start, end)
     if err != nil { return nil, err }
@@ -45,7 +133,9 @@ WHERE start_time BETWEEN $1 AND $2 ORDER BY start_time`
     var out []metrics.Deployment
     for rows.Next() {
         var d metrics.Deployment
-        if err := rows.Scan(&d.ID, &d.Service, &d.Environment, &d.Version, &d.Status, &d.StartTime, &d.EndTime, &d.CommitSHA, &d.CommitTime, &d.Author, &d.Repository, &d.Branch, &d.BuildURL, &d.CreatedAt, &d.UpdatedAt); err != nil { return nil, err }
+        var tags []byte
+        if err := rows.Scan(&d.ID, &d.Service, &d.Environment, &d.Version, &d.Status, &d.StartTime, &d.EndTime, &d.CommitSHA, &d.CommitTime, &d.Author, &d.Repository, &d.Branch, &d.BuildURL, &tags, &d.CreatedAt, &d.UpdatedAt); err != nil { return nil, err }
+        if err := scanTags(tags, &d.Tags); err != nil { return nil, err }
         out = append(out, d)
     }
     return out, rows.Err()
@@ -59,8 +149,31 @@ func NewPostgresIncidentRepo(db *sql.DB) *PostgresIncidentRepo { return &Postgre
 func (r *PostgresIncidentRepo) Create(ctx context.Context, i *metrics.Incident) error {
     const q = `INSERT INTO incidents (id, title, description, service, environment, severity, start_time, resolved_time, root_cause, assignee, tags, created_at, updated_at)
 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`
-    _, err := r.db.ExecContext(ctx, q, i.ID, i.Title, i.Description, i.Service, i.Environment, i.Severity, i.StartTime, i.ResolvedTime, i.RootCause, i.Assignee, nil, i.CreatedAt, i.UpdatedAt)
-    return err
+    _, err := r.db.ExecContext(ctx, q, i.ID, i.Title, i.Description, i.Service, i.Environment, i.Severity, i.StartTime, i.ResolvedTime, i.RootCause, i.Assignee, tagsJSON(i.Tags), i.CreatedAt, i.UpdatedAt)
+    return mapWriteErr(err)
+}
+
+func (r *PostgresIncidentRepo) Upsert(ctx context.Context, i *metrics.Incident) (bool, error) {
+    const q = `INSERT INTO incidents (id, title, description, service, environment, severity, start_time, resolved_time, root_cause, assignee, tags, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+ON CONFLICT (id) DO UPDATE SET
+  title=COALESCE(NULLIF(EXCLUDED.title, ''), incidents.title),
+  description=COALESCE(NULLIF(EXCLUDED.description, ''), incidents.description),
+  service=EXCLUDED.service,
+  severity=EXCLUDED.severity,
+  start_time=LEAST(incidents.start_time, EXCLUDED.start_time),
+  resolved_time=COALESCE(incidents.resolved_time, EXCLUDED.resolved_time),
+  root_cause=COALESCE(NULLIF(EXCLUDED.root_cause, ''), incidents.root_cause),
+  assignee=COALESCE(NULLIF(EXCLUDED.assignee, ''), incidents.assignee),
+  tags=COALESCE(incidents.tags || EXCLUDED.tags, EXCLUDED.tags, incidents.tags),
+  updated_at=EXCLUDED.updated_at
+RETURNING title, COALESCE(description, ''), service, environment, severity, start_time, resolved_time, COALESCE(root_cause, ''), COALESCE(assignee, ''), tags, created_at, updated_at, (xmax = 0)`
+    var created bool
+    var tags []byte
+    err := r.db.QueryRowContext(ctx, q, i.ID, i.Title, i.Description, i.Service, i.Environment, i.Severity, i.StartTime, i.ResolvedTime, i.RootCause, i.Assignee, tagsJSON(i.Tags), i.CreatedAt, i.UpdatedAt).
+        Scan(&i.Title, &i.Description, &i.Service, &i.Environment, &i.Severity, &i.StartTime, &i.ResolvedTime, &i.RootCause, &i.Assignee, &tags, &i.CreatedAt, &i.UpdatedAt, &created)
+    if err != nil { return false, mapWriteErr(err) }
+    return created, scanTags(tags, &i.Tags)
 }
 
 func (r *PostgresIncidentRepo) Resolve(ctx context.Context, id string, resolvedAt time.Time) error {
@@ -68,12 +181,15 @@ func (r *PostgresIncidentRepo) Resolve(ctx context.Context, id string, resolvedA
     res, err := r.db.ExecContext(ctx, q, id, resolvedAt)
     if err != nil { return err }
     n, _ := res.RowsAffected()
-    if n == 0 { return fmt.Errorf("incident not found or already resolved") }
-    return nil
+    if n > 0 { return nil }
+    var exists bool
+    if err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM incidents WHERE id=$1)`, id).Scan(&exists); err != nil { return err }
+    if exists { return fmt.Errorf("%w: incident already resolved", ErrConflict) }
+    return ErrNotFound
 }
 
 func (r *PostgresIncidentRepo) ListRange(ctx context.Context, start, end time.Time) ([]metrics.Incident, error) {
-    const q = `SELECT id, title, description, service, environment, severity, start_time, resolved_time, root_cause, assignee, created_at, updated_at FROM incidents
+    const q = `SELECT id, title, description, service, environment, severity, start_time, resolved_time, root_cause, assignee, tags, created_at, updated_at FROM incidents
 WHERE start_time BETWEEN $1 AND $2 ORDER BY start_time`
     rows, err := r.db.QueryContext(ctx, q, start, end)
     if err != nil { return nil, err }
@@ -81,7 +197,9 @@ WHERE start_time BETWEEN $1 AND $2 ORDER BY start_time`
     var out []metrics.Incident
     for rows.Next() {
         var inc metrics.Incident
-        if err := rows.Scan(&inc.ID, &inc.Title, &inc.Description, &inc.Service, &inc.Environment, &inc.Severity, &inc.StartTime, &inc.ResolvedTime, &inc.RootCause, &inc.Assignee, &inc.CreatedAt, &inc.UpdatedAt); err != nil { return nil, err }
+        var tags []byte
+        if err := rows.Scan(&inc.ID, &inc.Title, &inc.Description, &inc.Service, &inc.Environment, &inc.Severity, &inc.StartTime, &inc.ResolvedTime, &inc.RootCause, &inc.Assignee, &tags, &inc.CreatedAt, &inc.UpdatedAt); err != nil { return nil, err }
+        if err := scanTags(tags, &inc.Tags); err != nil { return nil, err }
         out = append(out, inc)
     }
     return out, rows.Err()
@@ -6,7 +6,9 @@ package storage_test
 import (
     "context"
     "database/sql"
+    "encoding/json"
     "fmt"
+    "net/http"
     "os/exec"
     "testing"
     "time"
@@ -33,7 +35,7 @@ func withTestPostgres(t *testing.T) (*sql.DB, func()) {
         postgres.WithUsername("metrichub"),
         postgres.WithPassword("password"),
         // Migration script path relative to module root (go test runs from module root)
-        postgres.WithInitScripts("migrations/0001_init_schema.up.sql"),
+        postgres.WithInitScripts("migrations/0001_init_schema.up.sql", "migrations/0002_ingestion_idempotency.up.sql", "migrations/0003_commits.up.sql", "migrations/0004_webhook_mappings.up.sql", "migrations/0005_webhook_inbox.up.sql", "migrations/0006_webhook_secrets.up.sql", "migrations/0007_plugin_state.up.sql", "migrations/0008_plugin_instances.up.sql", "migrations/0009_wasm_transforms.up.sql", "migrations/0010_ticket_links.up.sql"),
         tc.WithImage("postgres:15-alpine"),
     )
     require.NoError(t, err)
@@ -98,6 +100,124 @@ func TestPostgresDeploymentRepository_CreateAndListRange(t *testing.T) {
     require.Equal(t, "dep-1", list[0].ID)
 }
 
+func TestPostgresDeploymentRepository_UpsertAndConflict(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresDeploymentRepo(db)
+    ctx := context.Background()
+
+    now := time.Now().Add(-time.Hour)
+    dep := &metrics.Deployment{
+        ID:          "dep-up-1",
+        Service:     "api",
+        Environment: "prod",
+        Status:      metrics.DeploymentStatusRunning,
+        StartTime:   now,
+        CommitSHA:   "abc123",
+        CommitTime:  now,
+        Repository:  "org/api",
+        Tags:        map[string]string{"image": "api:1.2"},
+        CreatedAt:   time.Now(),
+        UpdatedAt:   time.Now(),
+    }
+    created, err := repo.Upsert(ctx, dep)
+    require.NoError(t, err)
+    require.True(t, created)
+
+    // Retry with a fresh ID updates the existing row instead of duplicating it.
+    retry := *dep
+    retry.ID = "dep-up-2"
+    retry.Status = metrics.DeploymentStatusSuccess
+    retry.EndTime = ptrTime(now.Add(5 * time.Minute))
+    retry.Tags = map[string]string{"trigger": "ci"}
+    created, err = repo.Upsert(ctx, &retry)
+    require.NoError(t, err)
+    require.False(t, created)
+    require.Equal(t, "dep-up-1", retry.ID)
+
+    list, err := repo.ListRange(ctx, now.Add(-time.Minute), time.Now())
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+    require.Equal(t, metrics.DeploymentStatusSuccess, list[0].Status)
+    // Tags are stored and merged
+    require.Equal(t, map[string]string{"image": "api:1.2", "trigger": "ci"}, list[0].Tags)
+
+    // An update with unknown (zero) times keeps the stored ones.
+    statusOnly := *dep
+    statusOnly.ID = "dep-up-3"
+    statusOnly.StartTime, statusOnly.CommitTime = time.Time{}, time.Time{}
+    created, err = repo.Upsert(ctx, &statusOnly)
+    require.NoError(t, err)
+    require.False(t, created)
+    require.WithinDuration(t, now, statusOnly.StartTime, time.Millisecond)
+    require.WithinDuration(t, now, statusOnly.CommitTime, time.Millisecond)
+
+    // A new deployment with unknown times starts at its end.
+    ended := now.Add(10 * time.Minute)
+    fresh := &metrics.Deployment{ID: "dep-up-4", Service: "api", Environment: "prod", Status: metrics.DeploymentStatusSuccess,
+        EndTime: &ended, CommitSHA: "def456", Repository: "org/api", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+    created, err = repo.Upsert(ctx, fresh)
+    require.NoError(t, err)
+    require.True(t, created)
+    require.WithinDuration(t, ended, fresh.StartTime, time.Millisecond)
+    require.WithinDuration(t, ended, fresh.CommitTime, time.Millisecond)
+
+    // Without a repository a later outcome updates the row with the same ID.
+    byID := &metrics.Deployment{ID: "flux-dep-1", Service: "web", Environment: "prod", Status: metrics.DeploymentStatusFailed,
+        StartTime: now, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+    created, err = repo.Upsert(ctx, byID)
+    require.NoError(t, err)
+    require.True(t, created)
+    later := *byID
+    later.Status = metrics.DeploymentStatusSuccess
+    created, err = repo.Upsert(ctx, &later)
+    require.NoError(t, err)
+    require.False(t, created)
+    require.Equal(t, metrics.DeploymentStatusSuccess, later.Status)
+
+    // Inserting the same primary key maps to ErrConflict.
+    err = repo.Create(ctx, dep)
+    require.ErrorIs(t, err, storage.ErrConflict)
+}
+
+func TestPostgresDeploymentRepository_CreateBatch(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresDeploymentRepo(db)
+
+    now := time.Now().Add(-time.Hour)
+    mk := func(id string) metrics.Deployment {
+        return metrics.Deployment{ID: id, Service: "api", Environment: "prod", Status: metrics.DeploymentStatusSuccess, StartTime: now, CommitTime: now, CreatedAt: now, UpdatedAt: now}
+    }
+    require.NoError(t, repo.Create(context.Background(), &metrics.Deployment{ID: "b-0", Service: "api", Environment: "prod", Status: metrics.DeploymentStatusSuccess, StartTime: now, CommitTime: now, CreatedAt: now, UpdatedAt: now}))
+
+    tagged := mk("b-2")
+    tagged.Tags = map[string]string{"image": "api:1.3"}
+    errs := repo.CreateBatch(context.Background(), []metrics.Deployment{mk("b-1"), mk("b-0"), tagged, mk("b-1")})
+    require.Len(t, errs, 4)
+    require.NoError(t, errs[0])
+    require.ErrorIs(t, errs[1], storage.ErrConflict) // existing row
+    require.NoError(t, errs[2])
+    require.ErrorIs(t, errs[3], storage.ErrConflict) // duplicate within batch
+    list, err := repo.ListRange(context.Background(), now.Add(-time.Minute), time.Now())
+    require.NoError(t, err)
+    for _, d := range list {
+        if d.ID == "b-2" {
+            require.Equal(t, tagged.Tags, d.Tags)
+        } else {
+            require.Nil(t, d.Tags)
+        }
+    }
+
+    // Postgres rejects NUL bytes in text, failing the statement; only that row fails.
+    errs = repo.CreateBatch(context.Background(), []metrics.Deployment{mk("b-3"), mk("b-\x00"), mk("b-4")})
+    require.Len(t, errs, 3)
+    require.NoError(t, errs[0])
+    require.Error(t, errs[1])
+    require.NotErrorIs(t, errs[1], storage.ErrConflict)
+    require.NoError(t, errs[2])
+}
+
 func TestPostgresIncidentRepository_CreateResolveListRange(t *testing.T) {
     db, cleanup := withTestPostgres(t)
     defer cleanup()
@@ -131,6 +251,8 @@ func TestPostgresIncidentRepository_CreateResolveListRange(t *testing.T) {
 
     // Resolve first
     require.NoError(t, repo.Resolve(context.Background(), "inc-1", time.Now()))
+    require.ErrorIs(t, repo.Resolve(context.Background(), "inc-1", time.Now()), storage.ErrConflict)
+    require.ErrorIs(t, repo.Resolve(context.Background(), "missing", time.Now()), storage.ErrNotFound)
 
     list, err := repo.ListRange(context.Background(), start.Add(-1*time.Hour), time.Now())
     require.NoError(t, err)
@@ -139,4 +261,321 @@ func TestPostgresIncidentRepository_CreateResolveListRange(t *testing.T) {
     require.True(t, list[0].IsResolved())
 }
 
+func TestPostgresIncidentRepository_Upsert(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresIncidentRepo(db)
+    ctx := context.Background()
+
+    start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+    inc := &metrics.Incident{ID: "pd-1", Title: "Checkout down", Service: "checkout", Environment: "prod",
+        Severity: metrics.SeverityMedium, StartTime: start, Tags: map[string]string{"urgency": "low"}, CreatedAt: start, UpdatedAt: start}
+    created, err := repo.Upsert(ctx, inc)
+    require.NoError(t, err)
+    require.True(t, created)
+
+    // Resolution merges into the same row
+    resolved := start.Add(30 * time.Minute)
+    update := *inc
+    update.ResolvedTime, update.UpdatedAt = &resolved, resolved
+    created, err = repo.Upsert(ctx, &update)
+    require.NoError(t, err)
+    require.False(t, created)
+
+    // A later priority change neither reopens it nor loses the title
+    bump := metrics.Incident{ID: "pd-1", Service: "checkout", Environment: "prod", Severity: metrics.SeverityCritical,
+        StartTime: start, Tags: map[string]string{"urgency": "high"}, UpdatedAt: time.Now()}
+    _, err = repo.Upsert(ctx, &bump)
+    require.NoError(t, err)
+    require.Equal(t, "Checkout down", bump.Title)
+    require.Equal(t, map[string]string{"urgency": "high"}, bump.Tags)
+    require.Equal(t, metrics.SeverityCritical, bump.Severity)
+    require.NotNil(t, bump.ResolvedTime)
+    require.True(t, bump.ResolvedTime.Equal(resolved))
+}
+
+func TestPostgresWebhookMappingRepository(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresWebhookMappingRepo(db)
+    ctx := context.Background()
+
+    m := &storage.WebhookMapping{Source: "acme", Config: []byte(`{"rules": []}`)}
+    created, err := repo.Put(ctx, m)
+    require.NoError(t, err)
+    require.True(t, created)
+    created, err = repo.Put(ctx, &storage.WebhookMapping{Source: "acme", Config: []byte(`{"description": "v2", "rules": []}`)})
+    require.NoError(t, err)
+    require.False(t, created)
+
+    got, err := repo.Get(ctx, "acme")
+    require.NoError(t, err)
+    require.JSONEq(t, `{"description": "v2", "rules": []}`, string(got.Config))
+    list, err := repo.List(ctx)
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+
+    require.NoError(t, repo.Delete(ctx, "acme"))
+    require.ErrorIs(t, repo.Delete(ctx, "acme"), storage.ErrNotFound)
+    _, err = repo.Get(ctx, "acme")
+    require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgresWASMTransformRepository(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresWASMTransformRepo(db)
+    ctx := context.Background()
+
+    tr := &storage.WASMTransform{Name: "ci", Module: []byte("\x00asm v1"), SHA256: "abc", Config: []byte(`{}`)}
+    created, err := repo.Put(ctx, tr)
+    require.NoError(t, err)
+    require.True(t, created)
+    created, err = repo.Put(ctx, &storage.WASMTransform{Name: "ci", Module: []byte("\x00asm v2!"), SHA256: "def", Config: []byte(`{"description": "v2"}`)})
+    require.NoError(t, err)
+    require.False(t, created)
+
+    got, err := repo.Get(ctx, "ci")
+    require.NoError(t, err)
+    require.Equal(t, []byte("\x00asm v2!"), got.Module)
+    require.Equal(t, "def", got.SHA256)
+    require.JSONEq(t, `{"description": "v2"}`, string(got.Config))
+    list, err := repo.List(ctx)
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+    require.Nil(t, list[0].Module)
+    require.Equal(t, 8, list[0].Size)
+
+    require.NoError(t, repo.Delete(ctx, "ci"))
+    require.ErrorIs(t, repo.Delete(ctx, "ci"), storage.ErrNotFound)
+    _, err = repo.Get(ctx, "ci")
+    require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgresWebhookInbox(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    inbox := storage.NewPostgresWebhookInbox(db)
+    ctx := context.Background()
+
+    item := &storage.InboxItem{Source: "github", DeliveryKey: "x-github-delivery:1", Headers: http.Header{"X-Github-Event": {"push"}}, Body: []byte(`{"ref":"main"}`)}
+    dup, err := inbox.Enqueue(ctx, item)
+    require.NoError(t, err)
+    require.False(t, dup)
+    require.Equal(t, storage.InboxPending, item.Status)
+    again := &storage.InboxItem{Source: "github", DeliveryKey: "x-github-delivery:1", Body: []byte(`{}`)}
+    dup, err = inbox.Enqueue(ctx, again)
+    require.NoError(t, err)
+    require.True(t, dup)
+    require.Equal(t, item.ID, again.ID)
+
+    // A claimed delivery is leased: nobody else sees it until it expires
+    claimed, err := inbox.Claim(ctx, 10, time.Minute)
+    require.NoError(t, err)
+    require.Len(t, claimed, 1)
+    require.Equal(t, 1, claimed[0].Attempts)
+    require.Equal(t, `{"ref":"main"}`, string(claimed[0].Body))
+    require.Equal(t, "push", claimed[0].Headers.Get("X-GitHub-Event"))
+    claimed, err = inbox.Claim(ctx, 10, time.Minute)
+    require.NoError(t, err)
+    require.Empty(t, claimed)
+
+    // Retries become due at retryAt; a nil retryAt dead-letters
+    require.NoError(t, inbox.Fail(ctx, item.ID, "db down", ptrTime(time.Now().Add(-time.Second))))
+    claimed, err = inbox.Claim(ctx, 10, time.Minute)
+    require.NoError(t, err)
+    require.Len(t, claimed, 1)
+    require.Equal(t, 2, claimed[0].Attempts)
+    require.NoError(t, inbox.Fail(ctx, item.ID, "still down", nil))
+    dead, err := inbox.List(ctx, storage.InboxDead, 10)
+    require.NoError(t, err)
+    require.Len(t, dead, 1)
+    require.Equal(t, "still down", dead[0].LastError)
+
+    require.NoError(t, inbox.Replay(ctx, item.ID))
+    require.ErrorIs(t, inbox.Replay(ctx, item.ID), storage.ErrConflict)
+    require.ErrorIs(t, inbox.Replay(ctx, 999), storage.ErrNotFound)
+    claimed, err = inbox.Claim(ctx, 10, time.Minute)
+    require.NoError(t, err)
+    require.Len(t, claimed, 1)
+    require.Equal(t, 1, claimed[0].Attempts)
+    require.NoError(t, inbox.Complete(ctx, item.ID, storage.InboxDone, []byte(`{"commits":1}`)))
+
+    got, err := inbox.Get(ctx, item.ID)
+    require.NoError(t, err)
+    require.Equal(t, storage.InboxDone, got.Status)
+    require.JSONEq(t, `{"commits":1}`, string(got.Result))
+    require.NotNil(t, got.ProcessedAt)
+
+    n, err := inbox.Purge(ctx, time.Now().Add(time.Minute))
+    require.NoError(t, err)
+    require.EqualValues(t, 1, n)
+    _, err = inbox.Get(ctx, item.ID)
+    require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgresWebhookSecretRepository(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresWebhookSecretRepo(db)
+    ctx := context.Background()
+
+    first, err := repo.Rotate(ctx, "github", "first-secret", time.Hour)
+    require.NoError(t, err)
+    second, err := repo.Rotate(ctx, "github", "second-secret", time.Hour)
+    require.NoError(t, err)
+    _, err = repo.Rotate(ctx, "gitlab", "other-plugin", time.Hour)
+    require.NoError(t, err)
+
+    // The previous secret stays active during its grace period
+    active, err := repo.Active(ctx, "github")
+    require.NoError(t, err)
+    require.Len(t, active, 2)
+    require.Equal(t, second.ID, active[0].ID)
+    require.Equal(t, first.ID, active[1].ID)
+    require.NotNil(t, active[1].ExpiresAt)
+    require.Nil(t, active[0].ExpiresAt)
+
+    // A third rotation expires the first at once: never more than two active
+    third, err := repo.Rotate(ctx, "github", "third-secret", time.Hour)
+    require.NoError(t, err)
+    active, err = repo.Active(ctx, "github")
+    require.NoError(t, err)
+    require.Len(t, active, 2)
+    require.Equal(t, []int64{third.ID, second.ID}, []int64{active[0].ID, active[1].ID})
+
+    require.NoError(t, repo.Revoke(ctx, "github", third.ID))
+    require.ErrorIs(t, repo.Revoke(ctx, "gitlab", third.ID), storage.ErrNotFound)
+    active, err = repo.Active(ctx, "github")
+    require.NoError(t, err)
+    require.Len(t, active, 1)
+    all, err := repo.List(ctx, "github")
+    require.NoError(t, err)
+    require.Len(t, all, 3)
+}
+
+func TestPostgresPluginState(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresPluginStateRepo(db)
+    ctx := context.Background()
+
+    cursor, err := repo.Cursor(ctx, "github")
+    require.NoError(t, err)
+    require.Equal(t, "", cursor)
+    require.NoError(t, repo.SaveCursor(ctx, "github", "page-1"))
+    require.NoError(t, repo.SaveCursor(ctx, "github", "page-2"))
+    cursor, err = repo.Cursor(ctx, "github")
+    require.NoError(t, err)
+    require.Equal(t, "page-2", cursor)
+
+    start := time.Now().UTC().Truncate(time.Millisecond)
+    for i := 0; i < 105; i++ {
+        run := storage.PluginRun{Plugin: "github", StartedAt: start.Add(time.Duration(i) * time.Second), Duration: 1500 * time.Millisecond, Items: i}
+        if i == 104 {
+            run.Error = "rate limited"
+        }
+        require.NoError(t, repo.RecordRun(ctx, run))
+    }
+    require.NoError(t, repo.RecordRun(ctx, storage.PluginRun{Plugin: "jira", StartedAt: start}))
+
+    // History is bounded per plugin and listed newest first
+    runs, err := repo.Runs(ctx, "github", 1000)
+    require.NoError(t, err)
+    require.Len(t, runs, 100)
+    require.Equal(t, "rate limited", runs[0].Error)
+    require.Equal(t, 104, runs[0].Items)
+    require.Equal(t, 5, runs[99].Items)
+    require.Equal(t, 1500*time.Millisecond, runs[0].Duration)
+    runs, err = repo.Runs(ctx, "jira", 10)
+    require.NoError(t, err)
+    require.Len(t, runs, 1)
+
+    // Deleting a plugin's state leaves other plugins' alone
+    require.NoError(t, repo.Delete(ctx, "github"))
+    cursor, err = repo.Cursor(ctx, "github")
+    require.NoError(t, err)
+    require.Equal(t, "", cursor)
+    runs, err = repo.Runs(ctx, "github", 10)
+    require.NoError(t, err)
+    require.Empty(t, runs)
+    runs, err = repo.Runs(ctx, "jira", 10)
+    require.NoError(t, err)
+    require.Len(t, runs, 1)
+}
+
+func TestPostgresPluginInstanceRepository(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresPluginInstanceRepo(db)
+    ctx := context.Background()
+
+    inst := &storage.PluginInstance{Name: "gh-acme", Type: "github", Config: json.RawMessage(`{"owner": "acme"}`), SecretRef: "env:GITHUB_TOKEN", Enabled: true}
+    require.NoError(t, repo.Create(ctx, inst))
+    require.False(t, inst.CreatedAt.IsZero())
+    require.ErrorIs(t, repo.Create(ctx, &storage.PluginInstance{Name: "gh-acme", Type: "github"}), storage.ErrConflict)
+
+    at := time.Now().UTC().Truncate(time.Millisecond)
+    require.NoError(t, repo.RecordSync(ctx, "gh-acme", at, ""))
+    require.NoError(t, repo.RecordSync(ctx, "gh-acme", at.Add(time.Minute), "rate limited"))
+    require.NoError(t, repo.RecordSync(ctx, "gh-acme", at.Add(2*time.Minute), "rate limited"))
+    require.ErrorIs(t, repo.RecordSync(ctx, "missing", at, ""), storage.ErrNotFound)
+
+    // Updates replace the configuration and keep the sync status
+    inst.Config, inst.Enabled, inst.IntervalSeconds = json.RawMessage(`{"owner": "acme", "repos": ["api"]}`), false, 300
+    require.NoError(t, repo.Update(ctx, inst))
+    got, err := repo.Get(ctx, "gh-acme")
+    require.NoError(t, err)
+    require.JSONEq(t, `{"owner": "acme", "repos": ["api"]}`, string(got.Config))
+    require.False(t, got.Enabled)
+    require.Equal(t, 300, got.IntervalSeconds)
+    require.Equal(t, "env:GITHUB_TOKEN", got.SecretRef)
+    require.True(t, got.LastSyncAt.Equal(at))
+    require.Equal(t, "rate limited", got.LastError)
+    require.EqualValues(t, 1, got.SuccessCount)
+    require.EqualValues(t, 2, got.FailureCount)
+    require.Equal(t, 2, got.ConsecutiveFailures)
+    require.ErrorIs(t, repo.Update(ctx, &storage.PluginInstance{Name: "missing"}), storage.ErrNotFound)
+
+    list, err := repo.List(ctx)
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+    require.NoError(t, repo.Delete(ctx, "gh-acme"))
+    require.ErrorIs(t, repo.Delete(ctx, "gh-acme"), storage.ErrNotFound)
+    _, err = repo.Get(ctx, "gh-acme")
+    require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
 func ptrTime(t time.Time) *time.Time { return &t }
+
+func TestPostgresTicketLinkRepository(t *testing.T) {
+    db, cleanup := withTestPostgres(t)
+    defer cleanup()
+    repo := storage.NewPostgresTicketLinkRepo(db)
+    ctx := context.Background()
+
+    require.Error(t, repo.Save(ctx, []metrics.TicketLink{{Ticket: "SHOP-1"}}))
+    require.Error(t, repo.Save(ctx, []metrics.TicketLink{{Ticket: "SHOP-1", DeploymentID: "d1", IncidentID: "i1"}}))
+    links := []metrics.TicketLink{
+        {Ticket: "SHOP-1", DeploymentID: "d2"},
+        {Ticket: "SHOP-1", DeploymentID: "d1"},
+        {Ticket: "SHOP-2", DeploymentID: "d1"},
+        {Ticket: "SHOP-3", DeploymentID: "d3"},
+        {Ticket: "SHOP-1", IncidentID: "jira-OPS-7"},
+        {Ticket: "SHOP-2", IncidentID: "jira-OPS-7"},
+    }
+    require.NoError(t, repo.Save(ctx, links))
+    // Saving again is a no-op
+    require.NoError(t, repo.Save(ctx, links[:2]))
+
+    got, err := repo.IncidentDeployments(ctx, "jira-OPS-7")
+    require.NoError(t, err)
+    require.Equal(t, []metrics.TicketLink{
+        {Ticket: "SHOP-1", DeploymentID: "d1", IncidentID: "jira-OPS-7"},
+        {Ticket: "SHOP-1", DeploymentID: "d2", IncidentID: "jira-OPS-7"},
+        {Ticket: "SHOP-2", DeploymentID: "d1", IncidentID: "jira-OPS-7"},
+    }, got)
+    got, err = repo.IncidentDeployments(ctx, "unknown")
+    require.NoError(t, err)
+    require.Empty(t, got)
+}
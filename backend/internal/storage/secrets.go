@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WebhookSecret is a signing secret for one webhook plugin. The secret is
+// kept in clear text because verifying HMAC signatures needs it.
+type WebhookSecret struct {
+	ID        int64      `json:"id"`
+	Plugin    string     `json:"plugin"`
+	Secret    string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ActiveAt reports whether the secret verifies deliveries at t.
+func (s WebhookSecret) ActiveAt(t time.Time) bool {
+	return s.ExpiresAt == nil || s.ExpiresAt.After(t)
+}
+
+// WebhookSecretRepository stores managed webhook secrets per plugin.
+type WebhookSecretRepository interface {
+	// Active returns the plugin's unexpired secrets, newest first.
+	Active(ctx context.Context, plugin string) ([]WebhookSecret, error)
+	// List returns all of the plugin's secrets, newest first.
+	List(ctx context.Context, plugin string) ([]WebhookSecret, error)
+	// Rotate adds secret as the plugin's newest. The previous newest stays
+	// active for grace (or until its own expiry, if sooner) and older ones
+	// expire now, so at most two secrets are ever active.
+	Rotate(ctx context.Context, plugin, secret string, grace time.Duration) (*WebhookSecret, error)
+	// Revoke expires the secret now; ErrNotFound when the plugin has no
+	// such secret.
+	Revoke(ctx context.Context, plugin string, id int64) error
+}
+
+// PostgresWebhookSecretRepo implements WebhookSecretRepository.
+type PostgresWebhookSecretRepo struct{ db *sql.DB }
+
+func NewPostgresWebhookSecretRepo(db *sql.DB) *PostgresWebhookSecretRepo {
+	return &PostgresWebhookSecretRepo{db: db}
+}
+
+func (r *PostgresWebhookSecretRepo) query(ctx context.Context, q string, args ...interface{}) ([]WebhookSecret, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WebhookSecret
+	for rows.Next() {
+		var s WebhookSecret
+		var expires sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Plugin, &s.Secret, &s.CreatedAt, &expires); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			s.ExpiresAt = &expires.Time
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresWebhookSecretRepo) Active(ctx context.Context, plugin string) ([]WebhookSecret, error) {
+	return r.query(ctx, `SELECT id, plugin, secret, created_at, expires_at FROM webhook_secrets
+WHERE plugin=$1 AND (expires_at IS NULL OR expires_at > NOW()) ORDER BY created_at DESC, id DESC`, plugin)
+}
+
+func (r *PostgresWebhookSecretRepo) List(ctx context.Context, plugin string) ([]WebhookSecret, error) {
+	return r.query(ctx, `SELECT id, plugin, secret, created_at, expires_at FROM webhook_secrets
+WHERE plugin=$1 ORDER BY created_at DESC, id DESC`, plugin)
+}
+
+func (r *PostgresWebhookSecretRepo) Rotate(ctx context.Context, plugin, secret string, grace time.Duration) (*WebhookSecret, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	// Serialize rotations of one plugin so two cannot both keep a predecessor
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('webhook_secrets:' || $1))`, plugin); err != nil {
+		return nil, err
+	}
+	const expire = `WITH active AS (
+  SELECT id, ROW_NUMBER() OVER (ORDER BY created_at DESC, id DESC) AS n FROM webhook_secrets
+  WHERE plugin=$1 AND (expires_at IS NULL OR expires_at > NOW())
+)
+UPDATE webhook_secrets s SET expires_at = CASE WHEN a.n = 1
+  THEN LEAST(COALESCE(s.expires_at, 'infinity'), NOW() + make_interval(secs => $2))
+  ELSE NOW() END
+FROM active a WHERE s.id = a.id`
+	if _, err := tx.ExecContext(ctx, expire, plugin, grace.Seconds()); err != nil {
+		return nil, err
+	}
+	s := WebhookSecret{Plugin: plugin, Secret: secret}
+	if err := tx.QueryRowContext(ctx, `INSERT INTO webhook_secrets (plugin, secret) VALUES ($1, $2) RETURNING id, created_at`,
+		plugin, secret).Scan(&s.ID, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &s, tx.Commit()
+}
+
+func (r *PostgresWebhookSecretRepo) Revoke(ctx context.Context, plugin string, id int64) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE webhook_secrets SET expires_at = LEAST(COALESCE(expires_at, 'infinity'), NOW())
+WHERE plugin=$1 AND id=$2`, plugin, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
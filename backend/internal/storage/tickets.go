@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// TicketLinkRepository records the issue tracker tickets deployments shipped
+// and incidents refer to.
+type TicketLinkRepository interface {
+	// Save records links; links already recorded are ignored.
+	Save(ctx context.Context, links []metrics.TicketLink) error
+	// IncidentDeployments returns a link for each deployment sharing a
+	// ticket with the incident, ordered by ticket and deployment.
+	IncidentDeployments(ctx context.Context, incidentID string) ([]metrics.TicketLink, error)
+}
+
+// checkLink rejects links without a ticket or with other than one target.
+func checkLink(l metrics.TicketLink) error {
+	if l.Ticket == "" || (l.DeploymentID == "") == (l.IncidentID == "") {
+		return fmt.Errorf("ticket link %+v: needs a ticket and either a deployment or an incident", l)
+	}
+	return nil
+}
+
+// PostgresTicketLinkRepo implements TicketLinkRepository.
+type PostgresTicketLinkRepo struct{ db *sql.DB }
+
+func NewPostgresTicketLinkRepo(db *sql.DB) *PostgresTicketLinkRepo {
+	return &PostgresTicketLinkRepo{db: db}
+}
+
+func (r *PostgresTicketLinkRepo) Save(ctx context.Context, links []metrics.TicketLink) error {
+	const q = `INSERT INTO ticket_links (ticket, deployment_id, incident_id) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`
+	for _, l := range links {
+		if err := checkLink(l); err != nil {
+			return err
+		}
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, l := range links {
+		if _, err := stmt.ExecContext(ctx, l.Ticket, l.DeploymentID, l.IncidentID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresTicketLinkRepo) IncidentDeployments(ctx context.Context, incidentID string) ([]metrics.TicketLink, error) {
+	const q = `SELECT DISTINCT d.ticket, d.deployment_id FROM ticket_links i
+JOIN ticket_links d ON d.ticket = i.ticket AND d.deployment_id <> ''
+WHERE i.incident_id = $1
+ORDER BY d.ticket, d.deployment_id`
+	rows, err := r.db.QueryContext(ctx, q, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	links := []metrics.TicketLink{}
+	for rows.Next() {
+		l := metrics.TicketLink{IncidentID: incidentID}
+		if err := rows.Scan(&l.Ticket, &l.DeploymentID); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
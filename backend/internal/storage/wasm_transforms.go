@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// WASMTransform is a stored WebAssembly webhook transform. Module and Config
+// are opaque here; the webhooks package compiles and validates them.
+type WASMTransform struct {
+	Name   string
+	Module []byte
+	SHA256 string
+	// Size is the module size in bytes, set when reading.
+	Size      int
+	Config    json.RawMessage
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WASMTransformRepository stores WebAssembly transforms keyed by name.
+type WASMTransformRepository interface {
+	// List returns the transforms without their modules.
+	List(ctx context.Context) ([]WASMTransform, error)
+	// Get returns the transform with its module or ErrNotFound.
+	Get(ctx context.Context, name string) (*WASMTransform, error)
+	// Put creates or replaces the transform, filling its timestamps, and
+	// reports whether it was created.
+	Put(ctx context.Context, t *WASMTransform) (bool, error)
+	// Delete removes the transform or returns ErrNotFound.
+	Delete(ctx context.Context, name string) error
+}
+
+// PostgresWASMTransformRepo implements WASMTransformRepository.
+type PostgresWASMTransformRepo struct{ db *sql.DB }
+
+func NewPostgresWASMTransformRepo(db *sql.DB) *PostgresWASMTransformRepo {
+	return &PostgresWASMTransformRepo{db: db}
+}
+
+func (r *PostgresWASMTransformRepo) List(ctx context.Context) ([]WASMTransform, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name, sha256, octet_length(module), config, created_at, updated_at FROM wasm_transforms ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WASMTransform
+	for rows.Next() {
+		var t WASMTransform
+		if err := rows.Scan(&t.Name, &t.SHA256, &t.Size, &t.Config, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresWASMTransformRepo) Get(ctx context.Context, name string) (*WASMTransform, error) {
+	var t WASMTransform
+	err := r.db.QueryRowContext(ctx, `SELECT name, module, sha256, config, created_at, updated_at FROM wasm_transforms WHERE name=$1`, name).
+		Scan(&t.Name, &t.Module, &t.SHA256, &t.Config, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Size = len(t.Module)
+	return &t, nil
+}
+
+func (r *PostgresWASMTransformRepo) Put(ctx context.Context, t *WASMTransform) (bool, error) {
+	const q = `INSERT INTO wasm_transforms (name, module, sha256, config) VALUES ($1, $2, $3, $4)
+ON CONFLICT (name) DO UPDATE SET module=EXCLUDED.module, sha256=EXCLUDED.sha256, config=EXCLUDED.config, updated_at=NOW()
+RETURNING created_at, updated_at, (xmax = 0)`
+	var created bool
+	if err := r.db.QueryRowContext(ctx, q, t.Name, t.Module, t.SHA256, []byte(t.Config)).Scan(&t.CreatedAt, &t.UpdatedAt, &created); err != nil {
+		return false, err
+	}
+	t.Size = len(t.Module)
+	return created, nil
+}
+
+func (r *PostgresWASMTransformRepo) Delete(ctx context.Context, name string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM wasm_transforms WHERE name=$1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
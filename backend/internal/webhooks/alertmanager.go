@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// AlertmanagerConfig configures the Alertmanager adapter.
+type AlertmanagerConfig struct {
+	// Token is a shared secret sent as a bearer token (http_config.authorization
+	// in the receiver). When empty, deliveries are accepted unverified
+	// (development only).
+	Token string
+	// Rule selects the alerts that count as incidents, by alertname and by
+	// the value of SeverityLabel.
+	Rule IncidentRule
+	// SeverityLabel names the label holding the alert severity. Defaults to
+	// "severity".
+	SeverityLabel string
+	// DefaultEnvironment is used when alerts carry no environment or env
+	// label. Defaults to "production".
+	DefaultEnvironment string
+}
+
+// Alertmanager handles Prometheus Alertmanager webhook notifications. Each
+// alert group (groupKey) is one incident: it opens when a matching alert
+// fires and resolves when the whole group is resolved.
+type Alertmanager struct {
+	secretVerifier
+	rule          IncidentRule
+	severityLabel string
+	environment   string
+}
+
+// NewAlertmanager builds the adapter.
+func NewAlertmanager(cfg AlertmanagerConfig) *Alertmanager {
+	a := &Alertmanager{secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: SharedToken{Header: "X-Alertmanager-Token", Bearer: true}}, rule: cfg.Rule, severityLabel: cfg.SeverityLabel, environment: cfg.DefaultEnvironment}
+	if a.severityLabel == "" {
+		a.severityLabel = "severity"
+	}
+	if a.environment == "" {
+		a.environment = "production"
+	}
+	return a
+}
+
+func (a *Alertmanager) Name() string { return "alertmanager" }
+
+func (a *Alertmanager) Description() string {
+	return "Prometheus Alertmanager alert groups as incidents"
+}
+
+type amAlert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	Fingerprint string            `json:"fingerprint"`
+}
+
+type amNotification struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []amAlert         `json:"alerts"`
+}
+
+// severityRanks orders common severity label values onto IncidentSeverity.
+var severityRanks = map[string]metrics.IncidentSeverity{
+	"critical": metrics.SeverityCritical,
+	"page":     metrics.SeverityCritical,
+	"p1":       metrics.SeverityCritical,
+	"high":     metrics.SeverityHigh,
+	"error":    metrics.SeverityHigh,
+	"major":    metrics.SeverityHigh,
+	"p2":       metrics.SeverityHigh,
+	"warning":  metrics.SeverityMedium,
+	"medium":   metrics.SeverityMedium,
+	"p3":       metrics.SeverityMedium,
+}
+
+// severityFromLabel maps a severity label value, defaulting to low.
+func severityFromLabel(v string) metrics.IncidentSeverity {
+	if sev, ok := severityRanks[strings.ToLower(v)]; ok {
+		return sev
+	}
+	return metrics.SeverityLow
+}
+
+func severityIndex(s metrics.IncidentSeverity) int {
+	for i, known := range metrics.IncidentSeverities {
+		if s == known {
+			return i
+		}
+	}
+	return -1
+}
+
+// Parse turns a group notification into one incident per firing episode of
+// the group, keyed by groupKey and the earliest start among the matching
+// alerts, so a group that fires again after resolving opens a new incident.
+// The incident takes the highest severity among the matching alerts, and is
+// resolved at the latest end once the group is.
+func (a *Alertmanager) Parse(_ http.Header, body []byte) (*Event, error) {
+	var n amNotification
+	if err := decode(body, &n); err != nil {
+		return nil, err
+	}
+	if n.GroupKey == "" {
+		return nil, fmt.Errorf("%w: missing groupKey", ErrMalformedPayload)
+	}
+
+	var matched []amAlert
+	for _, al := range n.Alerts {
+		if a.rule.Matches(al.Labels["alertname"], al.Labels[a.severityLabel]) {
+			matched = append(matched, al)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: no alert in group matches the incident rule", ErrUnsupportedEvent)
+	}
+
+	first := matched[0]
+	start := first.StartsAt
+	for _, al := range matched {
+		if al.StartsAt.Before(start) {
+			start = al.StartsAt
+		}
+	}
+	// Alertmanager gives an alert firing again a new startsAt
+	sum := sha256.Sum256([]byte(n.GroupKey + "@" + start.UTC().Format(time.RFC3339Nano)))
+	ev := &Event{Source: a.Name(), Type: "alert_group." + n.Status, DeliveryID: hex.EncodeToString(sum[:8]) + "/" + n.Status}
+	inc := metrics.Incident{
+		ID:          "am-" + hex.EncodeToString(sum[:12]),
+		Title:       firstNonEmpty(n.CommonAnnotations["summary"], first.Annotations["summary"], n.GroupLabels["alertname"], first.Labels["alertname"], "Alertmanager alert group"),
+		Description: firstNonEmpty(n.CommonAnnotations["description"], first.Annotations["description"]),
+		Service:     firstNonEmpty(labelOf(n, first, "service"), labelOf(n, first, "job"), labelOf(n, first, "alertname")),
+		Environment: firstNonEmpty(labelOf(n, first, "environment"), labelOf(n, first, "env"), a.environment),
+		Severity:    metrics.SeverityLow,
+		StartTime:   start,
+	}
+	var lastEnd time.Time
+	for _, al := range matched {
+		if sev := severityFromLabel(al.Labels[a.severityLabel]); severityIndex(sev) > severityIndex(inc.Severity) {
+			inc.Severity = sev
+		}
+		if al.EndsAt.After(lastEnd) {
+			lastEnd = al.EndsAt
+		}
+	}
+	if n.Status == "resolved" {
+		if lastEnd.IsZero() {
+			lastEnd = time.Now().UTC()
+		}
+		inc.ResolvedTime = &lastEnd
+	}
+	ev.Incidents = append(ev.Incidents, inc)
+	return ev, nil
+}
+
+// labelOf prefers the group's common label over the first alert's.
+func labelOf(n amNotification, first amAlert, name string) string {
+	return firstNonEmpty(n.CommonLabels[name], first.Labels[name])
+}
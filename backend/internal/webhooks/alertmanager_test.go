@@ -0,0 +1,134 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+func amPayload(status, secondStatus, secondSeverity string) string {
+	return `{
+		"version": "4", "groupKey": "{}:{alertname=\"HighErrorRate\"}", "status": "` + status + `", "receiver": "metrichub",
+		"groupLabels": {"alertname": "HighErrorRate"},
+		"commonLabels": {"alertname": "HighErrorRate", "service": "checkout", "env": "prod"},
+		"commonAnnotations": {"summary": "Checkout error rate above 5%"},
+		"alerts": [
+			{"status": "` + status + `", "labels": {"alertname": "HighErrorRate", "severity": "warning", "instance": "a"},
+				"startsAt": "2024-05-01T10:00:00Z", "endsAt": "2024-05-01T10:20:00Z", "fingerprint": "a1"},
+			{"status": "` + secondStatus + `", "labels": {"alertname": "HighErrorRate", "severity": "` + secondSeverity + `", "instance": "b"},
+				"startsAt": "2024-05-01T10:05:00Z", "endsAt": "2024-05-01T10:30:00Z", "fingerprint": "b2"}
+		]
+	}`
+}
+
+func TestAlertmanagerGroupIsOneIncident(t *testing.T) {
+	a := NewAlertmanager(AlertmanagerConfig{})
+	proc := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	ctx := context.Background()
+	for _, body := range []string{
+		amPayload("firing", "firing", "critical"),
+		amPayload("firing", "resolved", "critical"),
+		amPayload("resolved", "resolved", "critical"),
+	} {
+		ev, err := a.Parse(nil, []byte(body))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if _, err := proc.Process(ctx, ev); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	}
+	incs, _ := proc.Incidents.ListRange(ctx, time.Time{}, time.Now())
+	if len(incs) != 1 {
+		t.Fatalf("incidents = %d want 1 per group", len(incs))
+	}
+	inc := incs[0]
+	if inc.Severity != metrics.SeverityCritical || inc.Service != "checkout" || inc.Environment != "prod" ||
+		inc.Title != "Checkout error rate above 5%" {
+		t.Errorf("unexpected incident %+v", inc)
+	}
+	if inc.MTTR() != 30*time.Minute {
+		t.Errorf("mttr = %v want 30m (first start to last end)", inc.MTTR())
+	}
+}
+
+func TestAlertmanagerRefiringGroupOpensNewIncident(t *testing.T) {
+	a := NewAlertmanager(AlertmanagerConfig{})
+	proc := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	ctx := context.Background()
+	// The group fires again two hours after it resolved
+	refire := strings.ReplaceAll(amPayload("firing", "firing", "critical"), "2024-05-01T10:", "2024-05-01T12:")
+	for _, body := range []string{
+		amPayload("firing", "firing", "critical"),
+		amPayload("resolved", "resolved", "critical"),
+		refire,
+	} {
+		ev, err := a.Parse(nil, []byte(body))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if _, err := proc.Process(ctx, ev); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	}
+	incs, _ := proc.Incidents.ListRange(ctx, time.Time{}, time.Now())
+	if len(incs) != 2 {
+		t.Fatalf("incidents = %d want one per episode", len(incs))
+	}
+	if incs[0].ID == incs[1].ID {
+		t.Errorf("episodes share ID %s", incs[0].ID)
+	}
+	byStart := map[int]metrics.Incident{incs[0].StartTime.Hour(): incs[0], incs[1].StartTime.Hour(): incs[1]}
+	if first := byStart[10]; first.ResolvedTime == nil || first.MTTR() != 30*time.Minute {
+		t.Errorf("first episode = %+v", first)
+	}
+	if second, ok := byStart[12]; !ok || second.ResolvedTime != nil {
+		t.Errorf("second episode = %+v, want open from 12:00", second)
+	}
+}
+
+func TestAlertmanagerIncidentRule(t *testing.T) {
+	body := amPayload("firing", "firing", "info")
+	cases := []struct {
+		rule IncidentRule
+		want error
+	}{
+		{IncidentRule{Severities: []string{"critical"}}, ErrUnsupportedEvent},
+		{IncidentRule{Severities: []string{"Warning"}}, nil},
+		{IncidentRule{Severities: []string{"critical"}, Names: []string{"HighErrorRate"}}, nil},
+		{IncidentRule{}, nil},
+	}
+	for _, tc := range cases {
+		_, err := NewAlertmanager(AlertmanagerConfig{Rule: tc.rule}).Parse(nil, []byte(body))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("rule %+v: got %v want %v", tc.rule, err, tc.want)
+		}
+	}
+	if _, err := NewAlertmanager(AlertmanagerConfig{}).Parse(nil, []byte(strings.Replace(body, `"groupKey"`, `"other"`, 1))); !errors.Is(err, ErrMalformedPayload) {
+		t.Errorf("missing groupKey: got %v", err)
+	}
+}
+
+func TestAlertmanagerVerify(t *testing.T) {
+	a := NewAlertmanager(AlertmanagerConfig{Token: "t0ken"})
+	if err := a.Verify(http.Header{"Authorization": {"Bearer t0ken"}}, nil); err != nil {
+		t.Errorf("bearer token: %v", err)
+	}
+	if err := a.Verify(http.Header{"Authorization": {"Basic dDA6a2Vu"}}, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("basic auth: got %v", err)
+	}
+}
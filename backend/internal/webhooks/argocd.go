@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// ArgoCDConfig configures the Argo CD adapter.
+type ArgoCDConfig struct {
+	// Token is a shared secret sent as X-ArgoCD-Token (a header on the
+	// notifications webhook service) or as a bearer token. When empty,
+	// deliveries are accepted unverified (development only).
+	Token string
+}
+
+// ArgoCD handles Argo CD notifications webhooks rendered with the template in
+// docs/gitops.md. A deployment is one sync of an application's revision to
+// its destination; sync and health transitions update it.
+type ArgoCD struct{ secretVerifier }
+
+// NewArgoCD builds the adapter.
+func NewArgoCD(cfg ArgoCDConfig) *ArgoCD {
+	return &ArgoCD{secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: SharedToken{Header: "X-ArgoCD-Token", Bearer: true}}}
+}
+
+func (a *ArgoCD) Name() string { return "argocd" }
+
+func (a *ArgoCD) Description() string { return "Argo CD application syncs and health changes" }
+
+type argoNotification struct {
+	App               string `json:"app"`
+	Revision          string `json:"revision"`
+	RepoURL           string `json:"repo_url"`
+	SyncStatus        string `json:"sync_status"`
+	HealthStatus      string `json:"health_status"`
+	OperationPhase    string `json:"operation_phase"`
+	StartedAt         string `json:"started_at"`
+	FinishedAt        string `json:"finished_at"`
+	DestinationServer string `json:"destination_server"`
+	DestinationName   string `json:"destination_name"`
+	Namespace         string `json:"namespace"`
+	URL               string `json:"url"`
+	Author            string `json:"author"`
+	CommitTime        string `json:"commit_time"`
+}
+
+// argoStatus derives a deployment status from the sync operation phase and
+// application health: a successful sync is running until the application
+// reports Healthy, and failed once it reports Degraded.
+func argoStatus(phase, health string) (metrics.DeploymentStatus, bool) {
+	switch phase {
+	case "Running":
+		return metrics.DeploymentStatusRunning, true
+	case "Failed", "Error":
+		return metrics.DeploymentStatusFailed, true
+	case "Succeeded":
+		switch health {
+		case "Healthy", "Suspended":
+			return metrics.DeploymentStatusSuccess, true
+		case "Degraded":
+			return metrics.DeploymentStatusFailed, true
+		default: // Progressing, Missing, Unknown
+			return metrics.DeploymentStatusRunning, true
+		}
+	}
+	return "", false
+}
+
+// Parse maps one notification to a deployment keyed by (repository,
+// revision, destination).
+func (a *ArgoCD) Parse(_ http.Header, body []byte) (*Event, error) {
+	var n argoNotification
+	if err := decode(body, &n); err != nil {
+		return nil, err
+	}
+	if n.App == "" || n.Revision == "" {
+		return nil, fmt.Errorf("%w: missing app or revision", ErrMalformedPayload)
+	}
+	ev := &Event{Source: a.Name(), Type: "sync." + n.OperationPhase, DeliveryID: fmt.Sprintf("%s@%s/%s/%s", n.App, n.Revision, n.OperationPhase, n.HealthStatus)}
+	status, ok := argoStatus(n.OperationPhase, n.HealthStatus)
+	if !ok {
+		return nil, fmt.Errorf("%w: operation phase %q", ErrUnsupportedEvent, n.OperationPhase)
+	}
+	started, err := optionalTime(n.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+	finished, err := optionalTime(n.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := optionalTime(n.CommitTime)
+	if err != nil {
+		return nil, err
+	}
+	env := destination(n.DestinationName, n.DestinationServer, n.Namespace)
+	d := metrics.Deployment{
+		ID:          fmt.Sprintf("argocd-%s-%s-%s", n.App, shortSHA(n.Revision), env),
+		Service:     n.App,
+		Environment: env,
+		Version:     shortSHA(n.Revision),
+		Status:      status,
+		StartTime:   firstTime(started, time.Now().UTC()),
+		CommitSHA:   n.Revision,
+		CommitTime:  committed,
+		Author:      n.Author,
+		Repository:  repositoryPath(n.RepoURL),
+		BuildURL:    n.URL,
+	}
+	if status.IsTerminal() {
+		end := firstTime(finished, time.Now().UTC())
+		d.EndTime = &end
+	}
+	ev.Deployments = append(ev.Deployments, d)
+	return ev, nil
+}
+
+// destination renders "cluster/namespace", naming the cluster by its Argo CD
+// name, else its API server host; the local cluster is "in-cluster".
+func destination(name, server, namespace string) string {
+	cluster := name
+	if cluster == "" {
+		if u, err := url.Parse(server); err == nil && u.Host != "" {
+			cluster = u.Hostname()
+		} else {
+			cluster = server
+		}
+	}
+	if cluster == "" || cluster == "kubernetes.default.svc" {
+		cluster = "in-cluster"
+	}
+	if namespace == "" {
+		return cluster
+	}
+	return cluster + "/" + namespace
+}
+
+// optionalTime parses an RFC 3339 time; template fields that were not set
+// render as "" or "<no value>".
+func optionalTime(s string) (time.Time, error) {
+	if s == "" || s == "<no value>" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrMalformedPayload, err)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,89 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+func argoPayload(phase, health, finished string) string {
+	return `{"app": "checkout", "revision": "9fceb02d0ae598e95dc970b74767f19372d61af8",
+		"repo_url": "https://github.com/acme/deploy-config.git", "sync_status": "Synced",
+		"health_status": "` + health + `", "operation_phase": "` + phase + `",
+		"started_at": "2024-05-01T10:00:00Z", "finished_at": "` + finished + `",
+		"destination_server": "https://kubernetes.default.svc", "destination_name": "", "namespace": "shop",
+		"url": "https://argocd.example.com/applications/checkout", "author": "jane",
+		"commit_time": "2024-05-01T09:30:00Z"}`
+}
+
+func TestArgoCDSyncAndHealth(t *testing.T) {
+	a := NewArgoCD(ArgoCDConfig{})
+	proc := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	ctx := context.Background()
+	for _, body := range []string{
+		argoPayload("Running", "Progressing", "<no value>"),
+		argoPayload("Succeeded", "Progressing", "2024-05-01T10:02:00Z"),
+		argoPayload("Succeeded", "Healthy", "2024-05-01T10:02:00Z"),
+	} {
+		ev, err := a.Parse(nil, []byte(body))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if _, err := proc.Process(ctx, ev); err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	}
+	deps, _ := proc.Deployments.ListRange(ctx, time.Time{}, time.Now())
+	if len(deps) != 1 {
+		t.Fatalf("deployments = %d want 1 per sync", len(deps))
+	}
+	d := deps[0]
+	if d.Status != metrics.DeploymentStatusSuccess || d.Service != "checkout" || d.Environment != "in-cluster/shop" ||
+		d.Repository != "acme/deploy-config" || d.CommitSHA != "9fceb02d0ae598e95dc970b74767f19372d61af8" {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if d.LeadTime() != 32*time.Minute {
+		t.Errorf("lead time = %v want 32m", d.LeadTime())
+	}
+}
+
+func TestArgoCDStatus(t *testing.T) {
+	cases := []struct {
+		phase, health string
+		want          metrics.DeploymentStatus
+		err           error
+	}{
+		{"Succeeded", "Degraded", metrics.DeploymentStatusFailed, nil},
+		{"Succeeded", "Missing", metrics.DeploymentStatusRunning, nil},
+		{"Failed", "Healthy", metrics.DeploymentStatusFailed, nil},
+		{"Terminating", "Healthy", "", ErrUnsupportedEvent},
+	}
+	a := NewArgoCD(ArgoCDConfig{})
+	for _, tc := range cases {
+		ev, err := a.Parse(nil, []byte(argoPayload(tc.phase, tc.health, "2024-05-01T10:02:00Z")))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s/%s: got %v want %v", tc.phase, tc.health, err, tc.err)
+			continue
+		}
+		if err == nil && ev.Deployments[0].Status != tc.want {
+			t.Errorf("%s/%s: status %s want %s", tc.phase, tc.health, ev.Deployments[0].Status, tc.want)
+		}
+	}
+	named := strings.Replace(argoPayload("Running", "Progressing", ""), `"destination_name": ""`, `"destination_name": "prod-eu"`, 1)
+	if ev, err := a.Parse(nil, []byte(named)); err != nil || ev.Deployments[0].Environment != "prod-eu/shop" {
+		t.Errorf("named cluster: %v %+v", err, ev)
+	}
+	if err := NewArgoCD(ArgoCDConfig{Token: "s3cret"}).Verify(http.Header{"X-Argocd-Token": {"wrong"}}, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong token: got %v", err)
+	}
+}
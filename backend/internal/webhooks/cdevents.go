@@ -0,0 +1,326 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// CDEventsConfig configures the CDEvents adapter.
+type CDEventsConfig struct {
+	// Token is a shared secret sent as X-CDEvents-Token or as a bearer token;
+	// CloudEvents defines no signature of its own. When empty, deliveries are
+	// accepted unverified (development only).
+	Token string
+	// DefaultEnvironment is used for service and incident events without an
+	// environment. Defaults to "production".
+	DefaultEnvironment string
+}
+
+// CDEvents handles CDEvents (https://cdevents.dev) carried over the
+// CloudEvents HTTP binding, in binary, structured and batched modes.
+type CDEvents struct {
+	secretVerifier
+	environment string
+}
+
+// NewCDEvents builds the adapter.
+func NewCDEvents(cfg CDEventsConfig) *CDEvents {
+	env := cfg.DefaultEnvironment
+	if env == "" {
+		env = "production"
+	}
+	return &CDEvents{secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: SharedToken{Header: "X-CDEvents-Token", Bearer: true}}, environment: env}
+}
+
+func (c *CDEvents) Name() string { return "cdevents" }
+
+func (c *CDEvents) Description() string {
+	return "CDEvents over CloudEvents: service deployments, incidents and merged changes"
+}
+
+const (
+	cloudEventsJSON  = "application/cloudevents+json"
+	cloudEventsBatch = "application/cloudevents-batch+json"
+)
+
+// cloudEvent holds the CloudEvents attributes MetricHub reads; in structured
+// mode they come from the envelope and in binary mode from ce-* headers.
+type cloudEvent struct {
+	SpecVersion string          `json:"specversion"`
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	Type        string          `json:"type"`
+	Time        string          `json:"time"`
+	Data        json.RawMessage `json:"data"`
+}
+
+type cdRef struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+}
+
+type cdEvent struct {
+	Context struct {
+		Version   string    `json:"version"`
+		ID        string    `json:"id"`
+		Source    string    `json:"source"`
+		Type      string    `json:"type"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"context"`
+	Subject struct {
+		ID      string `json:"id"`
+		Source  string `json:"source"`
+		Type    string `json:"type"`
+		Content struct {
+			Environment cdRef  `json:"environment"`
+			Service     cdRef  `json:"service"`
+			Repository  cdRef  `json:"repository"`
+			ArtifactID  string `json:"artifactId"`
+			Description string `json:"description"`
+			TicketURI   string `json:"ticketURI"`
+		} `json:"content"`
+	} `json:"subject"`
+	CustomData json.RawMessage `json:"customData"`
+}
+
+// cdCustomData are the optional customData keys MetricHub understands, for
+// producers that know more than the spec's subject carries.
+type cdCustomData struct {
+	Repository string    `json:"repository"`
+	Commit     string    `json:"commit"`
+	CommitTime time.Time `json:"commitTime"`
+	Author     string    `json:"author"`
+	Severity   string    `json:"severity"`
+}
+
+// cdTypePattern splits "dev.cdevents.<subject>.<predicate>.<version>".
+var cdTypePattern = regexp.MustCompile(`^dev\.cdevents\.([a-z]+)\.([a-z]+)\.(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?)$`)
+
+// Parse reads the CloudEvents in the request and maps each CDEvent to the
+// domain models. A batch is accepted when at least one event maps.
+func (c *CDEvents) Parse(h http.Header, body []byte) (*Event, error) {
+	ces, err := cloudEvents(h, body)
+	if err != nil {
+		return nil, err
+	}
+	out := &Event{Source: c.Name()}
+	var ids, types []string
+	var lastErr error
+	for _, ce := range ces {
+		ev, err := c.parseOne(ce)
+		if err != nil {
+			if len(ces) == 1 {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		ids, types = append(ids, ev.DeliveryID), append(types, ev.Type)
+		out.Deployments = append(out.Deployments, ev.Deployments...)
+		out.Incidents = append(out.Incidents, ev.Incidents...)
+		out.Commits = append(out.Commits, ev.Commits...)
+	}
+	if len(ids) == 0 {
+		return nil, lastErr
+	}
+	out.DeliveryID, out.Type = strings.Join(ids, ","), strings.Join(types, ",")
+	return out, nil
+}
+
+// cloudEvents decodes the request according to its CloudEvents content mode.
+func cloudEvents(h http.Header, body []byte) ([]cloudEvent, error) {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case mediaType == cloudEventsBatch:
+		var batch []cloudEvent
+		if err := decode(body, &batch); err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			return nil, fmt.Errorf("%w: empty batch", ErrMalformedPayload)
+		}
+		return batch, nil
+	case mediaType == cloudEventsJSON:
+		var ce cloudEvent
+		if err := decode(body, &ce); err != nil {
+			return nil, err
+		}
+		return []cloudEvent{ce}, nil
+	case h.Get("Ce-Specversion") != "":
+		return []cloudEvent{{
+			SpecVersion: h.Get("Ce-Specversion"),
+			ID:          h.Get("Ce-Id"),
+			Source:      h.Get("Ce-Source"),
+			Type:        h.Get("Ce-Type"),
+			Time:        h.Get("Ce-Time"),
+			Data:        body,
+		}}, nil
+	}
+	return nil, fmt.Errorf("%w: not a CloudEvent (no ce-specversion header or %s body)", ErrMalformedPayload, cloudEventsJSON)
+}
+
+func (c *CDEvents) parseOne(ce cloudEvent) (*Event, error) {
+	if ce.SpecVersion != "1.0" {
+		return nil, fmt.Errorf("%w: unsupported CloudEvents specversion %q", ErrMalformedPayload, ce.SpecVersion)
+	}
+	if ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return nil, fmt.Errorf("%w: CloudEvent requires id, source and type", ErrMalformedPayload)
+	}
+	ev := &Event{Source: c.Name(), Type: ce.Type, DeliveryID: ce.Source + "/" + ce.ID}
+	m := cdTypePattern.FindStringSubmatch(ce.Type)
+	if m == nil {
+		return nil, fmt.Errorf("%w: type %q is not a CDEvent", ErrUnsupportedEvent, ce.Type)
+	}
+	var e cdEvent
+	if err := decode(ce.Data, &e); err != nil {
+		return nil, err
+	}
+	if e.Context.Type != "" && e.Context.Type != ce.Type {
+		return nil, fmt.Errorf("%w: CloudEvent type %q does not match CDEvent type %q", ErrMalformedPayload, ce.Type, e.Context.Type)
+	}
+	if e.Subject.ID == "" {
+		return nil, fmt.Errorf("%w: missing subject.id", ErrMalformedPayload)
+	}
+	var custom cdCustomData
+	if len(e.CustomData) > 0 && e.CustomData[0] == '{' {
+		if err := json.Unmarshal(e.CustomData, &custom); err != nil {
+			return nil, fmt.Errorf("%w: customData: %v", ErrMalformedPayload, err)
+		}
+	}
+	at := e.Context.Timestamp.UTC()
+	if at.IsZero() {
+		if t, err := time.Parse(time.RFC3339, ce.Time); err == nil {
+			at = t.UTC()
+		} else {
+			at = time.Now().UTC()
+		}
+	}
+	content := e.Subject.Content
+
+	switch subject, predicate := m[1], m[2]; {
+	case subject == "service" && (predicate == "deployed" || predicate == "upgraded" || predicate == "rolledback"):
+		art := parsePURL(content.ArtifactID)
+		sha := firstNonEmpty(custom.Commit, art.commit())
+		d := metrics.Deployment{
+			ID:          "cde-" + ce.ID,
+			Service:     cdName(e.Subject.ID),
+			Environment: firstNonEmpty(content.Environment.ID, c.environment),
+			Version:     firstNonEmpty(art.Version, shortSHA(sha)),
+			Status:      metrics.DeploymentStatusSuccess,
+			StartTime:   at,
+			EndTime:     &at,
+			CommitSHA:   sha,
+			CommitTime:  custom.CommitTime,
+			Author:      custom.Author,
+			Repository:  repositoryPath(firstNonEmpty(custom.Repository, art.repository())),
+			Tags:        map[string]string{"cdevents.predicate": predicate},
+		}
+		if content.ArtifactID != "" {
+			d.Tags["cdevents.artifact"] = content.ArtifactID
+		}
+		ev.Deployments = append(ev.Deployments, d)
+	case subject == "incident" && (predicate == "detected" || predicate == "reported" || predicate == "resolved"):
+		inc := metrics.Incident{
+			ID:          "cde-" + e.Subject.ID,
+			Title:       firstNonEmpty(content.Description, "CDEvents incident "+e.Subject.ID),
+			Service:     firstNonEmpty(cdName(content.Service.ID), "unknown"),
+			Environment: firstNonEmpty(content.Environment.ID, c.environment),
+			Severity:    metrics.SeverityMedium,
+			StartTime:   at,
+		}
+		if custom.Severity != "" {
+			inc.Severity = severityFromLabel(custom.Severity)
+		}
+		if predicate == "resolved" {
+			inc.ResolvedTime = &at
+		}
+		ev.Incidents = append(ev.Incidents, inc)
+	case subject == "change" && predicate == "merged":
+		repo := firstNonEmpty(custom.Repository, content.Repository.ID)
+		if repo == "" {
+			return nil, fmt.Errorf("%w: change.merged without a repository", ErrMalformedPayload)
+		}
+		ev.Commits = append(ev.Commits, metrics.Commit{
+			Repository:  repositoryPath(repo),
+			SHA:         firstNonEmpty(custom.Commit, e.Subject.ID),
+			Author:      custom.Author,
+			AuthoredAt:  firstTime(custom.CommitTime, at),
+			CommittedAt: at,
+		})
+	default:
+		return nil, fmt.Errorf("%w: %s.%s", ErrUnsupportedEvent, subject, predicate)
+	}
+	return ev, nil
+}
+
+// cdName reduces a subject id such as "service/checkout" to its last segment.
+func cdName(id string) string {
+	if id == "" {
+		return ""
+	}
+	return path.Base(id)
+}
+
+// purl is the part of a package URL (https://github.com/package-url/purl-spec)
+// MetricHub reads from CDEvents artifact ids.
+type purl struct {
+	Type, Namespace, Name, Version string
+	Qualifiers                     url.Values
+}
+
+var hexSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// parsePURL parses "pkg:type/namespace/name@version?qualifiers#subpath",
+// returning the zero value for anything else.
+func parsePURL(s string) purl {
+	rest, ok := strings.CutPrefix(s, "pkg:")
+	if !ok {
+		return purl{}
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, query, _ := strings.Cut(rest, "?")
+	var p purl
+	p.Qualifiers, _ = url.ParseQuery(query)
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		p.Version, _ = url.PathUnescape(rest[at+1:])
+		rest = rest[:at]
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	p.Type = strings.ToLower(parts[0])
+	if len(parts) > 1 {
+		p.Name, _ = url.PathUnescape(parts[len(parts)-1])
+		p.Namespace, _ = url.PathUnescape(strings.Join(parts[1:len(parts)-1], "/"))
+	}
+	return p
+}
+
+// repository returns the source repository of a VCS purl
+// (pkg:github/acme/api@<sha>) or the vcs_url qualifier of any other.
+func (p purl) repository() string {
+	switch p.Type {
+	case "github", "gitlab", "bitbucket":
+		return strings.Trim(p.Namespace+"/"+p.Name, "/")
+	}
+	vcs := strings.TrimPrefix(p.Qualifiers.Get("vcs_url"), "git+")
+	if at := strings.LastIndex(vcs, "@"); at > strings.LastIndex(vcs, "/") {
+		vcs = vcs[:at]
+	}
+	return vcs
+}
+
+// commit returns the version of a VCS purl when it is a full commit SHA.
+func (p purl) commit() string {
+	if p.repository() != "" && hexSHA.MatchString(p.Version) {
+		return p.Version
+	}
+	return ""
+}
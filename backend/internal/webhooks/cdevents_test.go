@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// cdFixture loads a CDEvents spec example and returns it in binary mode
+// (ce-* headers, CDEvent body) and in structured mode (CloudEvents envelope).
+func cdFixture(t *testing.T, name string) (binH http.Header, bin []byte, structH http.Header, structured []byte) {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "cdevents", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Context struct{ ID, Source, Type, Timestamp string } `json:"context"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	binH = http.Header{}
+	binH.Set("Content-Type", "application/json")
+	binH.Set("Ce-Specversion", "1.0")
+	binH.Set("Ce-Id", doc.Context.ID)
+	binH.Set("Ce-Source", doc.Context.Source)
+	binH.Set("Ce-Type", doc.Context.Type)
+	binH.Set("Ce-Time", doc.Context.Timestamp)
+	structured, _ = json.Marshal(map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              doc.Context.ID,
+		"source":          doc.Context.Source,
+		"type":            doc.Context.Type,
+		"time":            doc.Context.Timestamp,
+		"datacontenttype": "application/json",
+		"data":            json.RawMessage(raw),
+	})
+	structH = http.Header{"Content-Type": {"application/cloudevents+json; charset=utf-8"}}
+	return binH, raw, structH, structured
+}
+
+func TestCDEventsConformance(t *testing.T) {
+	c := NewCDEvents(CDEventsConfig{})
+	check := map[string]func(t *testing.T, ev *Event){
+		"service_deployed.json": func(t *testing.T, ev *Event) {
+			d := ev.Deployments[0]
+			if d.ID != "cde-271069a8-fc18-44f1-b38f-9d70a1695819" || d.Service != "myapp" || d.Environment != "test123" ||
+				d.Status != metrics.DeploymentStatusSuccess || d.EndTime == nil || d.Tags["cdevents.predicate"] != "deployed" {
+				t.Errorf("unexpected deployment %+v", d)
+			}
+			if d.Version != "sha256:0b31b1c02ff458ad9b7b81cbdf8f028bd54699fa151f221d1e8de6817db93427" {
+				t.Errorf("version = %q want the artifact digest", d.Version)
+			}
+		},
+		"service_upgraded.json": func(t *testing.T, ev *Event) {
+			if d := ev.Deployments[0]; d.Tags["cdevents.predicate"] != "upgraded" {
+				t.Errorf("unexpected deployment %+v", d)
+			}
+		},
+		"service_rolledback.json": func(t *testing.T, ev *Event) {
+			if d := ev.Deployments[0]; d.Tags["cdevents.predicate"] != "rolledback" {
+				t.Errorf("unexpected deployment %+v", d)
+			}
+		},
+		"incident_detected.json": func(t *testing.T, ev *Event) {
+			inc := ev.Incidents[0]
+			if inc.ID != "cde-incident-123" || inc.Title != "Response time above 10ms" || inc.Service != "myApp" ||
+				inc.Environment != "prod1" || inc.ResolvedTime != nil {
+				t.Errorf("unexpected incident %+v", inc)
+			}
+		},
+		"incident_reported.json": func(t *testing.T, ev *Event) {
+			if inc := ev.Incidents[0]; inc.ID != "cde-incident-123" || inc.ResolvedTime != nil {
+				t.Errorf("unexpected incident %+v", inc)
+			}
+		},
+		"incident_resolved.json": func(t *testing.T, ev *Event) {
+			if inc := ev.Incidents[0]; inc.ID != "cde-incident-123" || inc.ResolvedTime == nil {
+				t.Errorf("unexpected incident %+v", inc)
+			}
+		},
+		"change_merged.json": func(t *testing.T, ev *Event) {
+			if cm := ev.Commits[0]; cm.Repository != "TestRepo/TestOrg" || cm.SHA != "mySubject123" || cm.CommittedAt.IsZero() {
+				t.Errorf("unexpected commit %+v", cm)
+			}
+		},
+	}
+	files, _ := filepath.Glob(filepath.Join("testdata", "cdevents", "*.json"))
+	if len(files) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, f := range files {
+		name := filepath.Base(f)
+		t.Run(name, func(t *testing.T) {
+			binH, bin, structH, structured := cdFixture(t, name)
+			binEv, binErr := c.Parse(binH, bin)
+			structEv, structErr := c.Parse(structH, structured)
+			if fmt.Sprint(binErr) != fmt.Sprint(structErr) {
+				t.Fatalf("modes disagree: binary %v, structured %v", binErr, structErr)
+			}
+			fn, handled := check[name]
+			if !handled {
+				if !errors.Is(binErr, ErrUnsupportedEvent) {
+					t.Fatalf("got %v want ErrUnsupportedEvent", binErr)
+				}
+				return
+			}
+			if binErr != nil {
+				t.Fatalf("Parse: %v", binErr)
+			}
+			if !reflect.DeepEqual(binEv, structEv) {
+				t.Errorf("binary and structured modes differ:\n%+v\n%+v", binEv, structEv)
+			}
+			fn(t, binEv)
+		})
+	}
+}
+
+func TestCDEventsBatchAndErrors(t *testing.T) {
+	c := NewCDEvents(CDEventsConfig{})
+	var batch []json.RawMessage
+	for _, name := range []string{"service_deployed.json", "pipelinerun_finished.json", "incident_detected.json"} {
+		_, _, _, structured := cdFixture(t, name)
+		batch = append(batch, structured)
+	}
+	body, _ := json.Marshal(batch)
+	ev, err := c.Parse(http.Header{"Content-Type": {"application/cloudevents-batch+json"}}, body)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(ev.Deployments) != 1 || len(ev.Incidents) != 1 {
+		t.Errorf("batch mapped %d deployments, %d incidents", len(ev.Deployments), len(ev.Incidents))
+	}
+
+	binH, bin, _, _ := cdFixture(t, "service_deployed.json")
+	cases := []struct {
+		name   string
+		header func(h http.Header)
+	}{
+		{"no ce headers", func(h http.Header) { h.Del("Ce-Specversion") }},
+		{"old specversion", func(h http.Header) { h.Set("Ce-Specversion", "0.3") }},
+		{"missing id", func(h http.Header) { h.Del("Ce-Id") }},
+		{"type mismatch", func(h http.Header) { h.Set("Ce-Type", "dev.cdevents.service.upgraded.0.2.0") }},
+	}
+	for _, tc := range cases {
+		h := binH.Clone()
+		tc.header(h)
+		if _, err := c.Parse(h, bin); !errors.Is(err, ErrMalformedPayload) {
+			t.Errorf("%s: got %v want ErrMalformedPayload", tc.name, err)
+		}
+	}
+}
+
+func TestParsePURL(t *testing.T) {
+	sha := "9fceb02d0ae598e95dc970b74767f19372d61af8"
+	cases := []struct{ in, repo, commit, version string }{
+		{"pkg:github/acme/api@" + sha, "acme/api", sha, sha},
+		{"pkg:oci/api@sha256%3Aabc?vcs_url=git%2Bhttps://github.com/acme/api.git%40" + sha, "https://github.com/acme/api.git", "", "sha256:abc"},
+		{"pkg:golang/github.com/acme/api@v1.2.0", "", "", "v1.2.0"},
+		{"not-a-purl", "", "", ""},
+	}
+	for _, tc := range cases {
+		p := parsePURL(tc.in)
+		if p.repository() != tc.repo || p.commit() != tc.commit || p.Version != tc.version {
+			t.Errorf("parsePURL(%q) = repo %q commit %q version %q", tc.in, p.repository(), p.commit(), p.Version)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// FluxConfig configures the Flux adapter.
+type FluxConfig struct {
+	// Secret is the token of a generic-hmac Provider; deliveries are checked
+	// against X-Signature (sha256=<hex HMAC of the body>). When empty,
+	// deliveries are accepted unverified (development only).
+	Secret string
+	// Cluster names the cluster the controllers run in; the environment is
+	// "<cluster>/<namespace>" unless the Alert's eventMetadata sets one.
+	// Defaults to "in-cluster".
+	Cluster string
+}
+
+// Flux handles notification-controller events (generic and generic-hmac
+// providers) for Kustomizations and HelmReleases. Reconciliation outcomes
+// become deployments of the applied revision.
+type Flux struct {
+	secretVerifier
+	cluster string
+}
+
+// NewFlux builds the adapter.
+func NewFlux(cfg FluxConfig) *Flux {
+	cluster := cfg.Cluster
+	if cluster == "" {
+		cluster = "in-cluster"
+	}
+	return &Flux{secretVerifier: secretVerifier{secret: []byte(cfg.Secret), scheme: HMACSHA256{Header: "X-Signature", Prefix: "sha256="}}, cluster: cluster}
+}
+
+func (f *Flux) Name() string { return "flux" }
+
+func (f *Flux) Description() string { return "Flux Kustomization and HelmRelease reconciliations" }
+
+type fluxObject struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type fluxEvent struct {
+	InvolvedObject      fluxObject        `json:"involvedObject"`
+	Severity            string            `json:"severity"`
+	Timestamp           time.Time         `json:"timestamp"`
+	Message             string            `json:"message"`
+	Reason              string            `json:"reason"`
+	Metadata            map[string]string `json:"metadata"`
+	ReportingController string            `json:"reportingController"`
+}
+
+// fluxReasons maps event reasons onto deployment statuses; anything else
+// (source fetches, dependency waits, drift notices) is ignored.
+var fluxReasons = map[string]metrics.DeploymentStatus{
+	"Progressing":             metrics.DeploymentStatusRunning,
+	"ReconciliationSucceeded": metrics.DeploymentStatusSuccess,
+	"InstallSucceeded":        metrics.DeploymentStatusSuccess,
+	"UpgradeSucceeded":        metrics.DeploymentStatusSuccess,
+	"ReconciliationFailed":    metrics.DeploymentStatusFailed,
+	"HealthCheckFailed":       metrics.DeploymentStatusFailed,
+	"BuildFailed":             metrics.DeploymentStatusFailed,
+	"InstallFailed":           metrics.DeploymentStatusFailed,
+	"UpgradeFailed":           metrics.DeploymentStatusFailed,
+}
+
+// fluxRevision splits a source revision into branch and commit. Git sources
+// report "main@sha1:<sha>" (or "main/<sha>" before Flux 2.0); charts and OCI
+// artifacts report a version or digest, which carries no commit.
+func fluxRevision(rev string) (branch, sha string) {
+	if ref, digest, ok := strings.Cut(rev, "@"); ok {
+		if s, ok := strings.CutPrefix(digest, "sha1:"); ok {
+			return ref, s
+		}
+		return "", ""
+	}
+	if s, ok := strings.CutPrefix(rev, "sha1:"); ok {
+		return "", s
+	}
+	if i := strings.LastIndex(rev, "/"); i >= 0 && len(rev)-i-1 == 40 {
+		return rev[:i], rev[i+1:]
+	}
+	return "", ""
+}
+
+// Parse maps one reconciliation event to a deployment. The Alert's
+// eventMetadata may set "service", "environment" and "repository"; without a
+// repository only final outcomes are recorded, since there is no natural key
+// to merge progress into.
+func (f *Flux) Parse(_ http.Header, body []byte) (*Event, error) {
+	var e fluxEvent
+	if err := decode(body, &e); err != nil {
+		return nil, err
+	}
+	obj := e.InvolvedObject
+	ev := &Event{Source: f.Name(), Type: obj.Kind + "." + e.Reason}
+	if obj.Kind != "Kustomization" && obj.Kind != "HelmRelease" {
+		return nil, fmt.Errorf("%w: kind %q", ErrUnsupportedEvent, obj.Kind)
+	}
+	status, ok := fluxReasons[e.Reason]
+	if !ok {
+		return nil, fmt.Errorf("%w: reason %q", ErrUnsupportedEvent, e.Reason)
+	}
+	if obj.Name == "" {
+		return nil, fmt.Errorf("%w: missing involvedObject.name", ErrMalformedPayload)
+	}
+	md := e.Metadata
+	revision := md["revision"]
+	if revision == "" {
+		return nil, fmt.Errorf("%w: event carries no revision", ErrUnsupportedEvent)
+	}
+	repo := md["repository"]
+	if repo == "" && !status.IsTerminal() {
+		return nil, fmt.Errorf("%w: progress without a repository in eventMetadata", ErrUnsupportedEvent)
+	}
+	ev.DeliveryID = fmt.Sprintf("%s/%s/%s@%s/%s", obj.Kind, obj.Namespace, obj.Name, revision, e.Reason)
+
+	branch, sha := fluxRevision(revision)
+	version := revision
+	if sha != "" {
+		version = shortSHA(sha)
+	}
+	at := firstTime(e.Timestamp.UTC(), time.Now().UTC())
+	d := metrics.Deployment{
+		ID:          fmt.Sprintf("flux-%s-%s-%s-%s", strings.ToLower(obj.Kind), obj.Namespace, obj.Name, version),
+		Service:     firstNonEmpty(md["service"], obj.Name),
+		Environment: firstNonEmpty(md["environment"], md["env"], f.cluster+"/"+obj.Namespace),
+		Version:     version,
+		Status:      status,
+		StartTime:   at,
+		CommitSHA:   sha,
+		Branch:      branch,
+		Repository:  repositoryPath(repo),
+	}
+	if status.IsTerminal() {
+		d.EndTime = &at
+	}
+	ev.Deployments = append(ev.Deployments, d)
+	return ev, nil
+}
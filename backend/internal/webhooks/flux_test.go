@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+func fluxPayload(kind, reason, revision, extra string) string {
+	return `{"involvedObject": {"kind": "` + kind + `", "namespace": "apps", "name": "podinfo",
+		"apiVersion": "kustomize.toolkit.fluxcd.io/v1"},
+		"severity": "info", "timestamp": "2024-05-01T10:05:00Z", "message": "Reconciliation finished",
+		"reason": "` + reason + `", "reportingController": "kustomize-controller",
+		"metadata": {"revision": "` + revision + `"` + extra + `}}`
+}
+
+func TestFluxParse(t *testing.T) {
+	f := NewFlux(FluxConfig{Cluster: "prod-eu"})
+	ev, err := f.Parse(nil, []byte(fluxPayload("Kustomization", "ReconciliationSucceeded",
+		"main@sha1:9fceb02d0ae598e95dc970b74767f19372d61af8", `, "repository": "https://github.com/acme/fleet"`)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	d := ev.Deployments[0]
+	if d.Status != metrics.DeploymentStatusSuccess || d.Service != "podinfo" || d.Environment != "prod-eu/apps" ||
+		d.Branch != "main" || d.CommitSHA != "9fceb02d0ae598e95dc970b74767f19372d61af8" || d.Repository != "acme/fleet" || d.EndTime == nil {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+
+	ev, err = f.Parse(nil, []byte(fluxPayload("HelmRelease", "UpgradeFailed", "6.5.0", `, "environment": "production"`)))
+	if err != nil {
+		t.Fatalf("Parse helm: %v", err)
+	}
+	if d := ev.Deployments[0]; d.Status != metrics.DeploymentStatusFailed || d.Version != "6.5.0" || d.CommitSHA != "" || d.Environment != "production" {
+		t.Errorf("helm release: %+v", d)
+	}
+
+	cases := []struct {
+		name, kind, reason, extra string
+	}{
+		{"source event", "GitRepository", "NewArtifact", ""},
+		{"unknown reason", "Kustomization", "DependencyNotReady", ""},
+		{"progress without repository", "Kustomization", "Progressing", ""},
+	}
+	for _, tc := range cases {
+		if _, err := f.Parse(nil, []byte(fluxPayload(tc.kind, tc.reason, "main@sha1:abc", tc.extra))); !errors.Is(err, ErrUnsupportedEvent) {
+			t.Errorf("%s: got %v", tc.name, err)
+		}
+	}
+}
+
+func TestFluxLaterOutcomeReplacesStatus(t *testing.T) {
+	f := NewFlux(FluxConfig{Cluster: "prod-eu"})
+	proc := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	ctx := context.Background()
+	// Without a repository the deployment is keyed by ID, which is the same
+	// for every outcome of a revision
+	for _, reason := range []string{"HealthCheckFailed", "ReconciliationSucceeded"} {
+		ev, err := f.Parse(nil, []byte(fluxPayload("Kustomization", reason, "main@sha1:9fceb02d0ae598e95dc970b74767f19372d61af8", "")))
+		if err != nil {
+			t.Fatalf("Parse %s: %v", reason, err)
+		}
+		res, err := proc.Process(ctx, ev)
+		if err != nil || res.Deployments != 1 || res.Duplicates != 0 {
+			t.Fatalf("Process %s = %+v, %v", reason, res, err)
+		}
+	}
+	ds, _ := proc.Deployments.ListRange(ctx, time.Time{}, time.Now())
+	if len(ds) != 1 || ds[0].Status != metrics.DeploymentStatusSuccess {
+		t.Errorf("deployments = %+v, want one that succeeded", ds)
+	}
+}
+
+func TestFluxRevision(t *testing.T) {
+	sha := "9fceb02d0ae598e95dc970b74767f19372d61af8"
+	cases := []struct{ in, branch, sha string }{
+		{"main@sha1:" + sha, "main", sha},
+		{"sha1:" + sha, "", sha},
+		{"release/v2/" + sha, "release/v2", sha},
+		{"latest@sha256:3b8f1c", "", ""},
+		{"6.5.0", "", ""},
+	}
+	for _, tc := range cases {
+		if branch, got := fluxRevision(tc.in); branch != tc.branch || got != tc.sha {
+			t.Errorf("fluxRevision(%q) = %q, %q", tc.in, branch, got)
+		}
+	}
+}
+
+func TestFluxVerify(t *testing.T) {
+	f := NewFlux(FluxConfig{Secret: "s3cret"})
+	body := []byte(`{}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if err := f.Verify(http.Header{"X-Signature": {"sha256=" + hex.EncodeToString(mac.Sum(nil))}}, body); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := f.Verify(http.Header{"X-Signature": {"sha256=00"}}, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("bad signature: got %v", err)
+	}
+}
@@ -0,0 +1,604 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// ErrInvalidMapping reports a generic mapping that cannot be compiled.
+var ErrInvalidMapping = errors.New("webhooks: invalid mapping")
+
+// MappingConfig describes how the generic adapter turns one source's
+// payloads into deployments and incidents, without code. Expressions are
+// JSONPath (a "$"-rooted subset: .field, ['field'], [index]) or, when they do
+// not start with "$", literal values.
+type MappingConfig struct {
+	Description string `json:"description,omitempty"`
+	// Token, when set, authenticates deliveries with the Signature scheme:
+	// "token" (default) sends it as-is in TokenHeader (default
+	// X-Webhook-Token) or as a bearer token; "hmac-sha256" uses it to sign
+	// the body ("sha256=<hex>" in TokenHeader, default X-Webhook-Signature);
+	// "timestamped-hmac-sha256" signs "<unix>.<body>" ("t=<unix>,v1=<hex>"
+	// in TokenHeader, default X-Webhook-Signature) and rejects timestamps
+	// more than ToleranceSeconds (default 300) away.
+	Token            string `json:"token,omitempty"`
+	TokenHeader      string `json:"token_header,omitempty"`
+	Signature        string `json:"signature,omitempty"`
+	ToleranceSeconds int    `json:"tolerance_seconds,omitempty"`
+	// EventType and DeliveryID label each delivery in responses and logs.
+	EventType  string `json:"event_type,omitempty"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	// Rules are evaluated in order; every rule whose conditions hold emits
+	// one record, and a payload matching none is ignored.
+	Rules []MappingRule `json:"rules"`
+}
+
+// MappingRule maps a payload to one deployment or incident.
+type MappingRule struct {
+	Name string      `json:"name,omitempty"`
+	When []Condition `json:"when,omitempty"`
+	// Kind is "deployment" or "incident".
+	Kind string `json:"kind"`
+	// Fields maps record fields (id, service, start_time, ...) to expressions.
+	Fields map[string]string `json:"fields"`
+	// Status cases are tried in order before Fields["status"]; values are
+	// deployment statuses, or "open"/"resolved" for incidents.
+	Status []StatusCase `json:"status,omitempty"`
+}
+
+// StatusCase sets the status to Value when all its conditions hold.
+type StatusCase struct {
+	Value string      `json:"value"`
+	When  []Condition `json:"when"`
+}
+
+// Condition tests the value at Path with exactly one operator; with none it
+// tests that the path exists.
+type Condition struct {
+	Path    string      `json:"path"`
+	Equals  interface{} `json:"equals,omitempty"`
+	In      []string    `json:"in,omitempty"`
+	Exists  *bool       `json:"exists,omitempty"`
+	Matches string      `json:"matches,omitempty"`
+}
+
+var mappingFields = map[string]struct{ allowed, required []string }{
+	"deployment": {
+		allowed:  []string{"id", "service", "environment", "version", "status", "start_time", "end_time", "commit_sha", "commit_time", "author", "repository", "branch", "build_url"},
+		required: []string{"id", "service"},
+	},
+	"incident": {
+		allowed:  []string{"id", "title", "description", "service", "environment", "severity", "status", "start_time", "resolved_time", "root_cause", "assignee"},
+		required: []string{"id", "title", "service"},
+	},
+}
+
+var sourceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Generic is the adapter compiled from one source's MappingConfig. It is
+// served at /webhook/generic/<source>.
+type Generic struct {
+	source string
+	cfg    MappingConfig
+	secretVerifier
+	rules []compiledRule
+	event expr
+	id    expr
+}
+
+type compiledRule struct {
+	name   string
+	kind   string
+	when   []compiledCondition
+	fields map[string]expr
+	status []compiledStatus
+}
+
+type compiledStatus struct {
+	value string
+	when  []compiledCondition
+}
+
+type compiledCondition struct {
+	path    jsonPath
+	op      string
+	equals  string
+	in      []string
+	exists  bool
+	matches *regexp.Regexp
+}
+
+// CompileMapping validates a mapping document and builds its adapter.
+// Errors wrap ErrInvalidMapping and name the offending rule and field.
+func CompileMapping(source string, raw []byte) (*Generic, error) {
+	if !sourceName.MatchString(source) {
+		return nil, fmt.Errorf("%w: source must match %s", ErrInvalidMapping, sourceName)
+	}
+	var cfg MappingConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMapping, err)
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf("%w: at least one rule is required", ErrInvalidMapping)
+	}
+	g := &Generic{source: source, cfg: cfg}
+	g.secret = []byte(cfg.Token)
+	var err error
+	if g.scheme, err = mappingVerifier(cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMapping, err)
+	}
+	if g.event, err = compileExpr(cfg.EventType); err != nil {
+		return nil, fmt.Errorf("%w: event_type: %v", ErrInvalidMapping, err)
+	}
+	if g.id, err = compileExpr(cfg.DeliveryID); err != nil {
+		return nil, fmt.Errorf("%w: delivery_id: %v", ErrInvalidMapping, err)
+	}
+	for i, r := range cfg.Rules {
+		cr, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %d (%s): %v", ErrInvalidMapping, i, r.Name, err)
+		}
+		g.rules = append(g.rules, cr)
+	}
+	return g, nil
+}
+
+// mappingVerifier builds the verifier for a mapping's signature scheme.
+func mappingVerifier(cfg MappingConfig) (Verifier, error) {
+	if cfg.ToleranceSeconds < 0 {
+		return nil, fmt.Errorf("tolerance_seconds must not be negative")
+	}
+	switch cfg.Signature {
+	case "", "token":
+		return SharedToken{Header: firstNonEmpty(cfg.TokenHeader, "X-Webhook-Token"), Bearer: true}, nil
+	case "hmac-sha256":
+		return HMACSHA256{Header: firstNonEmpty(cfg.TokenHeader, "X-Webhook-Signature"), Prefix: "sha256="}, nil
+	case "timestamped-hmac-sha256":
+		return TimestampedHMAC{Header: firstNonEmpty(cfg.TokenHeader, "X-Webhook-Signature"), Tolerance: time.Duration(cfg.ToleranceSeconds) * time.Second}, nil
+	}
+	return nil, fmt.Errorf("signature must be token, hmac-sha256 or timestamped-hmac-sha256, got %q", cfg.Signature)
+}
+
+func compileRule(r MappingRule) (compiledRule, error) {
+	spec, ok := mappingFields[r.Kind]
+	if !ok {
+		return compiledRule{}, fmt.Errorf("kind must be deployment or incident, got %q", r.Kind)
+	}
+	cr := compiledRule{name: r.Name, kind: r.Kind, fields: make(map[string]expr)}
+	for field, src := range r.Fields {
+		if !containsString(spec.allowed, field) {
+			return cr, fmt.Errorf("unknown %s field %q", r.Kind, field)
+		}
+		e, err := compileExpr(src)
+		if err != nil {
+			return cr, fmt.Errorf("field %s: %v", field, err)
+		}
+		cr.fields[field] = e
+	}
+	for _, field := range spec.required {
+		if _, ok := cr.fields[field]; !ok {
+			return cr, fmt.Errorf("field %q is required", field)
+		}
+	}
+	var err error
+	if cr.when, err = compileConditions(r.When); err != nil {
+		return cr, err
+	}
+	for _, s := range r.Status {
+		if err := checkStatus(r.Kind, s.Value); err != nil {
+			return cr, err
+		}
+		when, err := compileConditions(s.When)
+		if err != nil {
+			return cr, fmt.Errorf("status %s: %v", s.Value, err)
+		}
+		cr.status = append(cr.status, compiledStatus{value: s.Value, when: when})
+	}
+	return cr, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func checkStatus(kind, v string) error {
+	if kind == "incident" {
+		if v != "open" && v != "resolved" {
+			return fmt.Errorf("incident status must be open or resolved, got %q", v)
+		}
+		return nil
+	}
+	for _, s := range metrics.DeploymentStatuses {
+		if string(s) == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown deployment status %q", v)
+}
+
+func compileConditions(in []Condition) ([]compiledCondition, error) {
+	out := make([]compiledCondition, 0, len(in))
+	for _, c := range in {
+		p, err := parseJSONPath(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("condition %q: %v", c.Path, err)
+		}
+		cc := compiledCondition{path: p, op: "exists", exists: true}
+		ops := 0
+		if c.Equals != nil {
+			cc.op, cc.equals, ops = "equals", stringify(c.Equals), ops+1
+		}
+		if c.In != nil {
+			cc.op, cc.in, ops = "in", c.In, ops+1
+		}
+		if c.Exists != nil {
+			cc.op, cc.exists, ops = "exists", *c.Exists, ops+1
+		}
+		if c.Matches != "" {
+			re, err := regexp.Compile(c.Matches)
+			if err != nil {
+				return nil, fmt.Errorf("condition %q: %v", c.Path, err)
+			}
+			cc.op, cc.matches, ops = "matches", re, ops+1
+		}
+		if ops > 1 {
+			return nil, fmt.Errorf("condition %q: use one of equals, in, exists or matches", c.Path)
+		}
+		out = append(out, cc)
+	}
+	return out, nil
+}
+
+func (c compiledCondition) holds(doc interface{}) bool {
+	v, found := c.path.lookup(doc)
+	if c.op == "exists" {
+		return found == c.exists
+	}
+	if !found {
+		return false
+	}
+	s := stringify(v)
+	switch c.op {
+	case "equals":
+		return s == c.equals
+	case "in":
+		for _, want := range c.in {
+			if s == want {
+				return true
+			}
+		}
+		return false
+	default: // matches
+		return c.matches.MatchString(s)
+	}
+}
+
+func allHold(conds []compiledCondition, doc interface{}) bool {
+	for _, c := range conds {
+		if !c.holds(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Source is the name the mapping is registered under.
+func (g *Generic) Source() string { return g.source }
+
+// Config returns the mapping the adapter was compiled from.
+func (g *Generic) Config() MappingConfig { return g.cfg }
+
+func (g *Generic) Name() string { return "generic/" + g.source }
+
+func (g *Generic) Description() string {
+	return firstNonEmpty(g.cfg.Description, "Generic mapping for "+g.source)
+}
+
+// Parse applies the mapping.
+func (g *Generic) Parse(_ http.Header, body []byte) (*Event, error) {
+	ev, _, err := g.Evaluate(body)
+	return ev, err
+}
+
+// Evaluate applies the mapping and also returns the names (or indexes) of
+// the rules that matched, for dry runs.
+func (g *Generic) Evaluate(body []byte) (*Event, []string, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedPayload, err)
+	}
+	ev := &Event{Source: g.Name(), Type: g.event.string(doc), DeliveryID: g.id.string(doc)}
+	var matched []string
+	for i, r := range g.rules {
+		if !allHold(r.when, doc) {
+			continue
+		}
+		matched = append(matched, firstNonEmpty(r.name, strconv.Itoa(i)))
+		var err error
+		if r.kind == "deployment" {
+			err = g.deployment(r, doc, ev)
+		} else {
+			err = g.incident(r, doc, ev)
+		}
+		if err != nil {
+			return nil, matched, fmt.Errorf("%w: rule %s: %v", ErrMalformedPayload, matched[len(matched)-1], err)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil, fmt.Errorf("%w: no mapping rule matched", ErrUnsupportedEvent)
+	}
+	return ev, matched, nil
+}
+
+// values evaluates every field of a rule, plus its status.
+func (r compiledRule) values(doc interface{}) map[string]string {
+	out := make(map[string]string, len(r.fields)+1)
+	for field, e := range r.fields {
+		out[field] = e.string(doc)
+	}
+	for _, s := range r.status {
+		if allHold(s.when, doc) {
+			out["status"] = s.value
+			break
+		}
+	}
+	return out
+}
+
+func (g *Generic) deployment(r compiledRule, doc interface{}, ev *Event) error {
+	d, err := mappedDeployment(g.source, r.values(doc))
+	if err != nil {
+		return err
+	}
+	ev.Deployments = append(ev.Deployments, d)
+	return nil
+}
+
+func (g *Generic) incident(r compiledRule, doc interface{}, ev *Event) error {
+	inc, err := mappedIncident(g.source, r.values(doc))
+	if err != nil {
+		return err
+	}
+	ev.Incidents = append(ev.Incidents, inc)
+	return nil
+}
+
+// mappedDeployment builds a deployment from mapped field values, applying
+// the defaults and prefixing the id with source.
+func mappedDeployment(source string, v map[string]string) (metrics.Deployment, error) {
+	if v["id"] == "" || v["service"] == "" {
+		return metrics.Deployment{}, errors.New("id and service must not be empty")
+	}
+	status := metrics.DeploymentStatus(firstNonEmpty(v["status"], string(metrics.DeploymentStatusSuccess)))
+	if err := checkStatus("deployment", string(status)); err != nil {
+		return metrics.Deployment{}, err
+	}
+	times, err := mappedTimes(v, "start_time", "end_time", "commit_time")
+	if err != nil {
+		return metrics.Deployment{}, err
+	}
+	d := metrics.Deployment{
+		ID:          source + "-" + v["id"],
+		Service:     v["service"],
+		Environment: firstNonEmpty(v["environment"], "production"),
+		Version:     v["version"],
+		Status:      status,
+		StartTime:   firstTime(times["start_time"], time.Now().UTC()),
+		CommitSHA:   v["commit_sha"],
+		CommitTime:  times["commit_time"],
+		Author:      v["author"],
+		Repository:  repositoryPath(v["repository"]),
+		Branch:      v["branch"],
+		BuildURL:    v["build_url"],
+	}
+	if status.IsTerminal() {
+		end := firstTime(times["end_time"], time.Now().UTC())
+		d.EndTime = &end
+	}
+	return d, nil
+}
+
+// mappedIncident is mappedDeployment for incidents.
+func mappedIncident(source string, v map[string]string) (metrics.Incident, error) {
+	if v["id"] == "" || v["title"] == "" || v["service"] == "" {
+		return metrics.Incident{}, errors.New("id, title and service must not be empty")
+	}
+	status := firstNonEmpty(v["status"], "open")
+	if err := checkStatus("incident", status); err != nil {
+		return metrics.Incident{}, err
+	}
+	times, err := mappedTimes(v, "start_time", "resolved_time")
+	if err != nil {
+		return metrics.Incident{}, err
+	}
+	inc := metrics.Incident{
+		ID:          source + "-" + v["id"],
+		Title:       v["title"],
+		Description: v["description"],
+		Service:     v["service"],
+		Environment: firstNonEmpty(v["environment"], "production"),
+		Severity:    metrics.SeverityMedium,
+		StartTime:   firstTime(times["start_time"], time.Now().UTC()),
+		RootCause:   v["root_cause"],
+		Assignee:    v["assignee"],
+	}
+	if v["severity"] != "" {
+		inc.Severity = severityFromLabel(v["severity"])
+	}
+	if status == "resolved" || !times["resolved_time"].IsZero() {
+		resolved := firstTime(times["resolved_time"], time.Now().UTC())
+		inc.ResolvedTime = &resolved
+	}
+	return inc, nil
+}
+
+// mappedTimes parses the named time fields that are present.
+func mappedTimes(v map[string]string, names ...string) (map[string]time.Time, error) {
+	out := make(map[string]time.Time, len(names))
+	for _, name := range names {
+		if v[name] == "" {
+			continue
+		}
+		t, err := parseMappedTime(v[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		out[name] = t
+	}
+	return out, nil
+}
+
+// parseMappedTime accepts RFC 3339 and Unix seconds or milliseconds.
+func parseMappedTime(s string) (time.Time, error) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		return time.Unix(int64(n), 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+	}
+	return t.UTC(), nil
+}
+
+// expr is a compiled field expression: a JSONPath or a literal.
+type expr struct {
+	path    jsonPath
+	literal string
+	isPath  bool
+}
+
+func compileExpr(s string) (expr, error) {
+	if !strings.HasPrefix(s, "$") {
+		return expr{literal: s}, nil
+	}
+	p, err := parseJSONPath(s)
+	return expr{path: p, isPath: true}, err
+}
+
+func (e expr) string(doc interface{}) string {
+	if !e.isPath {
+		return e.literal
+	}
+	v, _ := e.path.lookup(doc)
+	return stringify(v)
+}
+
+// jsonPath is a parsed "$"-rooted path; each step is a key or an index.
+type jsonPath []pathStep
+
+type pathStep struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+func parseJSONPath(s string) (jsonPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("path %q must start with $", s)
+	}
+	var p jsonPath
+	rest := s[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q: empty field name", s)
+			}
+			p = append(p, pathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed [", s)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p = append(p, pathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("path %q: [%s] is neither an index nor a quoted name", s, inner)
+			}
+			p = append(p, pathStep{index: n, isIdx: true})
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", s, rest[0])
+		}
+	}
+	return p, nil
+}
+
+// lookup walks the path; negative indexes count from the end.
+func (p jsonPath) lookup(doc interface{}) (interface{}, bool) {
+	cur := doc
+	for _, st := range p {
+		if st.isIdx {
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			i := st.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			cur = arr[i]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[st.key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// stringify renders scalars as text and other values as compact JSON.
+func stringify(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+const acmeMapping = `{
+	"description": "Acme in-house deployer",
+	"token": "t0ken",
+	"event_type": "$.event",
+	"delivery_id": "$.run.id",
+	"rules": [
+		{
+			"name": "deploys",
+			"kind": "deployment",
+			"when": [{"path": "$.event", "in": ["deploy.started", "deploy.finished"]}],
+			"fields": {
+				"id": "$.run.id", "service": "$.app", "environment": "$.target['env name']",
+				"version": "$.artifact.tags[-1]", "commit_sha": "$.git.sha", "repository": "$.git.repo",
+				"start_time": "$.run.started", "end_time": "$.run.finished"
+			},
+			"status": [
+				{"value": "running", "when": [{"path": "$.event", "equals": "deploy.started"}]},
+				{"value": "success", "when": [{"path": "$.run.exit_code", "equals": 0}]},
+				{"value": "failed", "when": [{"path": "$.run.exit_code", "exists": true}]}
+			]
+		},
+		{
+			"name": "rollbacks open incidents",
+			"kind": "incident",
+			"when": [{"path": "$.event", "equals": "deploy.finished"}, {"path": "$.run.rollback", "equals": true}],
+			"fields": {"id": "$.run.id", "title": "Rollback", "service": "$.app", "severity": "high", "start_time": "$.run.finished"}
+		}
+	]
+}`
+
+func acmePayload(event, exitCode, rollback string) []byte {
+	return []byte(`{"event": "` + event + `", "app": "checkout",
+		"target": {"env name": "staging"}, "artifact": {"tags": ["latest", "1.4.2"]},
+		"git": {"sha": "9fceb02d0ae598e95dc970b74767f19372d61af8", "repo": "git@github.com:acme/checkout.git"},
+		"run": {"id": 812, "started": 1714557600, "finished": "2024-05-01T10:10:00Z", "exit_code": ` + exitCode + `, "rollback": ` + rollback + `}}`)
+}
+
+func TestGenericMapping(t *testing.T) {
+	g, err := CompileMapping("acme", []byte(acmeMapping))
+	if err != nil {
+		t.Fatalf("CompileMapping: %v", err)
+	}
+	ev, matched, err := g.Evaluate(acmePayload("deploy.finished", "0", "false"))
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if len(matched) != 1 || ev.Type != "deploy.finished" || ev.DeliveryID != "812" || len(ev.Incidents) != 0 {
+		t.Fatalf("unexpected event %+v matched=%v", ev, matched)
+	}
+	d := ev.Deployments[0]
+	if d.ID != "acme-812" || d.Service != "checkout" || d.Environment != "staging" || d.Version != "1.4.2" ||
+		d.Status != metrics.DeploymentStatusSuccess || d.Repository != "acme/checkout" ||
+		!d.StartTime.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) || d.EndTime == nil || d.EndTime.Sub(d.StartTime) != 10*time.Minute {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+
+	cases := []struct {
+		event, exit, rollback string
+		status                metrics.DeploymentStatus
+		incidents             int
+	}{
+		{"deploy.started", "null", "false", metrics.DeploymentStatusRunning, 0},
+		{"deploy.finished", "1", "true", metrics.DeploymentStatusFailed, 1},
+	}
+	for _, tc := range cases {
+		ev, _, err := g.Evaluate(acmePayload(tc.event, tc.exit, tc.rollback))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.event, err)
+		}
+		if ev.Deployments[0].Status != tc.status || len(ev.Incidents) != tc.incidents {
+			t.Errorf("%s exit=%s: status %s, %d incidents", tc.event, tc.exit, ev.Deployments[0].Status, len(ev.Incidents))
+		}
+	}
+	if _, _, err := g.Evaluate(acmePayload("build.finished", "0", "false")); !errors.Is(err, ErrUnsupportedEvent) {
+		t.Errorf("unmatched payload: got %v", err)
+	}
+	if err := g.Verify(http.Header{"X-Webhook-Token": {"t0ken"}}, nil); err != nil {
+		t.Errorf("token: %v", err)
+	}
+	if err := g.Verify(http.Header{}, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("missing token: got %v", err)
+	}
+}
+
+func TestCompileMappingErrors(t *testing.T) {
+	cases := []struct{ name, source, doc string }{
+		{"bad source", "Acme Corp", `{"rules": [{"kind": "deployment", "fields": {"id": "$.id", "service": "x"}}]}`},
+		{"no rules", "acme", `{"rules": []}`},
+		{"unknown key", "acme", `{"rulez": []}`},
+		{"unknown kind", "acme", `{"rules": [{"kind": "build", "fields": {"id": "$.id"}}]}`},
+		{"unknown field", "acme", `{"rules": [{"kind": "deployment", "fields": {"id": "$.id", "service": "x", "colour": "red"}}]}`},
+		{"missing required", "acme", `{"rules": [{"kind": "incident", "fields": {"id": "$.id", "service": "x"}}]}`},
+		{"bad path", "acme", `{"rules": [{"kind": "deployment", "fields": {"id": "$.runs[first]", "service": "x"}}]}`},
+		{"bad status", "acme", `{"rules": [{"kind": "deployment", "fields": {"id": "$.id", "service": "x"}, "status": [{"value": "done"}]}]}`},
+		{"two operators", "acme", `{"rules": [{"kind": "deployment", "fields": {"id": "$.id", "service": "x"}, "when": [{"path": "$.a", "equals": 1, "in": ["1"]}]}]}`},
+	}
+	for _, tc := range cases {
+		if _, err := CompileMapping(tc.source, []byte(tc.doc)); !errors.Is(err, ErrInvalidMapping) {
+			t.Errorf("%s: got %v want ErrInvalidMapping", tc.name, err)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]interface{}{"a": map[string]interface{}{"b c": []interface{}{"x", map[string]interface{}{"d": true}}}}
+	cases := []struct {
+		path  string
+		want  string
+		found bool
+	}{
+		{"$.a['b c'][0]", "x", true},
+		{`$.a["b c"][1].d`, "true", true},
+		{"$.a['b c'][-1].d", "true", true},
+		{"$.a['b c'][2]", "", false},
+		{"$.a.missing", "", false},
+		{"$.a['b c'][0].x", "", false},
+	}
+	for _, tc := range cases {
+		p, err := parseJSONPath(tc.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		v, found := p.lookup(doc)
+		if found != tc.found || stringify(v) != tc.want {
+			t.Errorf("%s = %q, %v", tc.path, stringify(v), found)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// GitHubConfig configures the GitHub adapter.
+type GitHubConfig struct {
+	// Secret is the webhook secret used for X-Hub-Signature-256. When empty,
+	// deliveries are accepted unverified (development only).
+	Secret string
+	// DeployWorkflows selects the workflow_run events that count as
+	// deployments, matched against the workflow name and path. Defaults to
+	// "(?i)deploy".
+	DeployWorkflows string
+	// WorkflowEnvironment is the environment recorded for workflow-run
+	// deployments, which carry none of their own. Defaults to "production".
+	WorkflowEnvironment string
+}
+
+// GitHub handles deployment, deployment_status, workflow_run, push and
+// pull_request deliveries.
+type GitHub struct {
+	secretVerifier
+	workflows   *regexp.Regexp
+	environment string
+}
+
+// NewGitHub builds the adapter, rejecting an invalid DeployWorkflows pattern.
+func NewGitHub(cfg GitHubConfig) (*GitHub, error) {
+	pattern := cfg.DeployWorkflows
+	if pattern == "" {
+		pattern = "(?i)deploy"
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("github deploy workflow pattern: %w", err)
+	}
+	env := cfg.WorkflowEnvironment
+	if env == "" {
+		env = "production"
+	}
+	return &GitHub{secretVerifier: secretVerifier{secret: []byte(cfg.Secret), scheme: HMACSHA256{Header: "X-Hub-Signature-256", Prefix: "sha256="}}, workflows: re, environment: env}, nil
+}
+
+func (g *GitHub) Name() string { return "github" }
+
+func (g *GitHub) Description() string {
+	return "GitHub deployments, workflow runs, pushes and merged pull requests"
+}
+
+type ghUser struct {
+	Login string `json:"login"`
+}
+
+type ghRepository struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+type ghDeployment struct {
+	ID          int64     `json:"id"`
+	SHA         string    `json:"sha"`
+	Ref         string    `json:"ref"`
+	Environment string    `json:"environment"`
+	Creator     ghUser    `json:"creator"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ghDeploymentStatus struct {
+	State     string    `json:"state"`
+	TargetURL string    `json:"target_url"`
+	LogURL    string    `json:"log_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ghCommitAuthor struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+type ghCommit struct {
+	ID        string         `json:"id"`
+	Message   string         `json:"message"`
+	Timestamp time.Time      `json:"timestamp"`
+	Author    ghCommitAuthor `json:"author"`
+}
+
+type ghWorkflowRun struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	HeadBranch   string    `json:"head_branch"`
+	HeadSHA      string    `json:"head_sha"`
+	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion"`
+	HTMLURL      string    `json:"html_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	RunStartedAt time.Time `json:"run_started_at"`
+	Actor        ghUser    `json:"actor"`
+	HeadCommit   *ghCommit `json:"head_commit"`
+}
+
+type ghPullRequest struct {
+	Merged         bool       `json:"merged"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+	MergedAt       *time.Time `json:"merged_at"`
+	Title          string     `json:"title"`
+	User           ghUser     `json:"user"`
+}
+
+type ghPayload struct {
+	Action           string              `json:"action"`
+	Repository       ghRepository        `json:"repository"`
+	Sender           ghUser              `json:"sender"`
+	Deployment       *ghDeployment       `json:"deployment"`
+	DeploymentStatus *ghDeploymentStatus `json:"deployment_status"`
+	WorkflowRun      *ghWorkflowRun      `json:"workflow_run"`
+	Ref              string              `json:"ref"`
+	Deleted          bool                `json:"deleted"`
+	Commits          []ghCommit          `json:"commits"`
+	PullRequest      *ghPullRequest      `json:"pull_request"`
+}
+
+// Parse dispatches on X-GitHub-Event.
+func (g *GitHub) Parse(h http.Header, body []byte) (*Event, error) {
+	ev := &Event{Source: g.Name(), Type: h.Get("X-GitHub-Event"), DeliveryID: h.Get("X-GitHub-Delivery")}
+	var p ghPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPayload, err)
+	}
+	var err error
+	switch ev.Type {
+	case "deployment":
+		err = g.parseDeployment(ev, &p)
+	case "deployment_status":
+		err = g.parseDeploymentStatus(ev, &p)
+	case "workflow_run":
+		err = g.parseWorkflowRun(ev, &p)
+	case "push":
+		err = g.parsePush(ev, &p)
+	case "pull_request":
+		err = g.parsePullRequest(ev, &p)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnsupportedEvent, ev.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+func (g *GitHub) deployment(p *ghPayload) metrics.Deployment {
+	d := p.Deployment
+	return metrics.Deployment{
+		ID:          "gh-deploy-" + strconv.FormatInt(d.ID, 10),
+		Service:     p.Repository.Name,
+		Environment: d.Environment,
+		Version:     d.Ref,
+		Status:      metrics.DeploymentStatusPending,
+		StartTime:   d.CreatedAt,
+		CommitSHA:   d.SHA,
+		Author:      d.Creator.Login,
+		Repository:  p.Repository.FullName,
+		Branch:      d.Ref,
+	}
+}
+
+func (g *GitHub) parseDeployment(ev *Event, p *ghPayload) error {
+	if p.Deployment == nil {
+		return fmt.Errorf("%w: missing deployment", ErrMalformedPayload)
+	}
+	ev.Deployments = append(ev.Deployments, g.deployment(p))
+	return nil
+}
+
+// deploymentStates maps GitHub deployment status states; "inactive" (a
+// superseded deployment) is deliberately absent and ignored.
+var deploymentStates = map[string]metrics.DeploymentStatus{
+	"queued":      metrics.DeploymentStatusPending,
+	"pending":     metrics.DeploymentStatusPending,
+	"in_progress": metrics.DeploymentStatusRunning,
+	"success":     metrics.DeploymentStatusSuccess,
+	"failure":     metrics.DeploymentStatusFailed,
+	"error":       metrics.DeploymentStatusFailed,
+}
+
+func (g *GitHub) parseDeploymentStatus(ev *Event, p *ghPayload) error {
+	if p.Deployment == nil || p.DeploymentStatus == nil {
+		return fmt.Errorf("%w: missing deployment or deployment_status", ErrMalformedPayload)
+	}
+	st := p.DeploymentStatus
+	status, ok := deploymentStates[st.State]
+	if !ok {
+		return fmt.Errorf("%w: deployment state %q", ErrUnsupportedEvent, st.State)
+	}
+	d := g.deployment(p)
+	d.Status = status
+	if status.IsTerminal() {
+		end := st.CreatedAt
+		d.EndTime = &end
+	}
+	d.BuildURL = firstNonEmpty(st.LogURL, st.TargetURL)
+	ev.Deployments = append(ev.Deployments, d)
+	return nil
+}
+
+// workflowConclusions maps completed workflow_run conclusions; neutral,
+// skipped, stale and action_required runs did not deploy and are ignored.
+var workflowConclusions = map[string]metrics.DeploymentStatus{
+	"success":         metrics.DeploymentStatusSuccess,
+	"failure":         metrics.DeploymentStatusFailed,
+	"timed_out":       metrics.DeploymentStatusFailed,
+	"startup_failure": metrics.DeploymentStatusFailed,
+	"cancelled":       metrics.DeploymentStatusCancelled,
+}
+
+func (g *GitHub) parseWorkflowRun(ev *Event, p *ghPayload) error {
+	run := p.WorkflowRun
+	if run == nil {
+		return fmt.Errorf("%w: missing workflow_run", ErrMalformedPayload)
+	}
+	if !g.workflows.MatchString(run.Name) && !g.workflows.MatchString(run.Path) {
+		return fmt.Errorf("%w: workflow %q is not a deployment workflow", ErrUnsupportedEvent, run.Name)
+	}
+	var status metrics.DeploymentStatus
+	switch run.Status {
+	case "completed":
+		var ok bool
+		if status, ok = workflowConclusions[run.Conclusion]; !ok {
+			return fmt.Errorf("%w: workflow conclusion %q", ErrUnsupportedEvent, run.Conclusion)
+		}
+	case "in_progress":
+		status = metrics.DeploymentStatusRunning
+	default: // requested, queued, waiting, pending
+		status = metrics.DeploymentStatusPending
+	}
+	started := run.RunStartedAt
+	if started.IsZero() {
+		started = run.CreatedAt
+	}
+	d := metrics.Deployment{
+		ID:          "gh-run-" + strconv.FormatInt(run.ID, 10),
+		Service:     p.Repository.Name,
+		Environment: g.environment,
+		Version:     shortSHA(run.HeadSHA),
+		Status:      status,
+		StartTime:   started,
+		CommitSHA:   run.HeadSHA,
+		Author:      run.Actor.Login,
+		Repository:  p.Repository.FullName,
+		Branch:      run.HeadBranch,
+		BuildURL:    run.HTMLURL,
+	}
+	if status.IsTerminal() {
+		end := run.UpdatedAt
+		d.EndTime = &end
+	}
+	if hc := run.HeadCommit; hc != nil && hc.ID == run.HeadSHA {
+		d.CommitTime = hc.Timestamp
+		ev.Commits = append(ev.Commits, commitFrom(p.Repository.FullName, hc))
+	}
+	ev.Deployments = append(ev.Deployments, d)
+	return nil
+}
+
+func (g *GitHub) parsePush(ev *Event, p *ghPayload) error {
+	if p.Deleted || len(p.Commits) == 0 {
+		return fmt.Errorf("%w: push without commits", ErrUnsupportedEvent)
+	}
+	for i := range p.Commits {
+		ev.Commits = append(ev.Commits, commitFrom(p.Repository.FullName, &p.Commits[i]))
+	}
+	return nil
+}
+
+func (g *GitHub) parsePullRequest(ev *Event, p *ghPayload) error {
+	pr := p.PullRequest
+	if pr == nil {
+		return fmt.Errorf("%w: missing pull_request", ErrMalformedPayload)
+	}
+	if p.Action != "closed" || !pr.Merged || pr.MergeCommitSHA == "" || pr.MergedAt == nil {
+		return fmt.Errorf("%w: pull_request %s is not a merge", ErrUnsupportedEvent, p.Action)
+	}
+	ev.Commits = append(ev.Commits, metrics.Commit{
+		Repository:  p.Repository.FullName,
+		SHA:         pr.MergeCommitSHA,
+		Author:      pr.User.Login,
+		Message:     pr.Title,
+		AuthoredAt:  *pr.MergedAt,
+		CommittedAt: *pr.MergedAt,
+	})
+	return nil
+}
+
+func commitFrom(repository string, c *ghCommit) metrics.Commit {
+	return metrics.Commit{
+		Repository:  repository,
+		SHA:         c.ID,
+		Author:      firstNonEmpty(c.Author.Username, c.Author.Name),
+		Message:     c.Message,
+		AuthoredAt:  c.Timestamp,
+		CommittedAt: c.Timestamp,
+	}
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+const (
+	ghDeploymentStatusPayload = `{
+		"action": "created",
+		"deployment_status": {"state": "success", "log_url": "https://ci.example.com/run/7", "created_at": "2024-05-01T10:05:00Z"},
+		"deployment": {"id": 42, "sha": "abc123", "ref": "main", "environment": "production",
+			"creator": {"login": "octocat"}, "created_at": "2024-05-01T10:00:00Z"},
+		"repository": {"name": "api", "full_name": "acme/api"}
+	}`
+	ghWorkflowRunPayload = `{
+		"action": "completed",
+		"workflow_run": {"id": 9, "name": "Deploy", "path": ".github/workflows/deploy.yml",
+			"head_branch": "main", "head_sha": "def456", "status": "completed", "conclusion": "failure",
+			"html_url": "https://github.com/acme/api/actions/runs/9",
+			"run_started_at": "2024-05-01T11:00:00Z", "updated_at": "2024-05-01T11:07:00Z",
+			"actor": {"login": "hubot"},
+			"head_commit": {"id": "def456", "message": "fix", "timestamp": "2024-05-01T09:30:00Z", "author": {"name": "Hu Bot"}}},
+		"repository": {"name": "api", "full_name": "acme/api"}
+	}`
+	ghPushPayload = `{
+		"ref": "refs/heads/main",
+		"commits": [{"id": "abc123", "message": "feat", "timestamp": "2024-05-01T08:00:00Z", "author": {"name": "Octo", "username": "octocat"}}],
+		"repository": {"name": "api", "full_name": "acme/api"}
+	}`
+)
+
+func ghHeaders(event string) http.Header {
+	h := http.Header{}
+	h.Set("X-GitHub-Event", event)
+	h.Set("X-GitHub-Delivery", "delivery-1")
+	return h
+}
+
+func newGitHub(t *testing.T, cfg GitHubConfig) *GitHub {
+	t.Helper()
+	g, err := NewGitHub(cfg)
+	if err != nil {
+		t.Fatalf("NewGitHub: %v", err)
+	}
+	return g
+}
+
+func TestGitHubVerify(t *testing.T) {
+	body := []byte(`{"zen":"hi"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	valid := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	g := newGitHub(t, GitHubConfig{Secret: "s3cret"})
+	cases := []struct {
+		name string
+		sig  string
+		ok   bool
+	}{
+		{"valid", valid, true},
+		{"missing", "", false},
+		{"wrong prefix", "sha1=" + valid[7:], false},
+		{"not hex", "sha256=zz", false},
+		{"mismatch", "sha256=" + hex.EncodeToString(make([]byte, 32)), false},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		if tc.sig != "" {
+			h.Set("X-Hub-Signature-256", tc.sig)
+		}
+		err := g.Verify(h, body)
+		if tc.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v want ErrInvalidSignature", tc.name, err)
+		}
+	}
+	if err := newGitHub(t, GitHubConfig{}).Verify(http.Header{}, body); err != nil {
+		t.Errorf("no secret configured: got %v want nil", err)
+	}
+}
+
+func TestGitHubParseDeploymentStatus(t *testing.T) {
+	ev, err := newGitHub(t, GitHubConfig{}).Parse(ghHeaders("deployment_status"), []byte(ghDeploymentStatusPayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(ev.Deployments) != 1 {
+		t.Fatalf("deployments = %d want 1", len(ev.Deployments))
+	}
+	d := ev.Deployments[0]
+	if d.ID != "gh-deploy-42" || d.Status != metrics.DeploymentStatusSuccess || d.Repository != "acme/api" ||
+		d.Service != "api" || d.CommitSHA != "abc123" || d.Author != "octocat" || d.BuildURL != "https://ci.example.com/run/7" {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if d.EndTime == nil || !d.EndTime.Equal(time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC)) {
+		t.Errorf("end time = %v", d.EndTime)
+	}
+	if ev.DeliveryID != "delivery-1" {
+		t.Errorf("delivery id = %q", ev.DeliveryID)
+	}
+}
+
+func TestGitHubParseWorkflowRun(t *testing.T) {
+	g := newGitHub(t, GitHubConfig{WorkflowEnvironment: "prod"})
+	ev, err := g.Parse(ghHeaders("workflow_run"), []byte(ghWorkflowRunPayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	d := ev.Deployments[0]
+	if d.Status != metrics.DeploymentStatusFailed || d.Environment != "prod" || d.Branch != "main" ||
+		d.BuildURL != "https://github.com/acme/api/actions/runs/9" {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if !d.CommitTime.Equal(time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("commit time = %v", d.CommitTime)
+	}
+	if len(ev.Commits) != 1 || ev.Commits[0].SHA != "def456" {
+		t.Errorf("commits = %+v", ev.Commits)
+	}
+
+	g = newGitHub(t, GitHubConfig{DeployWorkflows: "^release$"})
+	if _, err := g.Parse(ghHeaders("workflow_run"), []byte(ghWorkflowRunPayload)); !errors.Is(err, ErrUnsupportedEvent) {
+		t.Errorf("non-matching workflow: got %v want ErrUnsupportedEvent", err)
+	}
+}
+
+func TestGitHubParseIgnoredAndMalformed(t *testing.T) {
+	g := newGitHub(t, GitHubConfig{})
+	cases := []struct {
+		event, body string
+		want        error
+	}{
+		{"ping", `{"zen":"hi"}`, ErrUnsupportedEvent},
+		{"deployment_status", `{"deployment_status":{"state":"inactive"},"deployment":{"id":1}}`, ErrUnsupportedEvent},
+		{"pull_request", `{"action":"closed","pull_request":{"merged":false}}`, ErrUnsupportedEvent},
+		{"push", `{"deleted":true}`, ErrUnsupportedEvent},
+		{"deployment", `{}`, ErrMalformedPayload},
+		{"push", `{"commits":`, ErrMalformedPayload},
+	}
+	for _, tc := range cases {
+		if _, err := g.Parse(ghHeaders(tc.event), []byte(tc.body)); !errors.Is(err, tc.want) {
+			t.Errorf("%s %s: got %v want %v", tc.event, tc.body, err, tc.want)
+		}
+	}
+}
+
+func TestProcessorUsesStoredCommitTime(t *testing.T) {
+	g := newGitHub(t, GitHubConfig{})
+	p := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	ctx := context.Background()
+
+	push, err := g.Parse(ghHeaders("push"), []byte(ghPushPayload))
+	if err != nil {
+		t.Fatalf("Parse push: %v", err)
+	}
+	if _, err := p.Process(ctx, push); err != nil {
+		t.Fatalf("Process push: %v", err)
+	}
+	ev, err := g.Parse(ghHeaders("deployment_status"), []byte(ghDeploymentStatusPayload))
+	if err != nil {
+		t.Fatalf("Parse deployment_status: %v", err)
+	}
+	res, err := p.Process(ctx, ev)
+	if err != nil || res.Deployments != 1 {
+		t.Fatalf("Process deployment_status: res=%+v err=%v", res, err)
+	}
+
+	deps, _ := p.Deployments.ListRange(ctx, time.Time{}, time.Now())
+	if len(deps) != 1 {
+		t.Fatalf("stored deployments = %d want 1", len(deps))
+	}
+	if want := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC); !deps[0].CommitTime.Equal(want) {
+		t.Errorf("commit time = %v want %v", deps[0].CommitTime, want)
+	}
+	if deps[0].LeadTime() != 2*time.Hour+5*time.Minute {
+		t.Errorf("lead time = %v", deps[0].LeadTime())
+	}
+
+	// A redelivered earlier "pending" state must not regress the finished deployment.
+	again, _ := g.Parse(ghHeaders("deployment"), []byte(ghDeploymentStatusPayload))
+	if _, err := p.Process(ctx, again); err != nil {
+		t.Fatalf("Process deployment: %v", err)
+	}
+	deps, _ = p.Deployments.ListRange(ctx, time.Time{}, time.Now())
+	if len(deps) != 1 || deps[0].Status != metrics.DeploymentStatusSuccess {
+		t.Errorf("after redelivery: %+v", deps)
+	}
+}
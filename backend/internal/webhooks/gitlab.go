@@ -0,0 +1,319 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// GitLabConfig configures the GitLab adapter.
+type GitLabConfig struct {
+	// Token is the secret token configured on the webhook and sent back in
+	// X-Gitlab-Token. When empty, deliveries are accepted unverified
+	// (development only).
+	Token string
+}
+
+// GitLab handles Deployment Hook, Pipeline Hook and Merge Request Hook
+// deliveries.
+type GitLab struct{ secretVerifier }
+
+// NewGitLab builds the adapter.
+func NewGitLab(cfg GitLabConfig) *GitLab {
+	return &GitLab{secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: SharedToken{Header: "X-Gitlab-Token"}}}
+}
+
+func (g *GitLab) Name() string { return "gitlab" }
+
+func (g *GitLab) Description() string {
+	return "GitLab deployments, pipelines and merged merge requests"
+}
+
+// glTime accepts the timestamp layouts GitLab mixes across hooks:
+// "2021-04-28 21:50:00 +0200", "2016-08-12 15:23:28 UTC" and RFC 3339.
+type glTime struct{ time.Time }
+
+var glTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05 MST"}
+
+func (t *glTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		return err
+	}
+	for _, layout := range glTimeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognized GitLab timestamp %q", s)
+}
+
+type glUser struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+type glProject struct {
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+}
+
+type glCommit struct {
+	ID        string `json:"id"`
+	Message   string `json:"message"`
+	Title     string `json:"title"`
+	Timestamp glTime `json:"timestamp"`
+	Author    struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+type glBuild struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Stage       string `json:"stage"`
+	Status      string `json:"status"`
+	CreatedAt   glTime `json:"created_at"`
+	StartedAt   glTime `json:"started_at"`
+	FinishedAt  glTime `json:"finished_at"`
+	Environment *struct {
+		Name   string `json:"name"`
+		Action string `json:"action"`
+	} `json:"environment"`
+}
+
+type glPipeline struct {
+	ID         int64  `json:"id"`
+	Ref        string `json:"ref"`
+	SHA        string `json:"sha"`
+	Status     string `json:"status"`
+	URL        string `json:"url"`
+	CreatedAt  glTime `json:"created_at"`
+	FinishedAt glTime `json:"finished_at"`
+}
+
+type glMergeRequest struct {
+	IID             int64     `json:"iid"`
+	Title           string    `json:"title"`
+	Action          string    `json:"action"`
+	State           string    `json:"state"`
+	MergeCommitSHA  string    `json:"merge_commit_sha"`
+	SquashCommitSHA string    `json:"squash_commit_sha"`
+	UpdatedAt       glTime    `json:"updated_at"`
+	LastCommit      *glCommit `json:"last_commit"`
+}
+
+// glDeploymentHook is the flat Deployment Hook payload.
+type glDeploymentHook struct {
+	Status          string    `json:"status"`
+	StatusChangedAt glTime    `json:"status_changed_at"`
+	DeploymentID    int64     `json:"deployment_id"`
+	DeployableURL   string    `json:"deployable_url"`
+	Environment     string    `json:"environment"`
+	Project         glProject `json:"project"`
+	ShortSHA        string    `json:"short_sha"`
+	User            glUser    `json:"user"`
+	CommitURL       string    `json:"commit_url"`
+	Ref             string    `json:"ref"`
+}
+
+type glPipelineHook struct {
+	ObjectAttributes glPipeline `json:"object_attributes"`
+	User             glUser     `json:"user"`
+	Project          glProject  `json:"project"`
+	Commit           *glCommit  `json:"commit"`
+	Builds           []glBuild  `json:"builds"`
+}
+
+type glMergeRequestHook struct {
+	ObjectAttributes glMergeRequest `json:"object_attributes"`
+	User             glUser         `json:"user"`
+	Project          glProject      `json:"project"`
+}
+
+// gitlabStatuses maps job and deployment statuses; skipped and manual jobs
+// never ran and are ignored.
+var gitlabStatuses = map[string]metrics.DeploymentStatus{
+	"created":              metrics.DeploymentStatusPending,
+	"waiting_for_resource": metrics.DeploymentStatusPending,
+	"preparing":            metrics.DeploymentStatusPending,
+	"pending":              metrics.DeploymentStatusPending,
+	"blocked":              metrics.DeploymentStatusPending,
+	"running":              metrics.DeploymentStatusRunning,
+	"success":              metrics.DeploymentStatusSuccess,
+	"failed":               metrics.DeploymentStatusFailed,
+	"canceled":             metrics.DeploymentStatusCancelled,
+}
+
+// Parse dispatches on X-Gitlab-Event.
+func (g *GitLab) Parse(h http.Header, body []byte) (*Event, error) {
+	ev := &Event{Source: g.Name(), Type: h.Get("X-Gitlab-Event"), DeliveryID: firstNonEmpty(h.Get("X-Gitlab-Webhook-UUID"), h.Get("X-Gitlab-Event-UUID"))}
+	var err error
+	switch ev.Type {
+	case "Deployment Hook":
+		err = g.parseDeployment(ev, body)
+	case "Pipeline Hook":
+		err = g.parsePipeline(ev, body)
+	case "Merge Request Hook":
+		err = g.parseMergeRequest(ev, body)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnsupportedEvent, ev.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+func decode(body []byte, dst interface{}) error {
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedPayload, err)
+	}
+	return nil
+}
+
+func (g *GitLab) parseDeployment(ev *Event, body []byte) error {
+	var p glDeploymentHook
+	if err := decode(body, &p); err != nil {
+		return err
+	}
+	if p.DeploymentID == 0 || p.Environment == "" {
+		return fmt.Errorf("%w: missing deployment_id or environment", ErrMalformedPayload)
+	}
+	status, ok := gitlabStatuses[p.Status]
+	if !ok {
+		return fmt.Errorf("%w: deployment status %q", ErrUnsupportedEvent, p.Status)
+	}
+	// The hook only carries the short SHA; the full one ends the commit URL.
+	sha := p.ShortSHA
+	if tail := path.Base(p.CommitURL); strings.HasPrefix(tail, p.ShortSHA) {
+		sha = tail
+	}
+	d := metrics.Deployment{
+		ID:          "gl-deploy-" + strconv.FormatInt(p.DeploymentID, 10),
+		Service:     p.Project.Name,
+		Environment: p.Environment,
+		Version:     p.ShortSHA,
+		Status:      status,
+		StartTime:   p.StatusChangedAt.Time,
+		CommitSHA:   sha,
+		Author:      firstNonEmpty(p.User.Username, p.User.Name),
+		Repository:  p.Project.PathWithNamespace,
+		Branch:      p.Ref,
+		BuildURL:    p.DeployableURL,
+	}
+	if status.IsTerminal() {
+		end := p.StatusChangedAt.Time
+		d.EndTime = &end
+	}
+	ev.Deployments = append(ev.Deployments, d)
+	return nil
+}
+
+// parsePipeline records one deployment per job that starts an environment;
+// pipelines without such a job are not deployments and are ignored.
+func (g *GitLab) parsePipeline(ev *Event, body []byte) error {
+	var p glPipelineHook
+	if err := decode(body, &p); err != nil {
+		return err
+	}
+	pl := p.ObjectAttributes
+	if pl.ID == 0 || pl.SHA == "" {
+		return fmt.Errorf("%w: missing pipeline id or sha", ErrMalformedPayload)
+	}
+	repo := p.Project.PathWithNamespace
+	for _, b := range p.Builds {
+		if b.Environment == nil || b.Environment.Name == "" || (b.Environment.Action != "" && b.Environment.Action != "start") {
+			continue
+		}
+		status, ok := gitlabStatuses[b.Status]
+		if !ok {
+			continue
+		}
+		started := firstTime(b.StartedAt.Time, b.CreatedAt.Time, pl.CreatedAt.Time)
+		d := metrics.Deployment{
+			ID:          fmt.Sprintf("gl-pipeline-%d-%d", pl.ID, b.ID),
+			Service:     p.Project.Name,
+			Environment: b.Environment.Name,
+			Version:     shortSHA(pl.SHA),
+			Status:      status,
+			StartTime:   started,
+			CommitSHA:   pl.SHA,
+			Author:      firstNonEmpty(p.User.Username, p.User.Name),
+			Repository:  repo,
+			Branch:      pl.Ref,
+			BuildURL:    pl.URL,
+		}
+		if status.IsTerminal() {
+			end := firstTime(b.FinishedAt.Time, pl.FinishedAt.Time, started)
+			d.EndTime = &end
+		}
+		ev.Deployments = append(ev.Deployments, d)
+	}
+	if len(ev.Deployments) == 0 {
+		return fmt.Errorf("%w: pipeline %d has no deployment jobs", ErrUnsupportedEvent, pl.ID)
+	}
+	if c := p.Commit; c != nil && c.ID == pl.SHA && !c.Timestamp.IsZero() {
+		for i := range ev.Deployments {
+			ev.Deployments[i].CommitTime = c.Timestamp.Time
+		}
+		ev.Commits = append(ev.Commits, metrics.Commit{
+			Repository:  repo,
+			SHA:         c.ID,
+			Author:      c.Author.Name,
+			Message:     firstNonEmpty(c.Title, c.Message),
+			AuthoredAt:  c.Timestamp.Time,
+			CommittedAt: c.Timestamp.Time,
+		})
+	}
+	return nil
+}
+
+// parseMergeRequest records the commit a merge produced, timestamped with the
+// merge, so deployments of it measure lead time from the merge.
+func (g *GitLab) parseMergeRequest(ev *Event, body []byte) error {
+	var p glMergeRequestHook
+	if err := decode(body, &p); err != nil {
+		return err
+	}
+	mr := p.ObjectAttributes
+	if mr.Action != "merge" || mr.State != "merged" {
+		return fmt.Errorf("%w: merge request action %q", ErrUnsupportedEvent, mr.Action)
+	}
+	sha := firstNonEmpty(mr.MergeCommitSHA, mr.SquashCommitSHA)
+	if sha == "" && mr.LastCommit != nil { // fast-forward merge
+		sha = mr.LastCommit.ID
+	}
+	if sha == "" || mr.UpdatedAt.IsZero() {
+		return fmt.Errorf("%w: merged merge request without commit or time", ErrMalformedPayload)
+	}
+	authored := mr.UpdatedAt.Time
+	if mr.LastCommit != nil && !mr.LastCommit.Timestamp.IsZero() {
+		authored = mr.LastCommit.Timestamp.Time
+	}
+	ev.Commits = append(ev.Commits, metrics.Commit{
+		Repository:  p.Project.PathWithNamespace,
+		SHA:         sha,
+		Author:      firstNonEmpty(p.User.Username, p.User.Name),
+		Message:     mr.Title,
+		AuthoredAt:  authored,
+		CommittedAt: mr.UpdatedAt.Time,
+	})
+	return nil
+}
+
+func firstTime(values ...time.Time) time.Time {
+	for _, v := range values {
+		if !v.IsZero() {
+			return v
+		}
+	}
+	return time.Time{}
+}
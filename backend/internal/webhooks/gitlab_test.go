@@ -0,0 +1,134 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+const (
+	glDeploymentPayload = `{
+		"object_kind": "deployment", "status": "success", "status_changed_at": "2021-04-28 21:50:00 +0200",
+		"deployment_id": 15, "deployable_url": "https://gitlab.example.com/acme/api/-/jobs/796",
+		"environment": "staging", "project": {"name": "api", "path_with_namespace": "acme/api"},
+		"short_sha": "279484c0", "user": {"name": "Administrator", "username": "root"},
+		"commit_url": "https://gitlab.example.com/acme/api/-/commit/279484c09fbe69ededfced8c1bb6e6d24616b468",
+		"ref": "main"
+	}`
+	glPipelinePayload = `{
+		"object_kind": "pipeline",
+		"object_attributes": {"id": 31, "ref": "main", "sha": "bcbb5ec396a2c0f828686f14fac9b80b780504f2",
+			"status": "failed", "url": "https://gitlab.example.com/acme/api/-/pipelines/31",
+			"created_at": "2016-08-12 15:23:28 UTC", "finished_at": "2016-08-12 15:26:29 UTC"},
+		"user": {"name": "Administrator", "username": "root"},
+		"project": {"name": "api", "path_with_namespace": "acme/api"},
+		"commit": {"id": "bcbb5ec396a2c0f828686f14fac9b80b780504f2", "title": "test", "timestamp": "2016-08-12T17:23:21+02:00",
+			"author": {"name": "User"}},
+		"builds": [
+			{"id": 380, "stage": "deploy", "name": "production", "status": "failed",
+				"started_at": "2016-08-12 15:25:00 UTC", "finished_at": "2016-08-12 15:26:00 UTC",
+				"environment": {"name": "production", "action": "start"}},
+			{"id": 381, "stage": "deploy", "name": "review", "status": "manual",
+				"environment": {"name": "review/main", "action": "start"}},
+			{"id": 382, "stage": "cleanup", "name": "stop", "status": "success",
+				"environment": {"name": "review/old", "action": "stop"}},
+			{"id": 377, "stage": "test", "name": "test", "status": "success"}
+		]
+	}`
+	glMergeRequestPayload = `{
+		"object_kind": "merge_request", "user": {"username": "root"},
+		"project": {"name": "api", "path_with_namespace": "acme/api"},
+		"object_attributes": {"iid": 1, "title": "MS-Viewport", "action": "merge", "state": "merged",
+			"merge_commit_sha": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7", "updated_at": "2013-12-03 17:23:34 UTC",
+			"last_commit": {"id": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7", "timestamp": "2013-12-03T17:00:00+00:00"}}
+	}`
+)
+
+func glHeaders(event string) http.Header {
+	h := http.Header{}
+	h.Set("X-Gitlab-Event", event)
+	h.Set("X-Gitlab-Token", "t0ken")
+	return h
+}
+
+func TestGitLabVerify(t *testing.T) {
+	g := NewGitLab(GitLabConfig{Token: "t0ken"})
+	if err := g.Verify(glHeaders("Push Hook"), nil); err != nil {
+		t.Errorf("matching token: %v", err)
+	}
+	if err := g.Verify(http.Header{"X-Gitlab-Token": {"nope"}}, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong token: got %v", err)
+	}
+	if err := g.Verify(http.Header{}, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("missing token: got %v", err)
+	}
+}
+
+func TestGitLabParseDeployment(t *testing.T) {
+	ev, err := NewGitLab(GitLabConfig{}).Parse(glHeaders("Deployment Hook"), []byte(glDeploymentPayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	d := ev.Deployments[0]
+	if d.ID != "gl-deploy-15" || d.Status != metrics.DeploymentStatusSuccess || d.Environment != "staging" ||
+		d.CommitSHA != "279484c09fbe69ededfced8c1bb6e6d24616b468" || d.Repository != "acme/api" || d.Author != "root" {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if want := time.Date(2021, 4, 28, 19, 50, 0, 0, time.UTC); d.EndTime == nil || !d.EndTime.Equal(want) {
+		t.Errorf("end time = %v want %v", d.EndTime, want)
+	}
+}
+
+func TestGitLabParsePipeline(t *testing.T) {
+	ev, err := NewGitLab(GitLabConfig{}).Parse(glHeaders("Pipeline Hook"), []byte(glPipelinePayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(ev.Deployments) != 1 {
+		t.Fatalf("deployments = %+v, want only the production job", ev.Deployments)
+	}
+	d := ev.Deployments[0]
+	if d.Environment != "production" || d.Status != metrics.DeploymentStatusFailed || d.ID != "gl-pipeline-31-380" {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if want := time.Date(2016, 8, 12, 15, 23, 21, 0, time.UTC); !d.CommitTime.Equal(want) {
+		t.Errorf("commit time = %v want %v", d.CommitTime, want)
+	}
+	if d.EndTime == nil || d.EndTime.Sub(d.StartTime) != time.Minute {
+		t.Errorf("start=%v end=%v", d.StartTime, d.EndTime)
+	}
+	if len(ev.Commits) != 1 {
+		t.Errorf("commits = %+v", ev.Commits)
+	}
+}
+
+func TestGitLabParseMergeRequestAndIgnored(t *testing.T) {
+	g := NewGitLab(GitLabConfig{})
+	ev, err := g.Parse(glHeaders("Merge Request Hook"), []byte(glMergeRequestPayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	c := ev.Commits[0]
+	if c.SHA != "da1560886d4f094c3e6c9ef40349f7d38b5d27d7" || !c.CommittedAt.Equal(time.Date(2013, 12, 3, 17, 23, 34, 0, time.UTC)) {
+		t.Errorf("unexpected commit %+v", c)
+	}
+
+	cases := []struct {
+		event, body string
+		want        error
+	}{
+		{"Push Hook", `{}`, ErrUnsupportedEvent},
+		{"Merge Request Hook", `{"object_attributes":{"action":"open","state":"opened"}}`, ErrUnsupportedEvent},
+		{"Pipeline Hook", `{"object_attributes":{"id":1,"sha":"abc"},"builds":[{"id":2,"status":"success"}]}`, ErrUnsupportedEvent},
+		{"Deployment Hook", `{"deployment_id":1}`, ErrMalformedPayload},
+		{"Pipeline Hook", `{"object_attributes":{"id":1,"sha":"abc","created_at":"yesterday"}}`, ErrMalformedPayload},
+	}
+	for _, tc := range cases {
+		if _, err := g.Parse(glHeaders(tc.event), []byte(tc.body)); !errors.Is(err, tc.want) {
+			t.Errorf("%s %s: got %v want %v", tc.event, tc.body, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+// ErrUnknownSource is returned by a Resolver for sources that no longer
+// exist, such as a deleted generic mapping; their deliveries cannot succeed.
+var ErrUnknownSource = errors.New("webhooks: unknown source")
+
+// Resolver finds the adapter for a stored delivery's source name.
+type Resolver func(ctx context.Context, source string) (Adapter, error)
+
+// InboxConfig tunes the inbox workers; zero values take the defaults.
+type InboxConfig struct {
+	// Workers is the number of concurrent processors (default 4).
+	Workers int
+	// MaxAttempts before a delivery is dead-lettered (default 8).
+	MaxAttempts int
+	// RetryBase is the first retry delay, doubled per attempt up to
+	// RetryMax (defaults 5s and 15m), with ±20% jitter.
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// PollInterval bounds how long due retries wait to be noticed (default 1s).
+	PollInterval time.Duration
+	// Lease is how long a claimed delivery stays invisible to other workers
+	// before it is retried, covering crashed processes (default 2m).
+	Lease time.Duration
+	// Retention is how long done and ignored deliveries are kept (default
+	// 7 days). Dead deliveries are kept until replayed.
+	Retention time.Duration
+}
+
+func (c InboxConfig) withDefaults() InboxConfig {
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 8
+	}
+	if c.RetryBase <= 0 {
+		c.RetryBase = 5 * time.Second
+	}
+	if c.RetryMax <= 0 {
+		c.RetryMax = 15 * time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.Lease <= 0 {
+		c.Lease = 2 * time.Minute
+	}
+	if c.Retention <= 0 {
+		c.Retention = 7 * 24 * time.Hour
+	}
+	return c
+}
+
+// InboxWorker processes stored deliveries: it parses them with their
+// adapter, stores the records, and retries failures with backoff until they
+// succeed or are dead-lettered. Processing is idempotent, so a delivery
+// retried after a crash does not duplicate records.
+type InboxWorker struct {
+	inbox     storage.WebhookInbox
+	resolve   Resolver
+	processor *Processor
+	cfg       InboxConfig
+	logger    *zap.Logger
+	wake      chan struct{}
+}
+
+// NewInboxWorker builds a worker pool; call Run to start it.
+func NewInboxWorker(inbox storage.WebhookInbox, resolve Resolver, processor *Processor, cfg InboxConfig, logger *zap.Logger) *InboxWorker {
+	return &InboxWorker{
+		inbox:     inbox,
+		resolve:   resolve,
+		processor: processor,
+		cfg:       cfg.withDefaults(),
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes an idle worker after a delivery was enqueued.
+func (w *InboxWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes deliveries until ctx is cancelled and the workers finish
+// their current delivery.
+func (w *InboxWorker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.purgeLoop(ctx)
+	}()
+	wg.Wait()
+}
+
+func (w *InboxWorker) loop(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for w.ProcessNext(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *InboxWorker) purgeLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := w.inbox.Purge(ctx, time.Now().Add(-w.cfg.Retention))
+			if err != nil {
+				w.logger.Warn("webhook inbox purge failed", zap.Error(err))
+			} else if n > 0 {
+				w.logger.Info("webhook inbox purged", zap.Int64("deliveries", n))
+			}
+		}
+	}
+}
+
+// ProcessNext claims and handles one due delivery, reporting whether there
+// was one.
+func (w *InboxWorker) ProcessNext(ctx context.Context) bool {
+	items, err := w.inbox.Claim(ctx, 1, w.cfg.Lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.logger.Warn("webhook inbox claim failed", zap.Error(err))
+		}
+		return false
+	}
+	if len(items) == 0 {
+		return false
+	}
+	w.handle(ctx, items[0])
+	return true
+}
+
+func (w *InboxWorker) handle(ctx context.Context, item storage.InboxItem) {
+	log := w.logger.With(zap.Int64("inbox_id", item.ID), zap.String("source", item.Source), zap.Int("attempt", item.Attempts))
+	adapter, err := w.resolve(ctx, item.Source)
+	if err != nil {
+		w.fail(ctx, log, item, err, !errors.Is(err, ErrUnknownSource))
+		return
+	}
+	ev, err := adapter.Parse(item.Headers, item.Body)
+	switch {
+	case errors.Is(err, ErrUnsupportedEvent):
+		reason, _ := json.Marshal(map[string]string{"reason": err.Error()})
+		if err := w.inbox.Complete(ctx, item.ID, storage.InboxIgnored, reason); err != nil {
+			log.Warn("webhook inbox update failed", zap.Error(err))
+		}
+		return
+	case err != nil:
+		// Parsing is deterministic: a payload that failed once always will
+		w.fail(ctx, log, item, err, false)
+		return
+	}
+
+	res, err := w.processor.Process(ctx, ev)
+	if err != nil {
+		w.fail(ctx, log, item, err, true)
+		return
+	}
+	out, _ := json.Marshal(res)
+	if err := w.inbox.Complete(ctx, item.ID, storage.InboxDone, out); err != nil {
+		log.Warn("webhook inbox update failed", zap.Error(err))
+		return
+	}
+	log.Info("webhook processed", zap.String("event", ev.Type), zap.String("delivery_id", ev.DeliveryID), zap.Any("result", res))
+}
+
+// fail schedules a retry for retryable errors with attempts left and
+// dead-letters the delivery otherwise.
+func (w *InboxWorker) fail(ctx context.Context, log *zap.Logger, item storage.InboxItem, cause error, retryable bool) {
+	var retryAt *time.Time
+	if retryable && item.Attempts < w.cfg.MaxAttempts {
+		at := time.Now().Add(w.backoff(item.Attempts))
+		retryAt = &at
+		log.Warn("webhook processing failed; will retry", zap.Time("retry_at", at), zap.Error(cause))
+	} else {
+		log.Error("webhook dead-lettered", zap.Error(cause))
+	}
+	if err := w.inbox.Fail(ctx, item.ID, cause.Error(), retryAt); err != nil {
+		log.Warn("webhook inbox update failed", zap.Error(err))
+	}
+}
+
+// backoff returns the delay before the retry following attempt n (1-based).
+func (w *InboxWorker) backoff(n int) time.Duration {
+	d := w.cfg.RetryBase
+	for i := 1; i < n && d < w.cfg.RetryMax; i++ {
+		d *= 2
+	}
+	if d > w.cfg.RetryMax {
+		d = w.cfg.RetryMax
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/5+1)) - d/10
+	return d + jitter
+}
+
+// deliveryHeaders carry provider delivery ids, most specific first.
+var deliveryHeaders = []string{"X-GitHub-Delivery", "X-Gitlab-Event-UUID", "X-Webhook-Id", "Ce-Id"}
+
+// DeliveryKey identifies a delivery for deduplication: the provider's
+// delivery id when it sends one, otherwise a hash of the body.
+func DeliveryKey(h http.Header, body []byte) string {
+	for _, name := range deliveryHeaders {
+		if v := h.Get(name); v != "" {
+			return strings.ToLower(name) + ":" + v
+		}
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// StoredHeaders returns the request headers worth keeping with a delivery.
+// Credentials and signatures are dropped: deliveries are verified before
+// they are stored and adapters never parse them.
+func StoredHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		switch {
+		case lower == "authorization", lower == "proxy-authorization", lower == "cookie",
+			strings.Contains(lower, "token"), strings.Contains(lower, "secret"),
+			strings.Contains(lower, "signature"), strings.Contains(lower, "api-key"):
+			continue
+		}
+		out[name] = append([]string(nil), values...)
+	}
+	return out
+}
+
+// String describes the config for startup logs.
+func (c InboxConfig) String() string {
+	c = c.withDefaults()
+	return fmt.Sprintf("workers=%d max_attempts=%d retry=%s..%s", c.Workers, c.MaxAttempts, c.RetryBase, c.RetryMax)
+}
@@ -0,0 +1,129 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestInboxWorker(t *testing.T) {
+	ctx := context.Background()
+	inbox := storage.NewMemoryWebhookInbox()
+	argo := NewArgoCD(ArgoCDConfig{})
+	outage := 2
+	resolve := func(_ context.Context, source string) (Adapter, error) {
+		switch source {
+		case "flaky":
+			if outage > 0 {
+				outage--
+				return nil, errors.New("database unavailable")
+			}
+			return argo, nil
+		case "argocd":
+			return argo, nil
+		}
+		return nil, ErrUnknownSource
+	}
+	proc := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	w := NewInboxWorker(inbox, resolve, proc, InboxConfig{MaxAttempts: 3, RetryBase: time.Millisecond, RetryMax: time.Millisecond}, zap.NewNop())
+
+	deliveries := []struct {
+		source, body string
+		want         storage.InboxStatus
+		attempts     int
+	}{
+		{"argocd", argoPayload("Succeeded", "Healthy", "2024-05-01T10:02:00Z"), storage.InboxDone, 1},
+		{"argocd", argoPayload("Terminating", "Progressing", ""), storage.InboxIgnored, 1},
+		{"argocd", `{"app": `, storage.InboxDead, 1},
+		{"retired", `{}`, storage.InboxDead, 1},
+		{"flaky", argoPayload("Running", "Progressing", ""), storage.InboxDone, 3},
+	}
+	for _, d := range deliveries {
+		item := &storage.InboxItem{Source: d.source, DeliveryKey: DeliveryKey(nil, []byte(d.body)), Body: []byte(d.body)}
+		if dup, err := inbox.Enqueue(ctx, item); err != nil || dup {
+			t.Fatalf("Enqueue(%s): dup=%v err=%v", d.source, dup, err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if !w.ProcessNext(ctx) {
+			time.Sleep(time.Millisecond)
+		}
+		if pending, _ := inbox.List(ctx, storage.InboxPending, 10); len(pending) == 0 {
+			break
+		}
+	}
+	for i, d := range deliveries {
+		it, err := inbox.Get(ctx, int64(i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Status != d.want || it.Attempts != d.attempts {
+			t.Errorf("%s %d: status %s after %d attempts, want %s after %d (last error %q)", d.source, it.ID, it.Status, it.Attempts, d.want, d.attempts, it.LastError)
+		}
+	}
+	if done, _ := inbox.Get(ctx, 1); !strings.Contains(string(done.Result), `"deployments":1`) {
+		t.Errorf("done result = %s", done.Result)
+	}
+
+	// A redelivery is recognised by its key and not queued again
+	body := []byte(deliveries[0].body)
+	item := &storage.InboxItem{Source: "argocd", DeliveryKey: DeliveryKey(nil, body), Body: body}
+	if dup, err := inbox.Enqueue(ctx, item); err != nil || !dup || item.ID != 1 {
+		t.Errorf("redelivery: dup=%v id=%d err=%v", dup, item.ID, err)
+	}
+
+	// Replaying a dead delivery gives it a fresh attempt budget
+	if err := inbox.Replay(ctx, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("Replay(done) = %v want ErrConflict", err)
+	}
+	if err := inbox.Replay(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	w.ProcessNext(ctx)
+	if it, _ := inbox.Get(ctx, 4); it.Status != storage.InboxDead || it.Attempts != 1 {
+		t.Errorf("replayed delivery: status %s attempts %d", it.Status, it.Attempts)
+	}
+}
+
+func TestInboxBackoff(t *testing.T) {
+	w := NewInboxWorker(nil, nil, nil, InboxConfig{RetryBase: time.Second, RetryMax: 10 * time.Second}, zap.NewNop())
+	for _, tc := range []struct {
+		attempt int
+		base    time.Duration
+	}{{1, time.Second}, {2, 2 * time.Second}, {4, 8 * time.Second}, {5, 10 * time.Second}, {30, 10 * time.Second}} {
+		got := w.backoff(tc.attempt)
+		if got < tc.base*9/10 || got > tc.base*11/10 {
+			t.Errorf("backoff(%d) = %v want %v ±10%%", tc.attempt, got, tc.base)
+		}
+	}
+}
+
+func TestDeliveryKeyAndStoredHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-GitHub-Delivery", "72d3162e")
+	h.Set("X-GitHub-Event", "deployment")
+	h.Set("X-Hub-Signature-256", "sha256=abc")
+	h.Set("X-Gitlab-Token", "secret")
+	h.Set("Authorization", "Bearer t")
+	if got := DeliveryKey(h, []byte("{}")); got != "x-github-delivery:72d3162e" {
+		t.Errorf("DeliveryKey = %q", got)
+	}
+	if a, b := DeliveryKey(nil, []byte("{}")), DeliveryKey(http.Header{}, []byte("{}")); a != b || !strings.HasPrefix(a, "sha256:") {
+		t.Errorf("body keys = %q, %q", a, b)
+	}
+	stored := StoredHeaders(h)
+	if len(stored) != 2 || stored.Get("X-GitHub-Event") != "deployment" {
+		t.Errorf("StoredHeaders = %v", stored)
+	}
+}
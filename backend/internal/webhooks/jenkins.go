@@ -0,0 +1,262 @@
+package webhooks
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// JenkinsConfig configures the Jenkins adapter.
+type JenkinsConfig struct {
+	// Token is a shared secret sent as X-Jenkins-Token or as a bearer token.
+	// When empty, deliveries are accepted unverified (development only).
+	Token string
+	// DeployJobs selects deployment jobs by full job name. Builds of other
+	// jobs count only when they carry an environment parameter. Defaults to
+	// "(?i)deploy".
+	DeployJobs string
+	// DefaultEnvironment is used when a deployment names no environment.
+	// Defaults to "production".
+	DefaultEnvironment string
+}
+
+// jenkinsEnvironmentParams are the build parameters read as the target
+// environment, in order of preference.
+var jenkinsEnvironmentParams = []string{"ENVIRONMENT", "DEPLOY_ENV", "TARGET_ENV", "ENV"}
+
+// Jenkins handles Notification plugin deliveries and the pipeline notification
+// shape documented in docs/jenkins.md.
+type Jenkins struct {
+	secretVerifier
+	jobs        *regexp.Regexp
+	environment string
+}
+
+// NewJenkins builds the adapter, rejecting an invalid DeployJobs pattern.
+func NewJenkins(cfg JenkinsConfig) (*Jenkins, error) {
+	pattern := cfg.DeployJobs
+	if pattern == "" {
+		pattern = "(?i)deploy"
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("jenkins deploy job pattern: %w", err)
+	}
+	env := cfg.DefaultEnvironment
+	if env == "" {
+		env = "production"
+	}
+	return &Jenkins{secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: SharedToken{Header: "X-Jenkins-Token", Bearer: true}}, jobs: re, environment: env}, nil
+}
+
+func (j *Jenkins) Name() string { return "jenkins" }
+
+func (j *Jenkins) Description() string {
+	return "Jenkins deployment builds via the Notification plugin or pipeline post steps"
+}
+
+type jenkinsChangeSet struct {
+	Items []struct {
+		CommitID  string     `json:"commitId"`
+		Timestamp unixMillis `json:"timestamp"`
+		Msg       string     `json:"msg"`
+		Author    struct {
+			FullName string `json:"fullName"`
+		} `json:"author"`
+	} `json:"items"`
+}
+
+// jenkinsNotification is the Notification plugin format ("build" nested)
+// with the flat pipeline shape's fields alongside; a delivery uses one or
+// the other.
+type jenkinsNotification struct {
+	Name  string `json:"name"`
+	Build *struct {
+		FullURL    string            `json:"full_url"`
+		Number     int64             `json:"number"`
+		Phase      string            `json:"phase"`
+		Status     string            `json:"status"`
+		Timestamp  unixMillis        `json:"timestamp"`
+		Duration   int64             `json:"duration"`
+		Parameters map[string]string `json:"parameters"`
+		SCM        struct {
+			URL    string `json:"url"`
+			Branch string `json:"branch"`
+			Commit string `json:"commit"`
+		} `json:"scm"`
+	} `json:"build"`
+
+	Job         string             `json:"job"`
+	BuildNumber int64              `json:"build_number"`
+	BuildURL    string             `json:"build_url"`
+	Phase       string             `json:"phase"`
+	Result      string             `json:"result"`
+	Timestamp   unixMillis         `json:"timestamp"`
+	Duration    int64              `json:"duration"`
+	Service     string             `json:"service"`
+	Environment string             `json:"environment"`
+	Repository  string             `json:"repository"`
+	Branch      string             `json:"branch"`
+	Commit      string             `json:"commit"`
+	Author      string             `json:"author"`
+	Parameters  map[string]string  `json:"parameters"`
+	ChangeSets  []jenkinsChangeSet `json:"changeSets"`
+}
+
+// jenkinsBuild is the normalized view of either delivery shape.
+type jenkinsBuild struct {
+	job, url, phase, result      string
+	number                       int64
+	started                      time.Time
+	duration                     time.Duration
+	service, environment, author string
+	repository, branch, commit   string
+	parameters                   map[string]string
+}
+
+func (n *jenkinsNotification) normalize() jenkinsBuild {
+	if b := n.Build; b != nil {
+		return jenkinsBuild{
+			job: n.Name, url: b.FullURL, phase: b.Phase, result: b.Status, number: b.Number,
+			started: b.Timestamp.Time(), duration: time.Duration(b.Duration) * time.Millisecond,
+			repository: b.SCM.URL, branch: b.SCM.Branch, commit: b.SCM.Commit, parameters: b.Parameters,
+		}
+	}
+	return jenkinsBuild{
+		job: n.Job, url: n.BuildURL, phase: n.Phase, result: n.Result, number: n.BuildNumber,
+		started: n.Timestamp.Time(), duration: time.Duration(n.Duration) * time.Millisecond,
+		service: n.Service, environment: n.Environment, author: n.Author,
+		repository: n.Repository, branch: n.Branch, commit: n.Commit, parameters: n.Parameters,
+	}
+}
+
+// jenkinsResults maps completed build results; NOT_BUILT builds never ran and
+// are ignored. UNSTABLE deploy builds count as failed changes.
+var jenkinsResults = map[string]metrics.DeploymentStatus{
+	"SUCCESS":  metrics.DeploymentStatusSuccess,
+	"UNSTABLE": metrics.DeploymentStatusFailed,
+	"FAILURE":  metrics.DeploymentStatusFailed,
+	"ABORTED":  metrics.DeploymentStatusCancelled,
+}
+
+// Parse maps deployment builds; builds of other jobs are ignored. Without
+// SCM information a build cannot be merged across phases, so only its
+// completion is recorded.
+func (j *Jenkins) Parse(_ http.Header, body []byte) (*Event, error) {
+	var n jenkinsNotification
+	if err := decode(body, &n); err != nil {
+		return nil, err
+	}
+	b := n.normalize()
+	if b.job == "" || b.number == 0 {
+		return nil, fmt.Errorf("%w: missing job name or build number", ErrMalformedPayload)
+	}
+	ev := &Event{Source: j.Name(), Type: "build." + strings.ToLower(b.phase), DeliveryID: fmt.Sprintf("%s#%d/%s", b.job, b.number, b.phase)}
+
+	env := firstNonEmpty(b.environment, paramValue(b.parameters, jenkinsEnvironmentParams...))
+	if env == "" && !j.jobs.MatchString(b.job) {
+		return nil, fmt.Errorf("%w: job %q is not a deployment job", ErrUnsupportedEvent, b.job)
+	}
+	repo, commit := repositoryPath(b.repository), b.commit
+
+	var status metrics.DeploymentStatus
+	switch b.phase {
+	case "QUEUED":
+		status = metrics.DeploymentStatusPending
+	case "STARTED":
+		status = metrics.DeploymentStatusRunning
+	case "COMPLETED", "FINALIZED":
+		var ok bool
+		if status, ok = jenkinsResults[b.result]; !ok {
+			return nil, fmt.Errorf("%w: build result %q", ErrUnsupportedEvent, b.result)
+		}
+	default:
+		return nil, fmt.Errorf("%w: build phase %q", ErrMalformedPayload, b.phase)
+	}
+	if !status.IsTerminal() && (repo == "" || commit == "") {
+		return nil, fmt.Errorf("%w: %s build without scm information", ErrUnsupportedEvent, strings.ToLower(b.phase))
+	}
+
+	started := b.started
+	if started.IsZero() {
+		started = time.Now().UTC()
+	}
+	d := metrics.Deployment{
+		ID:          fmt.Sprintf("jenkins-%s-%d", strings.ReplaceAll(b.job, "/", "-"), b.number),
+		Service:     firstNonEmpty(b.service, paramValue(b.parameters, "SERVICE"), path.Base(b.job)),
+		Environment: firstNonEmpty(env, j.environment),
+		Version:     firstNonEmpty(paramValue(b.parameters, "VERSION"), shortSHA(commit)),
+		Status:      status,
+		StartTime:   started,
+		CommitSHA:   commit,
+		Author:      b.author,
+		Repository:  repo,
+		Branch:      strings.TrimPrefix(b.branch, "origin/"),
+		BuildURL:    b.url,
+	}
+	if status.IsTerminal() {
+		end := time.Now().UTC()
+		if b.duration > 0 {
+			end = started.Add(b.duration)
+		}
+		d.EndTime = &end
+	}
+
+	for _, cs := range n.ChangeSets {
+		for _, item := range cs.Items {
+			if item.CommitID == "" || item.Timestamp <= 0 {
+				continue
+			}
+			c := metrics.Commit{
+				Repository:  repo,
+				SHA:         item.CommitID,
+				Author:      item.Author.FullName,
+				Message:     item.Msg,
+				AuthoredAt:  item.Timestamp.Time(),
+				CommittedAt: item.Timestamp.Time(),
+			}
+			if repo != "" {
+				ev.Commits = append(ev.Commits, c)
+			}
+			// Lead time starts at the oldest change shipped by this build.
+			if d.CommitTime.IsZero() || c.CommittedAt.Before(d.CommitTime) {
+				d.CommitTime = c.CommittedAt
+			}
+			if d.Author == "" && item.CommitID == commit {
+				d.Author = c.Author
+			}
+		}
+	}
+	ev.Deployments = append(ev.Deployments, d)
+	return ev, nil
+}
+
+func paramValue(params map[string]string, names ...string) string {
+	for _, name := range names {
+		if v := params[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// repositoryPath reduces a clone URL to the owner/name path the other
+// adapters record, e.g. "git@github.com:acme/api.git" -> "acme/api".
+// Values that are already paths are returned unchanged.
+func repositoryPath(raw string) string {
+	s := strings.TrimSuffix(strings.TrimSpace(raw), ".git")
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		s = u.Path
+	} else if at := strings.Index(s, "@"); at >= 0 {
+		if colon := strings.Index(s[at:], ":"); colon >= 0 {
+			s = s[at+colon+1:]
+		}
+	}
+	return strings.Trim(s, "/")
+}
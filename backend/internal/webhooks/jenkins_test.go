@@ -0,0 +1,127 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+const (
+	jenkinsNotificationPayload = `{
+		"name": "platform/api-deploy", "url": "job/platform/job/api-deploy/",
+		"build": {"full_url": "https://ci.example.com/job/platform/job/api-deploy/18/", "number": 18,
+			"phase": "COMPLETED", "status": "SUCCESS", "timestamp": 1714557600000, "duration": 90000,
+			"parameters": {"ENV": "staging"},
+			"scm": {"url": "git@github.com:acme/api.git", "branch": "origin/main", "commit": "c6d86dc7"}}
+	}`
+	jenkinsPipelinePayload = `{
+		"job": "api-release", "build_number": 7, "build_url": "https://ci.example.com/job/api-release/7/",
+		"phase": "COMPLETED", "result": "FAILURE", "timestamp": 1714557600000, "duration": 60000,
+		"service": "api", "environment": "production", "repository": "https://github.com/acme/api.git",
+		"branch": "main", "commit": "bbb",
+		"changeSets": [{"kind": "git", "items": [
+			{"commitId": "aaa", "timestamp": 1714550400000, "msg": "first", "author": {"fullName": "Ann"}},
+			{"commitId": "bbb", "timestamp": 1714554000000, "msg": "second", "author": {"fullName": "Bob"}}
+		]}]
+	}`
+)
+
+func newJenkins(t *testing.T, cfg JenkinsConfig) *Jenkins {
+	t.Helper()
+	j, err := NewJenkins(cfg)
+	if err != nil {
+		t.Fatalf("NewJenkins: %v", err)
+	}
+	return j
+}
+
+func TestJenkinsVerify(t *testing.T) {
+	j := newJenkins(t, JenkinsConfig{Token: "t0ken"})
+	cases := []struct {
+		header, value string
+		ok            bool
+	}{
+		{"X-Jenkins-Token", "t0ken", true},
+		{"Authorization", "Bearer t0ken", true},
+		{"Authorization", "t0ken", false},
+		{"X-Jenkins-Token", "nope", false},
+	}
+	for _, tc := range cases {
+		err := j.Verify(http.Header{tc.header: {tc.value}}, nil)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s=%q: got %v", tc.header, tc.value, err)
+		}
+	}
+}
+
+func TestJenkinsParseNotificationPlugin(t *testing.T) {
+	ev, err := newJenkins(t, JenkinsConfig{}).Parse(nil, []byte(jenkinsNotificationPayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	d := ev.Deployments[0]
+	if d.ID != "jenkins-platform-api-deploy-18" || d.Service != "api-deploy" || d.Environment != "staging" ||
+		d.Repository != "acme/api" || d.Branch != "main" || d.Status != metrics.DeploymentStatusSuccess {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if d.EndTime == nil || d.EndTime.Sub(d.StartTime) != 90*time.Second {
+		t.Errorf("start=%v end=%v", d.StartTime, d.EndTime)
+	}
+}
+
+func TestJenkinsParsePipelineShape(t *testing.T) {
+	j := newJenkins(t, JenkinsConfig{DeployJobs: "-release$"})
+	ev, err := j.Parse(nil, []byte(jenkinsPipelinePayload))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	d := ev.Deployments[0]
+	if d.Status != metrics.DeploymentStatusFailed || d.Repository != "acme/api" || d.Author != "Bob" {
+		t.Errorf("unexpected deployment %+v", d)
+	}
+	if want := time.UnixMilli(1714550400000).UTC(); !d.CommitTime.Equal(want) {
+		t.Errorf("commit time = %v want oldest change %v", d.CommitTime, want)
+	}
+	if len(ev.Commits) != 2 {
+		t.Errorf("commits = %+v", ev.Commits)
+	}
+}
+
+func TestJenkinsParseIgnored(t *testing.T) {
+	j := newJenkins(t, JenkinsConfig{})
+	cases := []struct {
+		body string
+		want error
+	}{
+		{`{"job":"unit-tests","build_number":1,"phase":"COMPLETED","result":"SUCCESS"}`, ErrUnsupportedEvent},
+		{`{"job":"deploy","build_number":1,"phase":"COMPLETED","result":"NOT_BUILT"}`, ErrUnsupportedEvent},
+		{`{"job":"deploy","build_number":1,"phase":"STARTED"}`, ErrUnsupportedEvent},
+		{`{"job":"deploy","build_number":1,"phase":"EXPLODED"}`, ErrMalformedPayload},
+		{`{"job":"deploy"}`, ErrMalformedPayload},
+	}
+	for _, tc := range cases {
+		if _, err := j.Parse(nil, []byte(tc.body)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v want %v", tc.body, err, tc.want)
+		}
+	}
+	if _, err := j.Parse(nil, []byte(`{"job":"unit-tests","build_number":1,"phase":"COMPLETED","result":"SUCCESS","parameters":{"DEPLOY_ENV":"qa"}}`)); err != nil {
+		t.Errorf("environment parameter should mark a deployment: %v", err)
+	}
+}
+
+func TestRepositoryPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://github.com/acme/api.git": "acme/api",
+		"git@github.com:acme/api.git":     "acme/api",
+		"ssh://git@host:22/group/sub/app": "group/sub/app",
+		"acme/api":                        "acme/api",
+		"":                                "",
+	} {
+		if got := repositoryPath(in); got != want {
+			t.Errorf("repositoryPath(%q) = %q want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package webhooks
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// OpsgenieConfig configures the Opsgenie adapter.
+type OpsgenieConfig struct {
+	// Token is a shared secret sent as X-Opsgenie-Token (a custom header on
+	// the webhook integration) or as a bearer token. When empty, deliveries
+	// are accepted unverified (development only).
+	Token string
+	// Rule selects the alerts that count as incidents, by alias or message
+	// and by priority (P1..P5).
+	Rule IncidentRule
+	// DefaultEnvironment is used when alert details carry no environment.
+	// Defaults to "production".
+	DefaultEnvironment string
+}
+
+// Opsgenie handles alert actions from an Opsgenie Webhook integration.
+type Opsgenie struct {
+	secretVerifier
+	rule        IncidentRule
+	environment string
+}
+
+// NewOpsgenie builds the adapter.
+func NewOpsgenie(cfg OpsgenieConfig) *Opsgenie {
+	env := cfg.DefaultEnvironment
+	if env == "" {
+		env = "production"
+	}
+	return &Opsgenie{secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: SharedToken{Header: "X-Opsgenie-Token", Bearer: true}}, rule: cfg.Rule, environment: env}
+}
+
+func (o *Opsgenie) Name() string { return "opsgenie" }
+
+func (o *Opsgenie) Description() string { return "Opsgenie alerts as incidents" }
+
+type ogAlert struct {
+	AlertID     string            `json:"alertId"`
+	TinyID      string            `json:"tinyId"`
+	Alias       string            `json:"alias"`
+	Message     string            `json:"message"`
+	Description string            `json:"description"`
+	Entity      string            `json:"entity"`
+	Priority    string            `json:"priority"`
+	Owner       string            `json:"owner"`
+	CreatedAt   unixMillis        `json:"createdAt"`
+	UpdatedAt   unixMillis        `json:"updatedAt"`
+	Details     map[string]string `json:"details"`
+}
+
+type ogWebhook struct {
+	Action string  `json:"action"`
+	Alert  ogAlert `json:"alert"`
+}
+
+var opsgeniePriorities = map[string]metrics.IncidentSeverity{
+	"P1": metrics.SeverityCritical,
+	"P2": metrics.SeverityHigh,
+	"P3": metrics.SeverityMedium,
+	"P4": metrics.SeverityLow,
+	"P5": metrics.SeverityLow,
+}
+
+// Parse opens incidents on Create, resolves them on Close and refreshes them
+// on the other lifecycle actions; notes, tags and the like are ignored.
+func (o *Opsgenie) Parse(_ http.Header, body []byte) (*Event, error) {
+	var w ogWebhook
+	if err := decode(body, &w); err != nil {
+		return nil, err
+	}
+	al := w.Alert
+	ev := &Event{Source: o.Name(), Type: w.Action, DeliveryID: fmt.Sprintf("%s/%s/%d", al.AlertID, w.Action, al.UpdatedAt)}
+	switch w.Action {
+	case "Create", "Close", "Acknowledge", "UnAcknowledge", "Escalate", "AssignOwnership", "UpdatePriority":
+	default:
+		return nil, fmt.Errorf("%w: action %q", ErrUnsupportedEvent, w.Action)
+	}
+	if al.AlertID == "" || al.CreatedAt <= 0 {
+		return nil, fmt.Errorf("%w: missing alertId or createdAt", ErrMalformedPayload)
+	}
+	if !o.rule.Matches(al.Alias, al.Priority) && !o.rule.Matches(al.Message, al.Priority) {
+		return nil, fmt.Errorf("%w: alert does not match the incident rule", ErrUnsupportedEvent)
+	}
+	severity, ok := opsgeniePriorities[al.Priority]
+	if !ok {
+		severity = metrics.SeverityMedium
+	}
+	inc := metrics.Incident{
+		ID:          "og-" + al.AlertID,
+		Title:       firstNonEmpty(al.Message, "Opsgenie alert "+al.TinyID),
+		Description: al.Description,
+		Service:     firstNonEmpty(al.Details["service"], al.Entity, "unknown"),
+		Environment: firstNonEmpty(al.Details["environment"], al.Details["env"], o.environment),
+		Severity:    severity,
+		StartTime:   al.CreatedAt.Time(),
+		Assignee:    al.Owner,
+	}
+	if w.Action == "Close" {
+		closed := al.UpdatedAt.Time()
+		if closed.IsZero() {
+			closed = time.Now().UTC()
+		}
+		inc.ResolvedTime = &closed
+	}
+	ev.Incidents = append(ev.Incidents, inc)
+	return ev, nil
+}
@@ -0,0 +1,55 @@
+package webhooks
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+func ogPayload(action, priority string) string {
+	return `{"action": "` + action + `", "alert": {"alertId": "70413a06-38d6-4c85-92b8-5ebc900d42e2", "tinyId": "1791",
+		"alias": "checkout-down", "message": "Checkout is down", "entity": "checkout", "priority": "` + priority + `",
+		"owner": "oncall@example.com", "createdAt": 1714557600000, "updatedAt": 1714559400000,
+		"details": {"environment": "staging"}},
+		"source": {"name": "", "type": "web"}, "integrationName": "MetricHub", "integrationType": "Webhook"}`
+}
+
+func TestOpsgenieParse(t *testing.T) {
+	o := NewOpsgenie(OpsgenieConfig{Rule: IncidentRule{Severities: []string{"P1", "P2"}}})
+	ev, err := o.Parse(nil, []byte(ogPayload("Create", "P1")))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	inc := ev.Incidents[0]
+	if inc.ID != "og-70413a06-38d6-4c85-92b8-5ebc900d42e2" || inc.Severity != metrics.SeverityCritical ||
+		inc.Service != "checkout" || inc.Environment != "staging" || inc.ResolvedTime != nil {
+		t.Errorf("unexpected incident %+v", inc)
+	}
+
+	ev, err = o.Parse(nil, []byte(ogPayload("Close", "P2")))
+	if err != nil {
+		t.Fatalf("Parse close: %v", err)
+	}
+	if inc := ev.Incidents[0]; inc.ResolvedTime == nil || inc.MTTR() != 30*time.Minute {
+		t.Errorf("close: %+v", inc)
+	}
+
+	cases := []struct {
+		action, priority string
+		want             error
+	}{
+		{"AddNote", "P1", ErrUnsupportedEvent},
+		{"Create", "P4", ErrUnsupportedEvent},
+	}
+	for _, tc := range cases {
+		if _, err := o.Parse(nil, []byte(ogPayload(tc.action, tc.priority))); !errors.Is(err, tc.want) {
+			t.Errorf("%s %s: got %v want %v", tc.action, tc.priority, err, tc.want)
+		}
+	}
+	byAlias := NewOpsgenie(OpsgenieConfig{Rule: IncidentRule{Severities: []string{"P1"}, Names: []string{"checkout-down"}}})
+	if _, err := byAlias.Parse(nil, []byte(ogPayload("Create", "P4"))); err != nil {
+		t.Errorf("alias listed in rule should count: %v", err)
+	}
+}
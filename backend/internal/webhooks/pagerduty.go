@@ -0,0 +1,172 @@
+package webhooks
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// PagerDutyConfig configures the PagerDuty adapter.
+type PagerDutyConfig struct {
+	// Secret is the v3 webhook subscription secret used for
+	// X-PagerDuty-Signature. When empty, deliveries are accepted unverified
+	// (development only).
+	Secret string
+	// Services maps a PagerDuty service ID or name to a MetricHub service,
+	// optionally with an environment as "service:environment". Unmapped
+	// services keep their PagerDuty name.
+	Services map[string]string
+	// Priorities maps priority names (P1, P2, ...) to severities, overriding
+	// DefaultPagerDutyPriorities entry by entry.
+	Priorities map[string]string
+	// DefaultEnvironment is used when a service mapping names no environment.
+	// Defaults to "production".
+	DefaultEnvironment string
+}
+
+// DefaultPagerDutyPriorities maps PagerDuty's standard priority scheme.
+var DefaultPagerDutyPriorities = map[string]metrics.IncidentSeverity{
+	"P1": metrics.SeverityCritical,
+	"P2": metrics.SeverityHigh,
+	"P3": metrics.SeverityMedium,
+	"P4": metrics.SeverityLow,
+	"P5": metrics.SeverityLow,
+}
+
+// PagerDuty handles v3 webhook incident events.
+type PagerDuty struct {
+	secretVerifier
+	services    map[string]string
+	priorities  map[string]metrics.IncidentSeverity
+	environment string
+}
+
+// NewPagerDuty builds the adapter, rejecting unknown severities in Priorities.
+func NewPagerDuty(cfg PagerDutyConfig) (*PagerDuty, error) {
+	priorities := make(map[string]metrics.IncidentSeverity, len(DefaultPagerDutyPriorities)+len(cfg.Priorities))
+	for name, sev := range DefaultPagerDutyPriorities {
+		priorities[name] = sev
+	}
+	for name, sev := range cfg.Priorities {
+		s := metrics.IncidentSeverity(strings.ToLower(sev))
+		if !s.Valid() {
+			return nil, fmt.Errorf("pagerduty priority %q: unknown severity %q", name, sev)
+		}
+		priorities[name] = s
+	}
+	env := cfg.DefaultEnvironment
+	if env == "" {
+		env = "production"
+	}
+	// X-PagerDuty-Signature lists "v1=<hex HMAC-SHA256>" values; PagerDuty
+	// sends several while a secret is being rotated, and any match is accepted.
+	scheme := HMACSHA256{Header: "X-PagerDuty-Signature", Prefix: "v1=", List: true}
+	return &PagerDuty{secretVerifier: secretVerifier{secret: []byte(cfg.Secret), scheme: scheme}, services: cfg.Services, priorities: priorities, environment: env}, nil
+}
+
+func (p *PagerDuty) Name() string { return "pagerduty" }
+
+func (p *PagerDuty) Description() string {
+	return "PagerDuty incidents: triggered, acknowledged, resolved and priority changes"
+}
+
+type pdReference struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+}
+
+type pdIncident struct {
+	ID        string        `json:"id"`
+	Number    int64         `json:"number"`
+	Title     string        `json:"title"`
+	HTMLURL   string        `json:"html_url"`
+	Urgency   string        `json:"urgency"`
+	CreatedAt time.Time     `json:"created_at"`
+	Service   pdReference   `json:"service"`
+	Priority  *pdReference  `json:"priority"`
+	Assignees []pdReference `json:"assignees"`
+}
+
+type pdWebhook struct {
+	Event struct {
+		ID         string     `json:"id"`
+		EventType  string     `json:"event_type"`
+		OccurredAt time.Time  `json:"occurred_at"`
+		Data       pdIncident `json:"data"`
+	} `json:"event"`
+}
+
+// Parse upserts the incident carried by every handled event type; each
+// delivery contains the full incident, so out-of-order events converge.
+func (p *PagerDuty) Parse(_ http.Header, body []byte) (*Event, error) {
+	var w pdWebhook
+	if err := decode(body, &w); err != nil {
+		return nil, err
+	}
+	e := w.Event
+	ev := &Event{Source: p.Name(), Type: e.EventType, DeliveryID: e.ID}
+	switch e.EventType {
+	case "incident.triggered", "incident.acknowledged", "incident.resolved", "incident.priority_updated":
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEvent, e.EventType)
+	}
+	data := e.Data
+	if data.ID == "" || data.CreatedAt.IsZero() {
+		return nil, fmt.Errorf("%w: missing incident id or created_at", ErrMalformedPayload)
+	}
+	service, env := p.service(data.Service)
+	inc := metrics.Incident{
+		ID:          "pd-" + data.ID,
+		Title:       firstNonEmpty(data.Title, "PagerDuty incident "+data.ID),
+		Description: strings.TrimSpace(fmt.Sprintf("PagerDuty incident #%d %s", data.Number, data.HTMLURL)),
+		Service:     service,
+		Environment: env,
+		Severity:    p.severity(data),
+		StartTime:   data.CreatedAt,
+	}
+	if len(data.Assignees) > 0 {
+		inc.Assignee = data.Assignees[0].Summary
+	}
+	if e.EventType == "incident.resolved" {
+		resolved := e.OccurredAt
+		if resolved.IsZero() {
+			resolved = time.Now().UTC()
+		}
+		inc.ResolvedTime = &resolved
+	}
+	ev.Incidents = append(ev.Incidents, inc)
+	return ev, nil
+}
+
+func (p *PagerDuty) service(ref pdReference) (string, string) {
+	mapped, ok := p.services[ref.ID]
+	if !ok {
+		mapped, ok = p.services[ref.Summary]
+	}
+	if !ok {
+		return firstNonEmpty(ref.Summary, ref.ID, "unknown"), p.environment
+	}
+	if service, env, found := strings.Cut(mapped, ":"); found && env != "" {
+		return service, env
+	}
+	return strings.TrimSuffix(mapped, ":"), p.environment
+}
+
+// severity prefers the incident priority and falls back to its urgency.
+func (p *PagerDuty) severity(data pdIncident) metrics.IncidentSeverity {
+	if data.Priority != nil {
+		if sev, ok := p.priorities[data.Priority.Summary]; ok {
+			return sev
+		}
+	}
+	switch data.Urgency {
+	case "high":
+		return metrics.SeverityHigh
+	case "low":
+		return metrics.SeverityLow
+	}
+	return metrics.SeverityMedium
+}
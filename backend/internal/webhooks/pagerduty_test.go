@@ -0,0 +1,134 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+func pdPayload(eventType, occurredAt, priority string) string {
+	prio := "null"
+	if priority != "" {
+		prio = `{"id":"PSO75BM","summary":"` + priority + `"}`
+	}
+	return `{"event":{"id":"01DEN","event_type":"` + eventType + `","resource_type":"incident","occurred_at":"` + occurredAt + `",
+		"data":{"id":"PGR0VU2","type":"incident","number":2,"title":"A little bump in the road",
+			"html_url":"https://acme.pagerduty.com/incidents/PGR0VU2","urgency":"high","created_at":"2020-10-02T18:45:22Z",
+			"service":{"id":"PF9KMXH","summary":"API Service"},"priority":` + prio + `,
+			"assignees":[{"id":"PTUXL6G","summary":"Earline Greenholt"}]}}}`
+}
+
+func TestPagerDutyVerify(t *testing.T) {
+	body := []byte(pdPayload("incident.triggered", "2020-10-02T18:45:22Z", ""))
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "v1=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	p, err := NewPagerDuty(PagerDutyConfig{Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		header string
+		ok     bool
+	}{
+		{sign("s3cret"), true},
+		{sign("old") + "," + sign("s3cret"), true},
+		{sign("old"), false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		err := p.Verify(http.Header{"X-Pagerduty-Signature": {tc.header}}, body)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q: got %v", tc.header, err)
+		}
+	}
+}
+
+func TestPagerDutyMapping(t *testing.T) {
+	p, err := NewPagerDuty(PagerDutyConfig{
+		Services:   map[string]string{"PF9KMXH": "api:staging"},
+		Priorities: map[string]string{"P2": "Critical"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		priority string
+		want     metrics.IncidentSeverity
+	}{
+		{"P1", metrics.SeverityCritical},
+		{"P2", metrics.SeverityCritical},
+		{"P4", metrics.SeverityLow},
+		{"", metrics.SeverityHigh}, // falls back to urgency
+	}
+	for _, tc := range cases {
+		ev, err := p.Parse(nil, []byte(pdPayload("incident.priority_updated", "2020-10-02T18:50:00Z", tc.priority)))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		inc := ev.Incidents[0]
+		if inc.Severity != tc.want {
+			t.Errorf("priority %q: severity %q want %q", tc.priority, inc.Severity, tc.want)
+		}
+		if inc.Service != "api" || inc.Environment != "staging" || inc.ID != "pd-PGR0VU2" || inc.Assignee != "Earline Greenholt" {
+			t.Errorf("unexpected incident %+v", inc)
+		}
+	}
+
+	p, _ = NewPagerDuty(PagerDutyConfig{})
+	ev, _ := p.Parse(nil, []byte(pdPayload("incident.triggered", "2020-10-02T18:45:22Z", "")))
+	if inc := ev.Incidents[0]; inc.Service != "API Service" || inc.Environment != "production" {
+		t.Errorf("unmapped service: %+v", inc)
+	}
+
+	if _, err := NewPagerDuty(PagerDutyConfig{Priorities: map[string]string{"P1": "sev1"}}); err == nil {
+		t.Error("unknown severity in priority map should be rejected")
+	}
+	if _, err := p.Parse(nil, []byte(strings.Replace(pdPayload("incident.triggered", "2020-10-02T18:45:22Z", ""), "incident.triggered", "incident.annotated", 1))); !errors.Is(err, ErrUnsupportedEvent) {
+		t.Errorf("annotated: got %v want ErrUnsupportedEvent", err)
+	}
+}
+
+func TestPagerDutyLifecycle(t *testing.T) {
+	p, _ := NewPagerDuty(PagerDutyConfig{})
+	proc := &Processor{
+		Deployments: storage.NewMemoryDeploymentRepo(),
+		Incidents:   storage.NewMemoryIncidentRepo(),
+		Commits:     storage.NewMemoryCommitRepo(),
+	}
+	ctx := context.Background()
+	// Deliveries may arrive out of order; the resolution must survive.
+	for _, e := range []struct{ typ, at, prio string }{
+		{"incident.triggered", "2020-10-02T18:45:22Z", ""},
+		{"incident.resolved", "2020-10-02T19:15:22Z", "P3"},
+		{"incident.acknowledged", "2020-10-02T18:50:00Z", "P3"},
+		{"incident.priority_updated", "2020-10-02T18:55:00Z", "P1"},
+	} {
+		ev, err := p.Parse(nil, []byte(pdPayload(e.typ, e.at, e.prio)))
+		if err != nil {
+			t.Fatalf("%s: %v", e.typ, err)
+		}
+		if _, err := proc.Process(ctx, ev); err != nil {
+			t.Fatalf("%s: %v", e.typ, err)
+		}
+	}
+	incs, _ := proc.Incidents.ListRange(ctx, time.Time{}, time.Now())
+	if len(incs) != 1 {
+		t.Fatalf("incidents = %d want 1", len(incs))
+	}
+	inc := incs[0]
+	if inc.Severity != metrics.SeverityCritical || inc.MTTR() != 30*time.Minute {
+		t.Errorf("severity=%s mttr=%v", inc.Severity, inc.MTTR())
+	}
+}
@@ -0,0 +1,96 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirhCC/MetricHub/internal/storage"
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// Result counts what a Processor stored for one event. Duplicates are
+// deployments whose ID is taken by a different stored deployment; they are
+// skipped and are not errors.
+type Result struct {
+	Deployments int `json:"deployments"`
+	Incidents   int `json:"incidents"`
+	Commits     int `json:"commits"`
+	Duplicates  int `json:"duplicates"`
+}
+
+// Processor stores parsed events through the repositories.
+type Processor struct {
+	Deployments storage.DeploymentRepository
+	Incidents   storage.IncidentRepository
+	Commits     storage.CommitRepository
+	// Tickets records ticket links; events' links are dropped when nil.
+	Tickets storage.TicketLinkRepository
+}
+
+// Process saves commits first so that deployments of those commits in the
+// same event pick up their commit time. Deployments carrying a repository and
+// commit SHA are upserted on that natural key, others by ID, so later status
+// updates merge into the same record. Incidents are upserted by ID so
+// lifecycle events (acknowledged, resolved, ...) update one record.
+// Ticket links are saved last.
+func (p *Processor) Process(ctx context.Context, ev *Event) (Result, error) {
+	var res Result
+	if len(ev.Commits) > 0 {
+		if err := p.Commits.Save(ctx, ev.Commits); err != nil {
+			return res, err
+		}
+		res.Commits = len(ev.Commits)
+	}
+	now := time.Now().UTC()
+	for i := range ev.Deployments {
+		d := &ev.Deployments[i]
+		stamp(&d.CreatedAt, &d.UpdatedAt, now)
+		if d.CommitTime.IsZero() {
+			d.CommitTime = p.commitTime(ctx, d)
+		}
+		_, err := p.Deployments.Upsert(ctx, d)
+		if errors.Is(err, storage.ErrConflict) {
+			res.Duplicates++
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Deployments++
+	}
+	for i := range ev.Incidents {
+		inc := &ev.Incidents[i]
+		stamp(&inc.CreatedAt, &inc.UpdatedAt, now)
+		if _, err := p.Incidents.Upsert(ctx, inc); err != nil {
+			return res, err
+		}
+		res.Incidents++
+	}
+	if len(ev.TicketLinks) > 0 && p.Tickets != nil {
+		if err := p.Tickets.Save(ctx, ev.TicketLinks); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// commitTime resolves the commit timestamp from stored commits, falling back
+// to the deployment start so lead time is never computed from the zero time.
+func (p *Processor) commitTime(ctx context.Context, d *metrics.Deployment) time.Time {
+	if d.Repository != "" && d.CommitSHA != "" {
+		if c, err := p.Commits.Get(ctx, d.Repository, d.CommitSHA); err == nil {
+			return c.CommittedAt
+		}
+	}
+	return d.StartTime
+}
+
+func stamp(created, updated *time.Time, now time.Time) {
+	if created.IsZero() {
+		*created = now
+	}
+	if updated.IsZero() {
+		*updated = now
+	}
+}
@@ -0,0 +1,89 @@
+// Command transform is a WebAssembly webhook transform used by the tests,
+// built with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o transform.wasm
+//
+// It maps a CI payload ({"event", "pipeline": {"id", "app", "result"}}) to a
+// deployment and an alert ({"alert": {"id", "summary", "app"}}) to an
+// incident. Payloads with "loop", "grow_mb" or "garbage" misbehave on
+// purpose.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+type payload struct {
+	Event    string `json:"event"`
+	Pipeline *struct {
+		ID     int    `json:"id"`
+		App    string `json:"app"`
+		Result string `json:"result"`
+	} `json:"pipeline"`
+	Alert *struct {
+		ID      string `json:"id"`
+		Summary string `json:"summary"`
+		App     string `json:"app"`
+	} `json:"alert"`
+	Loop    bool `json:"loop"`
+	GrowMB  int  `json:"grow_mb"`
+	Garbage bool `json:"garbage"`
+}
+
+// in and out keep the buffers shared with the host alive.
+var in, out []byte
+
+//go:wasmexport alloc
+func alloc(size int32) int32 {
+	in = make([]byte, size)
+	return int32(uintptr(unsafe.Pointer(&in[0])))
+}
+
+//go:wasmexport transform
+func transform(ptr, size int32) int64 {
+	out = run(in[:size])
+	return int64(uintptr(unsafe.Pointer(&out[0])))<<32 | int64(len(out))
+}
+
+var sink [][]byte
+
+func run(body []byte) []byte {
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return result(map[string]any{"error": err.Error()})
+	}
+	fmt.Fprintf(os.Stderr, "transforming %q\n", p.Event)
+	switch {
+	case p.Loop:
+		for {
+		}
+	case p.GrowMB > 0:
+		for i := 0; i < p.GrowMB; i++ {
+			sink = append(sink, make([]byte, 1<<20))
+		}
+	case p.Garbage:
+		return []byte("not json")
+	}
+	res := map[string]any{"event_type": p.Event}
+	if c := p.Pipeline; c != nil {
+		status := "failed"
+		if c.Result == "passed" {
+			status = "success"
+		}
+		res["deployments"] = []map[string]any{{"id": c.ID, "service": c.App, "status": status}}
+	}
+	if a := p.Alert; a != nil {
+		res["incidents"] = []map[string]any{{"id": a.ID, "title": a.Summary, "service": a.App, "severity": "critical"}}
+	}
+	return result(res)
+}
+
+func result(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func main() {}
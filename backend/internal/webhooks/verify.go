@@ -0,0 +1,197 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStaleTimestamp means a timestamped signature is outside the replay
+// tolerance. It wraps ErrInvalidSignature.
+var ErrStaleTimestamp = fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+
+// DefaultTolerance bounds the age of timestamped signatures.
+const DefaultTolerance = 5 * time.Minute
+
+// Verifier authenticates a raw delivery with one of a provider's signing
+// schemes. Any of secrets may match, so a new secret can be rolled out while
+// the previous one is still in use.
+type Verifier interface {
+	// Scheme names the signing scheme, e.g. "hmac-sha256".
+	Scheme() string
+	// Verify returns nil when body is signed with one of secrets and
+	// ErrInvalidSignature (or ErrStaleTimestamp) otherwise.
+	Verify(h http.Header, body []byte, secrets [][]byte) error
+}
+
+// SharedToken compares a token sent as-is, as GitLab and Opsgenie do.
+type SharedToken struct {
+	// Header carries the token.
+	Header string
+	// Bearer also accepts "Authorization: Bearer <token>".
+	Bearer bool
+}
+
+func (v SharedToken) Scheme() string { return "token" }
+
+func (v SharedToken) Verify(h http.Header, _ []byte, secrets [][]byte) error {
+	got := h.Get(v.Header)
+	if v.Bearer {
+		got = sharedToken(h, v.Header)
+	}
+	if got == "" {
+		return ErrInvalidSignature
+	}
+	// Compare against every secret so timing does not reveal which matched
+	match := 0
+	for _, s := range secrets {
+		match |= subtle.ConstantTimeCompare([]byte(got), s)
+	}
+	if match != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// HMACSHA256 checks a hex HMAC-SHA256 of the body, as GitHub, Flux and
+// PagerDuty send it.
+type HMACSHA256 struct {
+	// Header carries the signature, after Prefix (e.g. "sha256=").
+	Header string
+	Prefix string
+	// List accepts comma-separated signatures, one per sender secret
+	// (PagerDuty signs with every active secret during its rotations).
+	List bool
+}
+
+func (v HMACSHA256) Scheme() string { return "hmac-sha256" }
+
+func (v HMACSHA256) Verify(h http.Header, body []byte, secrets [][]byte) error {
+	sigs := []string{h.Get(v.Header)}
+	if v.List {
+		sigs = strings.Split(sigs[0], ",")
+	}
+	for _, sig := range sigs {
+		hexSig, ok := strings.CutPrefix(strings.TrimSpace(sig), v.Prefix)
+		if !ok {
+			continue
+		}
+		got, err := hex.DecodeString(hexSig)
+		if err != nil {
+			continue
+		}
+		if anyMAC(got, secrets, body) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// TimestampedHMAC checks a hex HMAC-SHA256 of "<timestamp>.<body>" and
+// rejects timestamps outside Tolerance, so a captured delivery cannot be
+// replayed later. The signature header is either "t=<unix>,v1=<hex>" or,
+// with TimestampHeader set, "v1=<hex>" next to a Unix timestamp header.
+type TimestampedHMAC struct {
+	Header          string
+	TimestampHeader string
+	// Tolerance defaults to DefaultTolerance.
+	Tolerance time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (v TimestampedHMAC) Scheme() string { return "timestamped-hmac-sha256" }
+
+func (v TimestampedHMAC) Verify(h http.Header, body []byte, secrets [][]byte) error {
+	var ts string
+	var sigs [][]byte
+	if v.TimestampHeader != "" {
+		ts = h.Get(v.TimestampHeader)
+	}
+	for _, part := range strings.Split(h.Get(v.Header), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			if v.TimestampHeader == "" {
+				ts = value
+			}
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	signed := append([]byte(ts+"."), body...)
+	for _, sig := range sigs {
+		if !anyMAC(sig, secrets, signed) {
+			continue
+		}
+		// Checked after the signature so unsigned requests learn nothing
+		now, tolerance := time.Now, v.Tolerance
+		if v.Now != nil {
+			now = v.Now
+		}
+		if tolerance <= 0 {
+			tolerance = DefaultTolerance
+		}
+		if age := now().Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return ErrStaleTimestamp
+		}
+		return nil
+	}
+	return ErrInvalidSignature
+}
+
+// SignTimestamped returns the TimestampedHMAC header value for body, for
+// senders and tests.
+func SignTimestamped(secret, body []byte, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// anyMAC reports whether sig is the HMAC-SHA256 of msg under any secret.
+func anyMAC(sig []byte, secrets [][]byte, msg []byte) bool {
+	ok := false
+	for _, s := range secrets {
+		mac := hmac.New(sha256.New, s)
+		mac.Write(msg)
+		if hmac.Equal(sig, mac.Sum(nil)) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// secretVerifier implements Verifies, Verifier and Verify for adapters
+// that check one configured secret with one signing scheme; adapters embed it.
+// Without a secret, deliveries are accepted unverified.
+type secretVerifier struct {
+	secret []byte
+	scheme Verifier
+}
+
+func (v secretVerifier) Verifies() bool { return len(v.secret) > 0 }
+
+// Verifier is the adapter's signing scheme.
+func (v secretVerifier) Verifier() Verifier { return v.scheme }
+
+// Verify checks the configured secret.
+func (v secretVerifier) Verify(h http.Header, body []byte) error {
+	if !v.Verifies() {
+		return nil
+	}
+	return v.scheme.Verify(h, body, [][]byte{v.secret})
+}
@@ -0,0 +1,115 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func hexMAC(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifiers(t *testing.T) {
+	body := []byte(`{"ok":true}`)
+	now := time.Unix(1_700_000_000, 0)
+	rotating := [][]byte{[]byte("new-secret"), []byte("old-secret")}
+	stamped := TimestampedHMAC{Header: "X-Webhook-Signature", Now: func() time.Time { return now }}
+	cases := []struct {
+		name    string
+		v       Verifier
+		headers map[string]string
+		secrets [][]byte
+		want    error
+	}{
+		{"token header", SharedToken{Header: "X-Token"}, map[string]string{"X-Token": "old-secret"}, rotating, nil},
+		{"token bearer", SharedToken{Header: "X-Token", Bearer: true}, map[string]string{"Authorization": "Bearer new-secret"}, rotating, nil},
+		{"token bearer not allowed", SharedToken{Header: "X-Token"}, map[string]string{"Authorization": "Bearer new-secret"}, rotating, ErrInvalidSignature},
+		{"token mismatch", SharedToken{Header: "X-Token"}, map[string]string{"X-Token": "retired"}, rotating, ErrInvalidSignature},
+		{"token without secrets", SharedToken{Header: "X-Token"}, map[string]string{"X-Token": "x"}, nil, ErrInvalidSignature},
+		{"hmac old secret", HMACSHA256{Header: "X-Sig", Prefix: "sha256="}, map[string]string{"X-Sig": "sha256=" + hexMAC("old-secret", string(body))}, rotating, nil},
+		{"hmac missing prefix", HMACSHA256{Header: "X-Sig", Prefix: "sha256="}, map[string]string{"X-Sig": hexMAC("old-secret", string(body))}, rotating, ErrInvalidSignature},
+		{"hmac list", HMACSHA256{Header: "X-Sig", Prefix: "v1=", List: true}, map[string]string{"X-Sig": "v1=abcd, v1=" + hexMAC("new-secret", string(body))}, rotating, nil},
+		{"hmac tampered", HMACSHA256{Header: "X-Sig", Prefix: "sha256="}, map[string]string{"X-Sig": "sha256=" + hexMAC("old-secret", `{"ok":false}`)}, rotating, ErrInvalidSignature},
+		{"timestamped", stamped, map[string]string{"X-Webhook-Signature": SignTimestamped([]byte("old-secret"), body, now.Add(-time.Minute))}, rotating, nil},
+		{"timestamped replayed", stamped, map[string]string{"X-Webhook-Signature": SignTimestamped([]byte("old-secret"), body, now.Add(-10*time.Minute))}, rotating, ErrStaleTimestamp},
+		{"timestamped future", stamped, map[string]string{"X-Webhook-Signature": SignTimestamped([]byte("new-secret"), body, now.Add(10*time.Minute))}, rotating, ErrStaleTimestamp},
+		{"timestamped wrong secret", stamped, map[string]string{"X-Webhook-Signature": SignTimestamped([]byte("retired"), body, now)}, rotating, ErrInvalidSignature},
+		{"timestamped separate header", TimestampedHMAC{Header: "X-Sig", TimestampHeader: "X-Timestamp", Now: func() time.Time { return now }},
+			map[string]string{"X-Timestamp": "1700000000", "X-Sig": "v1=" + hexMAC("new-secret", "1700000000."+string(body))}, rotating, nil},
+		{"timestamped missing", stamped, map[string]string{"X-Webhook-Signature": "v1=" + hexMAC("new-secret", string(body))}, rotating, ErrInvalidSignature},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		for k, v := range tc.headers {
+			h.Set(k, v)
+		}
+		err := tc.v.Verify(h, body, tc.secrets)
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: Verify = %v want %v", tc.name, err, tc.want)
+		}
+	}
+	if !errors.Is(ErrStaleTimestamp, ErrInvalidSignature) {
+		t.Error("ErrStaleTimestamp must wrap ErrInvalidSignature")
+	}
+}
+
+func TestGenericSignatureSchemes(t *testing.T) {
+	rules := `"rules": [{"kind": "deployment", "fields": {"id": "$.id", "service": "$.app"}}]`
+	body := []byte(`{"id": "1", "app": "api"}`)
+
+	g, err := CompileMapping("signed", []byte(`{"token": "0123456789abcdef", "signature": "timestamped-hmac-sha256", "tolerance_seconds": 60, `+rules+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	h.Set("X-Webhook-Signature", SignTimestamped([]byte("0123456789abcdef"), body, time.Now()))
+	if err := g.Verify(h, body); err != nil {
+		t.Errorf("fresh signature: %v", err)
+	}
+	h.Set("X-Webhook-Signature", SignTimestamped([]byte("0123456789abcdef"), body, time.Now().Add(-2*time.Minute)))
+	if err := g.Verify(h, body); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("old signature: %v", err)
+	}
+
+	g, err = CompileMapping("hmac", []byte(`{"token": "s", "signature": "hmac-sha256", "token_header": "X-Sig", `+rules+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = http.Header{}
+	h.Set("X-Sig", "sha256="+hexMAC("s", string(body)))
+	if err := g.Verify(h, body); err != nil || g.Verifier().Scheme() != "hmac-sha256" {
+		t.Errorf("hmac: %v scheme %s", err, g.Verifier().Scheme())
+	}
+
+	for _, bad := range []string{`"signature": "md5"`, `"tolerance_seconds": -1`} {
+		if _, err := CompileMapping("bad", []byte(`{`+bad+`, `+rules+`}`)); !errors.Is(err, ErrInvalidMapping) {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+}
+
+func TestSecretVerifier(t *testing.T) {
+	scheme := SharedToken{Header: "X-Token"}
+	h := http.Header{}
+	if err := (secretVerifier{scheme: scheme}).Verify(h, nil); err != nil {
+		t.Errorf("no secret: got %v, want unverified delivery accepted", err)
+	}
+	v := secretVerifier{secret: []byte("s3cret"), scheme: scheme}
+	if err := v.Verify(h, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("missing token: got %v", err)
+	}
+	h.Set("X-Token", "s3cret")
+	if err := v.Verify(h, nil); err != nil {
+		t.Errorf("matching token: %v", err)
+	}
+	if !v.Verifies() || v.Verifier().Scheme() != "token" {
+		t.Errorf("Verifies=%v scheme=%q", v.Verifies(), v.Verifier().Scheme())
+	}
+}
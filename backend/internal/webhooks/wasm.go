@@ -0,0 +1,421 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+var (
+	// ErrInvalidTransform reports a WebAssembly transform that cannot be
+	// compiled, does not implement the transform ABI or has invalid settings.
+	ErrInvalidTransform = errors.New("webhooks: invalid wasm transform")
+	// ErrTransformFailed means a transform trapped, exceeded its limits or
+	// returned output that is not a transform result.
+	ErrTransformFailed = errors.New("webhooks: wasm transform failed")
+)
+
+// WASMLimits bound every transform call. Zero values use the defaults.
+type WASMLimits struct {
+	// MemoryBytes caps a module's linear memory (default 64 MiB).
+	MemoryBytes int64
+	// Timeout bounds one call, instantiation included (default 2s).
+	Timeout time.Duration
+}
+
+const (
+	wasmPageBytes = 64 << 10
+	// maxWASMLogBytes bounds the stdout and stderr kept from one call.
+	maxWASMLogBytes = 64 << 10
+	// maxCompiledModules bounds the compiled modules kept by a runtime.
+	maxCompiledModules = 32
+)
+
+func (l WASMLimits) withDefaults() WASMLimits {
+	if l.MemoryBytes <= 0 {
+		l.MemoryBytes = 64 << 20
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = 2 * time.Second
+	}
+	return l
+}
+
+// WASMRuntime compiles and runs transform modules in a wazero sandbox: a
+// module sees only its own memory and WASI stdout and stderr, which are
+// captured; it has no filesystem, network, environment or host clock.
+// Modules run in wazero's interpreter, which compiles a module in a fraction
+// of the time its compiler takes; compiled modules are cached by SHA-256.
+type WASMRuntime struct {
+	limits   WASMLimits
+	rt       wazero.Runtime
+	mu       sync.Mutex
+	compiled map[string]wazero.CompiledModule
+}
+
+// NewWASMRuntime creates a runtime enforcing limits. Close releases it.
+func NewWASMRuntime(ctx context.Context, limits WASMLimits) (*WASMRuntime, error) {
+	limits = limits.withDefaults()
+	pages := limits.MemoryBytes / wasmPageBytes
+	if pages < 1 || pages > 65536 {
+		return nil, fmt.Errorf("webhooks: wasm memory limit must be between 64 KiB and 4 GiB, got %d bytes", limits.MemoryBytes)
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter().
+		WithMemoryLimitPages(uint32(pages)).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		_ = rt.Close(ctx)
+		return nil, err
+	}
+	return &WASMRuntime{limits: limits, rt: rt, compiled: make(map[string]wazero.CompiledModule)}, nil
+}
+
+// Limits returns the limits in force, defaults applied.
+func (r *WASMRuntime) Limits() WASMLimits { return r.limits }
+
+// Close releases the runtime and every compiled module.
+func (r *WASMRuntime) Close(ctx context.Context) error {
+	return r.rt.Close(ctx)
+}
+
+// Evict drops the compiled module with the given SHA-256, e.g. after the
+// transform using it was deleted. Calls in progress are not affected.
+func (r *WASMRuntime) Evict(ctx context.Context, sum string) {
+	r.mu.Lock()
+	m, ok := r.compiled[sum]
+	delete(r.compiled, sum)
+	r.mu.Unlock()
+	if ok {
+		_ = m.Close(ctx)
+	}
+}
+
+// compile returns the compiled module, compiling and checking its ABI on
+// first use.
+func (r *WASMRuntime) compile(ctx context.Context, sum string, module []byte) (wazero.CompiledModule, error) {
+	r.mu.Lock()
+	m, ok := r.compiled[sum]
+	r.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+	m, err := r.rt.CompileModule(ctx, module)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransform, err)
+	}
+	if err := checkTransformABI(m); err != nil {
+		_ = m.Close(ctx)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransform, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.compiled[sum]; ok {
+		_ = m.Close(ctx)
+		return prev, nil
+	}
+	for old, cm := range r.compiled {
+		if len(r.compiled) < maxCompiledModules {
+			break
+		}
+		delete(r.compiled, old)
+		_ = cm.Close(ctx)
+	}
+	r.compiled[sum] = m
+	return m, nil
+}
+
+// checkTransformABI checks the exports a transform must have and that it
+// imports nothing beyond WASI.
+func checkTransformABI(m wazero.CompiledModule) error {
+	if _, ok := m.ExportedMemories()["memory"]; !ok {
+		return errors.New(`module must export its memory as "memory"`)
+	}
+	fns := m.ExportedFunctions()
+	for name, sig := range map[string]struct{ params, results []api.ValueType }{
+		"alloc":     {[]api.ValueType{api.ValueTypeI32}, []api.ValueType{api.ValueTypeI32}},
+		"transform": {[]api.ValueType{api.ValueTypeI32, api.ValueTypeI32}, []api.ValueType{api.ValueTypeI64}},
+	} {
+		fn, ok := fns[name]
+		if !ok {
+			return fmt.Errorf("module must export function %q", name)
+		}
+		if !bytes.Equal(fn.ParamTypes(), sig.params) || !bytes.Equal(fn.ResultTypes(), sig.results) {
+			return fmt.Errorf("function %q must have signature (%s) -> %s", name, valueTypes(sig.params), valueTypes(sig.results))
+		}
+	}
+	for _, fn := range m.ImportedFunctions() {
+		if mod, name, _ := fn.Import(); mod != wasi_snapshot_preview1.ModuleName {
+			return fmt.Errorf("module imports %s.%s; only %s is available", mod, name, wasi_snapshot_preview1.ModuleName)
+		}
+	}
+	return nil
+}
+
+func valueTypes(ts []api.ValueType) string {
+	var b bytes.Buffer
+	for i, t := range ts {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(api.ValueTypeName(t))
+	}
+	return b.String()
+}
+
+// WASMTransformConfig holds a transform's settings; the module is stored
+// separately. Token, TokenHeader, Signature and ToleranceSeconds
+// authenticate deliveries as for MappingConfig.
+type WASMTransformConfig struct {
+	Description      string `json:"description,omitempty"`
+	Token            string `json:"token,omitempty"`
+	TokenHeader      string `json:"token_header,omitempty"`
+	Signature        string `json:"signature,omitempty"`
+	ToleranceSeconds int    `json:"tolerance_seconds,omitempty"`
+}
+
+// WASMTransform is the adapter for one uploaded WebAssembly module. It is
+// served at /webhook/wasm/<name>.
+//
+// A module exports its memory as "memory" and two functions:
+//
+//	alloc(len i32) -> i32                  // a buffer for the delivery body
+//	transform(ptr i32, len i32) -> i64     // (result ptr << 32) | result len
+//
+// The host writes the body into the buffer from alloc and calls transform,
+// whose result is a JSON transformResult. Each call gets a fresh instance,
+// so no state survives between deliveries. Reactor modules' _initialize is
+// called first; _start is never called.
+type WASMTransform struct {
+	name string
+	cfg  WASMTransformConfig
+	sum  string
+	size int
+	secretVerifier
+	rt     *WASMRuntime
+	module wazero.CompiledModule
+}
+
+// transformResult is what a module returns. Records use the field names of
+// generic mappings, with string, number or boolean values; they get the same
+// defaults and validation and their ids are prefixed with the transform
+// name. A result without records is an ignored event; Error rejects the
+// payload as malformed.
+type transformResult struct {
+	EventType   string                   `json:"event_type"`
+	DeliveryID  string                   `json:"delivery_id"`
+	Deployments []map[string]interface{} `json:"deployments"`
+	Incidents   []map[string]interface{} `json:"incidents"`
+	Error       string                   `json:"error"`
+}
+
+// ModuleSHA256 returns the hex SHA-256 of a module, the key its compiled
+// form is cached under.
+func ModuleSHA256(module []byte) string {
+	sum := sha256.Sum256(module)
+	return hex.EncodeToString(sum[:])
+}
+
+// Load validates a transform's name, settings and module and builds its
+// adapter. Errors wrap ErrInvalidTransform.
+func (r *WASMRuntime) Load(ctx context.Context, name string, module, config []byte) (*WASMTransform, error) {
+	if !sourceName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must match %s", ErrInvalidTransform, sourceName)
+	}
+	var cfg WASMTransformConfig
+	if len(config) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(config))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTransform, err)
+		}
+	}
+	verifier, err := mappingVerifier(MappingConfig{TokenHeader: cfg.TokenHeader, Signature: cfg.Signature, ToleranceSeconds: cfg.ToleranceSeconds})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransform, err)
+	}
+	sum := ModuleSHA256(module)
+	m, err := r.compile(ctx, sum, module)
+	if err != nil {
+		return nil, err
+	}
+	return &WASMTransform{name: name, cfg: cfg, sum: sum, size: len(module), secretVerifier: secretVerifier{secret: []byte(cfg.Token), scheme: verifier}, rt: r, module: m}, nil
+}
+
+// Config returns the transform's settings.
+func (t *WASMTransform) Config() WASMTransformConfig { return t.cfg }
+
+// SHA256 is the hex SHA-256 of the module.
+func (t *WASMTransform) SHA256() string { return t.sum }
+
+// Size is the module size in bytes.
+func (t *WASMTransform) Size() int { return t.size }
+
+func (t *WASMTransform) Name() string { return "wasm/" + t.name }
+
+func (t *WASMTransform) Description() string {
+	return firstNonEmpty(t.cfg.Description, "WebAssembly transform "+t.name)
+}
+
+// Parse runs the module on the body.
+func (t *WASMTransform) Parse(_ http.Header, body []byte) (*Event, error) {
+	ev, _, err := t.Run(context.Background(), body)
+	return ev, err
+}
+
+// Run runs the module on body within the runtime's limits and also returns
+// what it wrote to stdout and stderr, for dry runs.
+func (t *WASMTransform) Run(ctx context.Context, body []byte) (*Event, string, error) {
+	if len(body) == 0 {
+		return nil, "", fmt.Errorf("%w: empty body", ErrMalformedPayload)
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.rt.limits.Timeout)
+	defer cancel()
+	logs := &limitedBuffer{max: maxWASMLogBytes}
+	out, err := t.call(ctx, body, logs)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("exceeded the %s time limit", t.rt.limits.Timeout)
+		}
+		return nil, logs.String(), fmt.Errorf("%w: %s: %v", ErrTransformFailed, t.name, err)
+	}
+	ev, err := t.event(out)
+	return ev, logs.String(), err
+}
+
+// call instantiates the module and runs transform, returning a copy of its
+// result.
+func (t *WASMTransform) call(ctx context.Context, body []byte, logs *limitedBuffer) ([]byte, error) {
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions().
+		WithStdout(logs).
+		WithStderr(logs)
+	mod, err := t.rt.rt.InstantiateModule(ctx, t.module, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer mod.Close(context.Background())
+	if init := mod.ExportedFunction("_initialize"); init != nil {
+		if _, err := init.Call(ctx); err != nil {
+			return nil, fmt.Errorf("_initialize: %w", err)
+		}
+	}
+	res, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(body)))
+	if err != nil {
+		return nil, fmt.Errorf("alloc: %w", err)
+	}
+	mem := mod.Memory()
+	if !mem.Write(uint32(res[0]), body) {
+		return nil, fmt.Errorf("alloc returned %#x, outside memory", uint32(res[0]))
+	}
+	if res, err = mod.ExportedFunction("transform").Call(ctx, res[0], uint64(len(body))); err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	ptr, size := uint32(res[0]>>32), uint32(res[0])
+	out, ok := mem.Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("transform returned %d bytes at %#x, outside memory", size, ptr)
+	}
+	return bytes.Clone(out), nil
+}
+
+// event validates a transform result and builds the event from it.
+func (t *WASMTransform) event(out []byte) (*Event, error) {
+	var res transformResult
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("%w: %s: result is not a transform result: %v", ErrTransformFailed, t.name, err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedPayload, res.Error)
+	}
+	if len(res.Deployments)+len(res.Incidents) == 0 {
+		return nil, fmt.Errorf("%w: transform returned no records", ErrUnsupportedEvent)
+	}
+	ev := &Event{Source: t.Name(), Type: res.EventType, DeliveryID: res.DeliveryID}
+	for i, rec := range res.Deployments {
+		v, err := resultValues("deployment", rec)
+		var d metrics.Deployment
+		if err == nil {
+			d, err = mappedDeployment(t.name, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: deployments[%d]: %v", ErrMalformedPayload, i, err)
+		}
+		ev.Deployments = append(ev.Deployments, d)
+	}
+	for i, rec := range res.Incidents {
+		v, err := resultValues("incident", rec)
+		var inc metrics.Incident
+		if err == nil {
+			inc, err = mappedIncident(t.name, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: incidents[%d]: %v", ErrMalformedPayload, i, err)
+		}
+		ev.Incidents = append(ev.Incidents, inc)
+	}
+	return ev, nil
+}
+
+// resultValues checks a result record's fields and renders its values as
+// text.
+func resultValues(kind string, rec map[string]interface{}) (map[string]string, error) {
+	fields := make([]string, 0, len(rec))
+	for f := range rec {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	v := make(map[string]string, len(rec))
+	for _, f := range fields {
+		if !containsString(mappingFields[kind].allowed, f) {
+			return nil, fmt.Errorf("unknown %s field %q", kind, f)
+		}
+		switch rec[f].(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("field %s must be a string, number or boolean", f)
+		}
+		v[f] = stringify(rec[f])
+	}
+	return v, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the
+// rest, so a chatty module cannot exhaust host memory.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,151 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+// transformModule is testdata/transform, built once for the package's tests.
+var transformModule []byte
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "wasm-transform")
+	if err != nil {
+		panic(err)
+	}
+	out := filepath.Join(dir, "transform.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, "./testdata/transform")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building wasm transform: %v\n%s", err, b)
+		os.Exit(1)
+	}
+	if transformModule, err = os.ReadFile(out); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newWASMRuntime(t *testing.T, limits WASMLimits) *WASMRuntime {
+	t.Helper()
+	rt, err := NewWASMRuntime(context.Background(), limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = rt.Close(context.Background()) })
+	return rt
+}
+
+func TestWASMTransform(t *testing.T) {
+	ctx := context.Background()
+	rt := newWASMRuntime(t, WASMLimits{})
+	tr, err := rt.Load(ctx, "ci", transformModule, []byte(`{"token": "t0ken", "signature": "hmac-sha256"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Name() != "wasm/ci" || tr.SHA256() != ModuleSHA256(transformModule) || tr.Size() != len(transformModule) {
+		t.Errorf("adapter = %s %s %d", tr.Name(), tr.SHA256(), tr.Size())
+	}
+
+	body := []byte(`{"event": "pipeline.finished", "pipeline": {"id": 42, "app": "api", "result": "passed"}}`)
+	h := http.Header{}
+	h.Set("X-Webhook-Signature", "sha256="+hexMAC("t0ken", string(body)))
+	if err := tr.Verify(h, body); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	ev, logs, err := tr.Run(ctx, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Source != "wasm/ci" || ev.Type != "pipeline.finished" || len(ev.Deployments) != 1 {
+		t.Fatalf("event = %+v", ev)
+	}
+	d := ev.Deployments[0]
+	if d.ID != "ci-42" || d.Service != "api" || d.Status != metrics.DeploymentStatusSuccess || d.Environment != "production" || d.EndTime == nil {
+		t.Errorf("deployment = %+v", d)
+	}
+	if !strings.Contains(logs, `transforming "pipeline.finished"`) {
+		t.Errorf("logs = %q", logs)
+	}
+
+	// Every call gets a fresh instance
+	ev, err = tr.Parse(nil, []byte(`{"event": "alert", "alert": {"id": "a1", "summary": "API down", "app": "api"}}`))
+	if err != nil || len(ev.Incidents) != 1 || ev.Incidents[0].ID != "ci-a1" || ev.Incidents[0].Severity != metrics.SeverityCritical {
+		t.Fatalf("Parse(alert) = %+v, %v", ev, err)
+	}
+	if _, err := tr.Parse(nil, []byte(`{"event": "ping"}`)); !errors.Is(err, ErrUnsupportedEvent) {
+		t.Errorf("Parse(ping) = %v", err)
+	}
+	if _, err := tr.Parse(nil, []byte(`{not json`)); !errors.Is(err, ErrMalformedPayload) {
+		t.Errorf("Parse(invalid) = %v", err)
+	}
+	if _, err := tr.Parse(nil, []byte(`{"pipeline": {"id": 1, "result": "passed"}}`)); !errors.Is(err, ErrMalformedPayload) || !strings.Contains(err.Error(), "deployments[0]") {
+		t.Errorf("Parse(no service) = %v", err)
+	}
+}
+
+func TestWASMTransformLimits(t *testing.T) {
+	ctx := context.Background()
+	rt := newWASMRuntime(t, WASMLimits{MemoryBytes: 32 << 20, Timeout: time.Second})
+	tr, err := rt.Load(ctx, "ci", transformModule, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{
+		"timeout": `{"loop": true}`,
+		"memory":  `{"grow_mb": 64}`,
+		"garbage": `{"garbage": true}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			began := time.Now()
+			_, _, err := tr.Run(ctx, []byte(body))
+			if !errors.Is(err, ErrTransformFailed) {
+				t.Errorf("Run = %v", err)
+			}
+			if d := time.Since(began); d > 5*time.Second {
+				t.Errorf("Run returned after %s", d)
+			}
+		})
+	}
+	// A failed call leaves the transform usable
+	if _, _, err := tr.Run(ctx, []byte(`{"pipeline": {"id": 1, "app": "api"}}`)); err != nil {
+		t.Errorf("Run after failures = %v", err)
+	}
+}
+
+func TestWASMTransformLoadErrors(t *testing.T) {
+	ctx := context.Background()
+	rt := newWASMRuntime(t, WASMLimits{})
+	// A module without the transform exports: (module (memory (export "memory") 1))
+	bare := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x05, 0x03, 0x01, 0x00, 0x01, 0x07, 0x0a, 0x01, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00}
+	for name, tc := range map[string]struct {
+		name, config string
+		module       []byte
+		want         string
+	}{
+		"name":      {"Bad Name", "", transformModule, "name must match"},
+		"not wasm":  {"ci", "", []byte("hello"), "invalid wasm transform"},
+		"exports":   {"ci", "", bare, `must export function`},
+		"config":    {"ci", `{"tokn": "x"}`, transformModule, "unknown field"},
+		"signature": {"ci", `{"signature": "md5"}`, transformModule, "signature must be"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := rt.Load(ctx, tc.name, tc.module, []byte(tc.config))
+			if !errors.Is(err, ErrInvalidTransform) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package webhooks turns provider webhook deliveries (GitHub, GitLab, ...)
+// into DORA records. Each provider is an Adapter that verifies and parses a
+// raw delivery; the Processor stores the resulting Event through the
+// storage repositories.
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirhCC/MetricHub/pkg/metrics"
+)
+
+var (
+	// ErrInvalidSignature means the delivery could not be authenticated.
+	ErrInvalidSignature = errors.New("webhooks: invalid signature")
+	// ErrUnsupportedEvent means the delivery is valid but carries nothing we record.
+	ErrUnsupportedEvent = errors.New("webhooks: unsupported event")
+	// ErrMalformedPayload means the body could not be decoded.
+	ErrMalformedPayload = errors.New("webhooks: malformed payload")
+)
+
+// Event is the normalized result of parsing one delivery.
+type Event struct {
+	Source      string
+	Type        string
+	DeliveryID  string
+	Deployments []metrics.Deployment
+	Incidents   []metrics.Incident
+	Commits     []metrics.Commit
+	TicketLinks []metrics.TicketLink
+}
+
+// Empty reports whether the event carries no records.
+func (e *Event) Empty() bool {
+	return len(e.Deployments) == 0 && len(e.Incidents) == 0 && len(e.Commits) == 0 && len(e.TicketLinks) == 0
+}
+
+// Adapter verifies and parses deliveries from one provider.
+type Adapter interface {
+	// Name is the path segment the adapter is served under (/webhook/:name).
+	Name() string
+	// Description is a human-readable summary for plugin listings.
+	Description() string
+	// Verifies reports whether a secret is configured; adapters without one
+	// accept every delivery.
+	Verifies() bool
+	// Verify authenticates the raw body with the configured secret; it
+	// returns ErrInvalidSignature on mismatch.
+	Verify(h http.Header, body []byte) error
+	// Verifier is the provider's signing scheme, used to check deliveries
+	// against secrets managed outside the adapter (see the API's secret
+	// rotation).
+	Verifier() Verifier
+	// Parse maps the delivery to records. Events the adapter does not handle
+	// return ErrUnsupportedEvent; undecodable bodies return ErrMalformedPayload.
+	Parse(h http.Header, body []byte) (*Event, error)
+}
+
+// Registry looks adapters up by name.
+type Registry struct{ adapters map[string]Adapter }
+
+// NewRegistry registers the given adapters; a later adapter with the same
+// name replaces an earlier one.
+func NewRegistry(adapters ...Adapter) *Registry {
+	r := &Registry{adapters: make(map[string]Adapter, len(adapters))}
+	for _, a := range adapters {
+		r.adapters[a.Name()] = a
+	}
+	return r
+}
+
+// Get returns the adapter registered under name.
+func (r *Registry) Get(name string) (Adapter, bool) {
+	a, ok := r.adapters[name]
+	return a, ok
+}
+
+// Names returns the registered adapter names in sorted order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.adapters))
+	for name := range r.adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unixMillis is a Unix timestamp in milliseconds, as Jenkins and Opsgenie
+// report them.
+type unixMillis int64
+
+func (m unixMillis) Time() time.Time {
+	if m <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(m)).UTC()
+}
+
+// IncidentRule decides which alerts count as incidents. An alert counts when
+// its name is listed in Names or its severity (label value, priority, ...)
+// is listed in Severities; an empty rule counts every alert.
+type IncidentRule struct {
+	Severities []string
+	Names      []string
+}
+
+// Matches applies the rule; comparisons ignore case.
+func (r IncidentRule) Matches(name, severity string) bool {
+	if len(r.Severities) == 0 && len(r.Names) == 0 {
+		return true
+	}
+	return containsFold(r.Names, name) || containsFold(r.Severities, severity)
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if s != "" && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedToken returns the token sent in header, or else as an
+// "Authorization: Bearer" credential.
+func sharedToken(h http.Header, header string) string {
+	if v := h.Get(header); v != "" {
+		return v
+	}
+	if bearer, ok := strings.CutPrefix(h.Get("Authorization"), "Bearer "); ok {
+		return bearer
+	}
+	return ""
+}
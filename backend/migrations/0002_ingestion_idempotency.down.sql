@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uq_deployments_natural_key;
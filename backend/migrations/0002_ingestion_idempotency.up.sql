@@ -0,0 +1,5 @@
+-- Natural key for deployment upserts. Rows ingested without repository or
+-- commit_sha (legacy POST /deployments) are excluded so they never collide.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_deployments_natural_key
+  ON deployments(repository, commit_sha, environment)
+  WHERE repository <> '' AND commit_sha <> '';
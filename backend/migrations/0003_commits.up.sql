@@ -0,0 +1,12 @@
+-- Commit timestamps recorded from webhooks and collectors, used to derive
+-- deployment lead time from the commit rather than the deployment start.
+CREATE TABLE IF NOT EXISTS commits (
+  repository TEXT NOT NULL,
+  sha TEXT NOT NULL,
+  author TEXT,
+  message TEXT,
+  authored_at TIMESTAMPTZ NOT NULL,
+  committed_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (repository, sha)
+);
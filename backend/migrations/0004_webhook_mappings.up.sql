@@ -0,0 +1,8 @@
+-- Admin-registered mappings for the generic webhook adapter, one per source.
+-- The config is validated by the API before it is stored.
+CREATE TABLE IF NOT EXISTS webhook_mappings (
+  source TEXT PRIMARY KEY,
+  config JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
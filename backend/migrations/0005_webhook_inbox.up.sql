@@ -0,0 +1,23 @@
+-- Durable webhook inbox: every verified delivery is stored raw before it is
+-- processed by the inbox workers. Rows that keep failing end up 'dead' and
+-- can be replayed through the admin API.
+CREATE TABLE IF NOT EXISTS webhook_inbox (
+  id BIGSERIAL PRIMARY KEY,
+  source TEXT NOT NULL,
+  delivery_key TEXT NOT NULL,
+  headers JSONB NOT NULL DEFAULT '{}',
+  body BYTEA NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  locked_until TIMESTAMPTZ,
+  last_error TEXT,
+  result JSONB,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  processed_at TIMESTAMPTZ,
+  CONSTRAINT uq_webhook_inbox_delivery UNIQUE (source, delivery_key)
+);
+
+-- Workers poll for due work; admins list by status.
+CREATE INDEX IF NOT EXISTS idx_webhook_inbox_due ON webhook_inbox(next_attempt_at) WHERE status IN ('pending', 'processing');
+CREATE INDEX IF NOT EXISTS idx_webhook_inbox_status ON webhook_inbox(status, id);
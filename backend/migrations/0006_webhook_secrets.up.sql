@@ -0,0 +1,12 @@
+-- Webhook signing secrets managed through the admin API, per plugin. At most
+-- two are active at once: rotating adds a secret and gives the previous one
+-- a grace period, so senders can switch over without rejected deliveries.
+CREATE TABLE IF NOT EXISTS webhook_secrets (
+  id BIGSERIAL PRIMARY KEY,
+  plugin TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_secrets_plugin ON webhook_secrets(plugin, created_at DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS plugin_runs;
+DROP TABLE IF EXISTS plugin_checkpoints;
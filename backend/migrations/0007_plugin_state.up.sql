@@ -0,0 +1,18 @@
+-- Collector plugin state: the cursor each plugin resumes from after a
+-- restart, and a bounded history of collection cycles for plugin health.
+CREATE TABLE IF NOT EXISTS plugin_checkpoints (
+  plugin TEXT PRIMARY KEY,
+  cursor TEXT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS plugin_runs (
+  id BIGSERIAL PRIMARY KEY,
+  plugin TEXT NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL,
+  duration_ms BIGINT NOT NULL,
+  items INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_plugin_runs_plugin ON plugin_runs(plugin, id DESC);
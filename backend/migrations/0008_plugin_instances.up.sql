@@ -0,0 +1,19 @@
+-- Collector plugin instances configured through the admin API. Config never
+-- holds credentials: secret_ref names where the secret is read from
+-- (env:NAME or file:PATH). Sync status and health counters are updated after
+-- every collection cycle.
+CREATE TABLE IF NOT EXISTS plugin_instances (
+  name TEXT PRIMARY KEY,
+  type TEXT NOT NULL,
+  config JSONB NOT NULL DEFAULT '{}',
+  secret_ref TEXT NOT NULL DEFAULT '',
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  interval_seconds INTEGER NOT NULL DEFAULT 0,
+  last_sync_at TIMESTAMPTZ,
+  last_error TEXT NOT NULL DEFAULT '',
+  success_count BIGINT NOT NULL DEFAULT 0,
+  failure_count BIGINT NOT NULL DEFAULT 0,
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+-- WebAssembly webhook transforms uploaded through the admin API, one per
+-- name. The module is validated (compiled and checked for the transform ABI)
+-- before it is stored; config holds the signature settings.
+CREATE TABLE IF NOT EXISTS wasm_transforms (
+  name TEXT PRIMARY KEY,
+  module BYTEA NOT NULL,
+  sha256 TEXT NOT NULL,
+  config JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
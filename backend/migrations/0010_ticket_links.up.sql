@@ -0,0 +1,13 @@
+-- Issue tracker tickets shipped by deployments (from their commits) and
+-- referred to by incidents. An incident is linked to the deployments that
+-- share a ticket with it; each row names one of the two.
+CREATE TABLE IF NOT EXISTS ticket_links (
+  ticket TEXT NOT NULL,
+  deployment_id TEXT NOT NULL DEFAULT '',
+  incident_id TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (ticket, deployment_id, incident_id),
+  CHECK ((deployment_id = '') <> (incident_id = ''))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_links_incident ON ticket_links (incident_id) WHERE incident_id <> '';
@@ -18,6 +18,25 @@ const (
 	DeploymentStatusCancelled DeploymentStatus = "cancelled"
 )
 
+// DeploymentStatuses lists every known deployment status
+var DeploymentStatuses = []DeploymentStatus{
+	DeploymentStatusPending,
+	DeploymentStatusRunning,
+	DeploymentStatusSuccess,
+	DeploymentStatusFailed,
+	DeploymentStatusCancelled,
+}
+
+// Valid reports whether s is one of the known deployment statuses
+func (s DeploymentStatus) Valid() bool {
+	for _, known := range DeploymentStatuses {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
 // IncidentSeverity represents the severity of an incident
 type IncidentSeverity string
 
@@ -28,6 +47,24 @@ const (
 	SeverityCritical IncidentSeverity = "critical"
 )
 
+// IncidentSeverities lists every known incident severity, lowest first
+var IncidentSeverities = []IncidentSeverity{
+	SeverityLow,
+	SeverityMedium,
+	SeverityHigh,
+	SeverityCritical,
+}
+
+// Valid reports whether s is one of the known incident severities
+func (s IncidentSeverity) Valid() bool {
+	for _, known := range IncidentSeverities {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
 // Deployment represents a deployment event in the system
 type Deployment struct {
 	ID          string            `json:"id"`
@@ -74,6 +111,31 @@ func (d *Deployment) IsFailed() bool {
 	return d.Status == DeploymentStatusFailed
 }
 
+// IsTerminal reports whether the status is final (success, failed or cancelled)
+func (s DeploymentStatus) IsTerminal() bool {
+	return s == DeploymentStatusSuccess || s == DeploymentStatusFailed || s == DeploymentStatusCancelled
+}
+
+// Commit records when a change was authored and committed; deployments use it
+// to derive lead time from the commit rather than from the deployment start
+type Commit struct {
+	Repository  string    `json:"repository"`
+	SHA         string    `json:"sha"`
+	Author      string    `json:"author"`
+	Message     string    `json:"message,omitempty"`
+	AuthoredAt  time.Time `json:"authored_at"`
+	CommittedAt time.Time `json:"committed_at"`
+}
+
+// TicketLink ties an issue tracker ticket, such as SHOP-123, to a deployment
+// that shipped it or an incident that refers to it; exactly one of the two
+// IDs is set. Deployments and incidents sharing a ticket are linked
+type TicketLink struct {
+	Ticket       string `json:"ticket"`
+	DeploymentID string `json:"deployment_id,omitempty"`
+	IncidentID   string `json:"incident_id,omitempty"`
+}
+
 // Incident represents an incident/outage in the system
 type Incident struct {
 	ID           string            `json:"id"`